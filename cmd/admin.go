@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// adminCmd groups maintenance jobs that operate on the whole data directory
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Run maintenance jobs on the data directory",
+}
+
+func init() {
+	rootCmd.AddCommand(adminCmd)
+}
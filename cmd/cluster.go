@@ -0,0 +1,359 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/iamthiago/mini-s3/internal/client"
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	clusterEndpoint string
+	writeQuorum     int
+	readQuorum      int
+)
+
+// clusterCmd represents the cluster command
+var clusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "Manage a cluster of mini-s3 nodes",
+	Long: `Manage a cluster of mini-s3 nodes, see "mini-s3 serve --node-id".
+
+Commands are sent to the node at --endpoint, which forwards membership
+changes to the leader. Members are added and removed one at a time. A
+node started without --peers joins the cluster of any node with "cluster
+join", sent to the joining node. "cluster members" shows the nodes the
+gossip knows of: whether they are alive, suspected or dead, and the zone
+and capacity they were started with.
+"cluster ring" shows how object data is spread over the nodes, and
+which nodes keep an object when given one. "cluster hints" shows the
+writes a node keeps for nodes that missed them while away. When nodes
+join or leave, the leader moves object data onto the nodes the ring
+places it on, at most at the rate it was started with, and "cluster
+rebalance status" shows how far it got. "cluster quorum" sets how many replicas of a bucket's objects writes and reads
+wait for: by default a majority of them for writes, and one for reads.
+
+Example usage:
+  mini-s3 cluster status --endpoint http://127.0.0.1:9001
+  mini-s3 cluster ring
+  mini-s3 cluster ring <bucket-name> <object-name>
+  mini-s3 cluster hints --endpoint http://127.0.0.1:9002
+  mini-s3 cluster rebalance status
+  mini-s3 cluster quorum put <bucket-name> --write 3 --read 2
+  mini-s3 cluster quorum get <bucket-name>
+  mini-s3 cluster quorum delete <bucket-name>
+  mini-s3 cluster join http://127.0.0.1:9001 --endpoint http://127.0.0.1:9004
+  mini-s3 cluster members
+  mini-s3 cluster add n4 http://127.0.0.1:9004
+  mini-s3 cluster remove n4`,
+}
+
+var clusterStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show how a node sees its cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := client.New(clusterEndpoint).ClusterStatus()
+		if err != nil {
+			fmt.Printf("Failed to get cluster status: %v\n", err)
+			return
+		}
+
+		leader := status.Leader
+		if leader == "" {
+			leader = "(none)"
+		}
+		fmt.Printf("%-20s %s\n", "Node:", status.ID)
+		fmt.Printf("%-20s %s\n", "State:", status.State)
+		fmt.Printf("%-20s %d\n", "Term:", status.Term)
+		fmt.Printf("%-20s %s\n", "Leader:", leader)
+		fmt.Printf("%-20s %d\n", "Commit index:", status.CommitIndex)
+		fmt.Printf("%-20s %d\n", "Applied index:", status.AppliedIndex)
+		fmt.Printf("%-20s %d\n", "Snapshot index:", status.SnapshotIndex)
+		fmt.Println("Members:")
+		ids := make([]string, 0, len(status.Members))
+		for id := range status.Members {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			fmt.Printf("  %-18s %s\n", id, status.Members[id])
+		}
+	},
+}
+
+var clusterRingCmd = &cobra.Command{
+	Use:   "ring",
+	Short: "Show which nodes keep object data",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 1 {
+			fmt.Println("Usage: mini-s3 cluster ring [<bucket-name> <object-name>]")
+			return
+		}
+		var bucket, object string
+		if len(args) == 2 {
+			bucket, object = args[0], args[1]
+		}
+
+		status, err := client.New(clusterEndpoint).ClusterRing(bucket, object)
+		if err != nil {
+			fmt.Printf("Failed to get the ring: %v\n", err)
+			return
+		}
+
+		if status.Key != "" {
+			fmt.Printf("%s is kept by %s\n", status.Key, strings.Join(status.Replicas, ", "))
+			return
+		}
+		fmt.Printf("%-20s %d\n", "Replication factor:", status.ReplicationFactor)
+		fmt.Printf("%-20s %d\n", "Virtual nodes:", status.VirtualNodes)
+		fmt.Printf("\n%-20s %-10s %-10s %s\n", "NODE", "TOKENS", "PRIMARY", "REPLICA")
+		for _, owner := range status.Owners {
+			fmt.Printf("%-20s %-10d %-10s %s\n", owner.Node, owner.Tokens,
+				fmt.Sprintf("%.1f%%", owner.Primary*100), fmt.Sprintf("%.1f%%", owner.Replica*100))
+		}
+	},
+}
+
+var clusterHintsCmd = &cobra.Command{
+	Use:   "hints",
+	Short: "Show the writes a node keeps for nodes that missed them",
+	Run: func(cmd *cobra.Command, args []string) {
+		stats, err := client.New(clusterEndpoint).ClusterHints()
+		if err != nil {
+			fmt.Printf("Failed to get hints: %v\n", err)
+			return
+		}
+
+		oldest := "-"
+		if !stats.Oldest.IsZero() {
+			oldest = stats.Oldest.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-20s %d (%s)\n", "Pending:", stats.Pending, formatSize(stats.Bytes))
+		fmt.Printf("%-20s %s\n", "Oldest:", oldest)
+		fmt.Printf("%-20s %s\n", "Kept for:", stats.TTL)
+		fmt.Printf("%-20s %d\n", "Handed off:", stats.Replayed)
+		fmt.Printf("%-20s %d\n", "Expired:", stats.Expired)
+		fmt.Printf("%-20s %d\n", "Obsolete:", stats.Dropped)
+		if len(stats.Nodes) == 0 {
+			return
+		}
+		fmt.Println("Pending by node:")
+		ids := make([]string, 0, len(stats.Nodes))
+		for id := range stats.Nodes {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			fmt.Printf("  %-18s %d\n", id, stats.Nodes[id])
+		}
+	},
+}
+
+var clusterRebalanceCmd = &cobra.Command{
+	Use:   "rebalance",
+	Short: "Follow the moving of object data onto the nodes the ring places it on",
+}
+
+var clusterRebalanceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the progress of rebalancing",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := client.New(clusterEndpoint).ClusterRebalance()
+		if err != nil {
+			fmt.Printf("Failed to get the rebalance status: %v\n", err)
+			return
+		}
+
+		state := "idle"
+		if status.Running {
+			state = "running"
+		}
+		checked := "-"
+		if !status.Checked.IsZero() {
+			checked = status.Checked.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-20s %s\n", "Node:", status.Node)
+		fmt.Printf("%-20s %s\n", "State:", state)
+		fmt.Printf("%-20s %s\n", "Last checked:", checked)
+		fmt.Printf("%-20s %s/s\n", "Rate limit:", formatSize(status.Rate))
+		if status.Started.IsZero() {
+			fmt.Println("No object had to move yet")
+			return
+		}
+		progress := 100.0
+		if status.Keys > 0 {
+			progress = float64(status.Moved+status.Skipped+status.Failed) / float64(status.Keys) * 100
+		}
+		fmt.Printf("%-20s %s\n", "Started:", status.Started.Format("2006-01-02 15:04:05"))
+		if !status.Running {
+			fmt.Printf("%-20s %s\n", "Finished:", status.Finished.Format("2006-01-02 15:04:05"))
+		}
+		fmt.Printf("%-20s %d of %d objects (%.1f%%)\n", "Progress:", status.Moved+status.Skipped+status.Failed, status.Keys, progress)
+		fmt.Printf("%-20s %s of %s\n", "Data moved:", formatSize(status.MovedBytes), formatSize(status.Bytes))
+		fmt.Printf("%-20s %d\n", "Moved:", status.Moved)
+		fmt.Printf("%-20s %d\n", "Skipped:", status.Skipped)
+		fmt.Printf("%-20s %d\n", "Failed:", status.Failed)
+	},
+}
+
+var clusterQuorumCmd = &cobra.Command{
+	Use:   "quorum",
+	Short: "Manage how many replicas writes and reads of a bucket wait for",
+}
+
+var clusterQuorumPutCmd = &cobra.Command{
+	Use:   "put",
+	Short: "Set the write and read quorums of a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 cluster quorum put <bucket-name> [--write <n>] [--read <n>]")
+			return
+		}
+
+		q := &storage.QuorumConfiguration{Write: writeQuorum, Read: readQuorum}
+		if err := client.New(clusterEndpoint).PutBucketQuorum(args[0], q); err != nil {
+			fmt.Printf("Failed to set quorums: %v\n", err)
+			return
+		}
+		fmt.Printf("Set the quorums of bucket %s: %s\n", args[0], formatQuorum(q))
+	},
+}
+
+var clusterQuorumGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Show the write and read quorums of a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 cluster quorum get <bucket-name>")
+			return
+		}
+
+		q, err := client.New(clusterEndpoint).GetBucketQuorum(args[0])
+		if err != nil {
+			fmt.Printf("Failed to get quorums: %v\n", err)
+			return
+		}
+		if q == nil {
+			fmt.Printf("Bucket %s uses the default quorums\n", args[0])
+			return
+		}
+		fmt.Printf("Bucket %s: %s\n", args[0], formatQuorum(q))
+	},
+}
+
+var clusterQuorumDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Make a bucket use the default quorums again",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 cluster quorum delete <bucket-name>")
+			return
+		}
+
+		if err := client.New(clusterEndpoint).DeleteBucketQuorum(args[0]); err != nil {
+			fmt.Printf("Failed to delete quorums: %v\n", err)
+			return
+		}
+		fmt.Printf("Bucket %s uses the default quorums again\n", args[0])
+	},
+}
+
+// formatQuorum describes quorums, zero ones being the defaults.
+func formatQuorum(q *storage.QuorumConfiguration) string {
+	write, read := "default", "default"
+	if q.Write > 0 {
+		write = fmt.Sprint(q.Write)
+	}
+	if q.Read > 0 {
+		read = fmt.Sprint(q.Read)
+	}
+	return fmt.Sprintf("write %s, read %s", write, read)
+}
+
+var clusterMembersCmd = &cobra.Command{
+	Use:   "members",
+	Short: "Show the nodes of the cluster and whether they are alive",
+	Run: func(cmd *cobra.Command, args []string) {
+		members, err := client.New(clusterEndpoint).ClusterMembers()
+		if err != nil {
+			fmt.Printf("Failed to get members: %v\n", err)
+			return
+		}
+
+		fmt.Printf("%-20s %-30s %-10s %-12s %s\n", "NODE", "ADDRESS", "STATE", "ZONE", "CAPACITY")
+		for _, m := range members {
+			zone, capacity := m.Zone, "-"
+			if zone == "" {
+				zone = "-"
+			}
+			if m.Capacity > 0 {
+				capacity = formatSize(m.Capacity)
+			}
+			fmt.Printf("%-20s %-30s %-10s %-12s %s\n", m.ID, m.Addr, m.State, zone, capacity)
+		}
+	},
+}
+
+var clusterJoinCmd = &cobra.Command{
+	Use:   "join",
+	Short: "Make a node join the cluster of another",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 cluster join <url> --endpoint <url-of-the-joining-node>")
+			return
+		}
+
+		if err := client.New(clusterEndpoint).JoinCluster(args[0]); err != nil {
+			fmt.Printf("Failed to join: %v\n", err)
+			return
+		}
+		fmt.Printf("Node at %s joined the cluster of %s\n", clusterEndpoint, args[0])
+	},
+}
+
+var clusterAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a node to the cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 cluster add <node-id> <url>")
+			return
+		}
+
+		if err := client.New(clusterEndpoint).AddClusterMember(args[0], args[1]); err != nil {
+			fmt.Printf("Failed to add node: %v\n", err)
+			return
+		}
+		fmt.Printf("Node %s added to the cluster\n", args[0])
+	},
+}
+
+var clusterRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove a node from the cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 cluster remove <node-id>")
+			return
+		}
+
+		if err := client.New(clusterEndpoint).RemoveClusterMember(args[0]); err != nil {
+			fmt.Printf("Failed to remove node: %v\n", err)
+			return
+		}
+		fmt.Printf("Node %s removed from the cluster\n", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(clusterCmd)
+	clusterCmd.PersistentFlags().StringVar(&clusterEndpoint, "endpoint", "http://localhost:9000", "URL of a node of the cluster")
+	clusterCmd.AddCommand(clusterStatusCmd, clusterRingCmd, clusterHintsCmd, clusterRebalanceCmd, clusterQuorumCmd, clusterMembersCmd, clusterJoinCmd, clusterAddCmd, clusterRemoveCmd)
+	clusterRebalanceCmd.AddCommand(clusterRebalanceStatusCmd)
+	clusterQuorumCmd.AddCommand(clusterQuorumPutCmd, clusterQuorumGetCmd, clusterQuorumDeleteCmd)
+	clusterQuorumPutCmd.Flags().IntVar(&writeQuorum, "write", 0, "replicas a write waits for (default: a majority)")
+	clusterQuorumPutCmd.Flags().IntVar(&readQuorum, "read", 0, "replicas a read checks (default: 1)")
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/cluster"
+	"github.com/iamthiago/mini-s3/internal/server"
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// startClusterNode serves a cluster node on httptest the way serve does.
+func startClusterNode(t *testing.T, ctx context.Context, id string, peers func(url string) map[string]string) (*cluster.Node, string) {
+	t.Helper()
+	var handler atomic.Pointer[http.Handler]
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := handler.Load(); h != nil {
+			(*h).ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	tmpDir := t.TempDir()
+	node, err := cluster.New(cluster.Config{
+		ID:                id,
+		Addr:              srv.URL,
+		Peers:             peers(srv.URL),
+		Dir:               storage.DefaultRaftDir(tmpDir),
+		Local:             storage.NewLocalStorage(tmpDir, storage.NewValueChecksum()),
+		ElectionTimeout:   150 * time.Millisecond,
+		HeartbeatInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(cluster.PathPrefix+"/", node.Handler())
+	mux.Handle("/", server.New(node))
+	var h http.Handler = mux
+	handler.Store(&h)
+	go node.Run(ctx)
+	return node, srv.URL
+}
+
+func TestClusterCommands(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	node, endpoint := startClusterNode(t, ctx, "n1", func(url string) map[string]string {
+		return map[string]string{"n1": url}
+	})
+	// n2 joins the cluster, so it starts without peers
+	_, joining := startClusterNode(t, ctx, "n2", func(string) map[string]string { return nil })
+	_, joiner := startClusterNode(t, ctx, "n3", func(string) map[string]string { return nil })
+
+	oldEndpoint := clusterEndpoint
+	clusterEndpoint = endpoint
+	defer func() { clusterEndpoint = oldEndpoint }()
+
+	tests := []struct {
+		name           string
+		run            func()
+		expectedOutput string
+	}{
+		{
+			name: "status",
+			run: func() {
+				deadline := time.Now().Add(10 * time.Second)
+				for node.Status().Leader == "" && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+				}
+				clusterStatusCmd.Run(clusterStatusCmd, []string{})
+			},
+			expectedOutput: "Leader:              n1",
+		},
+		{
+			name:           "ring",
+			run:            func() { clusterRingCmd.Run(clusterRingCmd, []string{}) },
+			expectedOutput: "n1                   128        100.0%     100.0%",
+		},
+		{
+			name:           "ring placement of an object",
+			run:            func() { clusterRingCmd.Run(clusterRingCmd, []string{"docs", "a.txt"}) },
+			expectedOutput: "docs/a.txt is kept by n1",
+		},
+		{
+			name:           "ring with a bucket only",
+			run:            func() { clusterRingCmd.Run(clusterRingCmd, []string{"docs"}) },
+			expectedOutput: "Usage: mini-s3 cluster ring [<bucket-name> <object-name>]",
+		},
+		{
+			name:           "hints",
+			run:            func() { clusterHintsCmd.Run(clusterHintsCmd, []string{}) },
+			expectedOutput: "Pending:             0 (0 B)",
+		},
+		{
+			name:           "rebalance status before any object moved",
+			run:            func() { clusterRebalanceStatusCmd.Run(clusterRebalanceStatusCmd, []string{}) },
+			expectedOutput: "No object had to move yet",
+		},
+		{
+			name:           "quorum get without quorums",
+			run:            func() { clusterQuorumGetCmd.Run(clusterQuorumGetCmd, []string{"docs"}) },
+			expectedOutput: "Bucket docs uses the default quorums",
+		},
+		{
+			name: "quorum put",
+			run: func() {
+				writeQuorum, readQuorum = 2, 0
+				defer func() { writeQuorum, readQuorum = 0, 0 }()
+				clusterQuorumPutCmd.Run(clusterQuorumPutCmd, []string{"docs"})
+			},
+			expectedOutput: "Set the quorums of bucket docs: write 2, read default",
+		},
+		{
+			name:           "quorum get",
+			run:            func() { clusterQuorumGetCmd.Run(clusterQuorumGetCmd, []string{"docs"}) },
+			expectedOutput: "Bucket docs: write 2, read default",
+		},
+		{
+			name: "quorum put rejects more replicas than objects have",
+			run: func() {
+				readQuorum = 4
+				defer func() { readQuorum = 0 }()
+				clusterQuorumPutCmd.Run(clusterQuorumPutCmd, []string{"docs"})
+			},
+			expectedOutput: "Failed to set quorums: InvalidArgument: read quorum must be between 1 and the 3 replicas of each object, got 4",
+		},
+		{
+			name:           "quorum delete",
+			run:            func() { clusterQuorumDeleteCmd.Run(clusterQuorumDeleteCmd, []string{"docs"}) },
+			expectedOutput: "Bucket docs uses the default quorums again",
+		},
+		{
+			name:           "add a node",
+			run:            func() { clusterAddCmd.Run(clusterAddCmd, []string{"n2", joining}) },
+			expectedOutput: "Node n2 added to the cluster",
+		},
+		{
+			name:           "status lists the members",
+			run:            func() { clusterStatusCmd.Run(clusterStatusCmd, []string{}) },
+			expectedOutput: "  n2                 " + joining,
+		},
+		{
+			name:           "rejects an invalid address",
+			run:            func() { clusterAddCmd.Run(clusterAddCmd, []string{"n3", "n3:9000"}) },
+			expectedOutput: "Failed to add node:",
+		},
+		{
+			name:           "remove a node",
+			run:            func() { clusterRemoveCmd.Run(clusterRemoveCmd, []string{"n2"}) },
+			expectedOutput: "Node n2 removed from the cluster",
+		},
+		{
+			name:           "members",
+			run:            func() { clusterMembersCmd.Run(clusterMembersCmd, []string{}) },
+			expectedOutput: "n1                   " + endpoint,
+		},
+		{
+			name: "join through a member",
+			run: func() {
+				clusterEndpoint = joiner
+				defer func() { clusterEndpoint = endpoint }()
+				clusterJoinCmd.Run(clusterJoinCmd, []string{endpoint})
+			},
+			expectedOutput: "Node at " + joiner + " joined the cluster of " + endpoint,
+		},
+		{
+			name:           "members lists the node that joined",
+			run:            func() { clusterMembersCmd.Run(clusterMembersCmd, []string{}) },
+			expectedOutput: "n3                   " + joiner,
+		},
+		{
+			name:           "join without an address",
+			run:            func() { clusterJoinCmd.Run(clusterJoinCmd, []string{}) },
+			expectedOutput: "Usage: mini-s3 cluster join <url>",
+		},
+		{
+			name:           "missing arguments",
+			run:            func() { clusterAddCmd.Run(clusterAddCmd, []string{"n2"}) },
+			expectedOutput: "Usage: mini-s3 cluster add <node-id> <url>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			tt.run()
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			if !strings.Contains(output, tt.expectedOutput) {
+				t.Errorf("expected output to contain '%s', got '%s'", tt.expectedOutput, output)
+			}
+		})
+	}
+}
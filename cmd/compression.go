@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type bucketCompressor interface {
+	PutBucketCompression(bucket string, cfg *storage.CompressionConfig) error
+	GetBucketCompression(bucket string) (*storage.CompressionConfig, error)
+	DeleteBucketCompression(bucket string) error
+}
+
+// compressionCmd represents the compression command
+var compressionCmd = &cobra.Command{
+	Use:   "compression",
+	Short: "Manage transparent compression of a bucket",
+	Long: `Manage transparent compression of a bucket.
+
+Objects saved to a bucket with compression enabled are stored compressed,
+unless their content is already compressed (images, archives, ...).
+Reads always return the original bytes.
+
+Example usage:
+  mini-s3 compression put <bucket-name> <zstd|gzip|snappy>
+  mini-s3 compression get <bucket-name>
+  mini-s3 compression delete <bucket-name>`,
+}
+
+var compressionPutCmd = &cobra.Command{
+	Use:   "put",
+	Short: "Enable compression for new objects in a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 compression put <bucket-name> <zstd|gzip|snappy>")
+			return
+		}
+
+		compressor, ok := storageInstance.(bucketCompressor)
+		if !ok {
+			fmt.Println("Compression is not supported by this storage backend")
+			return
+		}
+
+		err := compressor.PutBucketCompression(args[0], &storage.CompressionConfig{Algorithm: args[1]})
+		if err != nil {
+			fmt.Printf("Failed to enable compression: %v\n", err)
+			return
+		}
+		fmt.Printf("Objects saved to bucket %s are now compressed with %s\n", args[0], args[1])
+	},
+}
+
+var compressionGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Show the compression settings of a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 compression get <bucket-name>")
+			return
+		}
+
+		compressor, ok := storageInstance.(bucketCompressor)
+		if !ok {
+			fmt.Println("Compression is not supported by this storage backend")
+			return
+		}
+
+		cfg, err := compressor.GetBucketCompression(args[0])
+		if err != nil {
+			fmt.Printf("Failed to get compression settings: %v\n", err)
+			return
+		}
+		if cfg == nil {
+			fmt.Printf("Compression is disabled for bucket %s\n", args[0])
+			return
+		}
+		fmt.Printf("Bucket %s is compressed with %s\n", args[0], cfg.Algorithm)
+	},
+}
+
+var compressionDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Disable compression for new objects in a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 compression delete <bucket-name>")
+			return
+		}
+
+		compressor, ok := storageInstance.(bucketCompressor)
+		if !ok {
+			fmt.Println("Compression is not supported by this storage backend")
+			return
+		}
+
+		if err := compressor.DeleteBucketCompression(args[0]); err != nil {
+			fmt.Printf("Failed to disable compression: %v\n", err)
+			return
+		}
+		fmt.Printf("Compression disabled for bucket %s\n", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(compressionCmd)
+	compressionCmd.AddCommand(compressionPutCmd, compressionGetCmd, compressionDeleteCmd)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// addConditionFlags adds the flags making a command conditional on the
+// object's ETag and, for commands that read, on its modification time.
+func addConditionFlags(cmd *cobra.Command, read bool) {
+	if read {
+		cmd.Flags().String("if-match", "", "only read the object if its ETag is one of these (comma-separated, or *)")
+		cmd.Flags().String("if-none-match", "", "only read the object if its ETag is none of these (comma-separated, or *)")
+		cmd.Flags().String("if-modified-since", "", "only read the object if it changed after this date (RFC 3339)")
+		cmd.Flags().String("if-unmodified-since", "", "only read the object if it did not change after this date (RFC 3339)")
+		return
+	}
+	cmd.Flags().String("if-match", "", "only replace the object if its ETag is still this one")
+	cmd.Flags().String("if-none-match", "", "use * to only create the object if it does not exist")
+}
+
+// conditionOptions turns the flags added by addConditionFlags into storage
+// options.
+func conditionOptions(cmd *cobra.Command) ([]storage.Option, error) {
+	var c storage.Conditions
+	c.IfMatch, _ = cmd.Flags().GetString("if-match")
+	c.IfNoneMatch, _ = cmd.Flags().GetString("if-none-match")
+	for flag, t := range map[string]*time.Time{
+		"if-modified-since":   &c.IfModifiedSince,
+		"if-unmodified-since": &c.IfUnmodifiedSince,
+	} {
+		if cmd.Flags().Lookup(flag) == nil {
+			continue
+		}
+		value, _ := cmd.Flags().GetString(flag)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("--%s: %w", flag, err)
+		}
+		*t = parsed
+	}
+	if c == (storage.Conditions{}) {
+		return nil, nil
+	}
+	return []storage.Option{storage.WithConditions(c)}, nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// cpCmd represents the cp command
+var cpCmd = &cobra.Command{
+	Use:   "cp",
+	Short: "Copy an object within or between buckets",
+	Long: `Copy an object within or between buckets without reading it back.
+
+The copy keeps the metadata and tags of the source unless
+--metadata-directive REPLACE is given, in which case they are taken from
+the flags instead. Copying an object onto itself needs REPLACE or a new
+--storage-class.
+
+Example usage:
+  mini-s3 cp s3://<bucket-name>/<object-name> s3://<bucket-name>/<object-name>
+  mini-s3 cp s3://logs/app.log s3://archive/app.log --storage-class ARCHIVE
+  mini-s3 cp s3://data/report.csv s3://data/report.csv --metadata-directive REPLACE --meta owner=finance`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 cp s3://<bucket-name>/<object-name> s3://<bucket-name>/<object-name>")
+			return
+		}
+
+		srcBucket, srcObject, err := parseS3URI(args[0])
+		if err != nil {
+			fmt.Printf("Invalid source: %v\n", err)
+			return
+		}
+		dstBucket, dstObject, err := parseS3URI(args[1])
+		if err != nil {
+			fmt.Printf("Invalid destination: %v\n", err)
+			return
+		}
+
+		opts, err := sseCustomerKeyOptions(cmd)
+		if err != nil {
+			fmt.Printf("Invalid SSE-C key: %v\n", err)
+			return
+		}
+		if value, _ := cmd.Flags().GetString("copy-source-sse-c-key"); value != "" {
+			key, err := parseSSECustomerKey(value)
+			if err != nil {
+				fmt.Printf("Invalid source SSE-C key: %v\n", err)
+				return
+			}
+			opts = append(opts, storage.WithCopySourceSSECustomerKey(key))
+		}
+
+		if directive, _ := cmd.Flags().GetString("metadata-directive"); directive != "" {
+			opts = append(opts, storage.WithMetadataDirective(strings.ToUpper(directive)))
+		}
+		if class, _ := cmd.Flags().GetString("storage-class"); class != "" {
+			opts = append(opts, storage.WithStorageClass(class))
+		}
+		if values, _ := cmd.Flags().GetStringArray("tag"); len(values) > 0 {
+			tags, err := parseKeyValues(values)
+			if err != nil {
+				fmt.Printf("Invalid tags: %v\n", err)
+				return
+			}
+			opts = append(opts, storage.WithTags(tags))
+		}
+		if contentType, _ := cmd.Flags().GetString("content-type"); contentType != "" {
+			opts = append(opts, storage.WithContentType(contentType))
+		}
+		if values, _ := cmd.Flags().GetStringArray("meta"); len(values) > 0 {
+			metadata, err := parseKeyValues(values)
+			if err != nil {
+				fmt.Printf("Invalid metadata: %v\n", err)
+				return
+			}
+			opts = append(opts, storage.WithUserMetadata(metadata))
+		}
+
+		if _, err := storageInstance.CopyObject(srcBucket, srcObject, dstBucket, dstObject, opts...); err != nil {
+			fmt.Printf("Failed to copy object: %v\n", err)
+			return
+		}
+		fmt.Printf("Copied %s to %s\n", args[0], args[1])
+	},
+}
+
+// parseS3URI splits an s3://bucket/key URI into its bucket and key.
+func parseS3URI(uri string) (string, string, error) {
+	rest, ok := strings.CutPrefix(uri, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("%q does not start with s3://", uri)
+	}
+	bucket, object, _ := strings.Cut(rest, "/")
+	if bucket == "" || object == "" {
+		return "", "", fmt.Errorf("%q must name both a bucket and an object", uri)
+	}
+	return bucket, object, nil
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd)
+
+	addSSECustomerKeyFlag(cpCmd)
+	cpCmd.Flags().String("copy-source-sse-c-key", "", "customer-provided key the source object is encrypted with")
+	cpCmd.Flags().String("metadata-directive", "", "COPY to keep the source's metadata and tags, REPLACE to take them from the flags")
+	cpCmd.Flags().String("content-type", "", "MIME type of the copy, with --metadata-directive REPLACE")
+	cpCmd.Flags().StringArray("meta", nil, "user-defined metadata of the copy, as key=value (repeatable)")
+	cpCmd.Flags().StringArray("tag", nil, "tag to attach to the copy, as key=value (repeatable)")
+	cpCmd.Flags().String("storage-class", "", "storage class to keep the copy in (STANDARD, COLD or ARCHIVE)")
+}
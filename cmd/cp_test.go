@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestCpCommand(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		flags          map[string]string
+		storage        *mockStorageForTesting
+		expectedOutput string
+	}{
+		{
+			name: "copies between buckets",
+			args: []string{"s3://reports/q1.csv", "s3://backup/2024/q1.csv"},
+			storage: &mockStorageForTesting{
+				copyFunc: func(srcBucket, srcObject, dstBucket, dstObject string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+					if srcBucket != "reports" || srcObject != "q1.csv" || dstBucket != "backup" || dstObject != "2024/q1.csv" {
+						t.Errorf("unexpected copy %s/%s -> %s/%s", srcBucket, srcObject, dstBucket, dstObject)
+					}
+					return &storage.ObjectInfo{}, nil
+				},
+			},
+			expectedOutput: "Copied s3://reports/q1.csv to s3://backup/2024/q1.csv",
+		},
+		{
+			name:  "replaces metadata",
+			args:  []string{"s3://reports/q1.csv", "s3://reports/q1.csv"},
+			flags: map[string]string{"metadata-directive": "replace", "meta": "owner=sales", "storage-class": "COLD"},
+			storage: &mockStorageForTesting{
+				copyFunc: func(srcBucket, srcObject, dstBucket, dstObject string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+					o := storage.NewOptions(opts...)
+					if o.MetadataDirective != storage.MetadataDirectiveReplace || o.UserMetadata["owner"] != "sales" || o.StorageClass != "COLD" {
+						t.Errorf("unexpected options %+v", o)
+					}
+					return &storage.ObjectInfo{}, nil
+				},
+			},
+			expectedOutput: "Copied s3://reports/q1.csv to s3://reports/q1.csv",
+		},
+		{
+			name: "reports failures",
+			args: []string{"s3://reports/q1.csv", "s3://reports/q1.csv"},
+			storage: &mockStorageForTesting{
+				copyFunc: func(srcBucket, srcObject, dstBucket, dstObject string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+					return nil, errors.New("copy failed")
+				},
+			},
+			expectedOutput: "Failed to copy object: copy failed",
+		},
+		{
+			name:           "rejects local paths",
+			args:           []string{"reports/q1.csv", "s3://backup/q1.csv"},
+			storage:        &mockStorageForTesting{},
+			expectedOutput: `Invalid source: "reports/q1.csv" does not start with s3://`,
+		},
+		{
+			name:           "needs an object",
+			args:           []string{"s3://reports/q1.csv", "s3://backup"},
+			storage:        &mockStorageForTesting{},
+			expectedOutput: `Invalid destination: "s3://backup" must name both a bucket and an object`,
+		},
+		{
+			name:           "missing arguments",
+			args:           []string{"s3://reports/q1.csv"},
+			storage:        &mockStorageForTesting{},
+			expectedOutput: "Usage: mini-s3 cp s3://<bucket-name>/<object-name> s3://<bucket-name>/<object-name>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := withMockStorage(tt.storage)
+			defer cleanup()
+
+			for name, value := range tt.flags {
+				if err := cpCmd.Flags().Set(name, value); err != nil {
+					t.Fatalf("Failed to set flag %s: %v", name, err)
+				}
+			}
+			defer func() {
+				_ = cpCmd.Flags().Set("metadata-directive", "")
+				_ = cpCmd.Flags().Set("storage-class", "")
+				_ = cpCmd.Flags().Lookup("meta").Value.(interface{ Replace([]string) error }).Replace(nil)
+			}()
+
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			cpCmd.Run(cpCmd, tt.args)
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			if !strings.Contains(output, tt.expectedOutput) {
+				t.Errorf("expected output to contain '%s', got '%s'", tt.expectedOutput, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type deduplicator interface {
+	DedupStats() (*storage.DedupStats, error)
+	CollectGarbage(grace time.Duration) (*storage.GarbageStats, error)
+}
+
+// dedupStatsCmd represents the admin dedup-stats command
+var dedupStatsCmd = &cobra.Command{
+	Use:   "dedup-stats",
+	Short: "Report logical vs physical bytes of deduplicated storage",
+	Long: `Report how much space content-addressed deduplication saves.
+
+Enable deduplication of whole objects with "dedup: true" in the config
+file, or of content-defined chunks with "dedup: chunk".
+
+Example usage:
+  mini-s3 admin dedup-stats`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dedup, ok := storageInstance.(deduplicator)
+		if !ok {
+			fmt.Println("Deduplication is not supported by this storage backend")
+			return
+		}
+
+		stats, err := dedup.DedupStats()
+		if err != nil {
+			fmt.Printf("Failed to compute dedup stats: %v\n", err)
+			return
+		}
+
+		fmt.Printf("%-20s %d (%d deduplicated, %d chunked)\n", "Objects:", stats.Objects, stats.DedupedObjects, stats.ChunkedObjects)
+		fmt.Printf("%-20s %d (%d unreferenced)\n", "Blobs:", stats.Blobs, stats.UnreferencedBlobs)
+		fmt.Printf("%-20s %d (%d unreferenced)\n", "Chunks:", stats.Chunks, stats.UnreferencedChunks)
+		fmt.Printf("%-20s %s\n", "Logical bytes:", formatSize(stats.LogicalBytes))
+		fmt.Printf("%-20s %s\n", "Stored bytes:", formatSize(stats.StoredBytes))
+		fmt.Printf("%-20s %s\n", "Physical bytes:", formatSize(stats.PhysicalBytes))
+		fmt.Printf("%-20s %.2fx\n", "Dedup ratio:", stats.Ratio())
+		fmt.Printf("%-20s %s\n", "Reclaimable by gc:", formatSize(stats.ReclaimableBytes))
+	},
+}
+
+// gcCmd represents the admin gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete blobs and chunks no object references any more",
+	Long: `Delete blobs and chunks of the deduplicated stores that no object references any more.
+
+Blobs and chunks whose references changed within the grace period are
+kept, so uploads in progress are never affected.
+
+Example usage:
+  mini-s3 admin gc
+  mini-s3 admin gc --grace 1h`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dedup, ok := storageInstance.(deduplicator)
+		if !ok {
+			fmt.Println("Deduplication is not supported by this storage backend")
+			return
+		}
+
+		grace, _ := cmd.Flags().GetDuration("grace")
+		stats, err := dedup.CollectGarbage(grace)
+		if err != nil {
+			fmt.Printf("Garbage collection failed: %v\n", err)
+			return
+		}
+		fmt.Printf("Deleted %d blobs, %d manifests and %d chunks, freed %s, dropped %d stale references (%d within grace period)\n",
+			stats.Blobs, stats.Manifests, stats.Chunks, formatSize(stats.FreedBytes), stats.StaleRefs, stats.Skipped)
+	},
+}
+
+func init() {
+	adminCmd.AddCommand(dedupStatsCmd, gcCmd)
+
+	gcCmd.Flags().Duration("grace", storage.DefaultGarbageGrace, "keep blobs and chunks whose references changed more recently than this")
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestDedupStatsCommand(t *testing.T) {
+	local := storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum(), storage.WithDeduplication())
+	for _, object := range []string{"a", "b"} {
+		if _, err := local.Save("bucket", object, strings.NewReader(strings.Repeat("x", 2048))); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name            string
+		storage         storage.Storage
+		expectedOutputs []string
+	}{
+		{
+			name:            "unsupported backend",
+			storage:         &mockStorageForTesting{},
+			expectedOutputs: []string{"Deduplication is not supported by this storage backend"},
+		},
+		{
+			name:    "reports logical and physical bytes",
+			storage: local,
+			expectedOutputs: []string{
+				"Logical bytes:       4.0 KB",
+				"Physical bytes:      2.0 KB",
+				"Dedup ratio:         2.00x",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := withMockStorage(tt.storage)
+			defer cleanup()
+
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			dedupStatsCmd.Run(dedupStatsCmd, []string{})
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			for _, expected := range tt.expectedOutputs {
+				if !bytes.Contains([]byte(output), []byte(expected)) {
+					t.Errorf("expected output to contain '%s', got '%s'", expected, output)
+				}
+			}
+		})
+	}
+}
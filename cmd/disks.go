@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type diskManager interface {
+	Disks() []storage.DiskStatus
+	ReplaceDisk(path string) error
+}
+
+// disksCmd represents the admin disks command
+var disksCmd = &cobra.Command{
+	Use:   "disks",
+	Short: "Show the state of the data disks",
+	Long: `Show the data disks object data is spread over, and whether they are online.
+
+Spread object data over several disks with "disks: [/mnt/d1, /mnt/d2]"
+in the config file, and pick how objects are placed on them with
+"disk-placement: hash" (the default) or "disk-placement: free-space".
+Disks that fail, or are unmounted, are taken offline: objects on them
+cannot be read until they are back, unless they are erasure-coded.
+
+Example usage:
+  mini-s3 admin disks`,
+	Run: func(cmd *cobra.Command, args []string) {
+		disks, ok := storageInstance.(diskManager)
+		if !ok || disks.Disks() == nil {
+			fmt.Println("Object data is not spread over several disks")
+			return
+		}
+
+		fmt.Printf("%-30s %-18s %-8s %-10s %-10s %s\n", "DISK", "ID", "STATE", "FREE", "SIZE", "REASON")
+		for _, status := range disks.Disks() {
+			state := "online"
+			if !status.Online {
+				state = "offline"
+			}
+			fmt.Printf("%-30s %-18s %-8s %-10s %-10s %s\n", status.Path, status.ID, state,
+				formatSize(status.Free), formatSize(status.Total), status.Reason)
+		}
+	},
+}
+
+// diskReplaceCmd represents the admin disks replace command
+var diskReplaceCmd = &cobra.Command{
+	Use:   "replace <path>",
+	Short: "Put a replaced data disk back in use",
+	Long: `Format the data disk mounted at path as a new one, and put it back in use.
+
+A disk that is replaced, or comes back empty, stays offline so objects are
+not written to its mount point by mistake. The objects kept on it before
+are gone; run "mini-s3 admin heal" to rebuild the shards of erasure-coded
+ones.
+
+Example usage:
+  mini-s3 admin disks replace /mnt/d2`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		disks, ok := storageInstance.(diskManager)
+		if !ok || disks.Disks() == nil {
+			fmt.Println("Object data is not spread over several disks")
+			return
+		}
+
+		if err := disks.ReplaceDisk(args[0]); err != nil {
+			fmt.Printf("Failed to replace disk: %v\n", err)
+			return
+		}
+		fmt.Printf("Disk %s is back online\n", args[0])
+	},
+}
+
+func init() {
+	adminCmd.AddCommand(disksCmd)
+	disksCmd.AddCommand(diskReplaceCmd)
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestDisksCommand(t *testing.T) {
+	disks := []string{t.TempDir(), t.TempDir()}
+	local := storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum(), storage.WithDisks(storage.PlacementHash, disks...))
+
+	tests := []struct {
+		name           string
+		storage        storage.Storage
+		setup          func()
+		run            func()
+		expectedOutput string
+	}{
+		{
+			name:           "unsupported backend",
+			storage:        &mockStorageForTesting{},
+			run:            func() { disksCmd.Run(disksCmd, []string{}) },
+			expectedOutput: "Object data is not spread over several disks",
+		},
+		{
+			name:           "single data directory",
+			storage:        storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum()),
+			run:            func() { disksCmd.Run(disksCmd, []string{}) },
+			expectedOutput: "Object data is not spread over several disks",
+		},
+		{
+			name:           "lists the disks",
+			storage:        local,
+			run:            func() { disksCmd.Run(disksCmd, []string{}) },
+			expectedOutput: disks[1],
+		},
+		{
+			name:    "an unmounted disk is offline",
+			storage: local,
+			setup: func() {
+				os.Remove(filepath.Join(disks[1], ".mini-s3-disk"))
+				local.CheckDisks()
+			},
+			run:            func() { disksCmd.Run(disksCmd, []string{}) },
+			expectedOutput: "offline",
+		},
+		{
+			name:           "replacing an unknown disk",
+			storage:        local,
+			run:            func() { diskReplaceCmd.Run(diskReplaceCmd, []string{"/nowhere"}) },
+			expectedOutput: "Failed to replace disk: /nowhere is not a data disk",
+		},
+		{
+			name:           "replacing a disk brings it back",
+			storage:        local,
+			run:            func() { diskReplaceCmd.Run(diskReplaceCmd, []string{disks[1]}) },
+			expectedOutput: "Disk " + disks[1] + " is back online",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := withMockStorage(tt.storage)
+			defer cleanup()
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			tt.run()
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			if !strings.Contains(output, tt.expectedOutput) {
+				t.Errorf("expected output to contain '%s', got '%s'", tt.expectedOutput, output)
+			}
+		})
+	}
+}
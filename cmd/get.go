@@ -1,11 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
+	"github.com/iamthiago/mini-s3/internal/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -16,7 +18,9 @@ var getCmd = &cobra.Command{
 	Long: `Get an object from a bucket and save it to a local file.
 
 Example usage:
-  mini-s3 get <bucket-name> <object-name> <output-dir>`,
+  mini-s3 get <bucket-name> <object-name> <output-dir>
+  mini-s3 get <bucket-name> <object-name> <output-dir> --sse-c-key <key>
+  mini-s3 get <bucket-name> <object-name> <output-dir> --if-none-match <etag>`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) < 3 {
 			fmt.Println("Usage: mini-s3 get <bucket-name> <object-name> <output-dir>")
@@ -27,7 +31,23 @@ Example usage:
 		object := args[1]
 		outDir := args[2]
 
-		fromBucket, objInfo, err := storageInstance.Get(bucket, object)
+		opts, err := sseCustomerKeyOptions(cmd)
+		if err != nil {
+			fmt.Printf("Invalid SSE-C key: %v\n", err)
+			return
+		}
+		conditionOpts, err := conditionOptions(cmd)
+		if err != nil {
+			fmt.Printf("Invalid condition: %v\n", err)
+			return
+		}
+		opts = append(opts, conditionOpts...)
+
+		fromBucket, objInfo, err := storageInstance.Get(bucket, object, opts...)
+		if errors.Is(err, storage.ErrNotModified) {
+			fmt.Printf("%s is not modified\n", object)
+			return
+		}
 		if err != nil {
 			fmt.Printf("Error getting object: %v. %v\n", object, err)
 			return
@@ -56,6 +76,9 @@ Example usage:
 func init() {
 	rootCmd.AddCommand(getCmd)
 
+	addSSECustomerKeyFlag(getCmd)
+	addConditionFlags(getCmd, true)
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
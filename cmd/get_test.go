@@ -40,7 +40,7 @@ func TestGetCommand(t *testing.T) {
 			args: []string{"test-bucket", "test.txt", destDir},
 			setupStorage: func() *mockStorageForTesting {
 				return &mockStorageForTesting{
-					getFunc: func(bucket, object string) (io.ReadCloser, *storage.ObjectInfo, error) {
+					getFunc: func(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
 						file, err := os.Open(testFile)
 						if err != nil {
 							return nil, nil, err
@@ -69,7 +69,7 @@ func TestGetCommand(t *testing.T) {
 			args: []string{"test-bucket", "nonexistent1.txt", destDir},
 			setupStorage: func() *mockStorageForTesting {
 				return &mockStorageForTesting{
-					getFunc: func(bucket, object string) (io.ReadCloser, *storage.ObjectInfo, error) {
+					getFunc: func(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
 						return nil, nil, os.ErrNotExist
 					},
 				}
@@ -81,7 +81,7 @@ func TestGetCommand(t *testing.T) {
 			args: []string{"test-bucket", "nonexistent2.txt", "/nonexistent/dir"},
 			setupStorage: func() *mockStorageForTesting {
 				return &mockStorageForTesting{
-					getFunc: func(bucket, object string) (io.ReadCloser, *storage.ObjectInfo, error) {
+					getFunc: func(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
 						return nil, nil, os.ErrPermission
 					},
 				}
@@ -93,7 +93,7 @@ func TestGetCommand(t *testing.T) {
 			args: []string{"test-bucket", "nonexistent3.txt", destDir},
 			setupStorage: func() *mockStorageForTesting {
 				return &mockStorageForTesting{
-					getFunc: func(bucket, object string) (io.ReadCloser, *storage.ObjectInfo, error) {
+					getFunc: func(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
 						return &errorReader{}, &storage.ObjectInfo{Object: object}, nil
 					},
 				}
@@ -150,3 +150,46 @@ func (e *errorReader) Read(p []byte) (n int, err error) {
 func (e *errorReader) Close() error {
 	return nil
 }
+
+func TestGetCommandConditions(t *testing.T) {
+	destDir := t.TempDir()
+	var got *storage.Conditions
+	cleanup := withMockStorage(&mockStorageForTesting{
+		getFunc: func(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
+			got = storage.NewOptions(opts...).Conditions
+			return nil, nil, storage.ErrNotModified
+		},
+	})
+	defer cleanup()
+
+	_ = getCmd.Flags().Set("if-none-match", `"abc"`)
+	_ = getCmd.Flags().Set("if-modified-since", "2024-01-01T00:00:00Z")
+	defer func() {
+		_ = getCmd.Flags().Set("if-none-match", "")
+		_ = getCmd.Flags().Set("if-modified-since", "")
+	}()
+
+	// Capture output
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	getCmd.Run(getCmd, []string{"config", "app.json", destDir})
+
+	// Restore stdout and read output
+	_ = w.Close()
+	os.Stdout = old
+	var buf bytes.Buffer
+	_, _ = io.Copy(&buf, r)
+	output := buf.String()
+
+	if got == nil || got.IfNoneMatch != `"abc"` || got.IfModifiedSince.Year() != 2024 {
+		t.Errorf("expected the conditions to reach storage, got %+v", got)
+	}
+	if !bytes.Contains([]byte(output), []byte("app.json is not modified")) {
+		t.Errorf("expected output to report the object as not modified, got '%s'", output)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "app.json")); !os.IsNotExist(err) {
+		t.Errorf("expected no file to be written, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// headCmd represents the head command
+var headCmd = &cobra.Command{
+	Use:   "head",
+	Short: "Show the metadata of an object",
+	Long: `Show the metadata of an object without reading it.
+
+Example usage:
+  mini-s3 head <bucket-name> <object-name>
+  mini-s3 head <bucket-name> <object-name> --sse-c-key <key>`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 head <bucket-name> <object-name>")
+			return
+		}
+
+		opts, err := sseCustomerKeyOptions(cmd)
+		if err != nil {
+			fmt.Printf("Invalid SSE-C key: %v\n", err)
+			return
+		}
+		conditionOpts, err := conditionOptions(cmd)
+		if err != nil {
+			fmt.Printf("Invalid condition: %v\n", err)
+			return
+		}
+		opts = append(opts, conditionOpts...)
+
+		info, err := storageInstance.Head(args[0], args[1], opts...)
+		if errors.Is(err, storage.ErrNotModified) {
+			fmt.Printf("%s is not modified\n", args[1])
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error getting object: %v. %v\n", args[1], err)
+			return
+		}
+
+		fmt.Printf("%-20s %s\n", "Size:", formatSize(info.Size))
+		fmt.Printf("%-20s %s\n", "Created:", info.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("%-20s %s\n", "ETag:", info.ETag)
+		fmt.Printf("%-20s %s\n", "Content-Type:", info.ContentType)
+		for _, field := range []struct{ name, value string }{
+			{"Content-Encoding:", info.ContentEncoding},
+			{"Content-Disposition:", info.ContentDisposition},
+			{"Cache-Control:", info.CacheControl},
+		} {
+			if field.value != "" {
+				fmt.Printf("%-20s %s\n", field.name, field.value)
+			}
+		}
+		if !info.Expires.IsZero() {
+			fmt.Printf("%-20s %s\n", "Expires:", info.Expires.UTC().Format("2006-01-02 15:04:05 MST"))
+		}
+		fmt.Printf("%-20s %s\n", "Storage class:", info.StorageClass)
+		if info.Checksum != "" {
+			fmt.Printf("%-20s %s\n", "Checksum:", info.Checksum)
+		}
+		if info.ReplicationStatus != "" {
+			fmt.Printf("%-20s %s\n", "Replication:", info.ReplicationStatus)
+		}
+
+		keys := make([]string, 0, len(info.UserMetadata))
+		for key := range info.UserMetadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("%-20s %s\n", "x-amz-meta-"+key+":", info.UserMetadata[key])
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(headCmd)
+
+	addSSECustomerKeyFlag(headCmd)
+	addConditionFlags(headCmd, true)
+}
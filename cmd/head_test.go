@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestHeadCommand(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		storage        *mockStorageForTesting
+		expectedOutput []string
+	}{
+		{
+			name: "shows metadata",
+			args: []string{"site", "report.csv"},
+			storage: &mockStorageForTesting{
+				headFunc: func(bucket, object string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+					return &storage.ObjectInfo{
+						Bucket: bucket, Object: object, Size: 2048,
+						ContentType: "text/csv", CacheControl: "no-cache", StorageClass: storage.StorageClassStandard,
+						UserMetadata: map[string]string{"source": "crm", "owner": "data"},
+					}, nil
+				},
+			},
+			expectedOutput: []string{
+				"Size:                2.0 KB",
+				"Content-Type:        text/csv",
+				"Cache-Control:       no-cache",
+				"x-amz-meta-owner:    data\nx-amz-meta-source:   crm",
+			},
+		},
+		{
+			name: "missing object",
+			args: []string{"site", "missing"},
+			storage: &mockStorageForTesting{
+				headFunc: func(bucket, object string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+					return nil, errors.New("not found")
+				},
+			},
+			expectedOutput: []string{"Error getting object: missing. not found"},
+		},
+		{
+			name:           "missing arguments",
+			args:           []string{"site"},
+			storage:        &mockStorageForTesting{},
+			expectedOutput: []string{"Usage: mini-s3 head <bucket-name> <object-name>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := withMockStorage(tt.storage)
+			defer cleanup()
+
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			headCmd.Run(headCmd, tt.args)
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			for _, expected := range tt.expectedOutput {
+				if !strings.Contains(output, expected) {
+					t.Errorf("expected output to contain '%s', got '%s'", expected, output)
+				}
+			}
+		})
+	}
+}
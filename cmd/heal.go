@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type healer interface {
+	Heal() (*storage.HealReport, error)
+}
+
+// healCmd represents the admin heal command
+var healCmd = &cobra.Command{
+	Use:   "heal",
+	Short: "Rebuild the lost shards of erasure-coded objects",
+	Long: `Check the shards of every erasure-coded object against their checksums,
+and rebuild those missing or corrupted from the others, like after a disk
+was replaced.
+
+Enable erasure coding with "erasure: {data: 4, parity: 2, disks: [...]}"
+in the config file. Objects that lost more shards than they have parity
+shards cannot be rebuilt, and are reported as lost.
+
+Example usage:
+  mini-s3 admin heal`,
+	Run: func(cmd *cobra.Command, args []string) {
+		h, ok := storageInstance.(healer)
+		if !ok {
+			fmt.Println("Healing is not supported by this storage backend")
+			return
+		}
+
+		report, err := h.Heal()
+		if err != nil {
+			fmt.Printf("Healing failed: %v\n", err)
+			return
+		}
+		fmt.Printf("Checked %d erasure-coded objects: healed %d, rebuilt %d shards, %d lost\n",
+			report.Objects, report.Healed, report.Shards, report.Lost)
+		if report.Stale > 0 {
+			fmt.Printf("Removed %d stale copies of replaced objects from disks that are back\n", report.Stale)
+		}
+	},
+}
+
+func init() {
+	adminCmd.AddCommand(healCmd)
+}
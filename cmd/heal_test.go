@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/erasure"
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestHealCommand(t *testing.T) {
+	coder, err := erasure.New(2, 1)
+	if err != nil {
+		t.Fatalf("Failed to create coder: %v", err)
+	}
+	disk := t.TempDir()
+	local := storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum(), storage.WithErasureCoding(coder, disk))
+	if _, err := local.Save("bucket", "object", strings.NewReader(strings.Repeat("x", 2048))); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	shards, _ := filepath.Glob(filepath.Join(disk, "*", "*.0"))
+	if len(shards) != 1 {
+		t.Fatalf("Expected one first shard, got %v", shards)
+	}
+
+	tests := []struct {
+		name           string
+		storage        storage.Storage
+		setup          func()
+		expectedOutput string
+	}{
+		{
+			name:           "unsupported backend",
+			storage:        &mockStorageForTesting{},
+			expectedOutput: "Healing is not supported by this storage backend",
+		},
+		{
+			name:           "nothing to heal",
+			storage:        local,
+			expectedOutput: "Checked 1 erasure-coded objects: healed 0, rebuilt 0 shards, 0 lost",
+		},
+		{
+			name:           "rebuilds a lost shard",
+			storage:        local,
+			setup:          func() { os.Remove(shards[0]) },
+			expectedOutput: "Checked 1 erasure-coded objects: healed 1, rebuilt 1 shards, 0 lost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := withMockStorage(tt.storage)
+			defer cleanup()
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			healCmd.Run(healCmd, []string{})
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			if !strings.Contains(output, tt.expectedOutput) {
+				t.Errorf("expected output to contain '%s', got '%s'", tt.expectedOutput, output)
+			}
+		})
+	}
+}
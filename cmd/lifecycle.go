@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type lifecycleManager interface {
+	PutBucketLifecycle(bucket string, cfg *storage.LifecycleConfiguration) error
+	GetBucketLifecycle(bucket string) (*storage.LifecycleConfiguration, error)
+	DeleteBucketLifecycle(bucket string) error
+	ApplyLifecycle(bucket string, now time.Time, dryRun bool) (*storage.LifecycleReport, error)
+}
+
+// lifecycleCmd represents the lifecycle command
+var lifecycleCmd = &cobra.Command{
+	Use:   "lifecycle",
+	Short: "Manage lifecycle rules of a bucket",
+	Long: `Manage lifecycle rules of a bucket.
+
+Rules use the S3 lifecycle configuration format, in XML or JSON, and can
+expire objects selected by prefix, tag or size, or move them to a colder
+storage class, a number of days after they were created or on a date.
+"mini-s3 serve" applies them periodically; "mini-s3 lifecycle run" applies
+them once.
+
+Example usage:
+  mini-s3 lifecycle put <bucket-name> lifecycle.json
+  mini-s3 lifecycle get <bucket-name>
+  mini-s3 lifecycle delete <bucket-name>
+  mini-s3 lifecycle run [bucket-name] --dry-run`,
+}
+
+var lifecyclePutCmd = &cobra.Command{
+	Use:   "put",
+	Short: "Set the lifecycle rules of a bucket from an XML or JSON file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 lifecycle put <bucket-name> <config-file>")
+			return
+		}
+
+		manager, ok := storageInstance.(lifecycleManager)
+		if !ok {
+			fmt.Println("Lifecycle rules are not supported by this storage backend")
+			return
+		}
+
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			fmt.Printf("Failed to read lifecycle configuration: %v\n", err)
+			return
+		}
+		cfg, err := storage.ParseLifecycleConfiguration(data)
+		if err != nil {
+			fmt.Printf("Failed to parse lifecycle configuration: %v\n", err)
+			return
+		}
+		if err := manager.PutBucketLifecycle(args[0], cfg); err != nil {
+			fmt.Printf("Failed to set lifecycle rules: %v\n", err)
+			return
+		}
+		fmt.Printf("Set %d lifecycle rules on bucket %s\n", len(cfg.Rules), args[0])
+	},
+}
+
+var lifecycleGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Show the lifecycle rules of a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 lifecycle get <bucket-name>")
+			return
+		}
+
+		manager, ok := storageInstance.(lifecycleManager)
+		if !ok {
+			fmt.Println("Lifecycle rules are not supported by this storage backend")
+			return
+		}
+
+		cfg, err := manager.GetBucketLifecycle(args[0])
+		if err != nil {
+			fmt.Printf("Failed to get lifecycle rules: %v\n", err)
+			return
+		}
+		if cfg == nil {
+			fmt.Printf("Bucket %s has no lifecycle rules\n", args[0])
+			return
+		}
+		data, _ := json.MarshalIndent(cfg, "", "  ")
+		fmt.Println(string(data))
+	},
+}
+
+var lifecycleDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Remove the lifecycle rules of a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 lifecycle delete <bucket-name>")
+			return
+		}
+
+		manager, ok := storageInstance.(lifecycleManager)
+		if !ok {
+			fmt.Println("Lifecycle rules are not supported by this storage backend")
+			return
+		}
+
+		if err := manager.DeleteBucketLifecycle(args[0]); err != nil {
+			fmt.Printf("Failed to remove lifecycle rules: %v\n", err)
+			return
+		}
+		fmt.Printf("Lifecycle rules removed from bucket %s\n", args[0])
+	},
+}
+
+var lifecycleRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Apply lifecycle rules now",
+	Long: `Apply the lifecycle rules of a bucket, or of every bucket, now.
+
+With --dry-run, the actions are listed but not taken.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, ok := storageInstance.(lifecycleManager)
+		if !ok {
+			fmt.Println("Lifecycle rules are not supported by this storage backend")
+			return
+		}
+
+		bucket := ""
+		if len(args) > 0 {
+			bucket = args[0]
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		report, err := manager.ApplyLifecycle(bucket, time.Now(), dryRun)
+		if report != nil {
+			printLifecycleReport(report, dryRun)
+		}
+		if err != nil {
+			fmt.Printf("Lifecycle run failed: %v\n", err)
+		}
+	},
+}
+
+func printLifecycleReport(report *storage.LifecycleReport, dryRun bool) {
+	expireVerb, transitionVerb := "Expired", "Transitioned"
+	if dryRun {
+		expireVerb, transitionVerb = "Would expire", "Would transition"
+	}
+
+	var expired, transitioned int
+	for _, action := range report.Actions {
+		switch action.Action {
+		case storage.LifecycleActionExpire:
+			expired++
+			fmt.Printf("%s %s/%s (%s) by rule %q\n", expireVerb, action.Bucket, action.Object, formatSize(action.Size), action.RuleID)
+		case storage.LifecycleActionTransition:
+			transitioned++
+			fmt.Printf("%s %s/%s (%s) to %s by rule %q\n", transitionVerb, action.Bucket, action.Object, formatSize(action.Size), action.StorageClass, action.RuleID)
+		}
+	}
+	if report.Retained > 0 {
+		fmt.Printf("Kept %d objects due to expire under object lock\n", report.Retained)
+	}
+	if report.ExpiredRestores > 0 {
+		fmt.Printf("%s %d restored copies of archived objects\n", expireVerb, report.ExpiredRestores)
+	}
+	for _, note := range report.Notes {
+		fmt.Printf("Note: %s\n", note)
+	}
+	fmt.Printf("%s %d of %d objects in %d buckets with lifecycle rules\n", expireVerb, expired, report.Scanned, report.Buckets)
+	if transitioned > 0 {
+		fmt.Printf("%s %d objects to colder storage classes\n", transitionVerb, transitioned)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(lifecycleCmd)
+	lifecycleCmd.AddCommand(lifecyclePutCmd, lifecycleGetCmd, lifecycleDeleteCmd, lifecycleRunCmd)
+
+	lifecycleRunCmd.Flags().Bool("dry-run", false, "list the actions without taking them")
+}
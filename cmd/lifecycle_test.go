@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestLifecycleCommands(t *testing.T) {
+	tmpDir := t.TempDir()
+	local := storage.NewLocalStorage(tmpDir, storage.NewValueChecksum())
+	if _, err := local.Save("logs", "app.log", strings.NewReader("content")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	configPath := filepath.Join(tmpDir, "lifecycle.json")
+	config := `{"Rules": [{"ID": "all", "Status": "Enabled", "Filter": {"Prefix": ""}, "Expiration": {"Date": "2000-01-01T00:00:00Z"}}]}`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		storage        storage.Storage
+		run            func()
+		expectedOutput string
+	}{
+		{
+			name:           "unsupported backend",
+			storage:        &mockStorageForTesting{},
+			run:            func() { lifecycleRunCmd.Run(lifecycleRunCmd, []string{}) },
+			expectedOutput: "Lifecycle rules are not supported by this storage backend",
+		},
+		{
+			name:           "put rules",
+			storage:        local,
+			run:            func() { lifecyclePutCmd.Run(lifecyclePutCmd, []string{"logs", configPath}) },
+			expectedOutput: "Set 1 lifecycle rules on bucket logs",
+		},
+		{
+			name:    "dry run lists expired objects",
+			storage: local,
+			run: func() {
+				_ = lifecycleRunCmd.Flags().Set("dry-run", "true")
+				defer func() { _ = lifecycleRunCmd.Flags().Set("dry-run", "false") }()
+				lifecycleRunCmd.Run(lifecycleRunCmd, []string{"logs"})
+			},
+			expectedOutput: `Would expire logs/app.log (7 B) by rule "all"`,
+		},
+		{
+			name:           "run expires objects",
+			storage:        local,
+			run:            func() { lifecycleRunCmd.Run(lifecycleRunCmd, []string{}) },
+			expectedOutput: "Expired 1 of 1 objects in 1 buckets with lifecycle rules",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := withMockStorage(tt.storage)
+			defer cleanup()
+
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			tt.run()
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			if !strings.Contains(output, tt.expectedOutput) {
+				t.Errorf("expected output to contain '%s', got '%s'", tt.expectedOutput, output)
+			}
+		})
+	}
+
+	if exists, _ := local.Exists("logs", "app.log"); exists {
+		t.Errorf("Expected app.log to be expired")
+	}
+}
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"slices"
 
+	"github.com/iamthiago/mini-s3/internal/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -15,7 +17,8 @@ var listCmd = &cobra.Command{
 This command retrieves and displays a list of objects stored in a bucket.
 
 Example usage:
-  mini-s3 list <bucket-name>`,
+  mini-s3 list <bucket-name>
+  mini-s3 list <bucket-name> --tag team=data`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) < 1 {
 			fmt.Println("Usage: mini-s3 list <bucket-name>")
@@ -24,27 +27,55 @@ Example usage:
 
 		bucket := args[0]
 
+		values, _ := cmd.Flags().GetStringArray("tag")
+		filter, err := parseKeyValues(values)
+		if err != nil {
+			fmt.Printf("Invalid tag filter: %v\n", err)
+			return
+		}
+
 		objects, err := storageInstance.ListObjects(bucket)
 		if err != nil {
 			fmt.Printf("Failed to list objects: %v\n", err)
 			return
 		}
+		if len(filter) > 0 {
+			objects = slices.DeleteFunc(objects, func(obj *storage.ObjectInfo) bool {
+				return !storage.MatchesTags(obj.Tags, filter)
+			})
+		}
 
 		if len(objects) == 0 {
 			fmt.Println("No objects found")
 			return
 		}
 
-		fmt.Printf("%-25s %-10s %s\n", "CREATED", "SIZE", "NAME")
-		fmt.Println("-----------------------------------------------------------")
+		fmt.Printf("%-25s %-10s %-10s %-10s %s\n", "CREATED", "SIZE", "STORED", "CLASS", "NAME")
+		fmt.Println("--------------------------------------------------------------------------------")
+		var logical, stored int64
 		for _, obj := range objects {
 			timestamp := obj.CreatedAt.Format("2006-01-02 15:04:05")
 			size := formatSize(obj.Size)
-			fmt.Printf("%-25s %-10s %s\n", timestamp, size, obj.Object)
+			storedSize := obj.Size
+			if obj.Compression != "" {
+				storedSize = obj.CompressedSize
+				logical += obj.Size
+				stored += obj.CompressedSize
+			}
+			fmt.Printf("%-25s %-10s %-10s %-10s %s\n", timestamp, size, formatSize(storedSize), obj.StorageClass, obj.Object)
+		}
+
+		if logical > 0 {
+			fmt.Printf("\nCompression saved %s (%.1f%%): %s stored as %s\n",
+				formatSize(logical-stored), savedPercent(logical, stored), formatSize(logical), formatSize(stored))
 		}
 	},
 }
 
+func savedPercent(logical, stored int64) float64 {
+	return float64(logical-stored) / float64(logical) * 100
+}
+
 func formatSize(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
@@ -60,4 +91,6 @@ func formatSize(bytes int64) string {
 
 func init() {
 	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringArray("tag", nil, "only list objects with this tag, as key=value (repeatable)")
 }
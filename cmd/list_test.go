@@ -49,6 +49,28 @@ func TestListCommand(t *testing.T) {
 			wantErr:        false,
 			expectedOutput: "file1.txt",
 		},
+		{
+			name: "reports compression savings",
+			args: []string{"test-bucket"},
+			setupStorage: func() *mockStorageForTesting {
+				return &mockStorageForTesting{
+					listObjectsFunc: func(bucket string) ([]*storage.ObjectInfo, error) {
+						return []*storage.ObjectInfo{
+							{
+								Bucket:         "test-bucket",
+								Object:         "logs.json",
+								Size:           10240,
+								Compression:    "zstd",
+								CompressedSize: 1024,
+								CreatedAt:      time.Date(2024, 1, 15, 14, 30, 45, 0, time.UTC),
+							},
+						}, nil
+					},
+				}
+			},
+			wantErr:        false,
+			expectedOutput: "Compression saved 9.0 KB (90.0%): 10.0 KB stored as 1.0 KB",
+		},
 		{
 			name: "empty bucket",
 			args: []string{"test-bucket"},
@@ -7,16 +7,18 @@ import (
 )
 
 type mockStorageForTesting struct {
-	saveFunc        func(bucket, object string, reader io.Reader) (*storage.ObjectInfo, error)
+	saveFunc        func(bucket, object string, reader io.Reader, opts ...storage.Option) (*storage.ObjectInfo, error)
 	listObjectsFunc func(bucket string) ([]*storage.ObjectInfo, error)
-	getFunc         func(bucket, object string) (io.ReadCloser, *storage.ObjectInfo, error)
-	deleteFunc      func(bucket, object string) error
+	getFunc         func(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error)
+	headFunc        func(bucket, object string, opts ...storage.Option) (*storage.ObjectInfo, error)
+	copyFunc        func(srcBucket, srcObject, dstBucket, dstObject string, opts ...storage.Option) (*storage.ObjectInfo, error)
+	deleteFunc      func(bucket, object string, opts ...storage.Option) error
 	existsFunc      func(bucket, object string) (bool, error)
 }
 
-func (m *mockStorageForTesting) Save(bucket, object string, reader io.Reader) (*storage.ObjectInfo, error) {
+func (m *mockStorageForTesting) Save(bucket, object string, reader io.Reader, opts ...storage.Option) (*storage.ObjectInfo, error) {
 	if m.saveFunc != nil {
-		return m.saveFunc(bucket, object, reader)
+		return m.saveFunc(bucket, object, reader, opts...)
 	}
 	return &storage.ObjectInfo{Checksum: "mock-checksum"}, nil
 }
@@ -28,20 +30,34 @@ func (m *mockStorageForTesting) ListObjects(bucket string) ([]*storage.ObjectInf
 	return []*storage.ObjectInfo{}, nil
 }
 
-func (m *mockStorageForTesting) Get(bucket, object string) (io.ReadCloser, *storage.ObjectInfo, error) {
+func (m *mockStorageForTesting) Get(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
 	if m.getFunc != nil {
-		return m.getFunc(bucket, object)
+		return m.getFunc(bucket, object, opts...)
 	}
 	return nil, nil, nil
 }
 
-func (m *mockStorageForTesting) Delete(bucket, object string) error {
+func (m *mockStorageForTesting) Head(bucket, object string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+	if m.headFunc != nil {
+		return m.headFunc(bucket, object, opts...)
+	}
+	return nil, nil
+}
+
+func (m *mockStorageForTesting) Delete(bucket, object string, opts ...storage.Option) error {
 	if m.deleteFunc != nil {
-		return m.deleteFunc(bucket, object)
+		return m.deleteFunc(bucket, object, opts...)
 	}
 	return nil
 }
 
+func (m *mockStorageForTesting) CopyObject(srcBucket, srcObject, dstBucket, dstObject string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+	if m.copyFunc != nil {
+		return m.copyFunc(srcBucket, srcObject, dstBucket, dstObject, opts...)
+	}
+	return &storage.ObjectInfo{Bucket: dstBucket, Object: dstObject}, nil
+}
+
 func (m *mockStorageForTesting) Exists(bucket, object string) (bool, error) {
 	if m.existsFunc != nil {
 		return m.existsFunc(bucket, object)
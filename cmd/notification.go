@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type notificationManager interface {
+	PutBucketNotification(bucket string, cfg *storage.NotificationConfiguration) error
+	GetBucketNotification(bucket string) (*storage.NotificationConfiguration, error)
+	DeleteBucketNotification(bucket string) error
+	DeliverNotifications(ctx context.Context, now time.Time) (*storage.NotificationReport, error)
+	GetNotificationStatus() (*storage.NotificationStatus, error)
+	RetryFailedNotifications() (int, error)
+}
+
+// notificationCmd represents the notification command
+var notificationCmd = &cobra.Command{
+	Use:   "notification",
+	Short: "Manage event notifications of a bucket",
+	Long: `Manage event notifications of a bucket.
+
+Rules send S3-format event messages about objects created
+(s3:ObjectCreated:*), removed (s3:ObjectRemoved:*) or expired by lifecycle
+rules (s3:LifecycleExpiration:*), optionally filtered by key prefix and
+suffix, to a destination:
+
+  http://host/path, https://host/path   a webhook, sent a POST per event
+  file:///path/events.jsonl             a JSON Lines file, one line per event
+  unix:///path/events.sock              a Unix socket, one line per event
+
+Events are queued in a persistent outbox and delivered by "mini-s3 serve",
+or once by "mini-s3 notification deliver", retrying failed deliveries with
+exponential backoff.
+
+Example usage:
+  mini-s3 notification put <bucket-name> notification.json
+  mini-s3 notification get <bucket-name>
+  mini-s3 notification delete <bucket-name>
+  mini-s3 notification deliver
+  mini-s3 notification status
+  mini-s3 notification retry`,
+}
+
+var notificationPutCmd = &cobra.Command{
+	Use:   "put",
+	Short: "Set the notification rules of a bucket from an XML or JSON file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 notification put <bucket-name> <config-file>")
+			return
+		}
+
+		manager, ok := storageInstance.(notificationManager)
+		if !ok {
+			fmt.Println("Event notifications are not supported by this storage backend")
+			return
+		}
+
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			fmt.Printf("Failed to read notification configuration: %v\n", err)
+			return
+		}
+		cfg, err := storage.ParseNotificationConfiguration(data)
+		if err != nil {
+			fmt.Printf("Failed to parse notification configuration: %v\n", err)
+			return
+		}
+		if err := manager.PutBucketNotification(args[0], cfg); err != nil {
+			fmt.Printf("Failed to set notification rules: %v\n", err)
+			return
+		}
+		fmt.Printf("Set %d notification rules on bucket %s\n", len(cfg.Rules), args[0])
+	},
+}
+
+var notificationGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Show the notification rules of a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 notification get <bucket-name>")
+			return
+		}
+
+		manager, ok := storageInstance.(notificationManager)
+		if !ok {
+			fmt.Println("Event notifications are not supported by this storage backend")
+			return
+		}
+
+		cfg, err := manager.GetBucketNotification(args[0])
+		if err != nil {
+			fmt.Printf("Failed to get notification rules: %v\n", err)
+			return
+		}
+		if cfg == nil {
+			fmt.Printf("Bucket %s has no notification rules\n", args[0])
+			return
+		}
+		data, _ := json.MarshalIndent(cfg, "", "  ")
+		fmt.Println(string(data))
+	},
+}
+
+var notificationDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Remove the notification rules of a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 notification delete <bucket-name>")
+			return
+		}
+
+		manager, ok := storageInstance.(notificationManager)
+		if !ok {
+			fmt.Println("Event notifications are not supported by this storage backend")
+			return
+		}
+
+		if err := manager.DeleteBucketNotification(args[0]); err != nil {
+			fmt.Printf("Failed to remove notification rules: %v\n", err)
+			return
+		}
+		fmt.Printf("Notification rules removed from bucket %s\n", args[0])
+	},
+}
+
+var notificationDeliverCmd = &cobra.Command{
+	Use:   "deliver",
+	Short: "Deliver the queued notifications that are due now",
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, ok := storageInstance.(notificationManager)
+		if !ok {
+			fmt.Println("Event notifications are not supported by this storage backend")
+			return
+		}
+
+		report, err := manager.DeliverNotifications(context.Background(), time.Now())
+		if err != nil {
+			fmt.Printf("Failed to deliver notifications: %v\n", err)
+			return
+		}
+		printNotificationReport(report)
+	},
+}
+
+var notificationStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show how many notifications are queued or failed",
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, ok := storageInstance.(notificationManager)
+		if !ok {
+			fmt.Println("Event notifications are not supported by this storage backend")
+			return
+		}
+
+		status, err := manager.GetNotificationStatus()
+		if err != nil {
+			fmt.Printf("Failed to get notification status: %v\n", err)
+			return
+		}
+		fmt.Printf("Pending: %d\n", status.Pending)
+		fmt.Printf("Failed:  %d\n", status.Failed)
+	},
+}
+
+var notificationRetryCmd = &cobra.Command{
+	Use:   "retry",
+	Short: "Queue the notifications given up on again",
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, ok := storageInstance.(notificationManager)
+		if !ok {
+			fmt.Println("Event notifications are not supported by this storage backend")
+			return
+		}
+
+		n, err := manager.RetryFailedNotifications()
+		if err != nil {
+			fmt.Printf("Failed to queue notifications again: %v\n", err)
+			return
+		}
+		fmt.Printf("Queued %d failed notifications again\n", n)
+	},
+}
+
+func printNotificationReport(report *storage.NotificationReport) {
+	fmt.Printf("Delivered %d notifications\n", report.Delivered)
+	if report.Retrying > 0 {
+		fmt.Printf("%d notifications wait for a retry\n", report.Retrying)
+	}
+	if report.Failed > 0 {
+		fmt.Printf("Gave up on %d notifications, see \"mini-s3 notification retry\"\n", report.Failed)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(notificationCmd)
+	notificationCmd.AddCommand(notificationPutCmd, notificationGetCmd, notificationDeleteCmd,
+		notificationDeliverCmd, notificationStatusCmd, notificationRetryCmd)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestNotificationCommands(t *testing.T) {
+	tmpDir := t.TempDir()
+	local := storage.NewLocalStorage(tmpDir, storage.NewValueChecksum())
+	sink := filepath.Join(tmpDir, "events.jsonl")
+
+	configPath := filepath.Join(tmpDir, "notification.json")
+	config := `{"Rules": [{"Id": "indexer", "Destination": "file://` + sink + `", "Events": ["s3:ObjectCreated:*"]}]}`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		storage        storage.Storage
+		run            func()
+		expectedOutput string
+	}{
+		{
+			name:           "unsupported backend",
+			storage:        &mockStorageForTesting{},
+			run:            func() { notificationStatusCmd.Run(notificationStatusCmd, []string{}) },
+			expectedOutput: "Event notifications are not supported by this storage backend",
+		},
+		{
+			name:           "put rules",
+			storage:        local,
+			run:            func() { notificationPutCmd.Run(notificationPutCmd, []string{"uploads", configPath}) },
+			expectedOutput: "Set 1 notification rules on bucket uploads",
+		},
+		{
+			name:           "get rules",
+			storage:        local,
+			run:            func() { notificationGetCmd.Run(notificationGetCmd, []string{"uploads"}) },
+			expectedOutput: `"Destination": "file://` + sink + `"`,
+		},
+		{
+			name:    "status counts queued events",
+			storage: local,
+			run: func() {
+				if _, err := local.Save("uploads", "a.csv", strings.NewReader("a")); err != nil {
+					t.Fatalf("Failed to save file: %v", err)
+				}
+				notificationStatusCmd.Run(notificationStatusCmd, []string{})
+			},
+			expectedOutput: "Pending: 1",
+		},
+		{
+			name:           "deliver sends queued events",
+			storage:        local,
+			run:            func() { notificationDeliverCmd.Run(notificationDeliverCmd, []string{}) },
+			expectedOutput: "Delivered 1 notifications",
+		},
+		{
+			name:           "delete rules",
+			storage:        local,
+			run:            func() { notificationDeleteCmd.Run(notificationDeleteCmd, []string{"uploads"}) },
+			expectedOutput: "Notification rules removed from bucket uploads",
+		},
+		{
+			name:           "missing arguments",
+			storage:        local,
+			run:            func() { notificationPutCmd.Run(notificationPutCmd, []string{"uploads"}) },
+			expectedOutput: "Usage: mini-s3 notification put <bucket-name> <config-file>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := withMockStorage(tt.storage)
+			defer cleanup()
+
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			tt.run()
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			if !strings.Contains(output, tt.expectedOutput) {
+				t.Errorf("expected output to contain '%s', got '%s'", tt.expectedOutput, output)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(sink)
+	if err != nil || !strings.Contains(string(data), `"key":"a.csv"`) {
+		t.Errorf("Expected the event in the sink, got '%s' %v", data, err)
+	}
+}
@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type objectLocker interface {
+	PutObjectLockConfiguration(bucket string, cfg *storage.ObjectLockConfiguration) error
+	GetObjectLockConfiguration(bucket string) (*storage.ObjectLockConfiguration, error)
+	PutObjectRetention(bucket, object string, retention *storage.Retention, opts ...storage.Option) error
+	GetObjectRetention(bucket, object string) (*storage.Retention, error)
+	PutObjectLegalHold(bucket, object string, on bool) error
+	GetObjectLegalHold(bucket, object string) (bool, error)
+}
+
+// objectLockCmd represents the object-lock command
+var objectLockCmd = &cobra.Command{
+	Use:   "object-lock",
+	Short: "Manage write-once (WORM) protection of objects",
+	Long: `Manage object lock, which protects objects from being overwritten or
+deleted.
+
+Once enabled on a bucket, object lock cannot be disabled. Objects can be
+retained until a date, in GOVERNANCE mode, which --bypass-governance
+overrides, or in COMPLIANCE mode, which nothing overrides. A legal hold
+protects an object until it is lifted, whatever its retention.
+
+Example usage:
+  mini-s3 object-lock enable <bucket-name> --mode COMPLIANCE --days 365
+  mini-s3 object-lock get <bucket-name>
+  mini-s3 object-lock retain <bucket-name> <object-name> --mode GOVERNANCE --days 30
+  mini-s3 object-lock hold <bucket-name> <object-name> on
+  mini-s3 object-lock status <bucket-name> <object-name>`,
+}
+
+var objectLockEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Enable object lock on a bucket, optionally with a default retention",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 object-lock enable <bucket-name> [--mode <mode> --days <days> | --years <years>]")
+			return
+		}
+
+		locker, ok := storageInstance.(objectLocker)
+		if !ok {
+			fmt.Println("Object lock is not supported by this storage backend")
+			return
+		}
+
+		cfg := &storage.ObjectLockConfiguration{ObjectLockEnabled: storage.ObjectLockEnabled}
+		mode, _ := cmd.Flags().GetString("mode")
+		days, _ := cmd.Flags().GetInt("days")
+		years, _ := cmd.Flags().GetInt("years")
+		if mode != "" || days != 0 || years != 0 {
+			cfg.Rule = &storage.ObjectLockRule{DefaultRetention: storage.DefaultRetention{Mode: mode, Days: days, Years: years}}
+		}
+
+		if err := locker.PutObjectLockConfiguration(args[0], cfg); err != nil {
+			fmt.Printf("Failed to enable object lock: %v\n", err)
+			return
+		}
+		if cfg.Rule == nil {
+			fmt.Printf("Enabled object lock on bucket %s\n", args[0])
+			return
+		}
+		fmt.Printf("Enabled object lock on bucket %s, retaining new objects in %s mode for %s\n", args[0], mode, retentionPeriod(days, years))
+	},
+}
+
+var objectLockGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Show the object lock configuration of a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 object-lock get <bucket-name>")
+			return
+		}
+
+		locker, ok := storageInstance.(objectLocker)
+		if !ok {
+			fmt.Println("Object lock is not supported by this storage backend")
+			return
+		}
+
+		cfg, err := locker.GetObjectLockConfiguration(args[0])
+		if err != nil {
+			fmt.Printf("Failed to get object lock configuration: %v\n", err)
+			return
+		}
+		if cfg == nil {
+			fmt.Printf("Object lock is not enabled on bucket %s\n", args[0])
+			return
+		}
+		data, _ := json.MarshalIndent(cfg, "", "  ")
+		fmt.Println(string(data))
+	},
+}
+
+var objectLockRetainCmd = &cobra.Command{
+	Use:   "retain",
+	Short: "Set, extend or remove the retention of an object",
+	Long: `Set, extend or remove the retention of an object.
+
+The retention ends on the date given with --until (RFC 3339), or after
+--days days. --clear removes it. Shortening or removing a GOVERNANCE
+retention needs --bypass-governance; a COMPLIANCE retention can only be
+extended.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 object-lock retain <bucket-name> <object-name> --mode <mode> (--until <date> | --days <days>)")
+			return
+		}
+
+		locker, ok := storageInstance.(objectLocker)
+		if !ok {
+			fmt.Println("Object lock is not supported by this storage backend")
+			return
+		}
+
+		var retention *storage.Retention
+		if clear, _ := cmd.Flags().GetBool("clear"); !clear {
+			mode, _ := cmd.Flags().GetString("mode")
+			until, err := retainUntil(cmd)
+			if err != nil {
+				fmt.Printf("Invalid retention: %v\n", err)
+				return
+			}
+			retention = &storage.Retention{Mode: mode, RetainUntilDate: until}
+		}
+
+		var opts []storage.Option
+		if bypass, _ := cmd.Flags().GetBool("bypass-governance"); bypass {
+			opts = append(opts, storage.WithBypassGovernanceRetention())
+		}
+
+		if err := locker.PutObjectRetention(args[0], args[1], retention, opts...); err != nil {
+			fmt.Printf("Failed to set retention: %v\n", err)
+			return
+		}
+		if retention == nil {
+			fmt.Printf("Removed the retention of %s/%s\n", args[0], args[1])
+			return
+		}
+		fmt.Printf("Retained %s/%s in %s mode until %s\n", args[0], args[1], retention.Mode, formatLockDate(retention.RetainUntilDate))
+	},
+}
+
+// retainUntil reads the end of a retention from --until or --days.
+func retainUntil(cmd *cobra.Command) (time.Time, error) {
+	until, _ := cmd.Flags().GetString("until")
+	days, _ := cmd.Flags().GetInt("days")
+	if (until == "") == (days == 0) {
+		return time.Time{}, fmt.Errorf("exactly one of --until and --days is required")
+	}
+	if days != 0 {
+		return time.Now().AddDate(0, 0, days), nil
+	}
+	return time.Parse(time.RFC3339, until)
+}
+
+var objectLockHoldCmd = &cobra.Command{
+	Use:   "hold",
+	Short: "Place or lift a legal hold on an object",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 3 || (args[2] != "on" && args[2] != "off") {
+			fmt.Println("Usage: mini-s3 object-lock hold <bucket-name> <object-name> on|off")
+			return
+		}
+
+		locker, ok := storageInstance.(objectLocker)
+		if !ok {
+			fmt.Println("Object lock is not supported by this storage backend")
+			return
+		}
+
+		on := args[2] == "on"
+		if err := locker.PutObjectLegalHold(args[0], args[1], on); err != nil {
+			fmt.Printf("Failed to set legal hold: %v\n", err)
+			return
+		}
+		if on {
+			fmt.Printf("Placed %s/%s under legal hold\n", args[0], args[1])
+		} else {
+			fmt.Printf("Lifted the legal hold on %s/%s\n", args[0], args[1])
+		}
+	},
+}
+
+var objectLockStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the retention and legal hold of an object",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 object-lock status <bucket-name> <object-name>")
+			return
+		}
+
+		locker, ok := storageInstance.(objectLocker)
+		if !ok {
+			fmt.Println("Object lock is not supported by this storage backend")
+			return
+		}
+
+		retention, err := locker.GetObjectRetention(args[0], args[1])
+		if err != nil {
+			fmt.Printf("Failed to get retention: %v\n", err)
+			return
+		}
+		hold, err := locker.GetObjectLegalHold(args[0], args[1])
+		if err != nil {
+			fmt.Printf("Failed to get legal hold: %v\n", err)
+			return
+		}
+
+		switch {
+		case retention == nil:
+			fmt.Println("Retention:  none")
+		case time.Now().Before(retention.RetainUntilDate):
+			fmt.Printf("Retention:  %s until %s\n", retention.Mode, formatLockDate(retention.RetainUntilDate))
+		default:
+			fmt.Printf("Retention:  %s, expired %s\n", retention.Mode, formatLockDate(retention.RetainUntilDate))
+		}
+		if hold {
+			fmt.Println("Legal hold: on")
+		} else {
+			fmt.Println("Legal hold: off")
+		}
+	},
+}
+
+func formatLockDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05 MST")
+}
+
+func retentionPeriod(days, years int) string {
+	if years == 1 {
+		return "1 year"
+	}
+	if years > 1 {
+		return fmt.Sprintf("%d years", years)
+	}
+	if days == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+// objectLockOptions turns the object lock flags of put into storage
+// options.
+func objectLockOptions(cmd *cobra.Command) ([]storage.Option, error) {
+	var opts []storage.Option
+
+	mode, _ := cmd.Flags().GetString("object-lock-mode")
+	until, _ := cmd.Flags().GetString("object-lock-retain-until-date")
+	if (mode == "") != (until == "") {
+		return nil, fmt.Errorf("--object-lock-mode and --object-lock-retain-until-date go together")
+	}
+	if mode != "" {
+		date, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, storage.WithRetention(mode, date))
+	}
+	if hold, _ := cmd.Flags().GetBool("object-lock-legal-hold"); hold {
+		opts = append(opts, storage.WithLegalHold())
+	}
+	if bypass, _ := cmd.Flags().GetBool("bypass-governance"); bypass {
+		opts = append(opts, storage.WithBypassGovernanceRetention())
+	}
+	return opts, nil
+}
+
+func addObjectLockFlags(cmd *cobra.Command) {
+	cmd.Flags().String("object-lock-mode", "", "retain the object in GOVERNANCE or COMPLIANCE mode")
+	cmd.Flags().String("object-lock-retain-until-date", "", "date the retention ends (RFC 3339)")
+	cmd.Flags().Bool("object-lock-legal-hold", false, "place the object under legal hold")
+	cmd.Flags().Bool("bypass-governance", false, "overwrite the object despite GOVERNANCE retention")
+}
+
+func init() {
+	rootCmd.AddCommand(objectLockCmd)
+	objectLockCmd.AddCommand(objectLockEnableCmd, objectLockGetCmd, objectLockRetainCmd, objectLockHoldCmd, objectLockStatusCmd)
+
+	objectLockEnableCmd.Flags().String("mode", "", "default retention mode for new objects (GOVERNANCE or COMPLIANCE)")
+	objectLockEnableCmd.Flags().Int("days", 0, "default retention period in days")
+	objectLockEnableCmd.Flags().Int("years", 0, "default retention period in years")
+
+	objectLockRetainCmd.Flags().String("mode", storage.RetentionModeGovernance, "retention mode (GOVERNANCE or COMPLIANCE)")
+	objectLockRetainCmd.Flags().String("until", "", "date the retention ends (RFC 3339)")
+	objectLockRetainCmd.Flags().Int("days", 0, "retain for this many days from now")
+	objectLockRetainCmd.Flags().Bool("clear", false, "remove the retention")
+	objectLockRetainCmd.Flags().Bool("bypass-governance", false, "allow shortening or removing a GOVERNANCE retention")
+}
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/iamthiago/mini-s3/internal/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -15,7 +17,14 @@ var putCmd = &cobra.Command{
 	Long: `Add objects to the specified bucket.
 
 Example usage:
-  mini-s3 put <bucket-name> <object-name>`,
+  mini-s3 put <bucket-name> <object-name>
+  mini-s3 put <bucket-name> <object-name> --sse-c-key <key>
+  mini-s3 put <bucket-name> <object-name> --storage-class COLD
+  mini-s3 put <bucket-name> <object-name> --tag team=data --tag sensitivity=high
+  mini-s3 put <bucket-name> <object-name> --content-type text/csv --meta source=crm
+  mini-s3 put <bucket-name> <object-name> --if-none-match '*'
+  mini-s3 put <bucket-name> <object-name> --if-match <etag>
+  mini-s3 put <bucket-name> <object-name> --object-lock-mode COMPLIANCE --object-lock-retain-until-date 2030-01-01T00:00:00Z`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) < 2 {
 			fmt.Println("Usage: mini-s3 put <bucket-name> <object-name>")
@@ -25,6 +34,51 @@ Example usage:
 		bucket := args[0]
 		object := args[1]
 
+		opts, err := sseCustomerKeyOptions(cmd)
+		if err != nil {
+			fmt.Printf("Invalid SSE-C key: %v\n", err)
+			return
+		}
+
+		if class, _ := cmd.Flags().GetString("storage-class"); class != "" {
+			opts = append(opts, storage.WithStorageClass(class))
+		}
+
+		lockOpts, err := objectLockOptions(cmd)
+		if err != nil {
+			fmt.Printf("Invalid object lock settings: %v\n", err)
+			return
+		}
+		opts = append(opts, lockOpts...)
+
+		if values, _ := cmd.Flags().GetStringArray("tag"); len(values) > 0 {
+			tags, err := parseKeyValues(values)
+			if err != nil {
+				fmt.Printf("Invalid tags: %v\n", err)
+				return
+			}
+			opts = append(opts, storage.WithTags(tags))
+		}
+
+		if contentType, _ := cmd.Flags().GetString("content-type"); contentType != "" {
+			opts = append(opts, storage.WithContentType(contentType))
+		}
+		if values, _ := cmd.Flags().GetStringArray("meta"); len(values) > 0 {
+			metadata, err := parseKeyValues(values)
+			if err != nil {
+				fmt.Printf("Invalid metadata: %v\n", err)
+				return
+			}
+			opts = append(opts, storage.WithUserMetadata(metadata))
+		}
+
+		conditionOpts, err := conditionOptions(cmd)
+		if err != nil {
+			fmt.Printf("Invalid condition: %v\n", err)
+			return
+		}
+		opts = append(opts, conditionOpts...)
+
 		file, err := os.Open(object)
 		if err != nil {
 			fmt.Printf("Failed to open file: %v\n", err)
@@ -34,7 +88,11 @@ Example usage:
 
 		objectName := filepath.Base(object)
 
-		_, err = storageInstance.Save(bucket, objectName, file)
+		_, err = storageInstance.Save(bucket, objectName, file, opts...)
+		if errors.Is(err, storage.ErrPreconditionFailed) {
+			fmt.Printf("Not saved: %s in bucket %s does not meet the given conditions\n", objectName, bucket)
+			return
+		}
 		if err != nil {
 			fmt.Printf("Failed to save file: %v\n", err)
 			return
@@ -45,4 +103,12 @@ Example usage:
 
 func init() {
 	rootCmd.AddCommand(putCmd)
+
+	addSSECustomerKeyFlag(putCmd)
+	addObjectLockFlags(putCmd)
+	addConditionFlags(putCmd, false)
+	putCmd.Flags().String("content-type", "", "MIME type of the object, detected from its name or content when not given")
+	putCmd.Flags().StringArray("meta", nil, "user-defined metadata, as key=value (repeatable)")
+	putCmd.Flags().StringArray("tag", nil, "tag to attach to the object, as key=value (repeatable)")
+	putCmd.Flags().String("storage-class", "", "storage class to keep the object in (STANDARD, COLD or ARCHIVE)")
 }
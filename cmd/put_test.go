@@ -30,7 +30,7 @@ func TestPutCommand(t *testing.T) {
 			args: []string{"test-bucket", testFile},
 			setupStorage: func() *mockStorageForTesting {
 				return &mockStorageForTesting{
-					saveFunc: func(bucket, object string, reader io.Reader) (*storage.ObjectInfo, error) {
+					saveFunc: func(bucket, object string, reader io.Reader, opts ...storage.Option) (*storage.ObjectInfo, error) {
 						if bucket != "test-bucket" {
 							t.Errorf("expected bucket 'test-bucket', got '%s'", bucket)
 						}
@@ -111,3 +111,75 @@ func TestPutCommandHasRequiredFields(t *testing.T) {
 		t.Error("putCmd.Short should not be empty")
 	}
 }
+
+func TestPutCommandSSECustomerKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	key := "0123456789abcdef0123456789abcdef"
+	var gotKey []byte
+	cleanup := withMockStorage(&mockStorageForTesting{
+		saveFunc: func(bucket, object string, reader io.Reader, opts ...storage.Option) (*storage.ObjectInfo, error) {
+			gotKey = storage.NewOptions(opts...).SSECustomerKey
+			return &storage.ObjectInfo{}, nil
+		},
+	})
+	defer cleanup()
+
+	if err := putCmd.Flags().Set(sseCustomerKeyFlag, key); err != nil {
+		t.Fatalf("Failed to set flag: %v", err)
+	}
+	defer func() { _ = putCmd.Flags().Set(sseCustomerKeyFlag, "") }()
+
+	putCmd.Run(putCmd, []string{"test-bucket", testFile})
+
+	if string(gotKey) != key {
+		t.Errorf("expected key '%s' to reach storage, got '%s'", key, gotKey)
+	}
+}
+
+func TestPutCommandConditions(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "app.json")
+	if err := os.WriteFile(testFile, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var got *storage.Conditions
+	cleanup := withMockStorage(&mockStorageForTesting{
+		saveFunc: func(bucket, object string, reader io.Reader, opts ...storage.Option) (*storage.ObjectInfo, error) {
+			got = storage.NewOptions(opts...).Conditions
+			return nil, storage.ErrPreconditionFailed
+		},
+	})
+	defer cleanup()
+
+	if err := putCmd.Flags().Set("if-match", "abc"); err != nil {
+		t.Fatalf("Failed to set flag: %v", err)
+	}
+	defer func() { _ = putCmd.Flags().Set("if-match", "") }()
+
+	// Capture output
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	putCmd.Run(putCmd, []string{"config", testFile})
+
+	// Restore stdout and read output
+	_ = w.Close()
+	os.Stdout = old
+	var buf bytes.Buffer
+	_, _ = io.Copy(&buf, r)
+	output := buf.String()
+
+	if got == nil || got.IfMatch != "abc" {
+		t.Errorf("expected If-Match 'abc' to reach storage, got %+v", got)
+	}
+	if !bytes.Contains([]byte(output), []byte("Not saved: app.json in bucket config does not meet the given conditions")) {
+		t.Errorf("unexpected output '%s'", output)
+	}
+}
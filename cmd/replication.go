@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type replicationManager interface {
+	PutBucketReplication(bucket string, cfg *storage.ReplicationConfiguration) error
+	GetBucketReplication(bucket string) (*storage.ReplicationConfiguration, error)
+	DeleteBucketReplication(bucket string) error
+	ReplicateObjects(ctx context.Context, now time.Time) (*storage.ReplicationReport, error)
+	GetReplicationBacklog() (*storage.ReplicationBacklog, error)
+	RetryFailedReplication() (int, error)
+}
+
+// replicationCmd represents the replication command
+var replicationCmd = &cobra.Command{
+	Use:   "replication",
+	Short: "Manage replication of a bucket to another bucket",
+	Long: `Manage replication of a bucket to another bucket.
+
+Rules copy the objects written to a bucket, optionally filtered by key
+prefix and tags, along with their metadata and tags, to a destination
+bucket, and delete them there when they are deleted if DeleteReplication
+is enabled. The destination bucket lives in:
+
+  (no endpoint)                    this data directory
+  file:///path/to/data             another data directory
+  http://host:9000                 a remote mini-s3, see "mini-s3 serve"
+
+Changes are queued durably and replicated by "mini-s3 serve", or once by
+"mini-s3 replication run", retrying failures with exponential backoff.
+"mini-s3 head" shows each object's replication status.
+
+Example usage:
+  mini-s3 replication put <bucket-name> replication.json
+  mini-s3 replication get <bucket-name>
+  mini-s3 replication delete <bucket-name>
+  mini-s3 replication run
+  mini-s3 replication status
+  mini-s3 replication retry`,
+}
+
+var replicationPutCmd = &cobra.Command{
+	Use:   "put",
+	Short: "Set the replication rules of a bucket from an XML or JSON file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 replication put <bucket-name> <config-file>")
+			return
+		}
+
+		manager, ok := storageInstance.(replicationManager)
+		if !ok {
+			fmt.Println("Replication is not supported by this storage backend")
+			return
+		}
+
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			fmt.Printf("Failed to read replication configuration: %v\n", err)
+			return
+		}
+		cfg, err := storage.ParseReplicationConfiguration(data)
+		if err != nil {
+			fmt.Printf("Failed to parse replication configuration: %v\n", err)
+			return
+		}
+		if err := manager.PutBucketReplication(args[0], cfg); err != nil {
+			fmt.Printf("Failed to set replication rules: %v\n", err)
+			return
+		}
+		fmt.Printf("Set %d replication rules on bucket %s\n", len(cfg.Rules), args[0])
+	},
+}
+
+var replicationGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Show the replication rules of a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 replication get <bucket-name>")
+			return
+		}
+
+		manager, ok := storageInstance.(replicationManager)
+		if !ok {
+			fmt.Println("Replication is not supported by this storage backend")
+			return
+		}
+
+		cfg, err := manager.GetBucketReplication(args[0])
+		if err != nil {
+			fmt.Printf("Failed to get replication rules: %v\n", err)
+			return
+		}
+		if cfg == nil {
+			fmt.Printf("Bucket %s has no replication rules\n", args[0])
+			return
+		}
+		data, _ := json.MarshalIndent(cfg, "", "  ")
+		fmt.Println(string(data))
+	},
+}
+
+var replicationDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Remove the replication rules of a bucket",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 replication delete <bucket-name>")
+			return
+		}
+
+		manager, ok := storageInstance.(replicationManager)
+		if !ok {
+			fmt.Println("Replication is not supported by this storage backend")
+			return
+		}
+
+		if err := manager.DeleteBucketReplication(args[0]); err != nil {
+			fmt.Printf("Failed to remove replication rules: %v\n", err)
+			return
+		}
+		fmt.Printf("Replication rules removed from bucket %s\n", args[0])
+	},
+}
+
+var replicationRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Replicate the queued changes that are due now",
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, ok := storageInstance.(replicationManager)
+		if !ok {
+			fmt.Println("Replication is not supported by this storage backend")
+			return
+		}
+
+		report, err := manager.ReplicateObjects(context.Background(), time.Now())
+		if err != nil {
+			fmt.Printf("Failed to replicate: %v\n", err)
+			return
+		}
+		printReplicationReport(report)
+	},
+}
+
+var replicationStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show how many changes wait to be replicated or failed",
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, ok := storageInstance.(replicationManager)
+		if !ok {
+			fmt.Println("Replication is not supported by this storage backend")
+			return
+		}
+
+		backlog, err := manager.GetReplicationBacklog()
+		if err != nil {
+			fmt.Printf("Failed to get replication status: %v\n", err)
+			return
+		}
+		fmt.Printf("Pending: %d\n", backlog.Pending)
+		fmt.Printf("Failed:  %d\n", backlog.Failed)
+	},
+}
+
+var replicationRetryCmd = &cobra.Command{
+	Use:   "retry",
+	Short: "Queue the changes given up on again",
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, ok := storageInstance.(replicationManager)
+		if !ok {
+			fmt.Println("Replication is not supported by this storage backend")
+			return
+		}
+
+		n, err := manager.RetryFailedReplication()
+		if err != nil {
+			fmt.Printf("Failed to queue changes again: %v\n", err)
+			return
+		}
+		fmt.Printf("Queued %d failed changes again\n", n)
+	},
+}
+
+func printReplicationReport(report *storage.ReplicationReport) {
+	fmt.Printf("Replicated %d changes\n", report.Replicated)
+	if report.Retrying > 0 {
+		fmt.Printf("%d changes wait for a retry\n", report.Retrying)
+	}
+	if report.Failed > 0 {
+		fmt.Printf("Gave up on %d changes, see \"mini-s3 replication retry\"\n", report.Failed)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(replicationCmd)
+	replicationCmd.AddCommand(replicationPutCmd, replicationGetCmd, replicationDeleteCmd,
+		replicationRunCmd, replicationStatusCmd, replicationRetryCmd)
+}
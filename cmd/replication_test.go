@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestReplicationCommands(t *testing.T) {
+	tmpDir := t.TempDir()
+	local := storage.NewLocalStorage(tmpDir, storage.NewValueChecksum())
+
+	configPath := filepath.Join(tmpDir, "replication.json")
+	config := `{"Rules": [{"ID": "backup", "Status": "Enabled", "Filter": {"Prefix": "reports/"}, "Destination": {"Bucket": "backup"}}]}`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		storage        storage.Storage
+		run            func()
+		expectedOutput string
+	}{
+		{
+			name:           "unsupported backend",
+			storage:        &mockStorageForTesting{},
+			run:            func() { replicationStatusCmd.Run(replicationStatusCmd, []string{}) },
+			expectedOutput: "Replication is not supported by this storage backend",
+		},
+		{
+			name:           "put rules",
+			storage:        local,
+			run:            func() { replicationPutCmd.Run(replicationPutCmd, []string{"data", configPath}) },
+			expectedOutput: "Set 1 replication rules on bucket data",
+		},
+		{
+			name:           "get rules",
+			storage:        local,
+			run:            func() { replicationGetCmd.Run(replicationGetCmd, []string{"data"}) },
+			expectedOutput: `"Bucket": "backup"`,
+		},
+		{
+			name:           "rejects replicating a bucket to itself",
+			storage:        local,
+			run:            func() { replicationPutCmd.Run(replicationPutCmd, []string{"backup", configPath}) },
+			expectedOutput: "Failed to set replication rules: invalid replication rule \"backup\": a bucket cannot be replicated to itself",
+		},
+		{
+			name:    "status counts queued changes",
+			storage: local,
+			run: func() {
+				if _, err := local.Save("data", "reports/q1.csv", strings.NewReader("a")); err != nil {
+					t.Fatalf("Failed to save file: %v", err)
+				}
+				replicationStatusCmd.Run(replicationStatusCmd, []string{})
+			},
+			expectedOutput: "Pending: 1",
+		},
+		{
+			name:           "run replicates queued changes",
+			storage:        local,
+			run:            func() { replicationRunCmd.Run(replicationRunCmd, []string{}) },
+			expectedOutput: "Replicated 1 changes",
+		},
+		{
+			name:           "head shows the replication status",
+			storage:        local,
+			run:            func() { headCmd.Run(headCmd, []string{"data", "reports/q1.csv"}) },
+			expectedOutput: "Replication:         COMPLETED",
+		},
+		{
+			name:           "retry with nothing failed",
+			storage:        local,
+			run:            func() { replicationRetryCmd.Run(replicationRetryCmd, []string{}) },
+			expectedOutput: "Queued 0 failed changes again",
+		},
+		{
+			name:           "delete rules",
+			storage:        local,
+			run:            func() { replicationDeleteCmd.Run(replicationDeleteCmd, []string{"data"}) },
+			expectedOutput: "Replication rules removed from bucket data",
+		},
+		{
+			name:           "get without rules",
+			storage:        local,
+			run:            func() { replicationGetCmd.Run(replicationGetCmd, []string{"data"}) },
+			expectedOutput: "Bucket data has no replication rules",
+		},
+		{
+			name:           "missing arguments",
+			storage:        local,
+			run:            func() { replicationPutCmd.Run(replicationPutCmd, []string{"data"}) },
+			expectedOutput: "Usage: mini-s3 replication put <bucket-name> <config-file>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := withMockStorage(tt.storage)
+			defer cleanup()
+
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			tt.run()
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			if !strings.Contains(output, tt.expectedOutput) {
+				t.Errorf("expected output to contain '%s', got '%s'", tt.expectedOutput, output)
+			}
+		})
+	}
+
+	if exists, _ := local.Exists("backup", "reports/q1.csv"); !exists {
+		t.Error("Expected the object to be replicated")
+	}
+}
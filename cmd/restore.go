@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type objectRestorer interface {
+	RestoreObject(bucket, object string, days int) (*storage.ObjectInfo, error)
+}
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Make an archived object readable for a number of days",
+	Long: `Make an object in the ARCHIVE storage class readable for a number of days.
+
+Archived objects cannot be read directly. Restoring one copies it out of
+its archive pack; the copy is deleted once it expires, at midnight UTC
+after the given number of days. Restoring again moves the expiry.
+
+Example usage:
+  mini-s3 restore <bucket-name> <object-name> --days 7`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 restore <bucket-name> <object-name>")
+			return
+		}
+
+		restorer, ok := storageInstance.(objectRestorer)
+		if !ok {
+			fmt.Println("Restoring objects is not supported by this storage backend")
+			return
+		}
+
+		days, _ := cmd.Flags().GetInt("days")
+		info, err := restorer.RestoreObject(args[0], args[1], days)
+		if err != nil {
+			fmt.Printf("Failed to restore object: %v\n", err)
+			return
+		}
+		fmt.Printf("Restored %s/%s until %s\n", args[0], args[1], info.RestoreExpiresAt.UTC().Format("2006-01-02 15:04:05 MST"))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	restoreCmd.Flags().Int("days", 1, "how many days the restored copy stays readable")
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/iamthiago/mini-s3/internal/client"
+	"github.com/iamthiago/mini-s3/internal/erasure"
 	"github.com/iamthiago/mini-s3/internal/storage"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -86,7 +89,8 @@ data-dir: ./data
 	}
 }
 
-func initStorage() {
+// resolveDataDir returns the data directory to use.
+func resolveDataDir() string {
 	// Priority: CLI flag > config file > default
 	rootDir := dataDir
 	if rootDir == "" {
@@ -95,6 +99,80 @@ func initStorage() {
 	if rootDir == "" {
 		rootDir = "./data" // default
 	}
+	return rootDir
+}
+
+// loadKeyring loads the keyring configured with keyring-file, or the
+// default one, refusing those kept inside the data directory.
+func loadKeyring(rootDir string) (*storage.Keyring, error) {
+	path := viper.GetString("keyring-file")
+	if path == "" {
+		var err error
+		if path, err = storage.DefaultKeyringPath(); err != nil {
+			return nil, fmt.Errorf("no default location, set keyring-file: %w", err)
+		}
+		// Keyrings used to be kept in the data directory by default
+		legacy := storage.LegacyKeyringPath(rootDir)
+		if _, err := os.Stat(legacy); err == nil {
+			return nil, fmt.Errorf("the keyring %s must be kept outside the data directory, move it to %s or set keyring-file", legacy, path)
+		}
+	}
+	if err := storage.ValidateKeyringPath(rootDir, path); err != nil {
+		return nil, err
+	}
+	return storage.LoadKeyring(path)
+}
+
+func initStorage() {
+	rootDir := resolveDataDir()
+
+	opts := []storage.LocalStorageOption{storage.WithRemoteStorage(client.Open)}
+	keyring, err := loadKeyring(rootDir)
+	if err != nil {
+		// Running without it would store new objects unencrypted
+		fmt.Printf("Failed to load keyring: %v\n", err)
+		os.Exit(1)
+	}
+	opts = append(opts, storage.WithKeyring(keyring))
+
+	for _, class := range []string{storage.StorageClassCold, storage.StorageClassArchive} {
+		if dir := viper.GetString("storage-classes." + strings.ToLower(class)); dir != "" {
+			opts = append(opts, storage.WithStorageClassRoot(class, dir))
+		}
+	}
+
+	switch dedup := viper.GetString("dedup"); dedup {
+	case "", "false":
+	case "chunk":
+		opts = append(opts, storage.WithChunkedDeduplication())
+	case "true", "object":
+		opts = append(opts, storage.WithDeduplication())
+	default:
+		fmt.Printf("Unknown dedup mode %q, deduplication is disabled\n", dedup)
+	}
+
+	if disks := viper.GetStringSlice("disks"); len(disks) > 0 {
+		placement := viper.GetString("disk-placement")
+		switch placement {
+		case "", storage.PlacementHash, storage.PlacementFreeSpace:
+		default:
+			fmt.Printf("Unknown disk placement %q, objects are placed by hash\n", placement)
+			placement = storage.PlacementHash
+		}
+		// Erasure coding, set after, spreads its shards over these disks
+		opts = append(opts, storage.WithDisks(placement, disks...))
+	}
+
+	if data, parity := viper.GetInt("erasure.data"), viper.GetInt("erasure.parity"); data > 0 || parity > 0 {
+		coder, err := erasure.New(data, parity)
+		if err != nil {
+			fmt.Printf("Invalid erasure coding, objects are stored as plain files: %v\n", err)
+		} else {
+			// Object data goes to one backend, so erasure coding replaces
+			// deduplication
+			opts = append(opts, storage.WithErasureCoding(coder, viper.GetStringSlice("erasure.disks")...))
+		}
+	}
 
-	storageInstance = storage.NewLocalStorage(rootDir, storage.NewValueChecksum())
+	storageInstance = storage.NewLocalStorage(rootDir, storage.NewValueChecksum(), opts...)
 }
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestRotateKeysCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyring, err := storage.LoadKeyring(filepath.Join(t.TempDir(), "keyring.json"))
+	if err != nil {
+		t.Fatalf("Failed to load keyring: %v", err)
+	}
+	local := storage.NewLocalStorage(tmpDir, storage.NewValueChecksum(), storage.WithKeyring(keyring))
+
+	tests := []struct {
+		name           string
+		storage        storage.Storage
+		setup          func()
+		expectedOutput string
+	}{
+		{
+			name:           "unsupported backend",
+			storage:        &mockStorageForTesting{},
+			expectedOutput: "Key rotation is not supported by this storage backend",
+		},
+		{
+			name:           "first run creates the keyring",
+			storage:        local,
+			expectedOutput: "Rotation to key version 1 completed",
+		},
+		{
+			name:    "second run rewraps existing objects",
+			storage: local,
+			setup: func() {
+				if _, err := local.Save("bucket", "file.txt", strings.NewReader("content")); err != nil {
+					t.Fatalf("Failed to save file: %v", err)
+				}
+			},
+			expectedOutput: "Rotation to key version 2 completed: 1 rewrapped, 0 failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := withMockStorage(tt.storage)
+			defer cleanup()
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			rotateKeysCmd.Run(rotateKeysCmd, []string{})
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			if !bytes.Contains([]byte(output), []byte(tt.expectedOutput)) {
+				t.Errorf("expected output to contain '%s', got '%s'", tt.expectedOutput, output)
+			}
+		})
+	}
+}
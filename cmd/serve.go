@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/cluster"
+	"github.com/iamthiago/mini-s3/internal/handoff"
+	"github.com/iamthiago/mini-s3/internal/ring"
+	"github.com/iamthiago/mini-s3/internal/server"
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddr         string
+	lifecycleInterval time.Duration
+	nodeID            string
+	clusterPeers      map[string]string
+	replicationFactor int
+	repairInterval    time.Duration
+	hintTTL           time.Duration
+	rebalanceRate     int64
+	advertiseAddr     string
+	zone              string
+	capacity          int64
+
+	allowGovernanceBypass bool
+)
+
+type lifecycleRunner interface {
+	RunLifecycle(ctx context.Context, interval time.Duration, report func(*storage.LifecycleReport, error))
+}
+
+type notificationRunner interface {
+	RunNotifications(ctx context.Context, interval time.Duration, report func(*storage.NotificationReport, error))
+}
+
+type replicationRunner interface {
+	RunReplication(ctx context.Context, interval time.Duration, report func(*storage.ReplicationReport, error))
+}
+
+type diskChecker interface {
+	RunDiskCheck(ctx context.Context, interval time.Duration, report func(storage.DiskStatus))
+}
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the data directory over the S3 HTTP API",
+	Long: `Serve the data directory over a path-style subset of the S3 HTTP API.
+
+While serving, bucket lifecycle rules are applied in the background every
+--lifecycle-interval (0 disables them), and queued event notifications
+and replication are delivered as they come. When object data is spread
+over several disks, they are checked every 30 seconds: failed disks are
+taken offline, and recovered ones brought back.
+
+With --node-id, the server is a node of a cluster: bucket and object
+metadata is committed through Raft, and every node serves the same
+objects. The data of each object is kept by --replication-factor nodes,
+chosen by consistent hashing, which compare what they hold every
+--repair-interval and repair what differs. Writes a node misses while
+unavailable are kept as hints by another node for up to --hint-ttl, and
+handed off to it once it is back. When nodes join or leave, the leader
+moves object data onto the nodes that keep it now, at most at
+--rebalance-rate bytes per second. The nodes of a new cluster are all
+started with the same --peers, including themselves. A node joining an
+existing cluster is started without, but with the --advertise URL the
+others reach it at, then joined with "mini-s3 cluster join". Nodes gossip
+to tell which of them are down, along with their --zone and --capacity.
+
+Example usage:
+  mini-s3 serve --addr :9000
+  mini-s3 serve --addr :9001 --data-dir ./n1 --node-id n1 \
+    --peers n1=http://127.0.0.1:9001,n2=http://127.0.0.1:9002,n3=http://127.0.0.1:9003
+  mini-s3 serve --addr :9004 --data-dir ./n4 --node-id n4 \
+    --advertise http://127.0.0.1:9004 --zone eu-west-1b --capacity 536870912000`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if runner, ok := storageInstance.(lifecycleRunner); ok && lifecycleInterval > 0 {
+			go runner.RunLifecycle(ctx, lifecycleInterval, func(report *storage.LifecycleReport, err error) {
+				if err != nil {
+					fmt.Printf("Lifecycle run failed: %v\n", err)
+				} else if len(report.Actions) > 0 {
+					fmt.Printf("Lifecycle expired %d objects\n", len(report.Actions))
+				}
+			})
+		}
+
+		if runner, ok := storageInstance.(notificationRunner); ok {
+			go runner.RunNotifications(ctx, time.Second, func(report *storage.NotificationReport, err error) {
+				if err != nil {
+					fmt.Printf("Notification delivery failed: %v\n", err)
+				} else if report.Failed > 0 {
+					fmt.Printf("Gave up on %d notifications\n", report.Failed)
+				}
+			})
+		}
+
+		if runner, ok := storageInstance.(replicationRunner); ok {
+			go runner.RunReplication(ctx, time.Second, func(report *storage.ReplicationReport, err error) {
+				if err != nil {
+					fmt.Printf("Replication failed: %v\n", err)
+				} else if report.Failed > 0 {
+					fmt.Printf("Gave up replicating %d changes\n", report.Failed)
+				}
+			})
+		}
+
+		if checker, ok := storageInstance.(diskChecker); ok {
+			go checker.RunDiskCheck(ctx, 30*time.Second, func(status storage.DiskStatus) {
+				if status.Online {
+					fmt.Printf("Disk %s is back online\n", status.Path)
+				} else {
+					fmt.Printf("Disk %s is offline: %s\n", status.Path, status.Reason)
+				}
+			})
+		}
+
+		newServer := func(s storage.Storage) *server.Server {
+			srv := server.New(s)
+			if allowGovernanceBypass {
+				srv.AllowGovernanceBypass()
+			}
+			return srv
+		}
+
+		var handler http.Handler = newServer(storageInstance)
+		if nodeID != "" {
+			node, err := cluster.New(cluster.Config{
+				ID:                nodeID,
+				Peers:             clusterPeers,
+				Dir:               storage.DefaultRaftDir(resolveDataDir()),
+				Local:             storageInstance,
+				Addr:              advertiseAddr,
+				Zone:              zone,
+				Capacity:          capacity,
+				ReplicationFactor: replicationFactor,
+				HintTTL:           hintTTL,
+				RebalanceRate:     rebalanceRate,
+			})
+			if err != nil {
+				fmt.Printf("Failed to start cluster node: %v\n", err)
+				return
+			}
+			go node.Run(ctx)
+			go node.RunRepair(ctx, repairInterval, func(report *cluster.RepairReport, err error) {
+				if err != nil {
+					fmt.Printf("Cluster repair failed: %v\n", err)
+					return
+				}
+				if report.Repaired > 0 || report.Removed > 0 {
+					fmt.Printf("Cluster repair sent %d copies of objects to peers and removed %d stale ones\n", report.Repaired, report.Removed)
+				}
+				if report.Failed > 0 {
+					fmt.Printf("Cluster repair failed %d times\n", report.Failed)
+				}
+			})
+			go node.RunHandoff(ctx, 10*time.Second, func(report *handoff.Report, err error) {
+				if err != nil {
+					fmt.Printf("Cluster handoff failed: %v\n", err)
+					return
+				}
+				if report.Replayed > 0 {
+					fmt.Printf("Handed off %d hinted writes to nodes that are back\n", report.Replayed)
+				}
+				if report.Expired > 0 {
+					fmt.Printf("Dropped %d expired hints\n", report.Expired)
+				}
+			})
+			go node.RunRebalance(ctx, 10*time.Second, func(status *ring.Rebalance, err error) {
+				if err != nil {
+					fmt.Printf("Cluster rebalance failed: %v\n", err)
+					return
+				}
+				fmt.Printf("Rebalanced %d objects (%d skipped, %d failed) onto the nodes that keep them now\n", status.Moved, status.Skipped, status.Failed)
+			})
+
+			mux := http.NewServeMux()
+			mux.Handle(cluster.PathPrefix+"/", node.Handler())
+			mux.Handle("/", newServer(node))
+			handler = mux
+			fmt.Printf("Running as cluster node %s\n", nodeID)
+		}
+
+		fmt.Printf("Listening on %s\n", serveAddr)
+		err := http.ListenAndServe(serveAddr, handler)
+		if err != nil {
+			fmt.Printf("Server stopped: %v\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":9000", "address to listen on")
+	serveCmd.Flags().BoolVar(&allowGovernanceBypass, "allow-governance-bypass", false, "honour x-amz-bypass-governance-retention; requests are not authenticated, so any client can then bypass GOVERNANCE retention")
+	serveCmd.Flags().DurationVar(&lifecycleInterval, "lifecycle-interval", time.Hour, "how often to apply lifecycle rules")
+	serveCmd.Flags().StringVar(&nodeID, "node-id", "", "run as the cluster node with this ID")
+	serveCmd.Flags().StringToStringVar(&clusterPeers, "peers", nil, "URLs of the nodes of a new cluster, as id=url pairs")
+	serveCmd.Flags().DurationVar(&repairInterval, "repair-interval", time.Minute, "how often cluster nodes compare and repair the data they hold")
+	serveCmd.Flags().DurationVar(&hintTTL, "hint-ttl", handoff.DefaultTTL, "how long cluster nodes keep writes for a node that is away")
+	serveCmd.Flags().Int64Var(&rebalanceRate, "rebalance-rate", cluster.DefaultRebalanceRate, "bytes per second the cluster leader moves to rebalance object data")
+	serveCmd.Flags().StringVar(&advertiseAddr, "advertise", "", "URL other cluster nodes reach this node at (default: its URL in --peers)")
+	serveCmd.Flags().StringVar(&zone, "zone", "", "zone the cluster node runs in, like a rack or availability zone")
+	serveCmd.Flags().Int64Var(&capacity, "capacity", 0, "bytes of object data the cluster node offers")
+	serveCmd.Flags().IntVar(&replicationFactor, "replication-factor", cluster.DefaultReplicationFactor, "how many cluster nodes keep each object's data")
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+const sseCustomerKeyFlag = "sse-c-key"
+
+func addSSECustomerKeyFlag(cmd *cobra.Command) {
+	cmd.Flags().String(sseCustomerKeyFlag, "", "customer-provided 256-bit encryption key (32 raw characters or base64)")
+}
+
+// sseCustomerKeyOptions turns the --sse-c-key flag into storage options. The
+// key is accepted either as 32 raw bytes or base64-encoded, like the AWS CLI.
+func sseCustomerKeyOptions(cmd *cobra.Command) ([]storage.Option, error) {
+	value, _ := cmd.Flags().GetString(sseCustomerKeyFlag)
+	if value == "" {
+		return nil, nil
+	}
+
+	key, err := parseSSECustomerKey(value)
+	if err != nil {
+		return nil, err
+	}
+	return []storage.Option{storage.WithSSECustomerKey(key)}, nil
+}
+
+func parseSSECustomerKey(value string) ([]byte, error) {
+	key := []byte(value)
+	if len(key) != 32 {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("key must be 32 bytes or base64-encoded: %w", err)
+		}
+		key = decoded
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
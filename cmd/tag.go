@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type objectTagger interface {
+	PutObjectTagging(bucket, object string, tags map[string]string) error
+	GetObjectTagging(bucket, object string) (map[string]string, error)
+	DeleteObjectTagging(bucket, object string) error
+}
+
+// tagCmd represents the tag command
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Manage the tags of an object",
+	Long: `Manage the tags of an object.
+
+Objects carry up to 10 key=value tags, which "mini-s3 list --tag" and
+lifecycle rules can select objects by.
+
+Example usage:
+  mini-s3 tag set <bucket-name> <object-name> team=data sensitivity=high
+  mini-s3 tag get <bucket-name> <object-name>
+  mini-s3 tag delete <bucket-name> <object-name>`,
+}
+
+var tagSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Replace the tags of an object",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 3 {
+			fmt.Println("Usage: mini-s3 tag set <bucket-name> <object-name> <key=value>...")
+			return
+		}
+
+		tagger, ok := storageInstance.(objectTagger)
+		if !ok {
+			fmt.Println("Tagging is not supported by this storage backend")
+			return
+		}
+
+		tags, err := parseKeyValues(args[2:])
+		if err != nil {
+			fmt.Printf("Invalid tags: %v\n", err)
+			return
+		}
+		if err := tagger.PutObjectTagging(args[0], args[1], tags); err != nil {
+			fmt.Printf("Failed to set tags: %v\n", err)
+			return
+		}
+		fmt.Printf("Set %d tags on %s/%s\n", len(tags), args[0], args[1])
+	},
+}
+
+var tagGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Show the tags of an object",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 tag get <bucket-name> <object-name>")
+			return
+		}
+
+		tagger, ok := storageInstance.(objectTagger)
+		if !ok {
+			fmt.Println("Tagging is not supported by this storage backend")
+			return
+		}
+
+		tags, err := tagger.GetObjectTagging(args[0], args[1])
+		if err != nil {
+			fmt.Printf("Failed to get tags: %v\n", err)
+			return
+		}
+		if len(tags) == 0 {
+			fmt.Printf("%s/%s has no tags\n", args[0], args[1])
+			return
+		}
+		for _, tag := range storage.TagSet(tags) {
+			fmt.Printf("%s=%s\n", tag.Key, tag.Value)
+		}
+	},
+}
+
+var tagDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Remove every tag of an object",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			fmt.Println("Usage: mini-s3 tag delete <bucket-name> <object-name>")
+			return
+		}
+
+		tagger, ok := storageInstance.(objectTagger)
+		if !ok {
+			fmt.Println("Tagging is not supported by this storage backend")
+			return
+		}
+
+		if err := tagger.DeleteObjectTagging(args[0], args[1]); err != nil {
+			fmt.Printf("Failed to remove tags: %v\n", err)
+			return
+		}
+		fmt.Printf("Tags removed from %s/%s\n", args[0], args[1])
+	},
+}
+
+// parseKeyValues turns key=value arguments, like tags or metadata, into a
+// map.
+func parseKeyValues(args []string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not in key=value form", arg)
+		}
+		if _, dup := pairs[key]; dup {
+			return nil, fmt.Errorf("%q is given more than once", key)
+		}
+		pairs[key] = value
+	}
+	return pairs, nil
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+	tagCmd.AddCommand(tagSetCmd, tagGetCmd, tagDeleteCmd)
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestTagCommands(t *testing.T) {
+	local := storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum())
+	for _, object := range []string{"users.csv", "orders.csv"} {
+		if _, err := local.Save("data", object, strings.NewReader("content")); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name             string
+		storage          storage.Storage
+		run              func()
+		expectedOutput   string
+		unexpectedOutput string
+	}{
+		{
+			name:           "unsupported backend",
+			storage:        &mockStorageForTesting{},
+			run:            func() { tagGetCmd.Run(tagGetCmd, []string{"data", "users.csv"}) },
+			expectedOutput: "Tagging is not supported by this storage backend",
+		},
+		{
+			name:           "malformed tag",
+			storage:        local,
+			run:            func() { tagSetCmd.Run(tagSetCmd, []string{"data", "users.csv", "team"}) },
+			expectedOutput: `Invalid tags: "team" is not in key=value form`,
+		},
+		{
+			name:           "set tags",
+			storage:        local,
+			run:            func() { tagSetCmd.Run(tagSetCmd, []string{"data", "users.csv", "team=data", "sensitivity=high"}) },
+			expectedOutput: "Set 2 tags on data/users.csv",
+		},
+		{
+			name:           "get tags",
+			storage:        local,
+			run:            func() { tagGetCmd.Run(tagGetCmd, []string{"data", "users.csv"}) },
+			expectedOutput: "sensitivity=high\nteam=data\n",
+		},
+		{
+			name:    "list filters by tag",
+			storage: local,
+			run: func() {
+				_ = listCmd.Flags().Set("tag", "team=data")
+				defer func() { _ = listCmd.Flags().Lookup("tag").Value.(interface{ Replace([]string) error }).Replace(nil) }()
+				listCmd.Run(listCmd, []string{"data"})
+			},
+			expectedOutput:   "users.csv",
+			unexpectedOutput: "orders.csv",
+		},
+		{
+			name:           "delete tags",
+			storage:        local,
+			run:            func() { tagDeleteCmd.Run(tagDeleteCmd, []string{"data", "users.csv"}) },
+			expectedOutput: "Tags removed from data/users.csv",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := withMockStorage(tt.storage)
+			defer cleanup()
+
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			tt.run()
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			if !strings.Contains(output, tt.expectedOutput) {
+				t.Errorf("expected output to contain '%s', got '%s'", tt.expectedOutput, output)
+			}
+			if tt.unexpectedOutput != "" && strings.Contains(output, tt.unexpectedOutput) {
+				t.Errorf("expected output not to contain '%s', got '%s'", tt.unexpectedOutput, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+type changeSubscriber interface {
+	ChangeFeedHead() (int64, error)
+	SubscribeChanges(ctx context.Context, filter storage.ChangeFilter, from int64, handle func(storage.Change) error) error
+}
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Print changes to the objects of a bucket as they happen",
+	Long: `Print objects created, overwritten and deleted in a bucket as it happens,
+including changes made by other processes sharing the data directory,
+until interrupted.
+
+Each line starts with the change's sequence number. Passing it to --from
+resumes watching right after that change; --from 0 starts at the oldest
+change retained.
+
+Example usage:
+  mini-s3 watch <bucket-name>
+  mini-s3 watch <bucket-name> photos/2024/
+  mini-s3 watch <bucket-name> --from 4096`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Usage: mini-s3 watch <bucket-name> [prefix]")
+			return
+		}
+
+		subscriber, ok := storageInstance.(changeSubscriber)
+		if !ok {
+			fmt.Println("The change feed is not supported by this storage backend")
+			return
+		}
+
+		filter := storage.ChangeFilter{Bucket: args[0]}
+		if len(args) > 1 {
+			filter.Prefix = args[1]
+		}
+
+		from, _ := cmd.Flags().GetInt64("from")
+		if !cmd.Flags().Changed("from") {
+			head, err := subscriber.ChangeFeedHead()
+			if err != nil {
+				fmt.Printf("Failed to watch bucket: %v\n", err)
+				return
+			}
+			from = head
+		}
+
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+
+		err := subscriber.SubscribeChanges(ctx, filter, from, func(change storage.Change) error {
+			printChange(change)
+			return nil
+		})
+		if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			fmt.Printf("Failed to watch bucket: %v\n", err)
+		}
+	},
+}
+
+func printChange(change storage.Change) {
+	timestamp := change.Time.Format("2006-01-02 15:04:05")
+	if change.Type == storage.ChangeDeleted {
+		fmt.Printf("%-10d %s %-11s %s\n", change.Sequence, timestamp, change.Type, change.Object)
+		return
+	}
+	fmt.Printf("%-10d %s %-11s %s (%s)\n", change.Sequence, timestamp, change.Type, change.Object, formatSize(change.Size))
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().Int64("from", 0, "resume after this sequence number instead of starting now")
+}
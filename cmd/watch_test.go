@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestWatchCommand(t *testing.T) {
+	local := storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum())
+	if _, err := local.Save("photos", "2024/a.jpg", strings.NewReader("before watching")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		storage        storage.Storage
+		args           []string
+		from           string
+		changes        func()
+		expectedOutput []string
+		unexpected     []string
+	}{
+		{
+			name:           "unsupported backend",
+			storage:        &mockStorageForTesting{},
+			args:           []string{"photos"},
+			expectedOutput: []string{"The change feed is not supported by this storage backend"},
+		},
+		{
+			name:           "missing arguments",
+			storage:        local,
+			args:           []string{},
+			expectedOutput: []string{"Usage: mini-s3 watch <bucket-name> [prefix]"},
+		},
+		{
+			name:    "prints changes from now on",
+			storage: local,
+			args:    []string{"photos", "2024/"},
+			changes: func() {
+				_, _ = local.Save("photos", "2024/a.jpg", strings.NewReader("overwritten"))
+				_, _ = local.Save("photos", "2023/b.jpg", strings.NewReader("other prefix"))
+				_, _ = local.Save("docs", "2024/c.txt", strings.NewReader("other bucket"))
+				_ = local.Delete("photos", "2024/a.jpg")
+			},
+			expectedOutput: []string{"overwritten 2024/a.jpg (11 B)", "deleted     2024/a.jpg"},
+			unexpected:     []string{"created", "2023/b.jpg", "2024/c.txt"},
+		},
+		{
+			name:           "resumes from a sequence",
+			storage:        local,
+			args:           []string{"photos", "2024/"},
+			from:           "0",
+			expectedOutput: []string{"created     2024/a.jpg (15 B)", "overwritten 2024/a.jpg", "deleted     2024/a.jpg"},
+		},
+		{
+			name:           "sequence outside the feed",
+			storage:        local,
+			args:           []string{"photos"},
+			from:           "1099511627776",
+			expectedOutput: []string{"Failed to watch bucket:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := withMockStorage(tt.storage)
+			defer cleanup()
+
+			flag := watchCmd.Flags().Lookup("from")
+			flag.Changed = false
+			if tt.from != "" {
+				_ = watchCmd.Flags().Set("from", tt.from)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			watchCmd.SetContext(ctx)
+
+			// Capture output
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			done := make(chan struct{})
+			go func() {
+				watchCmd.Run(watchCmd, tt.args)
+				close(done)
+			}()
+			if tt.changes != nil {
+				time.Sleep(50 * time.Millisecond)
+				tt.changes()
+			}
+			<-done
+
+			// Restore stdout and read output
+			_ = w.Close()
+			os.Stdout = old
+			var buf bytes.Buffer
+			_, _ = io.Copy(&buf, r)
+			output := buf.String()
+
+			for _, expected := range tt.expectedOutput {
+				if !strings.Contains(output, expected) {
+					t.Errorf("expected output to contain '%s', got '%s'", expected, output)
+				}
+			}
+			for _, unexpected := range tt.unexpected {
+				if strings.Contains(output, unexpected) {
+					t.Errorf("expected output not to contain '%s', got '%s'", unexpected, output)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+// Package client implements storage.Storage on top of a remote mini-s3
+// server, speaking the same path-style subset of the S3 HTTP API it serves.
+package client
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+const userMetadataPrefix = "x-amz-meta-"
+
+// Client is a Storage backed by the mini-s3 server at an endpoint, like
+// http://localhost:9000.
+type Client struct {
+	endpoint string
+	http     *http.Client
+}
+
+var _ storage.Storage = (*Client)(nil)
+
+// New returns a Client for the server at endpoint.
+func New(endpoint string) *Client {
+	return &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		http:     &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Open returns a Client for the server at endpoint, as a storage.Storage.
+// It fits storage.WithRemoteStorage.
+func Open(endpoint string) (storage.Storage, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("endpoint must be http:// or https://, got %q", endpoint)
+	}
+	return New(endpoint), nil
+}
+
+func (c *Client) objectURL(bucket, object string) string {
+	return c.endpoint + "/" + url.PathEscape(bucket) + "/" + escapeKey(object)
+}
+
+// escapeKey escapes each segment of an object key, keeping the slashes.
+func escapeKey(object string) string {
+	segments := strings.Split(object, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (c *Client) do(method, target string, body io.Reader, h http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range h {
+		req.Header[name] = values
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// Save uploads an object, sending the options as the headers the server
+// reads them from.
+func (c *Client) Save(bucket, object string, r io.Reader, opts ...storage.Option) (*storage.ObjectInfo, error) {
+	o := storage.NewOptions(opts...)
+	h := http.Header{}
+	putHeaders(h, o)
+	conditionHeaders(h, o.Conditions, "")
+
+	counted := &countingReader{r: r}
+	resp, err := c.do(http.MethodPut, c.objectURL(bucket, object), counted, h)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	info := objectInfo(bucket, object, resp.Header)
+	info.Size = counted.n
+	return info, nil
+}
+
+// Get downloads an object. The returned reader must be closed.
+func (c *Client) Get(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
+	o := storage.NewOptions(opts...)
+	h := readHeaders(o)
+	resp, err := c.do(http.MethodGet, c.objectURL(bucket, object), nil, h)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := objectInfo(bucket, object, resp.Header)
+	if o.Range != nil {
+		info.Range = &storage.ByteRange{Offset: o.Range.Offset, Length: resp.ContentLength}
+	}
+	return resp.Body, info, nil
+}
+
+func (c *Client) Head(bucket, object string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+	o := storage.NewOptions(opts...)
+	resp, err := c.do(http.MethodHead, c.objectURL(bucket, object), nil, readHeaders(o))
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return objectInfo(bucket, object, resp.Header), nil
+}
+
+// Delete deletes an object. Like S3, the server does not tell whether it
+// existed.
+func (c *Client) Delete(bucket, object string, opts ...storage.Option) error {
+	o := storage.NewOptions(opts...)
+	h := http.Header{}
+	if o.BypassGovernanceRetention {
+		h.Set("x-amz-bypass-governance-retention", "true")
+	}
+	resp, err := c.do(http.MethodDelete, c.objectURL(bucket, object), nil, h)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type copyObjectResult struct {
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+}
+
+// CopyObject copies an object within the server.
+func (c *Client) CopyObject(srcBucket, srcObject, dstBucket, dstObject string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+	o := storage.NewOptions(opts...)
+	h := http.Header{}
+	putHeaders(h, o)
+	conditionHeaders(h, o.Conditions, "")
+	conditionHeaders(h, o.CopyConditions, "x-amz-copy-source-")
+	h.Set("x-amz-copy-source", "/"+url.PathEscape(srcBucket)+"/"+escapeKey(srcObject))
+	if o.MetadataDirective != "" {
+		h.Set("x-amz-metadata-directive", o.MetadataDirective)
+	}
+	if key := o.CopySourceSSECustomerKey; key != nil {
+		sseCustomerKeyHeaders(h, key, "x-amz-copy-source-")
+	}
+
+	resp, err := c.do(http.MethodPut, c.objectURL(dstBucket, dstObject), nil, h)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result copyObjectResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	info := objectInfo(dstBucket, dstObject, resp.Header)
+	info.ETag = strings.Trim(result.ETag, `"`)
+	info.CreatedAt, _ = time.Parse(time.RFC3339, result.LastModified)
+	return info, nil
+}
+
+func (c *Client) Exists(bucket, object string) (bool, error) {
+	_, err := c.Head(bucket, object)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key            string `xml:"Key"`
+		LastModified   string `xml:"LastModified"`
+		ETag           string `xml:"ETag"`
+		Size           int64  `xml:"Size"`
+		ChecksumSHA256 string `xml:"ChecksumSHA256"`
+		StorageClass   string `xml:"StorageClass"`
+	} `xml:"Contents"`
+}
+
+func (c *Client) ListObjects(bucket string) ([]*storage.ObjectInfo, error) {
+	resp, err := c.do(http.MethodGet, c.endpoint+"/"+url.PathEscape(bucket), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result listBucketResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	objects := make([]*storage.ObjectInfo, 0, len(result.Contents))
+	for _, item := range result.Contents {
+		createdAt, _ := time.Parse(time.RFC3339, item.LastModified)
+		class := item.StorageClass
+		if class == "" {
+			class = storage.StorageClassStandard
+		}
+		objects = append(objects, &storage.ObjectInfo{
+			Bucket:       bucket,
+			Object:       item.Key,
+			Size:         item.Size,
+			Checksum:     item.ChecksumSHA256,
+			ETag:         strings.Trim(item.ETag, `"`),
+			CreatedAt:    createdAt,
+			StorageClass: class,
+		})
+	}
+	return objects, nil
+}
+
+// putHeaders sets the headers describing a new object.
+func putHeaders(h http.Header, o *storage.Options) {
+	if o.SSECustomerKey != nil {
+		sseCustomerKeyHeaders(h, o.SSECustomerKey, "")
+	}
+	if o.StorageClass != "" {
+		h.Set("x-amz-storage-class", o.StorageClass)
+	}
+	if r := o.Retention; r != nil {
+		h.Set("x-amz-object-lock-mode", r.Mode)
+		h.Set("x-amz-object-lock-retain-until-date", r.RetainUntilDate.UTC().Format(time.RFC3339))
+	}
+	if o.LegalHold {
+		h.Set("x-amz-object-lock-legal-hold", "ON")
+	}
+	if o.BypassGovernanceRetention {
+		h.Set("x-amz-bypass-governance-retention", "true")
+	}
+	if len(o.Tags) > 0 {
+		tags := url.Values{}
+		for key, value := range o.Tags {
+			tags.Set(key, value)
+		}
+		h.Set("x-amz-tagging", tags.Encode())
+	}
+	if o.ContentType != "" {
+		h.Set("Content-Type", o.ContentType)
+	}
+	if o.ContentEncoding != "" {
+		h.Set("Content-Encoding", o.ContentEncoding)
+	}
+	if o.ContentDisposition != "" {
+		h.Set("Content-Disposition", o.ContentDisposition)
+	}
+	if o.CacheControl != "" {
+		h.Set("Cache-Control", o.CacheControl)
+	}
+	if !o.Expires.IsZero() {
+		h.Set("Expires", o.Expires.UTC().Format(http.TimeFormat))
+	}
+	for key, value := range o.UserMetadata {
+		h.Set(userMetadataPrefix+key, value)
+	}
+	if o.Replica {
+		h.Set("x-amz-replication-status", storage.ReplicationStatusReplica)
+	}
+}
+
+// readHeaders turns the options of Get and Head into headers.
+func readHeaders(o *storage.Options) http.Header {
+	h := http.Header{}
+	if o.SSECustomerKey != nil {
+		sseCustomerKeyHeaders(h, o.SSECustomerKey, "")
+	}
+	if r := o.Range; r != nil {
+		switch {
+		case r.Offset < 0:
+			h.Set("Range", fmt.Sprintf("bytes=%d", r.Offset))
+		case r.Length < 0:
+			h.Set("Range", fmt.Sprintf("bytes=%d-", r.Offset))
+		default:
+			h.Set("Range", fmt.Sprintf("bytes=%d-%d", r.Offset, r.Offset+r.Length-1))
+		}
+	}
+	conditionHeaders(h, o.Conditions, "")
+	return h
+}
+
+func conditionHeaders(h http.Header, c *storage.Conditions, prefix string) {
+	if c == nil {
+		return
+	}
+	if c.IfMatch != "" {
+		h.Set(prefix+"If-Match", c.IfMatch)
+	}
+	if c.IfNoneMatch != "" {
+		h.Set(prefix+"If-None-Match", c.IfNoneMatch)
+	}
+	if !c.IfModifiedSince.IsZero() {
+		h.Set(prefix+"If-Modified-Since", c.IfModifiedSince.UTC().Format(http.TimeFormat))
+	}
+	if !c.IfUnmodifiedSince.IsZero() {
+		h.Set(prefix+"If-Unmodified-Since", c.IfUnmodifiedSince.UTC().Format(http.TimeFormat))
+	}
+}
+
+// sseCustomerKeyHeaders sets the SSE-C headers, with x-amz- replaced by
+// prefix when given.
+func sseCustomerKeyHeaders(h http.Header, key []byte, prefix string) {
+	if prefix == "" {
+		prefix = "x-amz-"
+	}
+	h.Set(prefix+"server-side-encryption-customer-algorithm", storage.SSECustomerAlgorithm)
+	h.Set(prefix+"server-side-encryption-customer-key", base64.StdEncoding.EncodeToString(key))
+	h.Set(prefix+"server-side-encryption-customer-key-MD5", storage.SSECustomerKeyMD5(key))
+}
+
+// objectInfo reads what the response headers tell about an object. Tags
+// are not sent along with objects, so they are left out.
+func objectInfo(bucket, object string, h http.Header) *storage.ObjectInfo {
+	info := &storage.ObjectInfo{
+		Bucket:               bucket,
+		Object:               object,
+		ETag:                 strings.Trim(h.Get("ETag"), `"`),
+		Checksum:             h.Get("x-amz-meta-sha256"),
+		StorageClass:         h.Get("x-amz-storage-class"),
+		ServerSideEncryption: h.Get("x-amz-server-side-encryption"),
+		SSECustomerAlgorithm: h.Get("x-amz-server-side-encryption-customer-algorithm"),
+		SSECustomerKeyMD5:    h.Get("x-amz-server-side-encryption-customer-key-MD5"),
+		ContentType:          h.Get("Content-Type"),
+		ContentEncoding:      h.Get("Content-Encoding"),
+		ContentDisposition:   h.Get("Content-Disposition"),
+		CacheControl:         h.Get("Cache-Control"),
+		ReplicationStatus:    h.Get("x-amz-replication-status"),
+	}
+	if info.StorageClass == "" {
+		info.StorageClass = storage.StorageClassStandard
+	}
+	if t, err := http.ParseTime(h.Get("Last-Modified")); err == nil {
+		info.CreatedAt = t
+	}
+	if t, err := http.ParseTime(h.Get("Expires")); err == nil {
+		info.Expires = t
+	}
+
+	// Content-Range carries the full size of ranged responses
+	if _, total, ok := strings.Cut(h.Get("Content-Range"), "/"); ok {
+		info.Size, _ = strconv.ParseInt(total, 10, 64)
+	} else {
+		info.Size, _ = strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	}
+
+	if mode := h.Get("x-amz-object-lock-mode"); mode != "" {
+		until, _ := time.Parse(time.RFC3339, h.Get("x-amz-object-lock-retain-until-date"))
+		info.Retention = &storage.Retention{Mode: mode, RetainUntilDate: until}
+	}
+	info.LegalHold = h.Get("x-amz-object-lock-legal-hold") == "ON"
+
+	for name, values := range h {
+		key, ok := strings.CutPrefix(strings.ToLower(name), userMetadataPrefix)
+		// The server sends the checksum as metadata too
+		if !ok || key == "sha256" {
+			continue
+		}
+		if info.UserMetadata == nil {
+			info.UserMetadata = map[string]string{}
+		}
+		info.UserMetadata[key] = strings.Join(values, ",")
+	}
+	return info
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
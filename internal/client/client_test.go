@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/server"
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func newTestClient(t *testing.T) (*Client, *storage.LocalStorage) {
+	t.Helper()
+	local := storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum())
+	srv := httptest.NewServer(server.New(local))
+	t.Cleanup(srv.Close)
+	return New(srv.URL), local
+}
+
+func TestClient(t *testing.T) {
+	c, local := newTestClient(t)
+
+	t.Run("Saves and reads objects with their metadata", func(t *testing.T) {
+		info, err := c.Save("docs", "reports/2024 q1.csv", strings.NewReader("a,b\n1,2\n"),
+			storage.WithContentType("text/csv"),
+			storage.WithUserMetadata(map[string]string{"owner": "finance"}),
+			storage.WithTags(map[string]string{"team": "data"}),
+			storage.WithStorageClass(storage.StorageClassCold))
+		if err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		if info.Size != 8 || info.ETag == "" {
+			t.Errorf("Expected size 8 and an ETag, got %+v", info)
+		}
+
+		stored, err := local.Head("docs", "reports/2024 q1.csv")
+		if err != nil {
+			t.Fatalf("Failed to head on the server: %v", err)
+		}
+		if stored.ContentType != "text/csv" || stored.UserMetadata["owner"] != "finance" || stored.Tags["team"] != "data" || stored.StorageClass != storage.StorageClassCold {
+			t.Errorf("Expected the metadata to reach the server, got %+v", stored)
+		}
+
+		body, got, err := c.Get("docs", "reports/2024 q1.csv")
+		if err != nil {
+			t.Fatalf("Failed to get: %v", err)
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if string(data) != "a,b\n1,2\n" || got.ETag != info.ETag || got.Size != 8 || got.ContentType != "text/csv" || got.UserMetadata["owner"] != "finance" {
+			t.Errorf("Unexpected object %q %+v", data, got)
+		}
+	})
+
+	t.Run("Reads ranges", func(t *testing.T) {
+		body, info, err := c.Get("docs", "reports/2024 q1.csv", storage.WithRange(4, 3))
+		if err != nil {
+			t.Fatalf("Failed to get: %v", err)
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if string(data) != "1,2" || info.Size != 8 || info.Range.Length != 3 {
+			t.Errorf("Unexpected range %q %+v", data, info)
+		}
+	})
+
+	t.Run("Maps errors back to storage errors", func(t *testing.T) {
+		if _, _, err := c.Get("docs", "missing"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected os.ErrNotExist, got %v", err)
+		}
+		if _, err := c.Head("docs", "missing"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected os.ErrNotExist from HEAD, got %v", err)
+		}
+		_, err := c.Save("docs", "reports/2024 q1.csv", strings.NewReader("x"), storage.WithConditions(storage.Conditions{IfNoneMatch: "*"}))
+		if !errors.Is(err, storage.ErrPreconditionFailed) {
+			t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+		}
+		info, _ := c.Head("docs", "reports/2024 q1.csv")
+		if _, err := c.Head("docs", "reports/2024 q1.csv", storage.WithConditions(storage.Conditions{IfNoneMatch: info.ETag})); !errors.Is(err, storage.ErrNotModified) {
+			t.Errorf("Expected ErrNotModified, got %v", err)
+		}
+	})
+
+	t.Run("Copies, lists and deletes", func(t *testing.T) {
+		copied, err := c.CopyObject("docs", "reports/2024 q1.csv", "docs", "copy.csv")
+		if err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+		source, _ := c.Head("docs", "reports/2024 q1.csv")
+		if copied.ETag != source.ETag {
+			t.Errorf("Expected the copy to have ETag %s, got %s", source.ETag, copied.ETag)
+		}
+
+		objects, err := c.ListObjects("docs")
+		if err != nil || len(objects) != 2 {
+			t.Fatalf("Expected 2 objects, got %d %v", len(objects), err)
+		}
+
+		if err := c.Delete("docs", "copy.csv"); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+		if exists, err := c.Exists("docs", "copy.csv"); err != nil || exists {
+			t.Errorf("Expected copy.csv to be gone, got %v %v", exists, err)
+		}
+	})
+}
+
+func TestReplicationToRemote(t *testing.T) {
+	remote, replicaStore := newTestClient(t)
+	source := storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum(), storage.WithRemoteStorage(Open))
+
+	cfg := &storage.ReplicationConfiguration{Rules: []storage.ReplicationRule{{
+		Status:            storage.ReplicationRuleEnabled,
+		DeleteReplication: &storage.DeleteReplication{Status: storage.ReplicationRuleEnabled},
+		Destination:       storage.ReplicationDestination{Endpoint: remote.endpoint, Bucket: "replica"},
+	}}}
+	if err := source.PutBucketReplication("photos", cfg); err != nil {
+		t.Fatalf("Failed to set replication rules: %v", err)
+	}
+	if _, err := source.Save("photos", "2024/beach.jpg", strings.NewReader("sand"), storage.WithContentType("image/jpeg")); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	report, err := source.ReplicateObjects(context.Background(), time.Now())
+	if err != nil || report.Replicated != 1 {
+		t.Fatalf("Expected 1 replicated, got %+v %v", report, err)
+	}
+	replica, err := replicaStore.Head("replica", "2024/beach.jpg")
+	if err != nil {
+		t.Fatalf("Expected the replica on the remote: %v", err)
+	}
+	if replica.ReplicationStatus != storage.ReplicationStatusReplica || replica.ContentType != "image/jpeg" {
+		t.Errorf("Unexpected replica %+v", replica)
+	}
+	if info, _ := source.Head("photos", "2024/beach.jpg"); info.ReplicationStatus != storage.ReplicationStatusCompleted {
+		t.Errorf("Expected COMPLETED, got %q", info.ReplicationStatus)
+	}
+
+	if err := source.Delete("photos", "2024/beach.jpg"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := source.ReplicateObjects(context.Background(), time.Now()); err != nil {
+		t.Fatalf("Failed to replicate: %v", err)
+	}
+	if exists, _ := replicaStore.Exists("replica", "2024/beach.jpg"); exists {
+		t.Error("Expected the delete to reach the remote")
+	}
+}
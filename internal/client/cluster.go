@@ -0,0 +1,190 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/iamthiago/mini-s3/internal/gossip"
+	"github.com/iamthiago/mini-s3/internal/handoff"
+	"github.com/iamthiago/mini-s3/internal/raft"
+	"github.com/iamthiago/mini-s3/internal/ring"
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// clusterPath is where cluster nodes serve the cluster's own API.
+const clusterPath = "/_cluster"
+
+// ClusterStatus returns how the node at the endpoint sees its cluster.
+func (c *Client) ClusterStatus() (*raft.Status, error) {
+	resp, err := c.do(http.MethodGet, c.endpoint+clusterPath+"/status", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	status := &raft.Status{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// ClusterRing returns how the cluster of the node at the endpoint spreads
+// object data over its nodes, along with the nodes of bucket/object when
+// both are given.
+func (c *Client) ClusterRing(bucket, object string) (*ring.Status, error) {
+	target := c.endpoint + clusterPath + "/ring"
+	if bucket != "" && object != "" {
+		target += "?" + url.Values{"bucket": {bucket}, "object": {object}}.Encode()
+	}
+	resp, err := c.do(http.MethodGet, target, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	status := &ring.Status{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// ClusterHints describes the hints the node at the endpoint keeps of
+// writes other nodes missed.
+func (c *Client) ClusterHints() (*handoff.Stats, error) {
+	resp, err := c.do(http.MethodGet, c.endpoint+clusterPath+"/hints", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	stats := &handoff.Stats{}
+	if err := json.NewDecoder(resp.Body).Decode(stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// ClusterRebalance returns the progress of moving object data onto the
+// nodes the ring of the cluster of the node at the endpoint places it on.
+func (c *Client) ClusterRebalance() (*ring.Rebalance, error) {
+	resp, err := c.do(http.MethodGet, c.endpoint+clusterPath+"/rebalance", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	status := &ring.Rebalance{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// GetBucketQuorum returns the quorums a bucket set in the cluster of the
+// node at the endpoint, or nil when it uses the defaults.
+func (c *Client) GetBucketQuorum(bucket string) (*storage.QuorumConfiguration, error) {
+	resp, err := c.do(http.MethodGet, c.quorumURL(bucket), nil, nil)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Code == "NoSuchQuorumConfiguration" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	q := &storage.QuorumConfiguration{}
+	if err := json.NewDecoder(resp.Body).Decode(q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// PutBucketQuorum sets the quorums of a bucket in the cluster of the node
+// at the endpoint.
+func (c *Client) PutBucketQuorum(bucket string, q *storage.QuorumConfiguration) error {
+	body, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	h := http.Header{"Content-Type": []string{"application/json"}}
+	resp, err := c.do(http.MethodPut, c.quorumURL(bucket), bytes.NewReader(body), h)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// DeleteBucketQuorum makes a bucket use the default quorums again.
+func (c *Client) DeleteBucketQuorum(bucket string) error {
+	resp, err := c.do(http.MethodDelete, c.quorumURL(bucket), nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *Client) quorumURL(bucket string) string {
+	return c.endpoint + clusterPath + "/quorum/" + url.PathEscape(bucket)
+}
+
+// AddClusterMember adds the node reached at addr to the cluster of the
+// node at the endpoint.
+func (c *Client) AddClusterMember(id, addr string) error {
+	body, err := json.Marshal(map[string]string{"id": id, "addr": addr})
+	if err != nil {
+		return err
+	}
+	h := http.Header{"Content-Type": []string{"application/json"}}
+	resp, err := c.do(http.MethodPost, c.endpoint+clusterPath+"/members", bytes.NewReader(body), h)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// ClusterMembers returns the nodes the node at the endpoint knows of
+// through gossip.
+func (c *Client) ClusterMembers() ([]gossip.Member, error) {
+	resp, err := c.do(http.MethodGet, c.endpoint+clusterPath+"/members", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var members []gossip.Member
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// JoinCluster makes the node at the endpoint join the cluster of the node
+// reached at addr.
+func (c *Client) JoinCluster(addr string) error {
+	body, err := json.Marshal(map[string]string{"addr": addr})
+	if err != nil {
+		return err
+	}
+	h := http.Header{"Content-Type": []string{"application/json"}}
+	resp, err := c.do(http.MethodPost, c.endpoint+clusterPath+"/join", bytes.NewReader(body), h)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// RemoveClusterMember removes a node from the cluster of the node at the
+// endpoint.
+func (c *Client) RemoveClusterMember(id string) error {
+	resp, err := c.do(http.MethodDelete, c.endpoint+clusterPath+"/members/"+url.PathEscape(id), nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// Error is an error response of the server.
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("mini-s3 responded %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Unwrap maps the error codes the server sends for storage errors back to
+// them, so callers can check for them like with any Storage.
+func (e *Error) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotModified:
+		return storage.ErrNotModified
+	case e.Code == "NoSuchKey", e.StatusCode == http.StatusNotFound:
+		return os.ErrNotExist
+	case e.Code == "PreconditionFailed":
+		return storage.ErrPreconditionFailed
+	case e.Code == "InvalidObjectState":
+		return storage.ErrInvalidObjectState
+	case e.Code == "InvalidRange":
+		return storage.ErrInvalidRange
+	case e.Code == "ServiceUnavailable":
+		return storage.ErrUnavailable
+	}
+	return nil
+}
+
+func responseError(resp *http.Response) error {
+	e := &Error{StatusCode: resp.StatusCode}
+	// HEAD and 304 responses have no body to tell more
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = xml.Unmarshal(data, e)
+	return e
+}
@@ -0,0 +1,451 @@
+// Package cluster runs mini-s3 on several nodes that share one namespace.
+// Bucket and object metadata is committed through a Raft log, so every
+// node sees the same objects and any of them serves reads and writes
+// consistently. Object data is spread over the nodes by consistent
+// hashing: each object is kept by a few of them, in their local Storage,
+// and read from any of those. Writes a replica misses while unavailable
+// are kept as hints, and handed off to it once it is back. Nodes gossip to
+// find each other and tell which of them are down. When nodes join or
+// leave, the leader moves object data onto the nodes the ring places it on.
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/client"
+	"github.com/iamthiago/mini-s3/internal/gossip"
+	"github.com/iamthiago/mini-s3/internal/handoff"
+	"github.com/iamthiago/mini-s3/internal/raft"
+	"github.com/iamthiago/mini-s3/internal/ring"
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+const (
+	// PathPrefix is where nodes serve the cluster's own API, next to the
+	// S3 API. Bucket names cannot contain underscores, so it never clashes
+	// with a bucket.
+	PathPrefix = "/_cluster"
+
+	// requestTimeout bounds how long an operation waits for the cluster,
+	// like for a leader to be elected.
+	requestTimeout = 10 * time.Second
+)
+
+// Config configures a Node.
+type Config struct {
+	// ID identifies the node in the cluster.
+	ID string
+
+	// Peers are the URLs the members of a new cluster are reached at, like
+	// http://10.0.0.2:9000, keyed by node ID and including this node.
+	// Nodes joining an existing cluster are given none, and wait to be
+	// added to it.
+	Peers map[string]string
+
+	// Addr is the URL other nodes reach this node at, its URL in Peers or
+	// in the Raft membership by default. Nodes joining a cluster with Join
+	// need one. Zone and Capacity describe the node to the others, see
+	// gossip.Member.
+	Addr     string
+	Zone     string
+	Capacity int64
+
+	// Dir is where the node keeps its Raft log.
+	Dir string
+
+	// Local stores the object data this node holds.
+	Local storage.Storage
+
+	// ReplicationFactor is how many nodes keep each object's data,
+	// DefaultReplicationFactor by default, or every node when there are
+	// fewer. VirtualNodes is how many points of the hash ring each node
+	// owns, ring.DefaultVirtualNodes by default. Objects keep the nodes
+	// they were written to until the leader rebalances them, so nodes
+	// configured differently still agree.
+	ReplicationFactor int
+	VirtualNodes      int
+
+	// RebalanceRate caps the bytes per second rebalancing moves,
+	// DefaultRebalanceRate by default.
+	RebalanceRate int64
+
+	// HintTTL is how long hints of writes a node missed are kept for it,
+	// handoff.DefaultTTL by default.
+	HintTTL time.Duration
+
+	// ElectionTimeout and HeartbeatInterval tune the Raft timers, and
+	// default to those of the raft package. GossipInterval is how often
+	// the node probes another, see gossip.Config.
+	ElectionTimeout   time.Duration
+	HeartbeatInterval time.Duration
+	GossipInterval    time.Duration
+}
+
+// Node is a member of a cluster, and a Storage spanning the whole cluster.
+type Node struct {
+	id     string
+	raft   *raft.Node
+	gossip *gossip.Node
+	meta   *metadata
+	local  storage.Storage
+	hints  *handoff.Store
+
+	replicationFactor int
+	virtualNodes      int
+	ringMu            sync.Mutex
+	hashRing          *ring.Ring
+
+	rebalanceRate int64
+	rebalancing   rebalancer
+
+	// clock makes the versions of this node's writes increase even when
+	// the wall clock does not.
+	clock atomic.Int64
+}
+
+var _ storage.Storage = (*Node)(nil)
+
+// New creates a node from its Raft state in cfg.Dir. It takes part in the
+// cluster once Run is called.
+func New(cfg Config) (*Node, error) {
+	n := &Node{id: cfg.ID, local: cfg.Local, replicationFactor: cfg.ReplicationFactor, virtualNodes: cfg.VirtualNodes}
+	n.hints = handoff.New(cfg.Local, cfg.HintTTL)
+	if n.replicationFactor <= 0 {
+		n.replicationFactor = DefaultReplicationFactor
+	}
+	n.rebalanceRate = cfg.RebalanceRate
+	if n.rebalanceRate <= 0 {
+		n.rebalanceRate = DefaultRebalanceRate
+	}
+	n.meta = newMetadata(n.release)
+
+	var err error
+	n.raft, err = raft.NewNode(raft.Config{
+		ID:                cfg.ID,
+		Dir:               cfg.Dir,
+		Peers:             cfg.Peers,
+		Transport:         raft.NewHTTPTransport(PathPrefix + "/raft"),
+		ElectionTimeout:   cfg.ElectionTimeout,
+		HeartbeatInterval: cfg.HeartbeatInterval,
+	}, n.meta)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := cfg.Addr
+	if addr == "" {
+		addr = cfg.Peers[cfg.ID]
+	}
+	if addr == "" {
+		addr = n.raft.Status().Members[cfg.ID]
+	}
+	n.gossip, err = gossip.NewNode(gossip.Config{
+		ID:            cfg.ID,
+		Addr:          addr,
+		Zone:          cfg.Zone,
+		Capacity:      cfg.Capacity,
+		Transport:     gossip.NewHTTPTransport(PathPrefix + "/gossip"),
+		Seeds:         n.seeds,
+		ProbeInterval: cfg.GossipInterval,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Run takes part in the cluster until ctx is done.
+func (n *Node) Run(ctx context.Context) {
+	go n.gossip.Run(ctx)
+	n.raft.Run(ctx)
+}
+
+// Status returns the node's view of the cluster.
+func (n *Node) Status() *raft.Status {
+	return n.raft.Status()
+}
+
+// Save stores the object's data on the nodes the ring places it on, then
+// commits its metadata once the bucket's write quorum of them verified it.
+// Conditions are checked at commit, so of two conditional writes racing on
+// different nodes only one succeeds.
+func (n *Node) Save(bucket, object string, r io.Reader, opts ...storage.Option) (*storage.ObjectInfo, error) {
+	o := storage.NewOptions(opts...)
+	if err := checkObjectLock(o); err != nil {
+		return nil, err
+	}
+	if o.ContentType == "" {
+		// The data is stored under another key, so the type is guessed from
+		// this one
+		contentType, replay, err := storage.DetectContentType(object, r)
+		if err != nil {
+			return nil, err
+		}
+		r = replay
+		o.ContentType = contentType
+		opts = append(slices.Clone(opts), storage.WithContentType(contentType))
+	}
+
+	// The write quorum is the one committed before the write
+	if err := n.barrier(); err != nil {
+		return nil, err
+	}
+	version := n.newVersion()
+	nodes := n.placement(bucket, object)
+	quorum, _ := n.quorums(bucket, len(nodes))
+	info, err := n.store(bucket, dataKey(object, version), r, nodes, quorum, withoutConditions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &record{Version: version, Nodes: nodes, Info: *info}
+	rec.Info.Bucket = bucket
+	rec.Info.Object = object
+	rec.Info.Path = ""
+	describe(&rec.Info, o)
+	err = n.propose(&command{Op: opPut, Bucket: bucket, Object: object, Record: rec, Conditions: o.Conditions})
+	if err != nil {
+		if errors.Is(err, storage.ErrPreconditionFailed) {
+			// Committed but rejected, so nothing refers to the data
+			n.discard(bucket, dataKey(object, version), nodes)
+		}
+		return nil, err
+	}
+	return rec.objectInfo(), nil
+}
+
+// checkObjectLock refuses retention and legal holds: the cluster has no
+// object lock, so nothing would keep such objects from being deleted.
+func checkObjectLock(o *storage.Options) error {
+	if o.Retention != nil || o.LegalHold {
+		return fmt.Errorf("%w: object lock is not supported in cluster mode", storage.ErrNotImplemented)
+	}
+	return nil
+}
+
+// Get reads the object's data from one of its replicas, once the bucket's
+// read quorum of them hold the version and checksum it was committed with.
+func (n *Node) Get(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
+	rec, err := n.lookup(bucket, object, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, quorum := n.quorums(bucket, len(rec.Nodes))
+	body, read, err := n.readBody(bucket, object, rec, quorum, withoutConditions(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+	info := rec.objectInfo()
+	info.Range = read.Range
+	return body, info, nil
+}
+
+func (n *Node) Head(bucket, object string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+	rec, err := n.lookup(bucket, object, opts)
+	if err != nil {
+		return nil, err
+	}
+	return rec.objectInfo(), nil
+}
+
+func (n *Node) Delete(bucket, object string, opts ...storage.Option) error {
+	return n.propose(&command{Op: opDelete, Bucket: bucket, Object: object})
+}
+
+// CopyObject reads the source and saves it again under the destination,
+// following the metadata directive like LocalStorage.CopyObject does.
+func (n *Node) CopyObject(srcBucket, srcObject, dstBucket, dstObject string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+	o := storage.NewOptions(opts...)
+	directive := o.MetadataDirective
+	if directive == "" {
+		directive = storage.MetadataDirectiveCopy
+	}
+	if directive != storage.MetadataDirectiveCopy && directive != storage.MetadataDirectiveReplace {
+		return nil, &storage.ErrInvalidMetadataDirective{Directive: directive}
+	}
+	if err := checkObjectLock(o); err != nil {
+		return nil, err
+	}
+	if srcBucket == dstBucket && srcObject == dstObject && directive == storage.MetadataDirectiveCopy && o.StorageClass == "" {
+		return nil, storage.ErrInvalidCopy
+	}
+
+	readOpts := []storage.Option{storage.WithSSECustomerKey(o.CopySourceSSECustomerKey)}
+	if o.CopyConditions != nil {
+		readOpts = append(readOpts, storage.WithConditions(*o.CopyConditions))
+	}
+	body, src, err := n.Get(srcBucket, srcObject, readOpts...)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotModified) {
+			// Copies fail their conditions rather than not modify anything
+			err = storage.ErrPreconditionFailed
+		}
+		return nil, err
+	}
+	defer body.Close()
+
+	tags := src.Tags
+	if len(o.Tags) > 0 {
+		tags = o.Tags
+	}
+	saveOpts := []storage.Option{
+		storage.WithTags(tags),
+		storage.WithStorageClass(o.StorageClass),
+		storage.WithSSECustomerKey(o.SSECustomerKey),
+	}
+	headers := src
+	if directive == storage.MetadataDirectiveReplace {
+		headers = &storage.ObjectInfo{
+			ContentType:        o.ContentType,
+			ContentEncoding:    o.ContentEncoding,
+			ContentDisposition: o.ContentDisposition,
+			CacheControl:       o.CacheControl,
+			Expires:            o.Expires,
+			UserMetadata:       o.UserMetadata,
+		}
+	}
+	saveOpts = append(saveOpts,
+		storage.WithContentType(headers.ContentType),
+		storage.WithContentEncoding(headers.ContentEncoding),
+		storage.WithContentDisposition(headers.ContentDisposition),
+		storage.WithCacheControl(headers.CacheControl),
+		storage.WithExpires(headers.Expires),
+		storage.WithUserMetadata(headers.UserMetadata))
+	if o.Conditions != nil {
+		saveOpts = append(saveOpts, storage.WithConditions(*o.Conditions))
+	}
+	return n.Save(dstBucket, dstObject, body, saveOpts...)
+}
+
+func (n *Node) Exists(bucket, object string) (bool, error) {
+	_, err := n.lookup(bucket, object, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (n *Node) ListObjects(bucket string) ([]*storage.ObjectInfo, error) {
+	if err := n.barrier(); err != nil {
+		return nil, err
+	}
+	records, err := n.meta.list(bucket)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*storage.ObjectInfo, len(records))
+	for i, rec := range records {
+		infos[i] = rec.objectInfo()
+	}
+	return infos, nil
+}
+
+// lookup returns the committed record of an object, once this node has
+// caught up with the writes committed before, and checks the conditions
+// of a read against it.
+func (n *Node) lookup(bucket, object string, opts []storage.Option) (*record, error) {
+	if err := n.barrier(); err != nil {
+		return nil, err
+	}
+	rec, err := n.meta.get(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	if o := storage.NewOptions(opts...); o.Conditions != nil {
+		if err := o.Conditions.Check(&rec.Info, true); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+// barrier waits until this node applied every command committed before,
+// so what it reads next is up to date.
+func (n *Node) barrier() error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	err := retryUnavailable(ctx, func() error {
+		return n.raft.Barrier(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", storage.ErrUnavailable, err)
+	}
+	return nil
+}
+
+// release drops this node's data of an object version no record refers to
+// anymore.
+func (n *Node) release(bucket, object string, rec *record) {
+	if slices.Contains(rec.Nodes, n.id) {
+		_ = n.local.Delete(bucket, dataKey(object, rec.Version))
+	}
+}
+
+// dataStorage returns the Storage holding the data a node keeps.
+func (n *Node) dataStorage(node string) (storage.Storage, error) {
+	if node == n.id {
+		return n.local, nil
+	}
+	addr := n.raft.Status().Members[node]
+	if addr == "" {
+		return nil, fmt.Errorf("node %s is not a member of the cluster", node)
+	}
+	if n.down(node) {
+		return nil, fmt.Errorf("%w: node %s is down", storage.ErrUnavailable, node)
+	}
+	return client.New(addr + PathPrefix + "/data"), nil
+}
+
+// newVersion returns a version for a write of this node, which sorts after
+// the versions of its previous writes.
+func (n *Node) newVersion() string {
+	now := time.Now().UnixNano()
+	for {
+		last := n.clock.Load()
+		next := max(now, last+1)
+		if n.clock.CompareAndSwap(last, next) {
+			return fmt.Sprintf("%019d.%s", next, n.id)
+		}
+	}
+}
+
+// dataKey is the key a version of an object's data is stored under, in
+// the local Storage of the nodes holding it.
+func dataKey(object, version string) string {
+	return object + "@" + version
+}
+
+// withoutConditions makes the options apply to stored data, whose
+// conditions the committed metadata answers instead.
+func withoutConditions(opts []storage.Option) []storage.Option {
+	return append(slices.Clone(opts), func(o *storage.Options) {
+		o.Conditions = nil
+	})
+}
+
+// requestError returns the first of the errors of nodes that is about the
+// request itself, like a bad range or customer key. Those would be the
+// same on every node, and are returned as they are.
+func requestError(errs []error) error {
+	for _, err := range errs {
+		var remote *client.Error
+		if errors.As(err, &remote) && remote.StatusCode >= 400 && remote.StatusCode < 500 && remote.StatusCode != http.StatusNotFound {
+			return err
+		}
+		if errors.Is(err, storage.ErrInvalidRange) || errors.Is(err, storage.ErrInvalidObjectState) || errors.Is(err, storage.ErrSSECustomerKeyMissing) ||
+			errors.Is(err, storage.ErrSSECustomerKeyMismatch) || errors.Is(err, storage.ErrSSECustomerKeyNotUsed) {
+			return err
+		}
+	}
+	return nil
+}
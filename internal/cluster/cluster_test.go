@@ -0,0 +1,649 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/client"
+	"github.com/iamthiago/mini-s3/internal/gossip"
+	"github.com/iamthiago/mini-s3/internal/raft"
+	"github.com/iamthiago/mini-s3/internal/server"
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+type testNode struct {
+	*Node
+	local *storage.LocalStorage
+	fault *faultyStorage
+	addr  string
+
+	// stop stops the node, as if it crashed, and start starts it again.
+	stop  func()
+	start func()
+}
+
+// Faults a node's data store can be given.
+const (
+	healthy int32 = iota
+	failing
+	corrupting
+)
+
+// faultyStorage fails, or reports the wrong checksum for, the writes and
+// reads of the data a node holds.
+type faultyStorage struct {
+	storage.Storage
+	mode atomic.Int32
+}
+
+func (f *faultyStorage) Save(bucket, object string, r io.Reader, opts ...storage.Option) (*storage.ObjectInfo, error) {
+	if f.mode.Load() == failing {
+		return nil, errors.New("disk failed")
+	}
+	info, err := f.Storage.Save(bucket, object, r, opts...)
+	if err == nil && f.mode.Load() == corrupting {
+		info.Checksum = "corrupt"
+	}
+	return info, err
+}
+
+func (f *faultyStorage) Get(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
+	if f.mode.Load() == failing {
+		return nil, nil, errors.New("disk failed")
+	}
+	return f.Storage.Get(bucket, object, opts...)
+}
+
+func (f *faultyStorage) Head(bucket, object string, opts ...storage.Option) (*storage.ObjectInfo, error) {
+	if f.mode.Load() == failing {
+		return nil, errors.New("disk failed")
+	}
+	return f.Storage.Head(bucket, object, opts...)
+}
+
+// newTestCluster starts a cluster of size nodes serving the S3 and cluster
+// APIs over HTTP, and waits for it to elect a leader.
+func newTestCluster(t *testing.T, size int) []*testNode {
+	t.Helper()
+	nodes := make([]*testNode, size)
+	handlers := make([]atomic.Pointer[http.Handler], size)
+	peers := map[string]string{}
+	for i := range nodes {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if h := handlers[i].Load(); h != nil {
+				(*h).ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(srv.Close)
+		nodes[i] = &testNode{addr: srv.URL}
+		peers[fmt.Sprintf("n%d", i+1)] = srv.URL
+	}
+
+	for i, node := range nodes {
+		dir := t.TempDir()
+		node.local = storage.NewLocalStorage(dir, storage.NewValueChecksum())
+		node.fault = &faultyStorage{Storage: node.local}
+		node.start = func() {
+			n, err := New(Config{
+				ID:                fmt.Sprintf("n%d", i+1),
+				Peers:             peers,
+				Dir:               storage.DefaultRaftDir(dir),
+				Local:             node.fault,
+				ReplicationFactor: 2,
+				ElectionTimeout:   150 * time.Millisecond,
+				HeartbeatInterval: 20 * time.Millisecond,
+				GossipInterval:    20 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create node: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			stopped := make(chan struct{})
+			node.stop = func() {
+				handlers[i].Store(nil)
+				cancel()
+				<-stopped
+			}
+			node.Node = n
+			var h http.Handler = newHandler(n)
+			handlers[i].Store(&h)
+			go func() {
+				defer close(stopped)
+				n.Run(ctx)
+			}()
+		}
+		node.start()
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for nodes[0].Status().Leader == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for a leader")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nodes
+}
+
+// newHandler serves a node the way serve does.
+func newHandler(n *Node) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(PathPrefix+"/", n.Handler())
+	mux.Handle("/", server.New(n))
+	return mux
+}
+
+// waitFor waits for a background task to have done something.
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// replicaOf returns the i-th node the data of an object is placed on.
+func replicaOf(nodes []*testNode, bucket, object string, i int) *testNode {
+	id := nodes[0].RingStatus(bucket, object).Replicas[i]
+	for _, node := range nodes {
+		if node.id == id {
+			return node
+		}
+	}
+	return nil
+}
+
+// localKeys returns the keys of the data a node holds in a bucket.
+func localKeys(t *testing.T, node *testNode, bucket string) []string {
+	t.Helper()
+	objects, err := node.local.ListObjects(bucket)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Failed to list %s: %v", node.id, err)
+	}
+	keys := make([]string, len(objects))
+	for i, obj := range objects {
+		keys[i] = obj.Object
+	}
+	return keys
+}
+
+func read(t *testing.T, s storage.Storage, bucket, object string) (string, *storage.ObjectInfo) {
+	t.Helper()
+	body, info, err := s.Get(bucket, object)
+	if err != nil {
+		t.Fatalf("Failed to get %s/%s: %v", bucket, object, err)
+	}
+	defer body.Close()
+	data, _ := io.ReadAll(body)
+	return string(data), info
+}
+
+func TestCluster(t *testing.T) {
+	nodes := newTestCluster(t, 3)
+
+	t.Run("Writes on any node are read on every node", func(t *testing.T) {
+		for i, node := range nodes {
+			content := fmt.Sprintf("written on n%d", i+1)
+			saved, err := node.Save("docs", "shared.txt", strings.NewReader(content), storage.WithContentType("text/plain"))
+			if err != nil {
+				t.Fatalf("Failed to save on n%d: %v", i+1, err)
+			}
+			for j, other := range nodes {
+				data, info := read(t, other, "docs", "shared.txt")
+				if data != content || info.ETag != saved.ETag || info.ContentType != "text/plain" {
+					t.Errorf("n%d read %q %+v after the write on n%d", j+1, data, info, i+1)
+				}
+			}
+		}
+	})
+
+	t.Run("Overwriting releases the previous data", func(t *testing.T) {
+		// Only the latest version is left, on the two nodes placed
+		rec, err := nodes[0].lookup("docs", "shared.txt", nil)
+		if err != nil {
+			t.Fatalf("Failed to get the record: %v", err)
+		}
+		for i, node := range nodes {
+			if held := localKeys(t, node, "docs"); slices.Contains(rec.Nodes, node.id) {
+				if len(held) != 1 || held[0] != dataKey("shared.txt", rec.Version) {
+					t.Errorf("Expected n%d to hold the latest version, got %v", i+1, held)
+				}
+			} else if len(held) != 0 {
+				t.Errorf("Expected n%d to hold no data, got %v", i+1, held)
+			}
+		}
+	})
+
+	t.Run("Data is placed on the ring", func(t *testing.T) {
+		for i := range 20 {
+			object := fmt.Sprintf("placed/%d.txt", i)
+			if _, err := nodes[i%3].Save("spread", object, strings.NewReader(object)); err != nil {
+				t.Fatalf("Failed to save %s: %v", object, err)
+			}
+		}
+		held := map[string]int{}
+		for _, node := range nodes {
+			held[node.id] = len(localKeys(t, node, "spread"))
+		}
+		for i := range 20 {
+			object := fmt.Sprintf("placed/%d.txt", i)
+			rec, _ := nodes[0].lookup("spread", object, nil)
+			placed := nodes[1].RingStatus("spread", object).Replicas
+			if len(rec.Nodes) != 2 || !slices.Equal(rec.Nodes, placed) {
+				t.Errorf("Expected %s on %v, got %v", object, placed, rec.Nodes)
+			}
+		}
+		// Each object is kept twice, by more than one pair of nodes
+		if held["n1"]+held["n2"]+held["n3"] != 40 || held["n1"] == 20 && held["n2"] == 20 {
+			t.Errorf("Unexpected spread of the data %v", held)
+		}
+		if info := nodes[2].RingStatus("", ""); info.ReplicationFactor != 2 || len(info.Owners) != 3 || info.Replicas != nil {
+			t.Errorf("Unexpected ring status %+v", info)
+		}
+	})
+
+	t.Run("Reads fall back to another replica", func(t *testing.T) {
+		rec, _ := nodes[0].lookup("spread", "placed/0.txt", nil)
+		var holder, reader *testNode
+		for _, node := range nodes {
+			if node.id == rec.Nodes[0] {
+				holder = node
+			}
+			if !slices.Contains(rec.Nodes, node.id) {
+				reader = node
+			}
+		}
+		// The first replica lost its copy
+		if err := holder.local.Delete("spread", dataKey("placed/0.txt", rec.Version)); err != nil {
+			t.Fatalf("Failed to delete the copy: %v", err)
+		}
+		if data, _ := read(t, reader, "spread", "placed/0.txt"); data != "placed/0.txt" {
+			t.Errorf("Expected to read the other replica, got %q", data)
+		}
+	})
+
+	t.Run("Conditional writes race safely across nodes", func(t *testing.T) {
+		create := storage.WithConditions(storage.Conditions{IfNoneMatch: "*"})
+		if _, err := nodes[0].Save("docs", "lock", strings.NewReader("first"), create); err != nil {
+			t.Fatalf("Failed to create: %v", err)
+		}
+		if _, err := nodes[1].Save("docs", "lock", strings.NewReader("second"), create); !errors.Is(err, storage.ErrPreconditionFailed) {
+			t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+		}
+		if data, _ := read(t, nodes[2], "docs", "lock"); data != "first" {
+			t.Errorf("Expected the first write to win, got %q", data)
+		}
+		copies := 0
+		for _, node := range nodes {
+			for _, key := range localKeys(t, node, "docs") {
+				if strings.HasPrefix(key, "lock@") {
+					copies++
+				}
+			}
+		}
+		if copies != 2 {
+			t.Errorf("Expected the rejected write's data to be dropped, got %d copies", copies)
+		}
+	})
+
+	t.Run("Copies, lists and deletes", func(t *testing.T) {
+		if _, err := nodes[1].CopyObject("docs", "lock", "backup", "lock", storage.WithTags(map[string]string{"kind": "copy"})); err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+		data, info := read(t, nodes[0], "backup", "lock")
+		if data != "first" || info.Tags["kind"] != "copy" {
+			t.Errorf("Unexpected copy %q %+v", data, info)
+		}
+
+		objects, err := nodes[2].ListObjects("docs")
+		if err != nil || len(objects) != 2 || objects[0].Object != "lock" || objects[1].Object != "shared.txt" {
+			t.Fatalf("Expected lock and shared.txt, got %v %v", objects, err)
+		}
+		if _, err := nodes[2].ListObjects("missing"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected a missing bucket to not exist, got %v", err)
+		}
+
+		if err := nodes[2].Delete("docs", "lock"); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+		for i, node := range nodes {
+			if exists, err := node.Exists("docs", "lock"); exists || err != nil {
+				t.Errorf("Expected n%d to see the deletion, got %v %v", i+1, exists, err)
+			}
+		}
+		if err := nodes[0].Delete("docs", "lock"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected deleting again to fail with os.ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("Object lock is refused", func(t *testing.T) {
+		until := time.Now().Add(time.Hour)
+		if _, err := nodes[0].Save("docs", "held", strings.NewReader("held"), storage.WithLegalHold()); !errors.Is(err, storage.ErrNotImplemented) {
+			t.Errorf("Expected a legal hold to be refused, got %v", err)
+		}
+		if _, err := nodes[1].Save("docs", "held", strings.NewReader("held"), storage.WithRetention(storage.RetentionModeCompliance, until)); !errors.Is(err, storage.ErrNotImplemented) {
+			t.Errorf("Expected a retention to be refused, got %v", err)
+		}
+		if _, err := nodes[2].CopyObject("docs", "shared.txt", "docs", "held", storage.WithLegalHold()); !errors.Is(err, storage.ErrNotImplemented) {
+			t.Errorf("Expected a copy under legal hold to be refused, got %v", err)
+		}
+		if exists, err := nodes[0].Exists("docs", "held"); exists || err != nil {
+			t.Errorf("Expected nothing to be saved, got %v %v", exists, err)
+		}
+	})
+
+	t.Run("Writes wait for the write quorum", func(t *testing.T) {
+		if err := nodes[0].PutBucketQuorum("strict", &storage.QuorumConfiguration{Write: 3}); err == nil {
+			t.Error("Expected a quorum above the replication factor to be rejected")
+		}
+		if err := nodes[0].PutBucketQuorum("relaxed", &storage.QuorumConfiguration{Write: 1}); err != nil {
+			t.Fatalf("Failed to set quorums: %v", err)
+		}
+		replica := replicaOf(nodes, "strict", "a.txt", 0)
+		replica.fault.mode.Store(failing)
+		defer replica.fault.mode.Store(healthy)
+
+		// Both replicas must store it by default
+		_, err := nodes[1].Save("strict", "a.txt", strings.NewReader("a"))
+		var quorumErr *QuorumError
+		if !errors.As(err, &quorumErr) || !errors.Is(err, storage.ErrUnavailable) || quorumErr.Needed != 2 || quorumErr.Acked != 1 {
+			t.Fatalf("Expected a write quorum error, got %v", err)
+		}
+		for _, node := range nodes {
+			if held := localKeys(t, node, "strict"); len(held) != 0 {
+				t.Errorf("Expected the failed write to be dropped from %s, got %v", node.id, held)
+			}
+		}
+
+		replica = replicaOf(nodes, "relaxed", "a.txt", 0)
+		replica.fault.mode.Store(corrupting)
+		defer replica.fault.mode.Store(healthy)
+		if _, err := nodes[1].Save("relaxed", "a.txt", strings.NewReader("a")); err != nil {
+			t.Fatalf("Expected one replica to be enough, got %v", err)
+		}
+		if held := localKeys(t, replica, "relaxed"); len(held) != 0 {
+			t.Errorf("Expected the corrupt copy to be dropped, got %v", held)
+		}
+	})
+
+	t.Run("Reads check the read quorum and repair stale replicas", func(t *testing.T) {
+		if err := nodes[2].PutBucketQuorum("relaxed", &storage.QuorumConfiguration{Write: 1, Read: 2}); err != nil {
+			t.Fatalf("Failed to set quorums: %v", err)
+		}
+		// The replica that dropped its corrupt copy cannot confirm the read
+		_, _, err := nodes[0].Get("relaxed", "a.txt")
+		var quorumErr *QuorumError
+		if !errors.As(err, &quorumErr) || quorumErr.Op != "read" || quorumErr.Acked != 1 {
+			t.Fatalf("Expected a read quorum error, got %v", err)
+		}
+
+		// but the read had it repaired
+		stale := replicaOf(nodes, "relaxed", "a.txt", 0)
+		waitFor(t, "the read repair", func() bool { return len(localKeys(t, stale, "relaxed")) == 1 })
+		if data, _ := read(t, nodes[0], "relaxed", "a.txt"); data != "a" {
+			t.Errorf("Expected to read both replicas, got %q", data)
+		}
+
+		stale.fault.mode.Store(failing)
+		defer stale.fault.mode.Store(healthy)
+		if _, err := client.New(nodes[0].addr).Head("relaxed", "a.txt"); err != nil {
+			t.Errorf("Expected the metadata to be readable still, got %v", err)
+		}
+		if _, _, err := client.New(nodes[0].addr).Get("relaxed", "a.txt"); !errors.Is(err, storage.ErrUnavailable) {
+			t.Errorf("Expected ServiceUnavailable over HTTP, got %v", err)
+		}
+
+		if err := nodes[1].DeleteBucketQuorum("relaxed"); err != nil {
+			t.Fatalf("Failed to delete quorums: %v", err)
+		}
+		if q, err := nodes[0].GetBucketQuorum("relaxed"); q != nil || err != nil {
+			t.Errorf("Expected the default quorums, got %+v %v", q, err)
+		}
+	})
+
+	t.Run("Writes a replica misses are handed off to it", func(t *testing.T) {
+		if err := nodes[0].PutBucketQuorum("hinted", &storage.QuorumConfiguration{Write: 1}); err != nil {
+			t.Fatalf("Failed to set quorums: %v", err)
+		}
+		away := replicaOf(nodes, "hinted", "a.txt", 0)
+		away.fault.mode.Store(failing)
+		defer away.fault.mode.Store(healthy)
+		coordinator := nodes[0]
+		if coordinator == away {
+			coordinator = nodes[1]
+		}
+
+		if _, err := coordinator.Save("hinted", "a.txt", strings.NewReader("hinted"), storage.WithContentType("text/plain")); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		stats, err := client.New(coordinator.addr).ClusterHints()
+		if err != nil || stats.Pending != 1 || stats.Nodes[away.id] != 1 || stats.Bytes != 6 {
+			t.Fatalf("Expected a hint for %s, got %+v %v", away.id, stats, err)
+		}
+		report, err := coordinator.Handoff(context.Background())
+		if err != nil || report.Pending != 1 || report.Replayed != 0 {
+			t.Errorf("Expected the hint to wait for %s, got %+v %v", away.id, report, err)
+		}
+
+		away.fault.mode.Store(healthy)
+		report, err = coordinator.Handoff(context.Background())
+		if err != nil || report.Replayed != 1 {
+			t.Fatalf("Expected the hint to be handed off, got %+v %v", report, err)
+		}
+		rec, _ := coordinator.lookup("hinted", "a.txt", nil)
+		info, err := away.local.Head("hinted", dataKey("a.txt", rec.Version))
+		if err != nil || info.Checksum != rec.Info.Checksum || info.ContentType != "text/plain" {
+			t.Errorf("Expected %s to hold the write it missed, got %+v %v", away.id, info, err)
+		}
+		if stats, _ := coordinator.HintStats(); stats.Pending != 0 || stats.Replayed != 1 {
+			t.Errorf("Expected no hints left, got %+v", stats)
+		}
+	})
+
+	t.Run("Repair fixes what peers hold", func(t *testing.T) {
+		defer func(grace time.Duration) { orphanGrace = grace }(orphanGrace)
+		orphanGrace = 0
+
+		for _, object := range []string{"x.txt", "y.txt"} {
+			if _, err := nodes[0].Save("heal", object, strings.NewReader("content of "+object)); err != nil {
+				t.Fatalf("Failed to save %s: %v", object, err)
+			}
+		}
+		x, _ := nodes[0].lookup("heal", "x.txt", nil)
+		y, _ := nodes[0].lookup("heal", "y.txt", nil)
+		// One replica lost x, another holds other content for y, and a third
+		// holds data nothing refers to
+		lost, diverged := replicaOf(nodes, "heal", "x.txt", 0), replicaOf(nodes, "heal", "y.txt", 1)
+		if err := lost.local.Delete("heal", dataKey("x.txt", x.Version)); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+		if _, err := diverged.local.Save("heal", dataKey("y.txt", y.Version), strings.NewReader("rot")); err != nil {
+			t.Fatalf("Failed to overwrite: %v", err)
+		}
+		if _, err := nodes[2].local.Save("heal", dataKey("ghost.txt", "0000000000000000001.n9"), strings.NewReader("boo")); err != nil {
+			t.Fatalf("Failed to save the orphan: %v", err)
+		}
+
+		total := &RepairReport{}
+		for _, node := range nodes {
+			report, err := node.Repair(context.Background())
+			if err != nil {
+				t.Fatalf("Repair failed on %s: %v", node.id, err)
+			}
+			total.Repaired += report.Repaired
+			total.Removed += report.Removed
+		}
+		if total.Repaired < 2 || total.Removed < 1 {
+			t.Errorf("Expected two copies repaired and one removed, got %+v", total)
+		}
+		for _, rec := range []*record{x, y} {
+			for i := range rec.Nodes {
+				node := replicaOf(nodes, "heal", rec.Info.Object, i)
+				info, err := node.local.Head("heal", dataKey(rec.Info.Object, rec.Version))
+				if err != nil || info.Checksum != rec.Info.Checksum {
+					t.Errorf("Expected %s to hold %s again, got %v %v", node.id, rec.Info.Object, info, err)
+				}
+			}
+		}
+		if slices.ContainsFunc(localKeys(t, nodes[2], "heal"), func(key string) bool { return strings.HasPrefix(key, "ghost.txt@") }) {
+			t.Error("Expected the orphan to be removed")
+		}
+
+		// Every tree matches now
+		for _, node := range nodes {
+			report, err := node.Repair(context.Background())
+			if err != nil || report.Partitions != 0 || report.Compared == 0 {
+				t.Errorf("Expected %s to find nothing to repair, got %+v %v", node.id, report, err)
+			}
+		}
+	})
+
+	t.Run("Gossip tells which nodes are down", func(t *testing.T) {
+		state := func(observer *testNode, id string) gossip.State {
+			m, _ := observer.gossip.Member(id)
+			return m.State
+		}
+		for _, node := range nodes {
+			waitFor(t, "every node to see "+node.id+" alive", func() bool {
+				return state(nodes[0], node.id) == gossip.Alive && state(nodes[1], node.id) == gossip.Alive && state(nodes[2], node.id) == gossip.Alive
+			})
+		}
+
+		cut := nodes[2]
+		cut.stop()
+		waitFor(t, cut.id+" to be found dead", func() bool { return state(nodes[0], cut.id) == gossip.Dead })
+		if _, err := nodes[0].dataStorage(cut.id); !errors.Is(err, storage.ErrUnavailable) {
+			t.Errorf("Expected writes to skip %s, got %v", cut.id, err)
+		}
+		if order := nodes[0].readOrder([]string{cut.id, nodes[1].id}); order[0] != nodes[1].id {
+			t.Errorf("Expected reads to try %s last, got %v", cut.id, order)
+		}
+
+		// Once back, it refutes its death
+		cut.start()
+		waitFor(t, cut.id+" to be back", func() bool { return state(nodes[0], cut.id) == gossip.Alive && state(cut, nodes[0].id) == gossip.Alive })
+		if members := nodes[1].Members(); len(members) != 3 {
+			t.Errorf("Expected three members, got %+v", members)
+		}
+	})
+
+	t.Run("Serves the S3 API on every node", func(t *testing.T) {
+		if _, err := client.New(nodes[0].addr).Save("web", "index.html", strings.NewReader("<html>")); err != nil {
+			t.Fatalf("Failed to save over HTTP: %v", err)
+		}
+		data, info := read(t, client.New(nodes[2].addr), "web", "index.html")
+		if data != "<html>" || info.Size != 6 {
+			t.Errorf("Unexpected object %q %+v", data, info)
+		}
+	})
+
+	t.Run("Membership changes go through the leader", func(t *testing.T) {
+		var leader, follower *testNode
+		for _, node := range nodes {
+			if node.Status().State == raft.Leader {
+				leader = node
+			} else {
+				follower = node
+			}
+		}
+		if err := client.New(follower.addr).AddClusterMember("n4", "http://127.0.0.1:1"); err != nil {
+			t.Fatalf("Failed to add a member through a follower: %v", err)
+		}
+		status, err := client.New(leader.addr).ClusterStatus()
+		if err != nil {
+			t.Fatalf("Failed to get the status: %v", err)
+		}
+		if len(status.Members) != 4 || status.Members["n4"] != "http://127.0.0.1:1" {
+			t.Errorf("Expected n4 to be a member, got %v", status.Members)
+		}
+		if err := follower.RemoveMember(context.Background(), "n4"); err != nil {
+			t.Fatalf("Failed to remove n4: %v", err)
+		}
+		if err := client.New(nodes[0].addr).AddClusterMember("", "ftp://x"); err == nil {
+			t.Error("Expected an invalid member to be rejected")
+		}
+	})
+
+	t.Run("Rebalancing moves data off a removed node", func(t *testing.T) {
+		var leader, removed, kept *testNode
+		for _, node := range nodes {
+			switch {
+			case node.Status().State == raft.Leader:
+				leader = node
+			case removed == nil:
+				removed = node
+			default:
+				kept = node
+			}
+		}
+		for i := range 10 {
+			if _, err := leader.Save("moving", fmt.Sprintf("obj%d", i), strings.NewReader(fmt.Sprintf("data %d", i))); err != nil {
+				t.Fatalf("Failed to save: %v", err)
+			}
+		}
+		if err := leader.RemoveMember(context.Background(), removed.id); err != nil {
+			t.Fatalf("Failed to remove %s: %v", removed.id, err)
+		}
+
+		// Until the data moves, reads go to the nodes it was written to
+		data, _ := read(t, kept, "moving", "obj0")
+		if data != "data 0" {
+			t.Errorf("Expected obj0 to be read during the move, got %q", data)
+		}
+
+		status, err := leader.Rebalance(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to rebalance: %v", err)
+		}
+		if status.Running || status.Moved == 0 || status.Failed != 0 || status.MovedBytes == 0 {
+			t.Errorf("Expected objects moved without failures, got %+v", status)
+		}
+		for i := range 10 {
+			object := fmt.Sprintf("obj%d", i)
+			rec, err := leader.lookup("moving", object, nil)
+			if err != nil {
+				t.Fatalf("Failed to look %s up: %v", object, err)
+			}
+			if slices.Contains(rec.Nodes, removed.id) {
+				t.Errorf("Expected %s moved off %s, got %v", object, removed.id, rec.Nodes)
+			}
+			for _, node := range []*testNode{leader, kept} {
+				if !slices.Contains(localKeys(t, node, "moving"), dataKey(object, rec.Version)) {
+					t.Errorf("Expected %s to hold %s", node.id, object)
+				}
+			}
+			if data, _ := read(t, kept, "moving", object); data != fmt.Sprintf("data %d", i) {
+				t.Errorf("Unexpected data of %s: %q", object, data)
+			}
+		}
+
+		if moves := leader.plan(); len(moves) != 0 {
+			t.Errorf("Expected nothing left to move, got %d objects", len(moves))
+		}
+
+		// Followers report the leader's progress
+		got, err := client.New(kept.addr).ClusterRebalance()
+		if err != nil {
+			t.Fatalf("Failed to get the rebalance status: %v", err)
+		}
+		if got.Node != leader.id || got.Rate != DefaultRebalanceRate {
+			t.Errorf("Expected the status of %s, got %+v", leader.id, got)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/handoff"
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// handOff keeps hints of a write for the replicas that were unavailable,
+// copied from the replica source that stored it. This node keeps them,
+// unless it is one of those replicas, and then source does. Writes
+// encrypted with a customer key are left to read repair, as the key is
+// not kept, and archived ones to anti-entropy repair.
+func (n *Node) handOff(bucket, key, source string, down []string, opts []storage.Option) {
+	o := storage.NewOptions(opts...)
+	if len(down) == 0 || len(o.SSECustomerKey) > 0 || o.StorageClass == storage.StorageClassArchive {
+		return
+	}
+	holder := n.id
+	if slices.Contains(down, n.id) {
+		holder = source
+	}
+	from, err := n.dataStorage(source)
+	if err != nil {
+		return
+	}
+	to, err := n.dataStorage(holder)
+	if err != nil {
+		return
+	}
+
+	info := &storage.ObjectInfo{StorageClass: o.StorageClass}
+	describe(info, o)
+	for _, node := range down {
+		body, _, err := from.Get(bucket, key)
+		if err != nil {
+			return
+		}
+		_, _ = to.Save(handoff.Bucket, handoff.Key(node, bucket, key), body, dataOptions(info, nil)...)
+		body.Close()
+	}
+}
+
+// RunHandoff hands off the hints this node keeps each interval until ctx
+// is done, handing each pass to report.
+func (n *Node) RunHandoff(ctx context.Context, interval time.Duration, report func(*handoff.Report, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		report(n.Handoff(ctx))
+	}
+}
+
+// Handoff hands off the hints this node keeps to the nodes they are for,
+// those that are back at least.
+func (n *Node) Handoff(ctx context.Context) (*handoff.Report, error) {
+	if err := n.barrier(); err != nil {
+		return nil, err
+	}
+	return n.hints.Replay(ctx, n.deliverHint)
+}
+
+// HintStats describes the hints this node keeps.
+func (n *Node) HintStats() (*handoff.Stats, error) {
+	return n.hints.Stats()
+}
+
+// deliverHint stores the write a hint keeps on the node it is for. Hints of
+// versions that are no longer committed are obsolete, once their write
+// had time to commit.
+func (n *Node) deliverHint(h handoff.Hint, body io.Reader, info *storage.ObjectInfo) error {
+	i := strings.LastIndex(h.Key, "@")
+	if i < 0 {
+		return handoff.ErrObsolete
+	}
+	rec, err := n.meta.get(h.Bucket, h.Key[:i])
+	if (err != nil || rec.Version != h.Key[i+1:]) && time.Since(h.StoredAt) > requestTimeout {
+		return handoff.ErrObsolete
+	}
+
+	target, err := n.dataStorage(h.Node)
+	if err != nil {
+		return err
+	}
+	stored, err := target.Save(h.Bucket, h.Key, body, dataOptions(info, nil)...)
+	if err != nil {
+		return err
+	}
+	if stored.Checksum != "" && info.Checksum != "" && stored.Checksum != info.Checksum {
+		_ = target.Delete(h.Bucket, h.Key)
+		return fmt.Errorf("node %s: %w", h.Node, &storage.ErrInvalidChecksum{Got: stored.Checksum, Expected: info.Checksum})
+	}
+	return nil
+}
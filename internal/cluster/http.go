@@ -0,0 +1,331 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/client"
+	"github.com/iamthiago/mini-s3/internal/raft"
+	"github.com/iamthiago/mini-s3/internal/server"
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// retryInterval is how often operations retry while the cluster has no
+// leader.
+const retryInterval = 50 * time.Millisecond
+
+// Handler serves the cluster's API, which the S3 API of the node should
+// be served next to:
+//
+//	/_cluster/raft/...                Raft RPCs between nodes
+//	/_cluster/gossip/...              gossip between nodes
+//	/_cluster/data/...                the object data this node holds,
+//	                                  over the S3 API
+//	POST   /_cluster/propose          commit a command, on the leader
+//	GET    /_cluster/status           the node's view of the cluster
+//	GET    /_cluster/ring             how object data is spread over the
+//	                                  nodes, and with ?bucket=&object=
+//	                                  where that of an object goes
+//	GET    /_cluster/merkle/<bucket>  the Merkle tree of the data this
+//	                                  node holds of a bucket
+//	GET    /_cluster/merkle/<bucket>/<partition>
+//	                                  the object versions of a partition
+//	GET    /_cluster/hints            the hints this node keeps for
+//	                                  other nodes
+//	GET    /_cluster/rebalance        the progress of rebalancing, asked
+//	                                  of the leader unless ?local=true
+//	GET    /_cluster/quorum/<bucket>  the quorums of a bucket, as JSON
+//	PUT    /_cluster/quorum/<bucket>  set them
+//	DELETE /_cluster/quorum/<bucket>  use the default quorums again
+//	GET    /_cluster/members          the nodes the gossip knows of
+//	POST   /_cluster/members          add the member {"id": ..., "addr": ...}
+//	POST   /_cluster/join             join the cluster of {"addr": ...}
+//	DELETE /_cluster/members/<id>     remove a member
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(PathPrefix+"/raft/", http.StripPrefix(PathPrefix+"/raft", n.raft.Handler()))
+	mux.Handle(PathPrefix+"/gossip/", http.StripPrefix(PathPrefix+"/gossip", n.gossip.Handler()))
+	mux.Handle(PathPrefix+"/data/", http.StripPrefix(PathPrefix+"/data", server.NewInternal(n.local)))
+	mux.HandleFunc("POST "+PathPrefix+"/propose", n.serveProposal)
+	mux.HandleFunc("GET "+PathPrefix+"/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(n.Status())
+	})
+	mux.HandleFunc("GET "+PathPrefix+"/ring", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(n.RingStatus(query.Get("bucket"), query.Get("object")))
+	})
+	mux.HandleFunc("GET "+PathPrefix+"/merkle/{bucket}", n.serveMerkle)
+	mux.HandleFunc("GET "+PathPrefix+"/merkle/{bucket}/{partition}", n.serveMerkle)
+	mux.HandleFunc("GET "+PathPrefix+"/hints", func(w http.ResponseWriter, r *http.Request) {
+		stats, err := n.HintStats()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(stats)
+	})
+	mux.HandleFunc("GET "+PathPrefix+"/rebalance", func(w http.ResponseWriter, r *http.Request) {
+		status, err := n.RebalanceStatus(r.Context(), r.URL.Query().Get("local") == "true")
+		if err != nil {
+			writeResult(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(status)
+	})
+	mux.HandleFunc("GET "+PathPrefix+"/quorum/{bucket}", func(w http.ResponseWriter, r *http.Request) {
+		q, err := n.GetBucketQuorum(r.PathValue("bucket"))
+		switch {
+		case err != nil:
+			writeResult(w, err)
+		case q == nil:
+			writeError(w, http.StatusNotFound, "NoSuchQuorumConfiguration", "The bucket uses the default quorums")
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(q)
+		}
+	})
+	mux.HandleFunc("PUT "+PathPrefix+"/quorum/{bucket}", func(w http.ResponseWriter, r *http.Request) {
+		var q storage.QuorumConfiguration
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedJSON", err.Error())
+			return
+		}
+		if err := q.Validate(n.replicationFactor); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+			return
+		}
+		writeResult(w, n.PutBucketQuorum(r.PathValue("bucket"), &q))
+	})
+	mux.HandleFunc("DELETE "+PathPrefix+"/quorum/{bucket}", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, n.DeleteBucketQuorum(r.PathValue("bucket")))
+	})
+	mux.HandleFunc("GET "+PathPrefix+"/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(n.Members())
+	})
+	mux.HandleFunc("POST "+PathPrefix+"/join", func(w http.ResponseWriter, r *http.Request) {
+		var join struct {
+			Addr string `json:"addr"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&join); err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedJSON", err.Error())
+			return
+		}
+		if err := validateMember(n.id, join.Addr); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+			return
+		}
+		writeResult(w, n.Join(r.Context(), join.Addr))
+	})
+	mux.HandleFunc("POST "+PathPrefix+"/members", func(w http.ResponseWriter, r *http.Request) {
+		var member struct {
+			ID   string `json:"id"`
+			Addr string `json:"addr"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedJSON", err.Error())
+			return
+		}
+		if err := validateMember(member.ID, member.Addr); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+			return
+		}
+		writeResult(w, n.AddMember(r.Context(), member.ID, member.Addr))
+	})
+	mux.HandleFunc("DELETE "+PathPrefix+"/members/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, n.RemoveMember(r.Context(), r.PathValue("id")))
+	})
+	return mux
+}
+
+// AddMember adds a node to the cluster, through the leader.
+func (n *Node) AddMember(ctx context.Context, id, addr string) error {
+	if err := validateMember(id, addr); err != nil {
+		return err
+	}
+	return n.changeMembers(ctx,
+		func(ctx context.Context) error { return n.raft.AddMember(ctx, id, addr) },
+		func(leader *client.Client) error { return leader.AddClusterMember(id, addr) })
+}
+
+// RemoveMember removes a node from the cluster, through the leader. The
+// objects whose data only that node holds can no longer be read.
+func (n *Node) RemoveMember(ctx context.Context, id string) error {
+	return n.changeMembers(ctx,
+		func(ctx context.Context) error { return n.raft.RemoveMember(ctx, id) },
+		func(leader *client.Client) error { return leader.RemoveClusterMember(id) })
+}
+
+// changeMembers makes a membership change here when this node is the
+// leader, or asks the leader to.
+func (n *Node) changeMembers(ctx context.Context, local func(context.Context) error, forward func(*client.Client) error) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	return retryUnavailable(ctx, func() error {
+		err := local(ctx)
+		var notLeader *raft.NotLeaderError
+		// A leader without an address, like a node removed meanwhile, is
+		// waited out like no leader
+		if errors.As(err, &notLeader) && notLeader.Leader != "" && notLeader.Addr != "" {
+			return forward(client.New(notLeader.Addr))
+		}
+		return err
+	})
+}
+
+func validateMember(id, addr string) error {
+	if id == "" {
+		return errors.New("a member needs an ID")
+	}
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("member address must be an http:// or https:// URL, got %q", addr)
+	}
+	return nil
+}
+
+// propose commits a command through the leader, and returns the error
+// applying it failed with, if any.
+func (n *Node) propose(cmd *command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	var applyErr error
+	err = retryUnavailable(ctx, func() error {
+		result, err := n.raft.Propose(ctx, data)
+		var notLeader *raft.NotLeaderError
+		// Like in changeMembers, a leader without an address is waited
+		// out like no leader
+		if errors.As(err, &notLeader) && notLeader.Leader != "" && notLeader.Addr != "" {
+			applyErr, err = forwardProposal(ctx, notLeader.Addr, data)
+			return err
+		}
+		if err == nil {
+			applyErr, _ = result.(error)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", storage.ErrUnavailable, err)
+	}
+	return applyErr
+}
+
+// forwardProposal has the leader at addr commit a command. It returns the
+// error applying the command failed with, or the one committing it did.
+func forwardProposal(ctx context.Context, addr string, data []byte) (error, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+PathPrefix+"/propose", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	var e errorResponse
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = xml.Unmarshal(body, &e)
+	if known, ok := errorCodes[e.Code]; ok {
+		return known, nil
+	}
+	switch resp.StatusCode {
+	case http.StatusMisdirectedRequest:
+		// The leader changed meanwhile
+		return nil, &raft.NotLeaderError{}
+	case http.StatusConflict:
+		return errors.New(e.Message), nil
+	default:
+		return nil, fmt.Errorf("proposing to %s: %s %s", addr, resp.Status, e.Message)
+	}
+}
+
+// serveProposal commits a command forwarded by another node. It is never
+// forwarded further, so nodes disagreeing on the leader cannot loop.
+func (n *Node) serveProposal(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	result, err := n.raft.Propose(r.Context(), data)
+	if err != nil {
+		writeResult(w, err)
+		return
+	}
+	if applyErr, ok := result.(error); ok {
+		if code := errorCode(applyErr); code != "" {
+			writeError(w, http.StatusConflict, code, applyErr.Error())
+		} else {
+			writeError(w, http.StatusConflict, "InvalidCommand", applyErr.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// retryUnavailable calls f until it does not fail for lack of a leader,
+// like during an election, or ctx is done.
+func retryUnavailable(ctx context.Context, f func() error) error {
+	for {
+		err := f()
+		var notLeader *raft.NotLeaderError
+		if !errors.As(err, &notLeader) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+// writeError writes an error in the format of the S3 API, which
+// client.Client reads.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(errorResponse{Code: code, Message: message})
+}
+
+func writeResult(w http.ResponseWriter, err error) {
+	var notLeader *raft.NotLeaderError
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.As(err, &notLeader):
+		writeError(w, http.StatusMisdirectedRequest, "NotLeader", err.Error())
+	case errors.Is(err, raft.ErrMembershipChangePending), errors.Is(err, raft.ErrLastMember):
+		writeError(w, http.StatusConflict, "OperationAborted", err.Error())
+	default:
+		writeError(w, http.StatusServiceUnavailable, "ServiceUnavailable", err.Error())
+	}
+}
@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/iamthiago/mini-s3/internal/client"
+	"github.com/iamthiago/mini-s3/internal/gossip"
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// Members returns the nodes the gossip knows of, with whether they are
+// alive and what they tell about themselves.
+func (n *Node) Members() []gossip.Member {
+	return n.gossip.Members()
+}
+
+// Join makes this node a member of the cluster the node at addr is in: it
+// joins the gossip through that node, then has the cluster's leader add it
+// to the Raft membership, unless it is a member already.
+func (n *Node) Join(ctx context.Context, addr string) error {
+	self, _ := n.gossip.Member(n.id)
+	if self.Addr == "" {
+		return fmt.Errorf("node %s does not know the address the others reach it at", n.id)
+	}
+	if err := validateMember(n.id, addr); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	if err := n.gossip.Join(ctx, addr); err != nil {
+		return fmt.Errorf("%w: joining through %s: %w", storage.ErrUnavailable, addr, err)
+	}
+	if n.raft.Status().Members[n.id] == self.Addr {
+		return nil
+	}
+	return client.New(addr).AddClusterMember(n.id, self.Addr)
+}
+
+// seeds returns the addresses of the Raft members, which the gossip joins
+// through while it knows of no other node.
+func (n *Node) seeds() []string {
+	members := n.raft.Status().Members
+	var addrs []string
+	for _, id := range slices.Sorted(maps.Keys(members)) {
+		if id != n.id {
+			addrs = append(addrs, members[id])
+		}
+	}
+	return addrs
+}
+
+// down tells whether the gossip found a node dead. Writes skip such nodes,
+// leaving hints for them instead, and reads try them last.
+func (n *Node) down(node string) bool {
+	m, ok := n.gossip.Member(node)
+	return ok && m.State == gossip.Dead
+}
@@ -0,0 +1,177 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/ring"
+)
+
+// merklePartitions is how many partitions the objects of a bucket are
+// split into by key hash, each a leaf of the bucket's Merkle tree.
+const merklePartitions = 64
+
+// holding is a version of an object whose data a node holds, or should.
+type holding struct {
+	Object   string `json:"object"`
+	Version  string `json:"version"`
+	Checksum string `json:"checksum"`
+
+	// StoredAt is when the node stored the data, left out of the tree.
+	StoredAt time.Time `json:"storedAt,omitzero"`
+}
+
+// merkleTree is a binary hash tree over the partitions of a bucket, in
+// heap order: the root first, and the children of i at 2i+1 and 2i+2. The
+// leaves, from merklePartitions-1 on, hash the holdings of a partition, so
+// two nodes holding the same versions with the same checksums have the
+// same tree, and comparing trees finds where they differ cheaply.
+type merkleTree []string
+
+func partitionOf(object string) int {
+	return int(ring.Hash(object) % merklePartitions)
+}
+
+func newMerkleTree(holdings []holding) merkleTree {
+	leaves := make([][]holding, merklePartitions)
+	for _, h := range holdings {
+		p := partitionOf(h.Object)
+		leaves[p] = append(leaves[p], h)
+	}
+
+	tree := make(merkleTree, 2*merklePartitions-1)
+	for p, leaf := range leaves {
+		sortHoldings(leaf)
+		sum := sha256.New()
+		for _, h := range leaf {
+			fmt.Fprintf(sum, "%s\x00%s\x00%s\n", h.Object, h.Version, h.Checksum)
+		}
+		tree[merklePartitions-1+p] = hex.EncodeToString(sum.Sum(nil))
+	}
+	for i := merklePartitions - 2; i >= 0; i-- {
+		sum := sha256.Sum256([]byte(tree[2*i+1] + tree[2*i+2]))
+		tree[i] = hex.EncodeToString(sum[:])
+	}
+	return tree
+}
+
+// diff returns the partitions whose leaves differ between the trees,
+// descending only into subtrees whose hashes differ.
+func (t merkleTree) diff(other merkleTree) []int {
+	if len(other) != len(t) {
+		// A tree of another shape tells nothing, so every partition differs
+		parts := make([]int, merklePartitions)
+		for p := range parts {
+			parts[p] = p
+		}
+		return parts
+	}
+
+	var parts []int
+	var walk func(i int)
+	walk = func(i int) {
+		if t[i] == other[i] {
+			return
+		}
+		if i >= merklePartitions-1 {
+			parts = append(parts, i-(merklePartitions-1))
+			return
+		}
+		walk(2*i + 1)
+		walk(2*i + 2)
+	}
+	walk(0)
+	return parts
+}
+
+func sortHoldings(holdings []holding) {
+	sort.Slice(holdings, func(i, j int) bool {
+		if holdings[i].Object != holdings[j].Object {
+			return holdings[i].Object < holdings[j].Object
+		}
+		return holdings[i].Version < holdings[j].Version
+	})
+}
+
+// holdings returns the object versions this node holds data of in a
+// bucket, those of one partition unless partition is negative.
+func (n *Node) holdings(bucket string, partition int) ([]holding, error) {
+	objects, err := n.local.ListObjects(bucket)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var holdings []holding
+	for _, obj := range objects {
+		i := strings.LastIndex(obj.Object, "@")
+		if i < 0 {
+			continue
+		}
+		h := holding{Object: obj.Object[:i], Version: obj.Object[i+1:], Checksum: obj.Checksum, StoredAt: obj.CreatedAt}
+		if partition < 0 || partitionOf(h.Object) == partition {
+			holdings = append(holdings, h)
+		}
+	}
+	return holdings, nil
+}
+
+// serveMerkle serves the Merkle tree of what this node holds of a bucket,
+// or with a partition, the holdings of that partition.
+func (n *Node) serveMerkle(w http.ResponseWriter, r *http.Request) {
+	partition := -1
+	if p := r.PathValue("partition"); p != "" {
+		var err error
+		if partition, err = strconv.Atoi(p); err != nil || partition < 0 || partition >= merklePartitions {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("invalid partition %q", p))
+			return
+		}
+	}
+	holdings, err := n.holdings(r.PathValue("bucket"), partition)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if partition < 0 {
+		_ = json.NewEncoder(w).Encode(newMerkleTree(holdings))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(holdings)
+}
+
+// fetchMerkle reads the Merkle tree of what the node at addr holds of a
+// bucket, or with a partition, the holdings of that partition, into v.
+func fetchMerkle(ctx context.Context, addr, bucket string, partition int, v any) error {
+	target := addr + PathPrefix + "/merkle/" + url.PathEscape(bucket)
+	if partition >= 0 {
+		target += "/" + strconv.Itoa(partition)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("reading the Merkle tree of %s: %s", addr, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMerkleTree(t *testing.T) {
+	holdings := []holding{
+		{Object: "a.txt", Version: "v1", Checksum: "c1"},
+		{Object: "b.txt", Version: "v1", Checksum: "c2"},
+		{Object: "c.txt", Version: "v2", Checksum: "c3"},
+	}
+	tree := newMerkleTree(holdings)
+
+	tests := []struct {
+		name     string
+		other    []holding
+		expected []int
+	}{
+		{
+			name:     "Same holdings in another order",
+			other:    []holding{holdings[2], holdings[0], holdings[1]},
+			expected: nil,
+		},
+		{
+			name:     "Missing object",
+			other:    holdings[:2],
+			expected: []int{partitionOf("c.txt")},
+		},
+		{
+			name:     "Other checksum",
+			other:    []holding{holdings[0], holdings[1], {Object: "c.txt", Version: "v2", Checksum: "rot"}},
+			expected: []int{partitionOf("c.txt")},
+		},
+		{
+			name:     "Other version",
+			other:    []holding{{Object: "a.txt", Version: "v2", Checksum: "c1"}, holdings[1], holdings[2]},
+			expected: []int{partitionOf("a.txt")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if parts := tree.diff(newMerkleTree(tt.other)); !slices.Equal(parts, tt.expected) {
+				t.Errorf("Expected partitions %v to differ, got %v", tt.expected, parts)
+			}
+		})
+	}
+
+	t.Run("A tree of another shape differs everywhere", func(t *testing.T) {
+		if parts := tree.diff(merkleTree{"root"}); len(parts) != merklePartitions {
+			t.Errorf("Expected every partition to differ, got %v", parts)
+		}
+	})
+}
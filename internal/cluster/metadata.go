@@ -0,0 +1,254 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// Operations of the commands committed through the Raft log.
+const (
+	opPut          = "put"
+	opDelete       = "delete"
+	opPutQuorum    = "put-quorum"
+	opDeleteQuorum = "delete-quorum"
+	opMove         = "move"
+)
+
+// errMoved is returned for a move of an object version that was
+// overwritten or deleted meanwhile.
+var errMoved = errors.New("the object changed while its data was moved")
+
+// record is the committed metadata of an object.
+type record struct {
+	// Version identifies the write that stored the object, and names its
+	// data on the nodes holding it. Nodes are the replicas the data was
+	// placed on, of which some may have missed the write.
+	Version string   `json:"version"`
+	Nodes   []string `json:"nodes"`
+
+	Info storage.ObjectInfo `json:"info"`
+}
+
+// objectInfo returns a copy of the object's metadata for callers.
+func (r *record) objectInfo() *storage.ObjectInfo {
+	info := r.Info
+	return &info
+}
+
+// command is a change to the metadata, committed through the Raft log.
+// Conditions are checked when the command is applied, against the object
+// as the log left it, which makes conditional writes atomic across nodes.
+type command struct {
+	Op         string              `json:"op"`
+	Bucket     string              `json:"bucket"`
+	Object     string              `json:"object"`
+	Record     *record             `json:"record,omitempty"`
+	Conditions *storage.Conditions `json:"conditions,omitempty"`
+
+	Quorum *storage.QuorumConfiguration `json:"quorum,omitempty"`
+}
+
+// metadata is the state machine of the cluster: every bucket, the records
+// of the objects in them, and the quorums of the buckets that set theirs.
+type metadata struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string]*record
+	quorums map[string]*storage.QuorumConfiguration
+
+	// released is called with the records writes replace or delete, once
+	// they are, so nodes can drop the data no record references anymore.
+	released func(bucket, object string, r *record)
+}
+
+func newMetadata(released func(bucket, object string, r *record)) *metadata {
+	return &metadata{
+		buckets:  map[string]map[string]*record{},
+		quorums:  map[string]*storage.QuorumConfiguration{},
+		released: released,
+	}
+}
+
+// Apply applies a command, and returns the error it failed with, if any.
+func (m *metadata) Apply(data []byte) any {
+	var cmd command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return fmt.Errorf("invalid cluster command: %w", err)
+	}
+
+	m.mu.Lock()
+	previous, err := m.apply(&cmd)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if previous != nil && m.released != nil {
+		m.released(cmd.Bucket, cmd.Object, previous)
+	}
+	return nil
+}
+
+// apply applies a command, and returns the record it replaced or deleted.
+func (m *metadata) apply(cmd *command) (*record, error) {
+	objects := m.buckets[cmd.Bucket]
+	current := objects[cmd.Object]
+	if cmd.Conditions != nil {
+		var info *storage.ObjectInfo
+		if current != nil {
+			info = &current.Info
+		}
+		if err := cmd.Conditions.Check(info, false); err != nil {
+			return nil, err
+		}
+	}
+
+	switch cmd.Op {
+	case opPutQuorum:
+		m.quorums[cmd.Bucket] = cmd.Quorum
+		return nil, nil
+	case opDeleteQuorum:
+		delete(m.quorums, cmd.Bucket)
+		return nil, nil
+	case opPut:
+		if objects == nil {
+			objects = map[string]*record{}
+			m.buckets[cmd.Bucket] = objects
+		}
+		objects[cmd.Object] = cmd.Record
+	case opDelete:
+		if current == nil {
+			return nil, os.ErrNotExist
+		}
+		delete(objects, cmd.Object)
+	case opMove:
+		// The data stays the same, so nothing is released. The nodes it moved
+		// off keep their copies until repair finds them unreferenced, which
+		// lets reads that started before finish.
+		if current == nil || cmd.Record == nil || current.Version != cmd.Record.Version {
+			return nil, errMoved
+		}
+		moved := *current
+		moved.Nodes = cmd.Record.Nodes
+		objects[cmd.Object] = &moved
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown cluster command %q", cmd.Op)
+	}
+	return current, nil
+}
+
+// get returns the record of an object, or os.ErrNotExist.
+func (m *metadata) get(bucket, object string) (*record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	r, ok := m.buckets[bucket][object]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return r, nil
+}
+
+// list returns the records of a bucket sorted by key, or os.ErrNotExist
+// for a bucket never written to.
+func (m *metadata) list(bucket string) ([]*record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	objects, ok := m.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("bucket %s: %w", bucket, os.ErrNotExist)
+	}
+	records := make([]*record, 0, len(objects))
+	for _, r := range objects {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return strings.Compare(records[i].Info.Object, records[j].Info.Object) < 0
+	})
+	return records, nil
+}
+
+// bucketNames returns the buckets holding objects, sorted.
+func (m *metadata) bucketNames() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Sorted(maps.Keys(m.buckets))
+}
+
+// expected returns the object versions a node should hold data of in a
+// bucket, those of one partition unless partition is negative.
+func (m *metadata) expected(bucket, node string, partition int) []holding {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var holdings []holding
+	for object, r := range m.buckets[bucket] {
+		if !slices.Contains(r.Nodes, node) || (partition >= 0 && partitionOf(object) != partition) {
+			continue
+		}
+		holdings = append(holdings, holding{Object: object, Version: r.Version, Checksum: r.Info.Checksum})
+	}
+	return holdings
+}
+
+// quorum returns the quorums a bucket set, or the zero configuration.
+func (m *metadata) quorum(bucket string) storage.QuorumConfiguration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if q := m.quorums[bucket]; q != nil {
+		return *q
+	}
+	return storage.QuorumConfiguration{}
+}
+
+// state is the metadata as snapshots hold it.
+type state struct {
+	Buckets map[string]map[string]*record           `json:"buckets"`
+	Quorums map[string]*storage.QuorumConfiguration `json:"quorums"`
+}
+
+func (m *metadata) Snapshot() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return json.Marshal(state{Buckets: m.buckets, Quorums: m.quorums})
+}
+
+func (m *metadata) Restore(data []byte) error {
+	st := state{
+		Buckets: map[string]map[string]*record{},
+		Quorums: map[string]*storage.QuorumConfiguration{},
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	if st.Buckets == nil || st.Quorums == nil {
+		return errors.New("invalid cluster snapshot")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buckets = st.Buckets
+	m.quorums = st.Quorums
+	return nil
+}
+
+// Apply errors cross nodes when proposals are forwarded to the leader, so
+// the ones callers check for are sent as codes.
+var errorCodes = map[string]error{
+	"PreconditionFailed": storage.ErrPreconditionFailed,
+	"NoSuchKey":          os.ErrNotExist,
+}
+
+func errorCode(err error) string {
+	for code, known := range errorCodes {
+		if errors.Is(err, known) {
+			return code
+		}
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func apply(t *testing.T, m *metadata, cmd *command) error {
+	t.Helper()
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	err, _ = m.Apply(data).(error)
+	return err
+}
+
+func put(version, etag string) *command {
+	return &command{Op: opPut, Bucket: "docs", Object: "a.txt", Record: &record{
+		Version: version,
+		Nodes:   []string{"n1"},
+		Info:    storage.ObjectInfo{Bucket: "docs", Object: "a.txt", ETag: etag},
+	}}
+}
+
+func TestMetadata(t *testing.T) {
+	var released []string
+	m := newMetadata(func(bucket, object string, r *record) {
+		released = append(released, r.Version)
+	})
+
+	tests := []struct {
+		name     string
+		cmd      *command
+		wantErr  error
+		released []string
+	}{
+		{
+			name: "Puts a new object",
+			cmd:  put("v1", "e1"),
+		},
+		{
+			name:     "Overwrites it and releases the previous version",
+			cmd:      put("v2", "e2"),
+			released: []string{"v1"},
+		},
+		{
+			name:     "Rejects a put whose conditions fail",
+			cmd:      &command{Op: opPut, Bucket: "docs", Object: "a.txt", Record: put("v3", "e3").Record, Conditions: &storage.Conditions{IfMatch: "e1"}},
+			wantErr:  storage.ErrPreconditionFailed,
+			released: []string{"v1"},
+		},
+		{
+			name:     "Accepts a put whose conditions hold",
+			cmd:      &command{Op: opPut, Bucket: "docs", Object: "a.txt", Record: put("v3", "e3").Record, Conditions: &storage.Conditions{IfMatch: "e2"}},
+			released: []string{"v1", "v2"},
+		},
+		{
+			name:     "Moves its data without releasing it",
+			cmd:      &command{Op: opMove, Bucket: "docs", Object: "a.txt", Record: &record{Version: "v3", Nodes: []string{"n2", "n3"}}},
+			released: []string{"v1", "v2"},
+		},
+		{
+			name:     "Rejects moving a version that was overwritten",
+			cmd:      &command{Op: opMove, Bucket: "docs", Object: "a.txt", Record: &record{Version: "v2", Nodes: []string{"n1"}}},
+			wantErr:  errMoved,
+			released: []string{"v1", "v2"},
+		},
+		{
+			name:     "Deletes it",
+			cmd:      &command{Op: opDelete, Bucket: "docs", Object: "a.txt"},
+			released: []string{"v1", "v2", "v3"},
+		},
+		{
+			name:     "Fails to delete a missing object",
+			cmd:      &command{Op: opDelete, Bucket: "docs", Object: "a.txt"},
+			wantErr:  os.ErrNotExist,
+			released: []string{"v1", "v2", "v3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := apply(t, m, tt.cmd); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if len(released) != len(tt.released) {
+				t.Errorf("Expected released versions %v, got %v", tt.released, released)
+			}
+		})
+	}
+
+	t.Run("Sets and deletes bucket quorums", func(t *testing.T) {
+		q := &storage.QuorumConfiguration{Write: 2, Read: 1}
+		if err := apply(t, m, &command{Op: opPutQuorum, Bucket: "docs", Quorum: q}); err != nil {
+			t.Fatalf("Failed to set quorums: %v", err)
+		}
+		if got := m.quorum("docs"); got != *q {
+			t.Errorf("Expected %+v, got %+v", q, got)
+		}
+		if err := apply(t, m, &command{Op: opDeleteQuorum, Bucket: "docs"}); err != nil {
+			t.Fatalf("Failed to delete quorums: %v", err)
+		}
+		if got := m.quorum("docs"); got != (storage.QuorumConfiguration{}) {
+			t.Errorf("Expected no quorums, got %+v", got)
+		}
+	})
+
+	t.Run("Restores a snapshot", func(t *testing.T) {
+		if err := apply(t, m, put("v4", "e4")); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+		q := &storage.QuorumConfiguration{Read: 2}
+		if err := apply(t, m, &command{Op: opPutQuorum, Bucket: "docs", Quorum: q}); err != nil {
+			t.Fatalf("Failed to set quorums: %v", err)
+		}
+		snapshot, err := m.Snapshot()
+		if err != nil {
+			t.Fatalf("Failed to snapshot: %v", err)
+		}
+
+		restored := newMetadata(nil)
+		if err := restored.Restore(snapshot); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		rec, err := restored.get("docs", "a.txt")
+		if err != nil || rec.Version != "v4" || rec.Info.ETag != "e4" {
+			t.Errorf("Unexpected record %+v %v", rec, err)
+		}
+		if records, err := restored.list("docs"); err != nil || len(records) != 1 {
+			t.Errorf("Expected one record, got %v %v", records, err)
+		}
+		if got := restored.quorum("docs"); got.Read != 2 {
+			t.Errorf("Expected the quorums to be restored, got %+v", got)
+		}
+		if err := restored.Restore([]byte(`{"buckets": null}`)); err == nil {
+			t.Error("Expected an incomplete snapshot to be rejected")
+		}
+	})
+}
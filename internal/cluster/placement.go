@@ -0,0 +1,215 @@
+package cluster
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/gossip"
+	"github.com/iamthiago/mini-s3/internal/ring"
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// DefaultReplicationFactor is how many nodes keep each object's data when
+// none is configured.
+const DefaultReplicationFactor = 3
+
+// placement returns the nodes the data of an object is written to, on the
+// ring of the current members.
+func (n *Node) placement(bucket, object string) []string {
+	return n.ring().Lookup(placementKey(bucket, object), n.replicationFactor)
+}
+
+// ring returns the ring of the current members, built again when they
+// change.
+func (n *Node) ring() *ring.Ring {
+	members := slices.Sorted(maps.Keys(n.raft.Status().Members))
+	n.ringMu.Lock()
+	defer n.ringMu.Unlock()
+	if n.hashRing == nil || !slices.Equal(n.hashRing.Nodes(), members) {
+		n.hashRing = ring.New(members, n.virtualNodes)
+	}
+	return n.hashRing
+}
+
+// RingStatus describes how the data of objects is spread over the nodes,
+// and where that of bucket/object goes when both are given.
+func (n *Node) RingStatus(bucket, object string) *ring.Status {
+	r := n.ring()
+	status := &ring.Status{
+		ReplicationFactor: n.replicationFactor,
+		VirtualNodes:      r.VirtualNodes(),
+		Owners:            r.Ownership(n.replicationFactor),
+	}
+	if bucket != "" && object != "" {
+		status.Key = placementKey(bucket, object)
+		status.Replicas = r.Lookup(status.Key, n.replicationFactor)
+	}
+	return status
+}
+
+func placementKey(bucket, object string) string {
+	return bucket + "/" + object
+}
+
+// store writes an object's data to every node at once, streaming it to
+// them as it is read. It succeeds once quorum of them stored it with the
+// checksum of what was read, and returns what they tell about the data,
+// preferring this node's fuller answer. The data is removed again from the
+// nodes that failed, or from all of them when the write does, and hints of
+// it are kept for the nodes that were unavailable.
+func (n *Node) store(bucket, key string, r io.Reader, nodes []string, quorum int, opts []storage.Option) (*storage.ObjectInfo, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: node %s is not a member of a cluster yet", storage.ErrUnavailable, n.id)
+	}
+
+	type result struct {
+		info *storage.ObjectInfo
+		err  error
+	}
+	results := make([]result, len(nodes))
+	writers := make([]*io.PipeWriter, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := n.dataStorage(node)
+			if err == nil {
+				results[i].info, err = s.Save(bucket, key, pr, opts...)
+			}
+			results[i].err = err
+			// A node that stopped reading early must not block the others
+			pr.CloseWithError(errStopped)
+		}()
+	}
+	hash := sha256.New()
+	_, copyErr := io.Copy(&fanout{writers: writers}, io.TeeReader(r, hash))
+	for _, w := range writers {
+		w.CloseWithError(copyErr)
+	}
+	wg.Wait()
+	if copyErr != nil && !errors.Is(copyErr, errStopped) {
+		n.discard(bucket, key, nodes)
+		return nil, copyErr
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	var info *storage.ObjectInfo
+	var source string
+	var failed, down []string
+	var errs []error
+	for i, res := range results {
+		if res.err == nil && res.info.Checksum != "" && res.info.Checksum != checksum {
+			res.err = &storage.ErrInvalidChecksum{Got: res.info.Checksum, Expected: checksum}
+		}
+		if res.err != nil {
+			failed = append(failed, nodes[i])
+			errs = append(errs, fmt.Errorf("node %s: %w", nodes[i], res.err))
+			var invalid *storage.ErrInvalidChecksum
+			if requestError([]error{res.err}) == nil && !errors.As(res.err, &invalid) {
+				down = append(down, nodes[i])
+			}
+			continue
+		}
+		if info == nil || nodes[i] == n.id {
+			info, source = res.info, nodes[i]
+		}
+	}
+
+	acked := len(nodes) - len(failed)
+	if acked < quorum {
+		n.discard(bucket, key, nodes)
+		if err := requestError(errs); err != nil {
+			return nil, err
+		}
+		return nil, &QuorumError{Op: "write", Needed: quorum, Acked: acked, Replicas: len(nodes), Err: errors.Join(errs...)}
+	}
+	n.discard(bucket, key, failed)
+	n.handOff(bucket, key, source, down, opts)
+	info.Checksum = checksum
+	return info, nil
+}
+
+// discard removes the data stored under key from the nodes, as far as they
+// can be reached.
+func (n *Node) discard(bucket, key string, nodes []string) {
+	for _, node := range nodes {
+		if s, err := n.dataStorage(node); err == nil {
+			_ = s.Delete(bucket, key)
+		}
+	}
+}
+
+// readOrder returns the nodes holding an object's data in the order to try
+// them in: this node first, then the others in placement order, those the
+// gossip tells are down or suspected last.
+func (n *Node) readOrder(nodes []string) []string {
+	if i := slices.Index(nodes, n.id); i > 0 {
+		nodes = slices.Concat(nodes[i:i+1], nodes[:i], nodes[i+1:])
+	}
+	healthy := func(node string) int {
+		if m, ok := n.gossip.Member(node); ok && m.State != gossip.Alive {
+			return 1
+		}
+		return 0
+	}
+	return slices.SortedStableFunc(slices.Values(nodes), func(a, b string) int {
+		return healthy(a) - healthy(b)
+	})
+}
+
+// describe completes what remote nodes tell about an object they stored,
+// which leaves out the headers and tags it was saved with.
+func describe(info *storage.ObjectInfo, o *storage.Options) {
+	info.ContentType = o.ContentType
+	info.ContentEncoding = o.ContentEncoding
+	info.ContentDisposition = o.ContentDisposition
+	info.CacheControl = o.CacheControl
+	info.Expires = o.Expires
+	info.UserMetadata = o.UserMetadata
+	info.Tags = o.Tags
+	if info.CreatedAt.IsZero() {
+		info.CreatedAt = time.Now()
+	}
+}
+
+// errStopped tells the copy of an object's data that every node stopped
+// reading it.
+var errStopped = errors.New("every node stopped reading the object's data")
+
+// fanout writes to several pipes, dropping those whose reader went away,
+// and only fails once all of them did.
+type fanout struct {
+	writers []*io.PipeWriter
+	dropped []bool
+}
+
+func (f *fanout) Write(p []byte) (int, error) {
+	if f.dropped == nil {
+		f.dropped = make([]bool, len(f.writers))
+	}
+	live := 0
+	for i, w := range f.writers {
+		if f.dropped[i] {
+			continue
+		}
+		if _, err := w.Write(p); err != nil {
+			f.dropped[i] = true
+			continue
+		}
+		live++
+	}
+	if live == 0 {
+		return 0, errStopped
+	}
+	return len(p), nil
+}
@@ -0,0 +1,179 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// QuorumError reports that fewer replicas than a quorum stored or agreed
+// on an object. It is an unavailability of the cluster, and unwraps to
+// storage.ErrUnavailable.
+type QuorumError struct {
+	// Op is "write" or "read".
+	Op       string
+	Needed   int
+	Acked    int
+	Replicas int
+	Err      error
+}
+
+func (e *QuorumError) Error() string {
+	msg := fmt.Sprintf("%s quorum not met: %d of %d replicas needed, %d answered", e.Op, e.Needed, e.Replicas, e.Acked)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap leaves out the errors of the replicas, which would tell about
+// them rather than the object, like a replica missing it.
+func (e *QuorumError) Unwrap() error {
+	return storage.ErrUnavailable
+}
+
+// quorums returns the write and read quorums of a bucket for objects kept
+// by the given number of replicas. Writes default to a majority of them,
+// and reads to one, which the Raft log keeps consistent already.
+func (n *Node) quorums(bucket string, replicas int) (write, read int) {
+	q := n.meta.quorum(bucket)
+	write, read = q.Write, q.Read
+	if write == 0 {
+		write = replicas/2 + 1
+	}
+	if read == 0 {
+		read = 1
+	}
+	return write, read
+}
+
+// PutBucketQuorum sets the quorums of a bucket.
+func (n *Node) PutBucketQuorum(bucket string, q *storage.QuorumConfiguration) error {
+	if err := q.Validate(n.replicationFactor); err != nil {
+		return err
+	}
+	return n.propose(&command{Op: opPutQuorum, Bucket: bucket, Quorum: q})
+}
+
+// GetBucketQuorum returns the quorums a bucket set, or nil.
+func (n *Node) GetBucketQuorum(bucket string) (*storage.QuorumConfiguration, error) {
+	if err := n.barrier(); err != nil {
+		return nil, err
+	}
+	q := n.meta.quorum(bucket)
+	if q == (storage.QuorumConfiguration{}) {
+		return nil, nil
+	}
+	return &q, nil
+}
+
+// DeleteBucketQuorum makes a bucket use the default quorums again.
+func (n *Node) DeleteBucketQuorum(bucket string) error {
+	return n.propose(&command{Op: opDeleteQuorum, Bucket: bucket})
+}
+
+// verify checks that a replica holds the version of an object its record
+// was committed with. Versions name the data, so a replica holding other
+// content has a corrupt or foreign copy.
+func verify(rec *record, info *storage.ObjectInfo) error {
+	if info.Checksum != "" && rec.Info.Checksum != "" && info.Checksum != rec.Info.Checksum {
+		return &storage.ErrInvalidChecksum{Got: info.Checksum, Expected: rec.Info.Checksum}
+	}
+	return nil
+}
+
+// confirm has replicas other than the one an object is read from confirm
+// they hold the committed version, until needed of them did. It returns
+// how many did, and the replicas found stale.
+func (n *Node) confirm(bucket, object string, rec *record, nodes []string, needed int, opts []storage.Option) (int, []string, []error) {
+	confirmed := 0
+	var stale []string
+	var errs []error
+	for _, node := range nodes {
+		if confirmed == needed {
+			break
+		}
+		data, err := n.dataStorage(node)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		info, err := data.Head(bucket, dataKey(object, rec.Version), opts...)
+		if err == nil {
+			err = verify(rec, info)
+		}
+		if err != nil {
+			if isStale(err) {
+				stale = append(stale, node)
+			}
+			errs = append(errs, fmt.Errorf("node %s: %w", node, err))
+			continue
+		}
+		confirmed++
+	}
+	return confirmed, stale, errs
+}
+
+// isStale reports whether a replica failed for missing the committed
+// version of an object, or holding another checksum of it, which read
+// repair fixes.
+func isStale(err error) bool {
+	var checksumErr *storage.ErrInvalidChecksum
+	return errors.Is(err, os.ErrNotExist) || errors.As(err, &checksumErr)
+}
+
+// readBody reads an object's data from its replicas, once read of them
+// agree on its version and checksum. The stale replicas it comes across
+// are repaired in the background.
+func (n *Node) readBody(bucket, object string, rec *record, read int, opts []storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
+	order := n.readOrder(rec.Nodes)
+	var stale []string
+	var errs []error
+	for i, node := range order {
+		data, err := n.dataStorage(node)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		body, info, err := data.Get(bucket, dataKey(object, rec.Version), opts...)
+		if err == nil {
+			if err = verify(rec, info); err != nil {
+				body.Close()
+			}
+		}
+		if err != nil {
+			if isStale(err) {
+				stale = append(stale, node)
+			}
+			errs = append(errs, fmt.Errorf("node %s: %w", node, err))
+			continue
+		}
+
+		confirmed, confirmStale, confirmErrs := n.confirm(bucket, object, rec, order[i+1:], read-1, headOptions(opts))
+		if stale = append(stale, confirmStale...); len(stale) > 0 {
+			go n.readRepair(bucket, rec, node, stale, storage.NewOptions(opts...).SSECustomerKey)
+		}
+		if confirmed < read-1 {
+			body.Close()
+			errs = append(errs, confirmErrs...)
+			return nil, nil, &QuorumError{Op: "read", Needed: read, Acked: confirmed + 1, Replicas: len(rec.Nodes), Err: errors.Join(errs...)}
+		}
+		return body, info, nil
+	}
+	if err := requestError(errs); err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, &QuorumError{Op: "read", Needed: read, Replicas: len(rec.Nodes), Err: errors.Join(errs...)}
+}
+
+// headOptions keeps the options of a read that Head takes, leaving out the
+// range.
+func headOptions(opts []storage.Option) []storage.Option {
+	return append(slices.Clone(opts), func(o *storage.Options) {
+		o.Range = nil
+	})
+}
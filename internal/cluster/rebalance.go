@@ -0,0 +1,307 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/raft"
+	"github.com/iamthiago/mini-s3/internal/ring"
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// DefaultRebalanceRate is how many bytes per second rebalancing moves when
+// no rate is configured.
+const DefaultRebalanceRate = 64 << 20
+
+// rebalancer tracks the progress of moving object data onto the nodes the
+// ring places it on.
+type rebalancer struct {
+	// pass is held while a pass runs, and mu while status changes.
+	pass   sync.Mutex
+	mu     sync.Mutex
+	status ring.Rebalance
+}
+
+func (r *rebalancer) update(f func(*ring.Rebalance)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(&r.status)
+}
+
+func (r *rebalancer) snapshot() *ring.Rebalance {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.status
+	return &status
+}
+
+// move is an object version whose data moves to other nodes.
+type move struct {
+	bucket string
+	rec    *record
+	nodes  []string
+}
+
+// RunRebalance runs a rebalance pass each interval until ctx is done,
+// while this node is the leader, handing each pass that moved something
+// to report.
+func (n *Node) RunRebalance(ctx context.Context, interval time.Duration, report func(*ring.Rebalance, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if n.raft.Status().State != raft.Leader {
+			continue
+		}
+		status, err := n.Rebalance(ctx)
+		if err != nil || status.Keys > 0 {
+			report(status, err)
+		}
+	}
+}
+
+// Rebalance moves the data of the objects whose nodes differ from those
+// the ring places them on now, like after a node joined or left. Each
+// object's data is copied from a replica holding it to the nodes missing
+// it, at most at the rebalance rate, and then its record is committed with
+// the new nodes. Until then reads go to the nodes it had, so they keep
+// working while data moves. Objects encrypted with a customer key cannot
+// be copied, as the key is not kept, and neither can archived ones.
+//
+// A pass is not started while another runs; the status of the running one
+// is returned then.
+func (n *Node) Rebalance(ctx context.Context) (*ring.Rebalance, error) {
+	if !n.rebalancing.pass.TryLock() {
+		return n.rebalancing.snapshot(), nil
+	}
+	defer n.rebalancing.pass.Unlock()
+	if err := n.barrier(); err != nil {
+		return nil, err
+	}
+
+	moves := n.plan()
+	now := time.Now()
+	n.rebalancing.update(func(s *ring.Rebalance) {
+		s.Node = n.id
+		s.Checked = now
+		s.Rate = n.rebalanceRate
+		if len(moves) == 0 {
+			return
+		}
+		*s = ring.Rebalance{Node: n.id, Running: true, Checked: now, Started: now, Keys: len(moves), Rate: n.rebalanceRate}
+		for _, m := range moves {
+			s.Bytes += m.rec.Info.Size
+		}
+	})
+	if len(moves) == 0 {
+		return n.rebalancing.snapshot(), nil
+	}
+
+	limit := &throttle{rate: n.rebalanceRate}
+	var err error
+	for _, m := range moves {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		moveErr := n.move(ctx, m, limit)
+		n.rebalancing.update(func(s *ring.Rebalance) {
+			switch {
+			case moveErr == nil:
+				s.Moved++
+			case errors.Is(moveErr, errNoCopy), errors.Is(moveErr, errMoved):
+				s.Skipped++
+			default:
+				s.Failed++
+			}
+		})
+	}
+	n.rebalancing.update(func(s *ring.Rebalance) {
+		s.Running = false
+		s.Finished = time.Now()
+	})
+	return n.rebalancing.snapshot(), err
+}
+
+// RebalanceStatus returns the progress of rebalancing. Only the leader
+// rebalances, so other nodes ask it, unless local is set.
+func (n *Node) RebalanceStatus(ctx context.Context, local bool) (*ring.Rebalance, error) {
+	status := n.raft.Status()
+	if local || status.State == raft.Leader || status.LeaderAddr == "" {
+		s := n.rebalancing.snapshot()
+		if s.Node == "" {
+			s.Node = n.id
+		}
+		s.Rate = n.rebalanceRate
+		return s, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, status.LeaderAddr+PathPrefix+"/rebalance?local=true", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", storage.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: reading the rebalance status of %s: %s", storage.ErrUnavailable, status.Leader, resp.Status)
+	}
+	s := &ring.Rebalance{}
+	return s, json.NewDecoder(resp.Body).Decode(s)
+}
+
+// plan returns the object versions whose nodes are not those the ring
+// places them on.
+func (n *Node) plan() []move {
+	r := n.ring()
+	var moves []move
+	for _, bucket := range n.meta.bucketNames() {
+		records, err := n.meta.list(bucket)
+		if err != nil {
+			continue
+		}
+		for _, rec := range records {
+			nodes := r.Lookup(placementKey(bucket, rec.Info.Object), n.replicationFactor)
+			if len(nodes) == 0 || sameNodes(nodes, rec.Nodes) {
+				continue
+			}
+			moves = append(moves, move{bucket: bucket, rec: rec, nodes: nodes})
+		}
+	}
+	return moves
+}
+
+func sameNodes(a, b []string) bool {
+	return slices.Equal(slices.Sorted(slices.Values(a)), slices.Sorted(slices.Values(b)))
+}
+
+// move copies an object version's data to the nodes of a move missing it,
+// from a replica holding it, then commits its record with those nodes.
+func (n *Node) move(ctx context.Context, m move, limit *throttle) error {
+	if m.rec.Info.SSECustomerKeyMD5 != "" {
+		return errNoCopy
+	}
+	key := dataKey(m.rec.Info.Object, m.rec.Version)
+	holds := func(node string) bool {
+		s, err := n.dataStorage(node)
+		if err != nil {
+			return false
+		}
+		info, err := s.Head(m.bucket, key)
+		return err == nil && info.Checksum == m.rec.Info.Checksum
+	}
+
+	source := ""
+	for _, node := range n.readOrder(m.rec.Nodes) {
+		if holds(node) {
+			source = node
+			break
+		}
+	}
+	if source == "" {
+		return errNoCopy
+	}
+	from, err := n.dataStorage(source)
+	if err != nil {
+		return err
+	}
+	from = &throttledStorage{Storage: from, ctx: ctx, limit: limit, moved: func(bytes int) {
+		n.rebalancing.update(func(s *ring.Rebalance) { s.MovedBytes += int64(bytes) })
+	}}
+
+	for _, node := range m.nodes {
+		if slices.Contains(m.rec.Nodes, node) || holds(node) {
+			continue
+		}
+		if err := n.copyData(m.bucket, m.rec, from, node, nil); err != nil {
+			return err
+		}
+	}
+	return n.propose(&command{Op: opMove, Bucket: m.bucket, Object: m.rec.Info.Object, Record: &record{Version: m.rec.Version, Nodes: m.nodes}})
+}
+
+// throttle spreads reads over time so they stay under a rate, in bytes per
+// second. It is shared by the reads of a pass.
+type throttle struct {
+	rate int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait waits until n more bytes can be read.
+func (t *throttle) wait(ctx context.Context, n int) error {
+	if t.rate <= 0 || n == 0 {
+		return nil
+	}
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(float64(n) / float64(t.rate) * float64(time.Second)))
+	t.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttledStorage reads object data under a throttle, telling moved how
+// much it read.
+type throttledStorage struct {
+	storage.Storage
+	ctx   context.Context
+	limit *throttle
+	moved func(bytes int)
+}
+
+func (s *throttledStorage) Get(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
+	body, info, err := s.Storage.Get(bucket, object, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &throttledReader{ReadCloser: body, s: s}, info, nil
+}
+
+type throttledReader struct {
+	io.ReadCloser
+	s *throttledStorage
+}
+
+// maxThrottledRead caps the bytes read at once, so the rate stays smooth.
+const maxThrottledRead = 32 << 10
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p[:min(len(p), maxThrottledRead)])
+	if n > 0 {
+		r.s.moved(n)
+		if waitErr := r.s.limit.wait(r.s.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,79 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestThrottledStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    int64
+		size    int
+		minimum time.Duration
+	}{
+		{
+			name: "Unlimited reads do not wait",
+			rate: 0,
+			size: 256 << 10,
+		},
+		{
+			name:    "Reads stay under the rate",
+			rate:    1 << 20,
+			size:    128 << 10,
+			minimum: 90 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum())
+			data := bytes.Repeat([]byte("x"), tt.size)
+			if _, err := local.Save("bucket", "object", bytes.NewReader(data)); err != nil {
+				t.Fatalf("Failed to save: %v", err)
+			}
+
+			var moved int
+			s := &throttledStorage{
+				Storage: local,
+				ctx:     context.Background(),
+				limit:   &throttle{rate: tt.rate},
+				moved:   func(bytes int) { moved += bytes },
+			}
+			start := time.Now()
+			body, _, err := s.Get("bucket", "object")
+			if err != nil {
+				t.Fatalf("Failed to get: %v", err)
+			}
+			got, err := io.ReadAll(body)
+			body.Close()
+			if err != nil {
+				t.Fatalf("Failed to read: %v", err)
+			}
+			elapsed := time.Since(start)
+
+			if !bytes.Equal(got, data) || moved != tt.size {
+				t.Errorf("Expected %d bytes read and counted, got %d and %d", tt.size, len(got), moved)
+			}
+			if elapsed < tt.minimum {
+				t.Errorf("Expected reads to take at least %s, took %s", tt.minimum, elapsed)
+			}
+		})
+	}
+
+	t.Run("Waiting stops with the context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		limit := &throttle{rate: 1}
+		_ = limit.wait(ctx, 1)
+		if err := limit.wait(ctx, 1); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the wait to be canceled, got %v", err)
+		}
+	})
+}
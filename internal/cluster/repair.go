@@ -0,0 +1,215 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// orphanGrace is how long data nothing refers to is kept before repair
+// removes it, so the data of writes not committed yet is left alone.
+var orphanGrace = 10 * time.Minute
+
+// RepairReport counts what a repair pass did.
+type RepairReport struct {
+	// Compared counts the bucket trees compared with peers, and Partitions
+	// the partitions found to differ.
+	Compared   int
+	Partitions int
+
+	// Repaired counts the copies of object data sent to peers missing
+	// them or holding another checksum, and Removed the copies peers held
+	// that nothing refers to anymore.
+	Repaired int
+	Removed  int
+
+	// Skipped counts the copies this node could not send, as it holds none
+	// itself or the object is encrypted with a customer key or archived,
+	// and Failed those it failed to, or the peers it could not compare
+	// with.
+	Skipped int
+	Failed  int
+}
+
+// RunRepair runs a repair pass each interval until ctx is done, handing
+// each to report.
+func (n *Node) RunRepair(ctx context.Context, interval time.Duration, report func(*RepairReport, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		report(n.Repair(ctx))
+	}
+}
+
+// Repair compares what each peer holds with what the committed metadata
+// says it should hold, bucket by bucket through Merkle trees, and fixes
+// the partitions that differ: it sends peers the data they miss or hold
+// another checksum of, when this node holds it, and removes the data they
+// hold that nothing refers to. Every node runs it, so each copy is sent by
+// a node holding it.
+func (n *Node) Repair(ctx context.Context) (*RepairReport, error) {
+	if err := n.barrier(); err != nil {
+		return nil, err
+	}
+	members := n.raft.Status().Members
+	report := &RepairReport{}
+	for _, bucket := range n.meta.bucketNames() {
+		for _, peer := range slices.Sorted(maps.Keys(members)) {
+			if peer == n.id {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+
+			var tree merkleTree
+			if err := fetchMerkle(ctx, members[peer], bucket, -1, &tree); err != nil {
+				report.Failed++
+				continue
+			}
+			report.Compared++
+			for _, p := range newMerkleTree(n.meta.expected(bucket, peer, -1)).diff(tree) {
+				report.Partitions++
+				var held []holding
+				if err := fetchMerkle(ctx, members[peer], bucket, p, &held); err != nil {
+					report.Failed++
+					continue
+				}
+				n.reconcile(bucket, peer, n.meta.expected(bucket, peer, p), held, report)
+			}
+		}
+	}
+	return report, nil
+}
+
+// reconcile fixes what a peer holds of a partition of a bucket.
+func (n *Node) reconcile(bucket, peer string, expected, held []holding, report *RepairReport) {
+	type version struct{ object, version string }
+	have := map[version]holding{}
+	for _, h := range held {
+		have[version{h.Object, h.Version}] = h
+	}
+	want := map[version]bool{}
+	for _, e := range expected {
+		want[version{e.Object, e.Version}] = true
+		if h, ok := have[version{e.Object, e.Version}]; ok && h.Checksum == e.Checksum {
+			continue
+		}
+		switch err := n.push(bucket, e, peer); {
+		case err == nil:
+			report.Repaired++
+		case errors.Is(err, errNoCopy):
+			report.Skipped++
+		default:
+			report.Failed++
+		}
+	}
+
+	target, err := n.dataStorage(peer)
+	if err != nil {
+		return
+	}
+	for _, h := range held {
+		if want[version{h.Object, h.Version}] || time.Since(h.StoredAt) < orphanGrace {
+			continue
+		}
+		// It may have been committed since the partition was compared
+		if rec, err := n.meta.get(bucket, h.Object); err == nil && rec.Version == h.Version && slices.Contains(rec.Nodes, peer) {
+			continue
+		}
+		if err := target.Delete(bucket, dataKey(h.Object, h.Version)); err != nil {
+			report.Failed++
+			continue
+		}
+		report.Removed++
+	}
+}
+
+// errNoCopy is returned by push when this node has no copy to send.
+var errNoCopy = errors.New("no copy of the object's data to send")
+
+// push sends a peer this node's copy of the data of an object version.
+func (n *Node) push(bucket string, h holding, peer string) error {
+	rec, err := n.meta.get(bucket, h.Object)
+	if err != nil || rec.Version != h.Version {
+		// Overwritten or deleted meanwhile
+		return errNoCopy
+	}
+	if rec.Info.SSECustomerKeyMD5 != "" {
+		// Only reads, which carry the key, can repair those
+		return errNoCopy
+	}
+	key := dataKey(h.Object, h.Version)
+	if info, err := n.local.Head(bucket, key); err != nil || info.Checksum != h.Checksum {
+		return errNoCopy
+	}
+	return n.copyData(bucket, rec, n.local, peer, nil)
+}
+
+// copyData copies the data of an object's committed version from source
+// to a node, checking the node stored it with the committed checksum.
+func (n *Node) copyData(bucket string, rec *record, source storage.Storage, node string, sseKey []byte) error {
+	key := dataKey(rec.Info.Object, rec.Version)
+	body, _, err := source.Get(bucket, key, storage.WithSSECustomerKey(sseKey))
+	if errors.Is(err, storage.ErrInvalidObjectState) {
+		// Archived data can only be copied once restored
+		return errNoCopy
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	target, err := n.dataStorage(node)
+	if err != nil {
+		return err
+	}
+	info, err := target.Save(bucket, key, body, dataOptions(&rec.Info, sseKey)...)
+	if err != nil {
+		return err
+	}
+	if info.Checksum != "" && info.Checksum != rec.Info.Checksum {
+		_ = target.Delete(bucket, key)
+		return fmt.Errorf("node %s: %w", node, &storage.ErrInvalidChecksum{Got: info.Checksum, Expected: rec.Info.Checksum})
+	}
+	return nil
+}
+
+// dataOptions returns the options that store a copy of an object's data
+// the way it was written.
+func dataOptions(info *storage.ObjectInfo, sseKey []byte) []storage.Option {
+	return []storage.Option{
+		storage.WithSSECustomerKey(sseKey),
+		storage.WithStorageClass(info.StorageClass),
+		storage.WithTags(info.Tags),
+		storage.WithContentType(info.ContentType),
+		storage.WithContentEncoding(info.ContentEncoding),
+		storage.WithContentDisposition(info.ContentDisposition),
+		storage.WithCacheControl(info.CacheControl),
+		storage.WithExpires(info.Expires),
+		storage.WithUserMetadata(info.UserMetadata),
+	}
+}
+
+// readRepair sends the replicas a read found missing the data of an
+// object, or holding another checksum, a copy from the replica it was
+// read from. The read's customer key, if any, is needed to copy it.
+func (n *Node) readRepair(bucket string, rec *record, source string, stale []string, sseKey []byte) {
+	from, err := n.dataStorage(source)
+	if err != nil {
+		return
+	}
+	for _, node := range stale {
+		_ = n.copyData(bucket, rec, from, node, sseKey)
+	}
+}
@@ -0,0 +1,186 @@
+// Package erasure implements Reed-Solomon erasure codes: data is split into
+// data shards, and parity shards are computed from them, so that the data
+// can be rebuilt from any of the shards as long as no more are lost than
+// there are parity shards.
+//
+// The code is systematic: data shards hold the data as it is, so reading
+// it needs no decoding while they are all there.
+package erasure
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrTooFewShards is returned when more shards are missing than there are
+// parity shards, so the data cannot be rebuilt.
+var ErrTooFewShards = errors.New("too few shards to reconstruct the data")
+
+// MaxShards bounds data and parity shards together, the size of the field
+// the code works in.
+const MaxShards = 256
+
+// Coder encodes and reconstructs shards for one layout of data and parity
+// shards. It is safe for concurrent use.
+type Coder struct {
+	data, parity int
+
+	// encoding has a row per shard, each telling how to compute that
+	// shard from the data shards. The first rows are the identity, and
+	// any data rows together are invertible.
+	encoding matrix
+}
+
+// New returns a coder splitting data into data shards, protected by parity
+// shards.
+func New(data, parity int) (*Coder, error) {
+	if data < 1 || parity < 1 || data+parity > MaxShards {
+		return nil, fmt.Errorf("erasure coding needs at least one data and one parity shard, and at most %d shards, got %d+%d", MaxShards, data, parity)
+	}
+
+	// A Vandermonde matrix has any data rows invertible, and keeps that
+	// property once multiplied by the inverse of its top rows, which
+	// turns those into the identity.
+	vandermonde := newMatrix(data+parity, data)
+	for r := range vandermonde {
+		for c := range vandermonde[r] {
+			vandermonde[r][c] = gfPow(byte(r), c)
+		}
+	}
+	top, _ := vandermonde[:data].invert()
+	return &Coder{data: data, parity: parity, encoding: vandermonde.mul(top)}, nil
+}
+
+// DataShards returns how many shards the data is split into.
+func (c *Coder) DataShards() int {
+	return c.data
+}
+
+// ParityShards returns how many parity shards protect the data.
+func (c *Coder) ParityShards() int {
+	return c.parity
+}
+
+// Shards returns how many shards there are in all.
+func (c *Coder) Shards() int {
+	return c.data + c.parity
+}
+
+// String describes the layout, like "4+2".
+func (c *Coder) String() string {
+	return fmt.Sprintf("%d+%d", c.data, c.parity)
+}
+
+// Encode computes the parity shards from the data shards, which come first
+// in shards and must be of the same size. Parity shards are allocated when
+// nil.
+func (c *Coder) Encode(shards [][]byte) error {
+	if err := c.check(shards); err != nil {
+		return err
+	}
+	size := len(shards[0])
+	for _, shard := range shards[:c.data] {
+		if len(shard) != size {
+			return errors.New("data shards differ in size")
+		}
+	}
+	for i := c.data; i < len(shards); i++ {
+		shards[i] = c.compute(shards[i], i, shards[:c.data], size)
+	}
+	return nil
+}
+
+// Reconstruct rebuilds the missing shards, given as nil, from the others,
+// which must be of the same size.
+func (c *Coder) Reconstruct(shards [][]byte) error {
+	return c.reconstruct(shards, true)
+}
+
+// ReconstructData is like Reconstruct, but only rebuilds the missing data
+// shards, leaving missing parity shards nil. Reading needs nothing else,
+// and does not pay for computing parity when no data shard is missing.
+func (c *Coder) ReconstructData(shards [][]byte) error {
+	return c.reconstruct(shards, false)
+}
+
+func (c *Coder) reconstruct(shards [][]byte, parity bool) error {
+	if err := c.check(shards); err != nil {
+		return err
+	}
+	if !parity && !slices.ContainsFunc(shards[:c.data], func(shard []byte) bool { return shard == nil }) {
+		return nil
+	}
+
+	var present []int
+	size := -1
+	for i, shard := range shards {
+		if shard == nil {
+			continue
+		}
+		if size >= 0 && len(shard) != size {
+			return errors.New("shards differ in size")
+		}
+		size = len(shard)
+		present = append(present, i)
+	}
+	if len(present) == len(shards) {
+		return nil
+	}
+	if len(present) < c.data {
+		return fmt.Errorf("%w: %d of %d shards left, %d needed", ErrTooFewShards, len(present), len(shards), c.data)
+	}
+
+	// The rows of the shards used tell how they were computed from the
+	// data, so their inverse computes the data back from them.
+	present = present[:c.data]
+	rows := make(matrix, c.data)
+	inputs := make([][]byte, c.data)
+	for i, shard := range present {
+		rows[i] = c.encoding[shard]
+		inputs[i] = shards[shard]
+	}
+	decoding, ok := rows.invert()
+	if !ok {
+		return errors.New("erasure code matrix is singular")
+	}
+	for i := range c.data {
+		if shards[i] == nil {
+			shards[i] = combine(nil, decoding[i], inputs, size)
+		}
+	}
+	for i := c.data; parity && i < len(shards); i++ {
+		if shards[i] == nil {
+			shards[i] = c.compute(nil, i, shards[:c.data], size)
+		}
+	}
+	return nil
+}
+
+func (c *Coder) check(shards [][]byte) error {
+	if len(shards) != c.Shards() {
+		return fmt.Errorf("expected %d shards, got %d", c.Shards(), len(shards))
+	}
+	return nil
+}
+
+// compute returns shard i computed from the data shards, into out when it
+// is large enough.
+func (c *Coder) compute(out []byte, i int, data [][]byte, size int) []byte {
+	return combine(out, c.encoding[i], data, size)
+}
+
+// combine returns the sum of the inputs, each multiplied by its
+// coefficient.
+func combine(out []byte, coefficients []byte, inputs [][]byte, size int) []byte {
+	if cap(out) < size {
+		out = make([]byte, size)
+	} else {
+		out = out[:size]
+		clear(out)
+	}
+	for j, input := range inputs {
+		mulAdd(out, input, coefficients[j])
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package erasure
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name         string
+		data, parity int
+		wantErr      bool
+	}{
+		{name: "4+2", data: 4, parity: 2},
+		{name: "Single data shard", data: 1, parity: 1},
+		{name: "No parity", data: 4, parity: 0, wantErr: true},
+		{name: "No data", data: 0, parity: 2, wantErr: true},
+		{name: "Too many shards", data: 200, parity: 57, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.data, tt.parity)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReconstruct(t *testing.T) {
+	coder, err := New(4, 2)
+	if err != nil {
+		t.Fatalf("Failed to create coder: %v", err)
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	original := make([][]byte, coder.Shards())
+	for i := range coder.DataShards() {
+		original[i] = make([]byte, 1000)
+		for j := range original[i] {
+			original[i][j] = byte(rng.IntN(256))
+		}
+	}
+	if err := coder.Encode(original); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		missing []int
+		wantErr error
+	}{
+		{name: "Nothing missing", missing: nil},
+		{name: "A data shard", missing: []int{1}},
+		{name: "A parity shard", missing: []int{5}},
+		{name: "Two data shards", missing: []int{0, 3}},
+		{name: "A data and a parity shard", missing: []int{2, 4}},
+		{name: "Three shards", missing: []int{0, 1, 5}, wantErr: ErrTooFewShards},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shards := make([][]byte, len(original))
+			for i := range original {
+				shards[i] = bytes.Clone(original[i])
+			}
+			for _, i := range tt.missing {
+				shards[i] = nil
+			}
+
+			err := coder.Reconstruct(shards)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			for i := range original {
+				if !bytes.Equal(shards[i], original[i]) {
+					t.Errorf("Shard %d was not rebuilt", i)
+				}
+			}
+		})
+	}
+
+	t.Run("Only data shards", func(t *testing.T) {
+		shards := make([][]byte, len(original))
+		for i := range original {
+			shards[i] = bytes.Clone(original[i])
+		}
+		shards[1], shards[5] = nil, nil
+		if err := coder.ReconstructData(shards); err != nil {
+			t.Fatalf("Failed to reconstruct: %v", err)
+		}
+		if !bytes.Equal(shards[1], original[1]) {
+			t.Error("Expected the data shard rebuilt")
+		}
+		if shards[5] != nil {
+			t.Error("Expected the parity shard left missing")
+		}
+	})
+}
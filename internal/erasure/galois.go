@@ -0,0 +1,125 @@
+package erasure
+
+// Arithmetic in GF(2^8), the field Reed-Solomon codes work in: adding is
+// XOR, and multiplying goes through logarithms, generated from the
+// polynomial x^8 + x^4 + x^3 + x^2 + 1.
+const polynomial = 0x11d
+
+var expTable, logTable = func() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := 1
+	for i := range 255 {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= polynomial
+		}
+	}
+	// Doubled, so products index it without a modulo
+	for i := 255; i < len(exp); i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func gfInverse(a byte) byte {
+	return expTable[255-int(logTable[a])]
+}
+
+// gfPow returns a to the power n.
+func gfPow(a byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])*n%255]
+}
+
+// mulAdd adds c times in to out, byte by byte.
+func mulAdd(out, in []byte, c byte) {
+	switch c {
+	case 0:
+		return
+	case 1:
+		for i, b := range in {
+			out[i] ^= b
+		}
+		return
+	}
+	logC := int(logTable[c])
+	for i, b := range in {
+		if b != 0 {
+			out[i] ^= expTable[logC+int(logTable[b])]
+		}
+	}
+}
+
+// matrix is a matrix over GF(2^8), by rows.
+type matrix [][]byte
+
+func newMatrix(rows, cols int) matrix {
+	m := make(matrix, rows)
+	for i := range m {
+		m[i] = make([]byte, cols)
+	}
+	return m
+}
+
+func (m matrix) mul(other matrix) matrix {
+	out := newMatrix(len(m), len(other[0]))
+	for i, row := range m {
+		for j, c := range row {
+			mulAdd(out[i], other[j], c)
+		}
+	}
+	return out
+}
+
+// invert returns the inverse of a square matrix, by Gauss-Jordan
+// elimination, or false if it is singular.
+func (m matrix) invert() (matrix, bool) {
+	n := len(m)
+	work := newMatrix(n, 2*n)
+	for i := range m {
+		copy(work[i], m[i])
+		work[i][n+i] = 1
+	}
+
+	for col := range n {
+		pivot := col
+		for pivot < n && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, false
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+
+		scale := gfInverse(work[col][col])
+		for j := range work[col] {
+			work[col][j] = gfMul(work[col][j], scale)
+		}
+		for row := range n {
+			if row != col && work[row][col] != 0 {
+				mulAdd(work[row], work[col], work[row][col])
+			}
+		}
+	}
+
+	inverse := newMatrix(n, n)
+	for i := range inverse {
+		copy(inverse[i], work[i][n:])
+	}
+	return inverse, true
+}
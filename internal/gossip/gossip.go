@@ -0,0 +1,446 @@
+// Package gossip implements SWIM-style membership: nodes find each other
+// through any one of them, tell whether the others are alive by probing
+// them, and spread what they learn by piggybacking it on their probes.
+//
+// Each probe interval a node pings one member, going round the members in
+// a shuffled order. When the member does not answer in time, a few others
+// are asked to ping it too, and only when none of them hears back is it
+// suspected. A suspected member refutes the suspicion by announcing itself
+// alive again with a higher incarnation; one that does not within the
+// suspicion timeout is declared dead. Members carry metadata, like their
+// zone and capacity, which spreads the same way.
+package gossip
+
+import (
+	"context"
+	"errors"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// State is what a node believes of a member.
+type State string
+
+const (
+	Alive   State = "alive"
+	Suspect State = "suspect"
+	Dead    State = "dead"
+)
+
+// rank orders the states a member can be in at one incarnation, the later
+// overriding the earlier.
+func (s State) rank() int {
+	switch s {
+	case Suspect:
+		return 1
+	case Dead:
+		return 2
+	default:
+		return 0
+	}
+}
+
+const (
+	defaultProbeInterval = time.Second
+
+	// retransmitMult scales how many probes carry each update, which is
+	// retransmitMult times the bits of the member count.
+	retransmitMult = 3
+
+	// maxUpdates caps the updates a message carries.
+	maxUpdates = 16
+
+	// indirectChecks is how many members are asked to ping a member that
+	// did not answer.
+	indirectChecks = 3
+)
+
+// ErrWrongNode is returned for a Ping meant for another node, like one
+// that was at the address before.
+var ErrWrongNode = errors.New("ping meant for another node")
+
+// Member is a node of the cluster as some node sees it.
+type Member struct {
+	ID   string `json:"id"`
+	Addr string `json:"addr"`
+
+	// Zone is where the node runs, like a rack or availability zone, and
+	// Capacity how many bytes of object data it offers, 0 when not told.
+	Zone     string `json:"zone,omitempty"`
+	Capacity int64  `json:"capacity,omitempty"`
+
+	State State `json:"state"`
+	// Incarnation is raised by the member itself only, to refute being
+	// suspected or to change its metadata.
+	Incarnation uint64 `json:"incarnation"`
+	// Since is when the node seeing the member learned it is in State.
+	Since time.Time `json:"since,omitzero"`
+}
+
+// Config configures a Node.
+type Config struct {
+	// ID identifies the node, and Addr is where the others reach it.
+	ID   string
+	Addr string
+
+	// Zone and Capacity are the node's metadata, see Member.
+	Zone     string
+	Capacity int64
+
+	Transport Transport
+
+	// Seeds returns addresses of nodes to join through while the node
+	// knows of no other member, like after a restart.
+	Seeds func() []string
+
+	// ProbeInterval is how often a member is probed, one second by
+	// default. Probes time out after half of it, members are suspected
+	// for five times it, and the whole member list is exchanged with a
+	// random member every thirty times it.
+	ProbeInterval time.Duration
+}
+
+// Node is a member of the gossip.
+type Node struct {
+	id        string
+	transport Transport
+	seeds     func() []string
+
+	probeInterval    time.Duration
+	probeTimeout     time.Duration
+	suspicionTimeout time.Duration
+	syncInterval     time.Duration
+
+	mu      sync.Mutex
+	members map[string]*Member
+	// updates are the member states to piggyback on messages, with how
+	// many messages carried each.
+	updates map[string]int
+	// order is the shuffled round of members to probe, from next on.
+	order []string
+	next  int
+}
+
+// NewNode creates a node knowing only of itself. It takes part in the
+// gossip once Run is called.
+func NewNode(cfg Config) (*Node, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("gossip node needs an ID")
+	}
+	if cfg.Transport == nil {
+		return nil, errors.New("gossip node needs a transport")
+	}
+	n := &Node{
+		id:            cfg.ID,
+		transport:     cfg.Transport,
+		seeds:         cfg.Seeds,
+		probeInterval: cfg.ProbeInterval,
+		updates:       map[string]int{},
+	}
+	if n.probeInterval <= 0 {
+		n.probeInterval = defaultProbeInterval
+	}
+	n.probeTimeout = n.probeInterval / 2
+	n.suspicionTimeout = 5 * n.probeInterval
+	n.syncInterval = 30 * n.probeInterval
+	n.members = map[string]*Member{cfg.ID: {
+		ID:       cfg.ID,
+		Addr:     cfg.Addr,
+		Zone:     cfg.Zone,
+		Capacity: cfg.Capacity,
+		State:    Alive,
+		Since:    time.Now(),
+	}}
+	n.updates[cfg.ID] = 0
+	return n, nil
+}
+
+// Run probes members and exchanges member lists until ctx is done.
+func (n *Node) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.probeInterval)
+	defer ticker.Stop()
+	lastSync := time.Time{}
+	for {
+		if time.Since(lastSync) >= n.syncInterval || n.alone() {
+			n.sync(ctx)
+			lastSync = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n.expireSuspicions(now)
+			n.probe(ctx)
+		}
+	}
+}
+
+// Join exchanges member lists with the node at addr, which makes this
+// node known to the cluster that node is in.
+func (n *Node) Join(ctx context.Context, addr string) error {
+	resp, err := n.transport.Sync(ctx, addr, &Sync{From: n.id, Members: n.Members()})
+	if err != nil {
+		return err
+	}
+	n.merge(resp.Members)
+	return nil
+}
+
+// Members returns every member known, this node included, sorted by ID.
+func (n *Node) Members() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	members := make([]Member, 0, len(n.members))
+	for _, m := range n.members {
+		members = append(members, *m)
+	}
+	slices.SortFunc(members, func(a, b Member) int { return strings.Compare(a.ID, b.ID) })
+	return members
+}
+
+// Member returns what this node believes of a member, and false for one
+// it does not know.
+func (n *Node) Member(id string) (Member, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	m, ok := n.members[id]
+	if !ok {
+		return Member{}, false
+	}
+	return *m, true
+}
+
+// alone tells whether this node knows of no other member alive.
+func (n *Node) alone() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for id, m := range n.members {
+		if id != n.id && m.State != Dead {
+			return false
+		}
+	}
+	return true
+}
+
+// sync exchanges member lists with a random member, dead ones included so
+// a partition heals once it is over, or with a seed while this node knows
+// of no other member.
+func (n *Node) sync(ctx context.Context) {
+	var addrs []string
+	n.mu.Lock()
+	for id, m := range n.members {
+		if id != n.id && m.Addr != "" {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	n.mu.Unlock()
+	if len(addrs) == 0 && n.seeds != nil {
+		for _, addr := range n.seeds() {
+			if addr != n.self().Addr {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.probeInterval)
+	defer cancel()
+	_ = n.Join(ctx, addrs[rand.IntN(len(addrs))])
+}
+
+func (n *Node) self() Member {
+	m, _ := n.Member(n.id)
+	return m
+}
+
+// probe pings the next member of the round, through others when it does
+// not answer itself, and suspects it when none of them hears back.
+func (n *Node) probe(ctx context.Context) {
+	target, ok := n.nextTarget()
+	if !ok {
+		return
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, n.probeTimeout)
+	ack, err := n.transport.Ping(pingCtx, target.Addr, &Ping{From: n.id, Target: target.ID, Updates: n.piggyback()})
+	cancel()
+	if err == nil {
+		n.merge(ack.Updates)
+		return
+	}
+
+	helpers := n.helpers(target.ID)
+	if len(helpers) == 0 {
+		n.suspect(target)
+		return
+	}
+	ctx, cancel = context.WithTimeout(ctx, n.probeInterval-n.probeTimeout)
+	defer cancel()
+	acks := make(chan *Ack, len(helpers))
+	for _, helper := range helpers {
+		req := &PingReq{From: n.id, Target: target, Updates: n.piggyback()}
+		go func() {
+			ack, err := n.transport.PingReq(ctx, helper.Addr, req)
+			if err != nil || ack.From != target.ID {
+				ack = nil
+			}
+			acks <- ack
+		}()
+	}
+	for range helpers {
+		if ack := <-acks; ack != nil {
+			n.merge(ack.Updates)
+			return
+		}
+	}
+	n.suspect(target)
+}
+
+// nextTarget returns the next member to probe, shuffling the members not
+// known dead into a new round once one is over.
+func (n *Node) nextTarget() (Member, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for {
+		if n.next >= len(n.order) {
+			n.order = n.order[:0]
+			for id, m := range n.members {
+				if id != n.id && m.State != Dead {
+					n.order = append(n.order, id)
+				}
+			}
+			if len(n.order) == 0 {
+				return Member{}, false
+			}
+			rand.Shuffle(len(n.order), func(i, j int) { n.order[i], n.order[j] = n.order[j], n.order[i] })
+			n.next = 0
+		}
+		m := n.members[n.order[n.next]]
+		n.next++
+		if m != nil && m.State != Dead {
+			return *m, true
+		}
+	}
+}
+
+// helpers returns random members alive to ping a target indirectly.
+func (n *Node) helpers(target string) []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var helpers []Member
+	for id, m := range n.members {
+		if id != n.id && id != target && m.State == Alive {
+			helpers = append(helpers, *m)
+		}
+	}
+	rand.Shuffle(len(helpers), func(i, j int) { helpers[i], helpers[j] = helpers[j], helpers[i] })
+	return helpers[:min(len(helpers), indirectChecks)]
+}
+
+// suspect marks a member that did not answer a probe as suspected, at the
+// incarnation it was probed at.
+func (n *Node) suspect(target Member) {
+	target.State = Suspect
+	n.merge([]Member{target})
+}
+
+// expireSuspicions declares dead the members suspected for longer than
+// the suspicion timeout.
+func (n *Node) expireSuspicions(now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for id, m := range n.members {
+		if m.State == Suspect && now.Sub(m.Since) >= n.suspicionTimeout {
+			m.State = Dead
+			m.Since = now
+			n.updates[id] = 0
+		}
+	}
+}
+
+// merge applies what other nodes tell about members. A member's state at
+// a higher incarnation overrides the one known, and at the same one, dead
+// overrides suspected, which overrides alive. This node refutes what it
+// hears about itself when it is not its latest state.
+func (n *Node) merge(members []Member) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := time.Now()
+	for _, u := range members {
+		if u.ID == "" {
+			continue
+		}
+		current, known := n.members[u.ID]
+		if u.ID == n.id {
+			if u.Incarnation > current.Incarnation || (u.Incarnation == current.Incarnation && u.State != Alive) {
+				current.Incarnation = u.Incarnation + 1
+				n.updates[n.id] = 0
+			}
+			continue
+		}
+		if known && (u.Incarnation < current.Incarnation ||
+			(u.Incarnation == current.Incarnation && u.State.rank() <= current.State.rank())) {
+			continue
+		}
+
+		u.Since = now
+		if known && current.State == u.State {
+			u.Since = current.Since
+		}
+		n.members[u.ID] = &u
+		n.updates[u.ID] = 0
+	}
+}
+
+// piggyback returns the updates the next message carries, those carried
+// the least first, and forgets those carried often enough to have spread.
+func (n *Node) piggyback() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ids := make([]string, 0, len(n.updates))
+	for id := range n.updates {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b string) int { return n.updates[a] - n.updates[b] })
+
+	limit := retransmitMult * bits.Len(uint(len(n.members)))
+	var updates []Member
+	for _, id := range ids[:min(len(ids), maxUpdates)] {
+		updates = append(updates, *n.members[id])
+		if n.updates[id]++; n.updates[id] >= limit {
+			delete(n.updates, id)
+		}
+	}
+	return updates
+}
+
+func (n *Node) handlePing(req *Ping) (*Ack, error) {
+	if req.Target != "" && req.Target != n.id {
+		return nil, ErrWrongNode
+	}
+	n.merge(req.Updates)
+	return &Ack{From: n.id, Updates: n.piggyback()}, nil
+}
+
+func (n *Node) handlePingReq(ctx context.Context, req *PingReq) (*Ack, error) {
+	n.merge(req.Updates)
+	ctx, cancel := context.WithTimeout(ctx, n.probeTimeout)
+	defer cancel()
+	ack, err := n.transport.Ping(ctx, req.Target.Addr, &Ping{From: n.id, Target: req.Target.ID, Updates: n.piggyback()})
+	if err != nil {
+		return nil, err
+	}
+	n.merge(ack.Updates)
+	return ack, nil
+}
+
+func (n *Node) handleSync(req *Sync) *Sync {
+	n.merge(req.Members)
+	return &Sync{From: n.id, Members: n.Members()}
+}
@@ -0,0 +1,183 @@
+package gossip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		known    Member
+		update   Member
+		expected Member
+	}{
+		{
+			name:     "Suspicion overrides alive at the same incarnation",
+			known:    Member{ID: "n2", State: Alive, Incarnation: 1},
+			update:   Member{ID: "n2", State: Suspect, Incarnation: 1},
+			expected: Member{ID: "n2", State: Suspect, Incarnation: 1},
+		},
+		{
+			name:     "Alive does not override suspicion at the same incarnation",
+			known:    Member{ID: "n2", State: Suspect, Incarnation: 1},
+			update:   Member{ID: "n2", State: Alive, Incarnation: 1},
+			expected: Member{ID: "n2", State: Suspect, Incarnation: 1},
+		},
+		{
+			name:     "A higher incarnation overrides death",
+			known:    Member{ID: "n2", State: Dead, Incarnation: 1},
+			update:   Member{ID: "n2", State: Alive, Incarnation: 2, Zone: "b"},
+			expected: Member{ID: "n2", State: Alive, Incarnation: 2, Zone: "b"},
+		},
+		{
+			name:     "Older incarnations are ignored",
+			known:    Member{ID: "n2", State: Alive, Incarnation: 3},
+			update:   Member{ID: "n2", State: Dead, Incarnation: 2},
+			expected: Member{ID: "n2", State: Alive, Incarnation: 3},
+		},
+		{
+			name:     "Suspicions of this node are refuted",
+			known:    Member{ID: "n1", State: Alive, Incarnation: 0},
+			update:   Member{ID: "n1", State: Suspect, Incarnation: 0},
+			expected: Member{ID: "n1", State: Alive, Incarnation: 1},
+		},
+		{
+			name:     "This node takes over its state from before a restart",
+			known:    Member{ID: "n1", State: Alive, Incarnation: 0},
+			update:   Member{ID: "n1", State: Dead, Incarnation: 7},
+			expected: Member{ID: "n1", State: Alive, Incarnation: 8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := NewNode(Config{ID: "n1", Transport: NewHTTPTransport("/gossip")})
+			if err != nil {
+				t.Fatalf("Failed to create node: %v", err)
+			}
+			known := tt.known
+			n.members[known.ID] = &known
+			n.merge([]Member{tt.update})
+
+			got, _ := n.Member(tt.expected.ID)
+			got.Since = time.Time{}
+			if got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+type testNode struct {
+	*Node
+	addr    string
+	handler atomic.Pointer[http.Handler]
+	stop    context.CancelFunc
+}
+
+// start creates a node behind its own HTTP server, seeded with seed when
+// given.
+func start(t *testing.T, id, zone, seed string) *testNode {
+	t.Helper()
+	node := &testNode{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := node.handler.Load()
+		if h == nil {
+			http.Error(w, "stopped", http.StatusServiceUnavailable)
+			return
+		}
+		http.StripPrefix("/gossip", *h).ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	node.addr = srv.URL
+	node.run(t, id, zone, seed)
+	return node
+}
+
+func (node *testNode) run(t *testing.T, id, zone, seed string) {
+	t.Helper()
+	n, err := NewNode(Config{
+		ID:            id,
+		Addr:          node.addr,
+		Zone:          zone,
+		Capacity:      1 << 30,
+		Transport:     NewHTTPTransport("/gossip"),
+		Seeds:         func() []string { return []string{seed} },
+		ProbeInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	node.Node = n
+	h := n.Handler()
+	node.handler.Store(&h)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	node.stop = cancel
+	go n.Run(ctx)
+}
+
+// waitFor waits until every node sees member id in state.
+func waitFor(t *testing.T, nodes []*testNode, id string, state State) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, node := range nodes {
+		for {
+			if m, ok := node.Member(id); ok && m.State == state {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s to see %s %s, got %+v", node.id, id, state, node.Members())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestGossip(t *testing.T) {
+	n1 := start(t, "n1", "a", "")
+	n2 := start(t, "n2", "a", n1.addr)
+	n3 := start(t, "n3", "b", n1.addr)
+	nodes := []*testNode{n1, n2, n3}
+
+	t.Run("Nodes find each other through a seed", func(t *testing.T) {
+		for _, node := range nodes {
+			waitFor(t, nodes, node.id, Alive)
+		}
+		m, _ := n2.Member("n3")
+		if m.Addr != n3.addr || m.Zone != "b" || m.Capacity != 1<<30 {
+			t.Errorf("Expected n2 to know the metadata of n3, got %+v", m)
+		}
+	})
+
+	t.Run("A node that stops answering is suspected, then dead", func(t *testing.T) {
+		n3.stop()
+		n3.handler.Store(nil)
+		waitFor(t, nodes[:2], "n3", Dead)
+	})
+
+	t.Run("A node that comes back refutes its death", func(t *testing.T) {
+		n3.run(t, "n3", "c", n2.addr)
+		waitFor(t, nodes, "n3", Alive)
+		m, _ := n1.Member("n3")
+		if m.Incarnation == 0 || m.Zone != "c" {
+			t.Errorf("Expected n3 back at a higher incarnation with its new zone, got %+v", m)
+		}
+	})
+
+	t.Run("A node joins through any member", func(t *testing.T) {
+		n4 := start(t, "n4", "b", "")
+		if err := n4.Join(context.Background(), n3.addr); err != nil {
+			t.Fatalf("Failed to join: %v", err)
+		}
+		if len(n4.Members()) != 4 {
+			t.Errorf("Expected n4 to learn every member from n3, got %+v", n4.Members())
+		}
+		waitFor(t, append(nodes, n4), "n4", Alive)
+	})
+}
@@ -0,0 +1,41 @@
+package gossip
+
+import "context"
+
+// Ping checks that the node it is sent to is alive. Target is the ID the
+// sender expects there, so a node taking over another's address is not
+// mistaken for it.
+type Ping struct {
+	From    string   `json:"from"`
+	Target  string   `json:"target"`
+	Updates []Member `json:"updates,omitempty"`
+}
+
+// Ack answers a Ping, directly or relayed by the node a PingReq asked.
+type Ack struct {
+	From    string   `json:"from"`
+	Updates []Member `json:"updates,omitempty"`
+}
+
+// PingReq asks a node to ping Target on behalf of one that got no answer
+// itself, and relay the Ack.
+type PingReq struct {
+	From    string   `json:"from"`
+	Target  Member   `json:"target"`
+	Updates []Member `json:"updates,omitempty"`
+}
+
+// Sync exchanges the whole member list of two nodes, when one joins and
+// every once in a while after.
+type Sync struct {
+	From    string   `json:"from"`
+	Members []Member `json:"members"`
+}
+
+// Transport carries the messages between nodes, addressed by the
+// addresses in members.
+type Transport interface {
+	Ping(ctx context.Context, addr string, req *Ping) (*Ack, error)
+	PingReq(ctx context.Context, addr string, req *PingReq) (*Ack, error)
+	Sync(ctx context.Context, addr string, req *Sync) (*Sync, error)
+}
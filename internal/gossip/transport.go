@@ -0,0 +1,98 @@
+package gossip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HTTPTransport sends messages as JSON POST requests to the Handler of
+// other nodes, served under Prefix at their address.
+type HTTPTransport struct {
+	Prefix string
+	Client *http.Client
+}
+
+// NewHTTPTransport returns a transport to nodes serving their Handler
+// under prefix.
+func NewHTTPTransport(prefix string) *HTTPTransport {
+	return &HTTPTransport{Prefix: strings.TrimSuffix(prefix, "/"), Client: http.DefaultClient}
+}
+
+func (t *HTTPTransport) Ping(ctx context.Context, addr string, req *Ping) (*Ack, error) {
+	resp := &Ack{}
+	return resp, t.call(ctx, addr, "ping", req, resp)
+}
+
+func (t *HTTPTransport) PingReq(ctx context.Context, addr string, req *PingReq) (*Ack, error) {
+	resp := &Ack{}
+	return resp, t.call(ctx, addr, "ping-req", req, resp)
+}
+
+func (t *HTTPTransport) Sync(ctx context.Context, addr string, req *Sync) (*Sync, error) {
+	resp := &Sync{}
+	return resp, t.call(ctx, addr, "sync", req, resp)
+}
+
+func (t *HTTPTransport) call(ctx context.Context, addr, message string, req, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(addr, "/") + t.Prefix + "/" + message
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := t.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		text, _ := io.ReadAll(io.LimitReader(httpResp.Body, 1024))
+		return fmt.Errorf("gossip %s to %s failed: %s %s", message, addr, httpResp.Status, bytes.TrimSpace(text))
+	}
+	return json.NewDecoder(httpResp.Body).Decode(resp)
+}
+
+// Handler serves the messages of HTTPTransport.
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /ping", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, func(req *Ping) (*Ack, error) { return n.handlePing(req) })
+	})
+	mux.HandleFunc("POST /ping-req", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, func(req *PingReq) (*Ack, error) { return n.handlePingReq(r.Context(), req) })
+	})
+	mux.HandleFunc("POST /sync", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, func(req *Sync) (*Sync, error) { return n.handleSync(req), nil })
+	})
+	return mux
+}
+
+func serve[Req, Resp any](w http.ResponseWriter, r *http.Request, handle func(*Req) (*Resp, error)) {
+	req := new(Req)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := handle(req)
+	switch {
+	case errors.Is(err, ErrWrongNode):
+		http.Error(w, err.Error(), http.StatusMisdirectedRequest)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,239 @@
+// Package handoff keeps the hints of a cluster node: copies of writes a
+// replica missed while it was unavailable, which the node hands off to the
+// replica once it is back. Hints are objects of the node's local Storage,
+// so they survive restarts, and expire after a while, leaving anti-entropy
+// repair to bring replicas that stay away longer up to date.
+package handoff
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+const (
+	// Bucket is the bucket of the local Storage hints are kept in. Bucket
+	// names cannot contain underscores, so it never clashes with one.
+	Bucket = "_hints"
+
+	// DefaultTTL is how long hints are kept when no TTL is configured.
+	DefaultTTL = 3 * time.Hour
+)
+
+// ErrObsolete tells Replay that a hint is no longer needed, like when the
+// write it copies was overwritten since, and can be dropped.
+var ErrObsolete = errors.New("hinted write is obsolete")
+
+// Hint is a write kept for a node that missed it.
+type Hint struct {
+	// Node is the node the write is for, and Bucket and Key where the node
+	// stores it.
+	Node   string
+	Bucket string
+	Key    string
+
+	Size     int64
+	StoredAt time.Time
+}
+
+// Key returns the key of the local Storage the hint of a node's write of
+// bucket/key is kept under.
+func Key(node, bucket, key string) string {
+	return url.PathEscape(node) + "/" + bucket + "/" + key
+}
+
+// parseKey returns the hint kept under a key, and false for keys Key did
+// not return.
+func parseKey(name string) (Hint, bool) {
+	escaped, rest, ok := strings.Cut(name, "/")
+	if !ok {
+		return Hint{}, false
+	}
+	bucket, key, ok := strings.Cut(rest, "/")
+	if !ok || bucket == "" || key == "" {
+		return Hint{}, false
+	}
+	node, err := url.PathUnescape(escaped)
+	if err != nil || node == "" {
+		return Hint{}, false
+	}
+	return Hint{Node: node, Bucket: bucket, Key: key}, true
+}
+
+// Report counts what a pass over the hints did.
+type Report struct {
+	// Replayed counts the hints handed off, Expired those dropped for
+	// being older than the TTL and Dropped the obsolete ones.
+	Replayed int
+	Expired  int
+	Dropped  int
+
+	// Pending counts the hints left for a later pass, as their node could
+	// not take them.
+	Pending int
+}
+
+// Stats describes the hints a node keeps.
+type Stats struct {
+	// Pending counts the hints waiting to be handed off, Bytes their size
+	// and Oldest when the oldest of them was stored. Nodes counts them by
+	// the node they are for.
+	Pending int            `json:"pending"`
+	Bytes   int64          `json:"bytes"`
+	Oldest  time.Time      `json:"oldest,omitzero"`
+	Nodes   map[string]int `json:"nodes,omitempty"`
+
+	// TTL is how long hints are kept. Replayed, Expired and Dropped count
+	// the hints replays did away with since the node started.
+	TTL      time.Duration `json:"ttl"`
+	Replayed int64         `json:"replayed"`
+	Expired  int64         `json:"expired"`
+	Dropped  int64         `json:"dropped"`
+}
+
+// Store keeps hints in a local Storage.
+type Store struct {
+	local storage.Storage
+	ttl   time.Duration
+
+	replayed atomic.Int64
+	expired  atomic.Int64
+	dropped  atomic.Int64
+}
+
+// New creates a Store keeping hints in local for ttl, or DefaultTTL when
+// ttl is not positive.
+func New(local storage.Storage, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Store{local: local, ttl: ttl}
+}
+
+// List returns the hints kept, oldest first.
+func (s *Store) List() ([]Hint, error) {
+	objects, err := s.local.ListObjects(Bucket)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hints := make([]Hint, 0, len(objects))
+	for _, obj := range objects {
+		h, ok := parseKey(obj.Object)
+		if !ok {
+			continue
+		}
+		h.Size, h.StoredAt = obj.Size, obj.CreatedAt
+		hints = append(hints, h)
+	}
+	slices.SortStableFunc(hints, func(a, b Hint) int {
+		return a.StoredAt.Compare(b.StoredAt)
+	})
+	return hints, nil
+}
+
+// Replay hands off the hints kept, oldest first, by calling deliver with
+// each hint's data and what the local Storage tells about it. Delivered
+// hints are removed, as are expired ones and those deliver returns
+// ErrObsolete for. Once delivering to a node fails, its other hints are
+// left for a later pass, so a node still away is not tried again and
+// again.
+func (s *Store) Replay(ctx context.Context, deliver func(h Hint, body io.Reader, info *storage.ObjectInfo) error) (*Report, error) {
+	hints, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	away := map[string]bool{}
+	for _, h := range hints {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		key := Key(h.Node, h.Bucket, h.Key)
+		if time.Since(h.StoredAt) > s.ttl {
+			if err := s.remove(key); err != nil {
+				return report, err
+			}
+			report.Expired++
+			s.expired.Add(1)
+			continue
+		}
+		if away[h.Node] {
+			report.Pending++
+			continue
+		}
+
+		err := s.deliver(key, h, deliver)
+		switch {
+		case err == nil:
+			report.Replayed++
+			s.replayed.Add(1)
+		case errors.Is(err, ErrObsolete):
+			report.Dropped++
+			s.dropped.Add(1)
+		default:
+			away[h.Node] = true
+			report.Pending++
+			continue
+		}
+		if err := s.remove(key); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (s *Store) deliver(key string, h Hint, deliver func(Hint, io.Reader, *storage.ObjectInfo) error) error {
+	body, info, err := s.local.Get(Bucket, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return deliver(h, body, info)
+}
+
+func (s *Store) remove(key string) error {
+	if err := s.local.Delete(Bucket, key); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Stats describes the hints kept.
+func (s *Store) Stats() (*Stats, error) {
+	hints, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		Pending:  len(hints),
+		TTL:      s.ttl,
+		Replayed: s.replayed.Load(),
+		Expired:  s.expired.Load(),
+		Dropped:  s.dropped.Load(),
+	}
+	for _, h := range hints {
+		if stats.Nodes == nil {
+			stats.Nodes = map[string]int{}
+		}
+		stats.Nodes[h.Node]++
+		stats.Bytes += h.Size
+	}
+	if len(hints) > 0 {
+		stats.Oldest = hints[0].StoredAt
+	}
+	return stats, nil
+}
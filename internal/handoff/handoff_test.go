@@ -0,0 +1,96 @@
+package handoff
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		expected Hint
+		ok       bool
+	}{
+		{name: "Plain key", key: Key("n1", "docs", "a.txt@1.n2"), expected: Hint{Node: "n1", Bucket: "docs", Key: "a.txt@1.n2"}, ok: true},
+		{name: "Key with slashes", key: Key("n1", "docs", "dir/a.txt@1.n2"), expected: Hint{Node: "n1", Bucket: "docs", Key: "dir/a.txt@1.n2"}, ok: true},
+		{name: "Node with a slash", key: Key("rack/n1", "docs", "a.txt"), expected: Hint{Node: "rack/n1", Bucket: "docs", Key: "a.txt"}, ok: true},
+		{name: "Missing key", key: "n1/docs", ok: false},
+		{name: "Missing node", key: "/docs/a.txt", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ok := parseKey(tt.key)
+			if ok != tt.ok || h != tt.expected {
+				t.Errorf("Expected %+v %v, got %+v %v", tt.expected, tt.ok, h, ok)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	local := storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum())
+	add := func(node, key, content string) {
+		t.Helper()
+		if _, err := local.Save(Bucket, Key(node, "docs", key), strings.NewReader(content), storage.WithContentType("text/plain")); err != nil {
+			t.Fatalf("Failed to save the hint: %v", err)
+		}
+	}
+	add("n1", "a.txt@1.n3", "a")
+	add("n1", "b.txt@2.n3", "bb")
+	add("n2", "c.txt@3.n3", "ccc")
+	add("n2", "d.txt@4.n3", "dddd")
+
+	s := New(local, time.Hour)
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Pending != 4 || stats.Bytes != 10 || stats.Nodes["n1"] != 2 || stats.Nodes["n2"] != 2 || stats.Oldest.IsZero() {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	delivered := map[string]string{}
+	report, err := s.Replay(context.Background(), func(h Hint, body io.Reader, info *storage.ObjectInfo) error {
+		switch {
+		case h.Node == "n1":
+			return errors.New("connection refused")
+		case h.Key == "d.txt@4.n3":
+			return ErrObsolete
+		}
+		data, _ := io.ReadAll(body)
+		delivered[h.Key] = string(data) + " " + info.ContentType
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	// The second hint for n1 is not tried once the first failed
+	if report.Replayed != 1 || report.Dropped != 1 || report.Pending != 2 || report.Expired != 0 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if delivered["c.txt@3.n3"] != "ccc text/plain" || len(delivered) != 1 {
+		t.Errorf("Unexpected deliveries %v", delivered)
+	}
+
+	// Hints outliving the TTL are dropped
+	s.ttl = time.Nanosecond
+	report, err = s.Replay(context.Background(), func(Hint, io.Reader, *storage.ObjectInfo) error {
+		t.Error("Expected expired hints not to be delivered")
+		return nil
+	})
+	if err != nil || report.Expired != 2 {
+		t.Errorf("Expected both hints for n1 to expire, got %+v %v", report, err)
+	}
+	stats, _ = s.Stats()
+	if stats.Pending != 0 || stats.Replayed != 1 || stats.Dropped != 1 || stats.Expired != 2 || stats.Nodes != nil {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
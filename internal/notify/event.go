@@ -0,0 +1,83 @@
+// Package notify delivers bucket event notifications, in the S3 event
+// message format, to webhooks, JSON Lines files and Unix sockets.
+package notify
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Message is the document delivered to targets. Like S3, it wraps the
+// records of the events in a Records array.
+type Message struct {
+	Records []Record `json:"Records"`
+}
+
+// Record describes a single event, in the S3 event message format.
+type Record struct {
+	EventVersion string    `json:"eventVersion"`
+	EventSource  string    `json:"eventSource"`
+	AWSRegion    string    `json:"awsRegion"`
+	EventTime    time.Time `json:"eventTime"`
+	// EventName is the event type without its s3: prefix, like
+	// ObjectCreated:Put.
+	EventName string `json:"eventName"`
+	S3        S3     `json:"s3"`
+}
+
+type S3 struct {
+	SchemaVersion   string `json:"s3SchemaVersion"`
+	ConfigurationID string `json:"configurationId"`
+	Bucket          Bucket `json:"bucket"`
+	Object          Object `json:"object"`
+}
+
+type Bucket struct {
+	Name string `json:"name"`
+	ARN  string `json:"arn"`
+}
+
+type Object struct {
+	// Key is URL-encoded, like in S3 events.
+	Key  string `json:"key"`
+	Size int64  `json:"size,omitempty"`
+	ETag string `json:"eTag,omitempty"`
+	// Sequencer orders the events of a key: a later event has a greater
+	// value, compared as strings of equal length.
+	Sequencer string `json:"sequencer"`
+}
+
+// NewRecord builds the record of an event on an object. eventType is the
+// full type, like s3:ObjectCreated:Put.
+func NewRecord(eventType, configurationID, bucket, key string, size int64, etag, sequencer string, at time.Time) Record {
+	return Record{
+		EventVersion: "2.1",
+		EventSource:  "aws:s3",
+		EventTime:    at.UTC(),
+		EventName:    strings.TrimPrefix(eventType, "s3:"),
+		S3: S3{
+			SchemaVersion:   "1.0",
+			ConfigurationID: configurationID,
+			Bucket:          Bucket{Name: bucket, ARN: "arn:aws:s3:::" + bucket},
+			Object: Object{
+				Key:       EncodeKey(key),
+				Size:      size,
+				ETag:      etag,
+				Sequencer: sequencer,
+			},
+		},
+	}
+}
+
+// EncodeKey URL-encodes an object key the way S3 events do, with spaces
+// as + and slashes kept.
+func EncodeKey(key string) string {
+	return strings.ReplaceAll(url.QueryEscape(key), "%2F", "/")
+}
+
+// Marshal encodes the message holding record, on a single line.
+func Marshal(record Record) ([]byte, error) {
+	return json.Marshal(Message{Records: []Record{record}})
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileTarget appends each message as a line to a JSON Lines file, which
+// other processes can tail.
+type fileTarget struct {
+	path string
+}
+
+// fileMu serializes appends, so lines from concurrent deliveries never
+// interleave.
+var fileMu sync.Mutex
+
+func newFileTarget(path string) *fileTarget {
+	return &fileTarget{path: path}
+}
+
+func (t *fileTarget) Send(ctx context.Context, message []byte) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(t.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(message, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	// The message leaves the outbox once delivered, so it must be on disk
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRecord(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	record := NewRecord("s3:ObjectCreated:Put", "indexer", "photos", "2024/red flower.jpg", 42, "abc", "0000000000000001", at)
+
+	data, err := Marshal(record)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var message Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(message.Records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(message.Records))
+	}
+	got := message.Records[0]
+	if got.EventName != "ObjectCreated:Put" || got.EventSource != "aws:s3" || !got.EventTime.Equal(at) {
+		t.Errorf("Unexpected event fields %+v", got)
+	}
+	if got.S3.Bucket.ARN != "arn:aws:s3:::photos" || got.S3.ConfigurationID != "indexer" {
+		t.Errorf("Unexpected bucket fields %+v", got.S3)
+	}
+	if got.S3.Object.Key != "2024/red+flower.jpg" || got.S3.Object.Size != 42 || got.S3.Object.ETag != "abc" {
+		t.Errorf("Unexpected object fields %+v", got.S3.Object)
+	}
+	if strings.Contains(string(data), "\n") {
+		t.Errorf("Expected the message on a single line")
+	}
+}
+
+func TestNewTarget(t *testing.T) {
+	tests := []struct {
+		destination string
+		wantErr     bool
+	}{
+		{"http://localhost:8080/events", false},
+		{"https://indexer.example.com/hook", false},
+		{"file:///var/log/events.jsonl", false},
+		{"unix:///run/events.sock", false},
+		{"ftp://example.com/events", true},
+		{"http:///events", true},
+		{"file://", true},
+		{"events.jsonl", true},
+	}
+	for _, tt := range tests {
+		_, err := NewTarget(tt.destination)
+		var invalid *ErrInvalidDestination
+		if tt.wantErr != errors.As(err, &invalid) {
+			t.Errorf("%s: wantErr %v, got %v", tt.destination, tt.wantErr, err)
+		}
+	}
+}
+
+func TestWebhookTarget(t *testing.T) {
+	var received []string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		received = append(received, string(body))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	target, err := NewTarget(srv.URL + "/hook")
+	if err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+	if err := target.Send(context.Background(), []byte(`{"Records":[]}`)); err != nil {
+		t.Errorf("Failed to send: %v", err)
+	}
+	if len(received) != 1 || received[0] != `{"Records":[]}` {
+		t.Errorf("Expected the message to be posted, got %v", received)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := target.Send(context.Background(), []byte(`{}`)); err == nil {
+		t.Errorf("Expected a non-2xx answer to fail the delivery")
+	}
+}
+
+func TestFileTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sink", "events.jsonl")
+	target, err := NewTarget("file://" + path)
+	if err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+	for _, message := range []string{`{"n":1}`, `{"n":2}`} {
+		if err := target.Send(context.Background(), []byte(message)); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read sink: %v", err)
+	}
+	if string(data) != "{\"n\":1}\n{\"n\":2}\n" {
+		t.Errorf("Expected one line per message, got %q", data)
+	}
+}
+
+func TestSocketTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		lines <- line
+	}()
+
+	target, err := NewTarget("unix://" + path)
+	if err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+	if err := target.Send(context.Background(), []byte(`{"n":1}`)); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	select {
+	case line := <-lines:
+		if line != "{\"n\":1}\n" {
+			t.Errorf("Expected the message as a line, got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the message")
+	}
+
+	listener.Close()
+	if err := target.Send(context.Background(), []byte(`{}`)); err == nil {
+		t.Errorf("Expected sending without a listener to fail")
+	}
+}
@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// socketTimeout bounds connecting to and writing to a socket.
+const socketTimeout = 5 * time.Second
+
+// socketTarget writes each message as a line to a Unix stream socket,
+// connecting for every message so a restarted listener is picked up.
+type socketTarget struct {
+	path string
+}
+
+func newSocketTarget(path string) *socketTarget {
+	return &socketTarget{path: path}
+}
+
+func (t *socketTarget) Send(ctx context.Context, message []byte) error {
+	dialer := net.Dialer{Timeout: socketTimeout}
+	conn, err := dialer.DialContext(ctx, "unix", t.path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(socketTimeout)); err != nil {
+		return err
+	}
+	_, err = conn.Write(append(message, '\n'))
+	return err
+}
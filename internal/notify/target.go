@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Target delivers encoded messages to a destination.
+type Target interface {
+	// Send delivers a message, returning once the destination has
+	// accepted it.
+	Send(ctx context.Context, message []byte) error
+}
+
+// ErrInvalidDestination is returned for destinations no target handles.
+type ErrInvalidDestination struct {
+	Destination string
+	Reason      string
+}
+
+func (e *ErrInvalidDestination) Error() string {
+	return fmt.Sprintf("invalid destination %q: %s", e.Destination, e.Reason)
+}
+
+// NewTarget returns the target for a destination URI:
+//
+//	http://host/path, https://host/path   POST each message to a webhook
+//	file:///path/events.jsonl             append each message as a line
+//	unix:///path/events.sock              write each message as a line
+func NewTarget(destination string) (Target, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, &ErrInvalidDestination{Destination: destination, Reason: err.Error()}
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return nil, &ErrInvalidDestination{Destination: destination, Reason: "a webhook needs a host"}
+		}
+		return newWebhookTarget(destination), nil
+	case "file":
+		if u.Path == "" {
+			return nil, &ErrInvalidDestination{Destination: destination, Reason: "a file needs a path"}
+		}
+		return newFileTarget(u.Path), nil
+	case "unix":
+		if u.Path == "" {
+			return nil, &ErrInvalidDestination{Destination: destination, Reason: "a socket needs a path"}
+		}
+		return newSocketTarget(u.Path), nil
+	default:
+		return nil, &ErrInvalidDestination{Destination: destination, Reason: "the scheme must be http, https, file or unix"}
+	}
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// webhookTimeout bounds a single delivery, so a hung endpoint only delays
+// the retry.
+const webhookTimeout = 10 * time.Second
+
+// webhookTarget POSTs each message to a URL, and takes any 2xx response as
+// delivered.
+type webhookTarget struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookTarget(url string) *webhookTarget {
+	return &webhookTarget{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+func (t *webhookTarget) Send(ctx context.Context, message []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s answered %s", t.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	stateFile    = "state.json"
+	logFile      = "log.jsonl"
+	snapshotFile = "snapshot.json"
+)
+
+// EntryType tells what an entry of the log holds.
+type EntryType string
+
+const (
+	// EntryCommand entries hold a command for the state machine.
+	EntryCommand EntryType = ""
+	// EntryNoop entries are appended by every new leader, to commit the
+	// entries of previous terms.
+	EntryNoop EntryType = "noop"
+	// EntryConfiguration entries hold the members of the cluster, as a
+	// JSON object of addresses keyed by node ID. They take effect as soon
+	// as they are appended.
+	EntryConfiguration EntryType = "configuration"
+)
+
+// Entry is an entry of the replicated log.
+type Entry struct {
+	Index uint64    `json:"index"`
+	Term  uint64    `json:"term"`
+	Type  EntryType `json:"type,omitempty"`
+	Data  []byte    `json:"data,omitempty"`
+}
+
+// Snapshot replaces the log up to and including Index with the state
+// machine's state at that point, and the members of the cluster then.
+type Snapshot struct {
+	Index   uint64            `json:"index"`
+	Term    uint64            `json:"term"`
+	Members map[string]string `json:"members"`
+	Data    []byte            `json:"data,omitempty"`
+}
+
+// hardState is what a node must remember across restarts besides its log.
+type hardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"votedFor,omitempty"`
+}
+
+// disk persists a node's state, log and snapshot under a directory. The
+// log is a file of one JSON entry per line, appended to and synced before
+// a node acts on new entries, and rewritten when entries are truncated or
+// compacted into a snapshot.
+type disk struct {
+	dir string
+	log *os.File
+}
+
+// openDisk opens the state under dir, creating it when missing. A line
+// torn by a crash while appending ends the log.
+func openDisk(dir string) (*disk, *hardState, *Snapshot, []Entry, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	d := &disk{dir: dir}
+
+	state := &hardState{}
+	if err := readJSONFile(filepath.Join(dir, stateFile), state); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil, nil, err
+	}
+	var snapshot *Snapshot
+	if err := readJSONFile(filepath.Join(dir, snapshotFile), &snapshot); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil, nil, err
+	}
+
+	entries, err := d.readLog(snapshot)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	// Drop whatever a torn line left behind
+	if err := d.rewrite(entries); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return d, state, snapshot, entries, nil
+}
+
+// readLog returns the entries of the log that follow the snapshot.
+func (d *disk) readLog(snapshot *Snapshot) ([]Entry, error) {
+	file, err := os.Open(filepath.Join(d.dir, logFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var after uint64
+	if snapshot != nil {
+		after = snapshot.Index
+	}
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<30)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			break
+		}
+		if entry.Index <= after {
+			continue
+		}
+		if entry.Index != after+uint64(len(entries))+1 {
+			return nil, fmt.Errorf("raft log has entry %d after %d", entry.Index, after+uint64(len(entries)))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func (d *disk) saveState(state *hardState) error {
+	return writeJSONFile(filepath.Join(d.dir, stateFile), state)
+}
+
+func (d *disk) saveSnapshot(snapshot *Snapshot) error {
+	return writeJSONFile(filepath.Join(d.dir, snapshotFile), snapshot)
+}
+
+// append adds entries to the end of the log.
+func (d *disk) append(entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	w := bufio.NewWriter(d.log)
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return d.log.Sync()
+}
+
+// rewrite replaces the log with entries.
+func (d *disk) rewrite(entries []Entry) error {
+	tmp, err := os.CreateTemp(d.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if d.log != nil {
+		d.log.Close()
+	}
+	d.log = tmp
+	if err := d.append(entries); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(d.dir, logFile)); err != nil {
+		tmp.Close()
+		return err
+	}
+	return nil
+}
+
+func (d *disk) close() error {
+	return d.log.Close()
+}
+
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSONFile replaces the file at path with v, atomically and durably.
+func writeJSONFile(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,72 @@
+package raft
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDisk(t *testing.T) {
+	t.Run("Reloads state, snapshot and the entries after it", func(t *testing.T) {
+		dir := t.TempDir()
+		d, _, _, _, err := openDisk(dir)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		if err := d.saveState(&hardState{Term: 3, VotedFor: "n2"}); err != nil {
+			t.Fatalf("Failed to save state: %v", err)
+		}
+		if err := d.append([]Entry{{Index: 1, Term: 1}, {Index: 2, Term: 2}, {Index: 3, Term: 3, Data: []byte("x")}}); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+		if err := d.saveSnapshot(&Snapshot{Index: 1, Term: 1, Members: map[string]string{"n1": "a"}}); err != nil {
+			t.Fatalf("Failed to save snapshot: %v", err)
+		}
+		d.close()
+
+		_, state, snapshot, entries, err := openDisk(dir)
+		if err != nil {
+			t.Fatalf("Failed to reopen: %v", err)
+		}
+		if state.Term != 3 || state.VotedFor != "n2" {
+			t.Errorf("Unexpected state %+v", state)
+		}
+		if snapshot.Index != 1 || snapshot.Members["n1"] != "a" {
+			t.Errorf("Unexpected snapshot %+v", snapshot)
+		}
+		if len(entries) != 2 || entries[0].Index != 2 || string(entries[1].Data) != "x" {
+			t.Errorf("Expected entries 2 and 3, got %+v", entries)
+		}
+	})
+
+	t.Run("Drops a torn last line", func(t *testing.T) {
+		dir := t.TempDir()
+		d, _, _, _, err := openDisk(dir)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		if err := d.append([]Entry{{Index: 1, Term: 1}}); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+		d.close()
+
+		file, _ := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0644)
+		file.WriteString(`{"index":2,"te`)
+		file.Close()
+
+		d, _, _, entries, err := openDisk(dir)
+		if err != nil {
+			t.Fatalf("Failed to reopen: %v", err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("Expected the torn entry to be dropped, got %+v", entries)
+		}
+		if err := d.append([]Entry{{Index: 2, Term: 1}}); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+		d.close()
+		if _, _, _, entries, _ := openDisk(dir); len(entries) != 2 {
+			t.Errorf("Expected 2 entries after appending again, got %+v", entries)
+		}
+	})
+}
@@ -0,0 +1,781 @@
+// Package raft implements the Raft consensus algorithm: a cluster of nodes
+// elects a leader, which replicates a log of commands to the others and
+// tells them once a majority stored each one, so every node applies the
+// same commands in the same order to its state machine.
+//
+// Besides leader election and log replication, nodes compact their log
+// into snapshots of the state machine, send those to followers too far
+// behind, and change the members of the cluster one node at a time. Nodes
+// talk over a Transport, like HTTPTransport.
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// State is the role a node plays in its current term.
+type State string
+
+const (
+	Follower  State = "follower"
+	Candidate State = "candidate"
+	Leader    State = "leader"
+)
+
+const (
+	defaultElectionTimeout   = time.Second
+	defaultHeartbeatInterval = 100 * time.Millisecond
+	defaultSnapshotThreshold = 1024
+
+	// maxAppendEntries caps the entries sent to a follower at once.
+	maxAppendEntries = 512
+)
+
+var errClosed = errors.New("raft node is stopped")
+
+// StateMachine is what the replicated log drives. Apply is called with the
+// commands of committed entries, in log order, and returns the result
+// Propose returns on the node that proposed it. Snapshot returns the
+// state reached by the commands applied so far, which Restore brings back.
+type StateMachine interface {
+	Apply(command []byte) any
+	Snapshot() ([]byte, error)
+	Restore(snapshot []byte) error
+}
+
+// Config configures a Node.
+type Config struct {
+	// ID identifies the node in the cluster.
+	ID string
+
+	// Dir is where the node persists its log, snapshots and votes.
+	Dir string
+
+	// Peers are the addresses of the members of a new cluster, keyed by
+	// node ID and including this node. Every node of a new cluster must be
+	// given the same ones. Nodes joining an existing cluster are given
+	// none, and wait for its leader to add them. Peers is ignored once the
+	// node has state in Dir.
+	Peers map[string]string
+
+	Transport Transport
+
+	// ElectionTimeout is how long followers wait to hear from a leader
+	// before starting an election, randomized up to twice as long.
+	// HeartbeatInterval is how often the leader contacts idle followers.
+	ElectionTimeout   time.Duration
+	HeartbeatInterval time.Duration
+
+	// SnapshotThreshold is how many applied entries the log grows by
+	// before it is compacted into a snapshot.
+	SnapshotThreshold uint64
+}
+
+// Status describes a node, as seen by it.
+type Status struct {
+	ID            string            `json:"id"`
+	State         State             `json:"state"`
+	Term          uint64            `json:"term"`
+	Leader        string            `json:"leader,omitempty"`
+	LeaderAddr    string            `json:"leaderAddr,omitempty"`
+	CommitIndex   uint64            `json:"commitIndex"`
+	AppliedIndex  uint64            `json:"appliedIndex"`
+	LastIndex     uint64            `json:"lastIndex"`
+	SnapshotIndex uint64            `json:"snapshotIndex"`
+	Members       map[string]string `json:"members"`
+}
+
+// Node is a member of a Raft cluster.
+type Node struct {
+	id                string
+	fsm               StateMachine
+	transport         Transport
+	disk              *disk
+	electionTimeout   time.Duration
+	heartbeatInterval time.Duration
+	snapshotThreshold uint64
+
+	// applyMu serializes applying entries to the state machine with
+	// restoring it from a snapshot. It is taken before mu.
+	applyMu sync.Mutex
+
+	mu       sync.Mutex
+	closed   bool
+	state    State
+	term     uint64
+	votedFor string
+	leader   string
+	votes    map[string]bool
+
+	// entries follow the snapshot, so entries[0] has index snapshot.Index+1.
+	snapshot *Snapshot
+	entries  []Entry
+
+	// members are the latest configuration in the log, appended at
+	// membersIndex, whether committed or not.
+	members      map[string]string
+	membersIndex uint64
+
+	commitIndex uint64
+	lastApplied uint64
+	// applied is closed and replaced whenever lastApplied advances.
+	applied chan struct{}
+	// applySignal wakes up the apply loop when commitIndex advances.
+	applySignal chan struct{}
+	// waiters are the proposals of this node waiting to be applied, by
+	// index.
+	waiters map[uint64]*waiter
+
+	electionDeadline time.Time
+	lastContact      time.Time
+
+	// Leader state, reset on every election won. termStart is the index
+	// of the entry the leader appended when elected.
+	termStart     uint64
+	lastHeartbeat time.Time
+	nextIndex     map[string]uint64
+	matchIndex    map[string]uint64
+	lastAck       map[string]time.Time
+	inflight      map[string]bool
+}
+
+type waiter struct {
+	term uint64
+	done chan result
+}
+
+type result struct {
+	value any
+	err   error
+}
+
+// NewNode loads the node's state from cfg.Dir, or starts a new cluster
+// with cfg.Peers, and restores fsm from the latest snapshot. The node
+// takes part in the cluster once Run is called.
+func NewNode(cfg Config, fsm StateMachine) (*Node, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("raft node needs an ID")
+	}
+	if cfg.Transport == nil {
+		return nil, errors.New("raft node needs a transport")
+	}
+
+	d, state, snapshot, entries, err := openDisk(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		snapshot = &Snapshot{Members: map[string]string{}}
+		if len(entries) == 0 && len(cfg.Peers) > 0 {
+			snapshot.Members = maps.Clone(cfg.Peers)
+			if err := d.saveSnapshot(snapshot); err != nil {
+				d.close()
+				return nil, err
+			}
+		}
+	}
+	if snapshot.Data != nil {
+		if err := fsm.Restore(snapshot.Data); err != nil {
+			d.close()
+			return nil, fmt.Errorf("restoring raft snapshot: %w", err)
+		}
+	}
+
+	n := &Node{
+		id:                cfg.ID,
+		fsm:               fsm,
+		transport:         cfg.Transport,
+		disk:              d,
+		electionTimeout:   cfg.ElectionTimeout,
+		heartbeatInterval: cfg.HeartbeatInterval,
+		snapshotThreshold: cfg.SnapshotThreshold,
+		state:             Follower,
+		term:              state.Term,
+		votedFor:          state.VotedFor,
+		snapshot:          snapshot,
+		entries:           entries,
+		commitIndex:       snapshot.Index,
+		lastApplied:       snapshot.Index,
+		applied:           make(chan struct{}),
+		applySignal:       make(chan struct{}, 1),
+		waiters:           map[uint64]*waiter{},
+	}
+	if n.electionTimeout <= 0 {
+		n.electionTimeout = defaultElectionTimeout
+	}
+	if n.heartbeatInterval <= 0 {
+		n.heartbeatInterval = defaultHeartbeatInterval
+	}
+	if n.snapshotThreshold == 0 {
+		n.snapshotThreshold = defaultSnapshotThreshold
+	}
+	n.refreshMembers()
+	n.resetElectionDeadline()
+	return n, nil
+}
+
+// Run takes part in the cluster until ctx is done, then stops the node.
+func (n *Node) Run(ctx context.Context) {
+	applied := make(chan struct{})
+	go func() {
+		defer close(applied)
+		n.applyLoop(ctx)
+	}()
+
+	ticker := time.NewTicker(min(n.heartbeatInterval, n.electionTimeout/10))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			<-applied
+			n.mu.Lock()
+			n.closed = true
+			n.disk.close()
+			for index, w := range n.waiters {
+				delete(n.waiters, index)
+				w.done <- result{err: errClosed}
+			}
+			n.mu.Unlock()
+			return
+		case now := <-ticker.C:
+			n.tick(now)
+		}
+	}
+}
+
+func (n *Node) tick(now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return
+	}
+	if n.state == Leader {
+		// A leader cut off from most of the cluster steps down, rather
+		// than take proposals it cannot commit
+		if !n.hasQuorumContact(now) {
+			n.leader = ""
+			n.becomeFollower(n.term)
+			return
+		}
+		if now.Sub(n.lastHeartbeat) >= n.heartbeatInterval {
+			n.broadcast()
+		}
+		return
+	}
+	if _, member := n.members[n.id]; member && now.After(n.electionDeadline) {
+		n.startElection()
+	}
+}
+
+// Propose appends command to the log, and returns what the state machine
+// returned applying it once it is committed. Only the leader takes
+// proposals; other nodes return a *NotLeaderError.
+func (n *Node) Propose(ctx context.Context, command []byte) (any, error) {
+	n.mu.Lock()
+	if err := n.checkLeader(); err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	index, w, err := n.appendLocked(EntryCommand, command)
+	n.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return n.wait(ctx, index, w)
+}
+
+// AddMember adds a node to the cluster, or changes its address. The node
+// should be running already, without peers, so the leader can bring it up
+// to date.
+func (n *Node) AddMember(ctx context.Context, id, addr string) error {
+	return n.changeMembers(ctx, func(members map[string]string) error {
+		members[id] = addr
+		return nil
+	})
+}
+
+// RemoveMember removes a node from the cluster. The leader may remove
+// itself, and steps down once the change is committed.
+func (n *Node) RemoveMember(ctx context.Context, id string) error {
+	return n.changeMembers(ctx, func(members map[string]string) error {
+		if _, ok := members[id]; ok && len(members) == 1 {
+			return ErrLastMember
+		}
+		delete(members, id)
+		return nil
+	})
+}
+
+// changeMembers commits the members change makes to the current ones.
+// Changes go one at a time, so the old and new majorities always overlap.
+func (n *Node) changeMembers(ctx context.Context, change func(map[string]string) error) error {
+	n.mu.Lock()
+	if err := n.checkLeader(); err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	if n.membersIndex > n.commitIndex {
+		n.mu.Unlock()
+		return ErrMembershipChangePending
+	}
+	members := maps.Clone(n.members)
+	if err := change(members); err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	if maps.Equal(members, n.members) {
+		n.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	index, w, err := n.appendLocked(EntryConfiguration, data)
+	n.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = n.wait(ctx, index, w)
+	return err
+}
+
+// appendLocked appends an entry of the leader's term to its log and starts
+// replicating it.
+func (n *Node) appendLocked(typ EntryType, data []byte) (uint64, *waiter, error) {
+	entry := Entry{Index: n.lastIndex() + 1, Term: n.term, Type: typ, Data: data}
+	if err := n.appendEntries([]Entry{entry}); err != nil {
+		return 0, nil, err
+	}
+	w := &waiter{term: n.term, done: make(chan result, 1)}
+	n.waiters[entry.Index] = w
+	n.advanceCommit()
+	n.broadcast()
+	return entry.Index, w, nil
+}
+
+func (n *Node) wait(ctx context.Context, index uint64, w *waiter) (any, error) {
+	select {
+	case r := <-w.done:
+		return r.value, r.err
+	case <-ctx.Done():
+		n.mu.Lock()
+		if n.waiters[index] == w {
+			delete(n.waiters, index)
+		}
+		n.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// ReadIndex returns an index the state machine must have applied for
+// reads to observe every write committed before ReadIndex was called.
+// Only the leader answers, after checking with a majority that it still
+// is the leader.
+func (n *Node) ReadIndex(ctx context.Context) (uint64, error) {
+	n.mu.Lock()
+	if err := n.checkLeader(); err != nil {
+		n.mu.Unlock()
+		return 0, err
+	}
+	term, start := n.term, n.termStart
+	n.mu.Unlock()
+
+	// A new leader only knows which entries are committed once the entry
+	// it appended when elected is
+	if err := n.WaitApplied(ctx, start); err != nil {
+		return 0, err
+	}
+
+	n.mu.Lock()
+	if n.state != Leader || n.term != term {
+		n.mu.Unlock()
+		return 0, ErrLeadershipLost
+	}
+	index := n.commitIndex
+	n.mu.Unlock()
+
+	if err := n.confirmLeadership(ctx, term); err != nil {
+		return 0, err
+	}
+	return index, nil
+}
+
+// Barrier waits until this node's state machine reflects every write
+// committed before Barrier was called, asking the leader for its read
+// index when this node is not the leader. Reads made after Barrier are
+// linearizable.
+func (n *Node) Barrier(ctx context.Context) error {
+	n.mu.Lock()
+	if n.state == Leader {
+		n.mu.Unlock()
+		index, err := n.ReadIndex(ctx)
+		if err != nil {
+			return err
+		}
+		return n.WaitApplied(ctx, index)
+	}
+	leader, addr := n.leader, n.members[n.leader]
+	n.mu.Unlock()
+
+	if leader == "" || addr == "" {
+		return &NotLeaderError{}
+	}
+	resp, err := n.transport.ReadIndex(ctx, addr)
+	if err != nil {
+		return err
+	}
+	return n.WaitApplied(ctx, resp.Index)
+}
+
+// WaitApplied waits until the state machine has applied the entry at
+// index.
+func (n *Node) WaitApplied(ctx context.Context, index uint64) error {
+	for {
+		n.mu.Lock()
+		if n.lastApplied >= index {
+			n.mu.Unlock()
+			return nil
+		}
+		if n.closed {
+			n.mu.Unlock()
+			return errClosed
+		}
+		applied := n.applied
+		n.mu.Unlock()
+
+		select {
+		case <-applied:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Leader returns the ID and address of the leader this node knows of,
+// which are empty during elections.
+func (n *Node) Leader() (string, string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leader, n.members[n.leader]
+}
+
+// Status returns the node's view of the cluster.
+func (n *Node) Status() *Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return &Status{
+		ID:            n.id,
+		State:         n.state,
+		Term:          n.term,
+		Leader:        n.leader,
+		LeaderAddr:    n.members[n.leader],
+		CommitIndex:   n.commitIndex,
+		AppliedIndex:  n.lastApplied,
+		LastIndex:     n.lastIndex(),
+		SnapshotIndex: n.snapshot.Index,
+		Members:       maps.Clone(n.members),
+	}
+}
+
+func (n *Node) checkLeader() error {
+	if n.closed {
+		return errClosed
+	}
+	if n.state != Leader {
+		return &NotLeaderError{Leader: n.leader, Addr: n.members[n.leader]}
+	}
+	return nil
+}
+
+func (n *Node) startElection() {
+	n.state = Candidate
+	n.term++
+	n.votedFor = n.id
+	n.leader = ""
+	n.resetElectionDeadline()
+	if err := n.persistState(); err != nil {
+		// Try again at the next timeout
+		n.state = Follower
+		return
+	}
+
+	n.votes = map[string]bool{n.id: true}
+	if len(n.votes) >= n.majority() {
+		n.becomeLeader()
+		return
+	}
+
+	lastIndex := n.lastIndex()
+	lastTerm, _ := n.termAt(lastIndex)
+	req := &VoteRequest{Term: n.term, CandidateID: n.id, LastLogIndex: lastIndex, LastLogTerm: lastTerm}
+	for id, addr := range n.members {
+		if id != n.id {
+			go n.requestVote(id, addr, req)
+		}
+	}
+}
+
+func (n *Node) requestVote(id, addr string, req *VoteRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.electionTimeout)
+	defer cancel()
+	resp, err := n.transport.RequestVote(ctx, addr, req)
+	if err != nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if resp.Term > n.term {
+		n.becomeFollower(resp.Term)
+		return
+	}
+	if n.state != Candidate || n.term != req.Term || !resp.Granted {
+		return
+	}
+	n.votes[id] = true
+	if len(n.votes) >= n.majority() {
+		n.becomeLeader()
+	}
+}
+
+func (n *Node) becomeLeader() {
+	now := time.Now()
+	n.state = Leader
+	n.leader = n.id
+	n.nextIndex = map[string]uint64{}
+	n.matchIndex = map[string]uint64{}
+	n.lastAck = map[string]time.Time{}
+	n.inflight = map[string]bool{}
+	for id := range n.members {
+		n.nextIndex[id] = n.lastIndex() + 1
+		n.lastAck[id] = now
+	}
+
+	// Committing an entry of its own term commits those of the previous
+	// leaders too
+	n.termStart = n.lastIndex() + 1
+	if err := n.appendEntries([]Entry{{Index: n.termStart, Term: n.term, Type: EntryNoop}}); err != nil {
+		n.leader = ""
+		n.becomeFollower(n.term)
+		return
+	}
+	n.advanceCommit()
+	n.broadcast()
+}
+
+// becomeFollower moves to term, if it is newer, and waits for a leader.
+func (n *Node) becomeFollower(term uint64) {
+	if term > n.term {
+		n.term = term
+		n.votedFor = ""
+		n.leader = ""
+		// Voting twice in a term is worse than not voting, so a failure
+		// only loses the vote
+		if err := n.persistState(); err != nil {
+			n.votedFor = n.id
+		}
+	}
+	n.state = Follower
+	n.resetElectionDeadline()
+}
+
+// hasQuorumContact reports whether the leader heard from a majority within
+// an election timeout.
+func (n *Node) hasQuorumContact(now time.Time) bool {
+	count := 0
+	for id := range n.members {
+		if id == n.id || now.Sub(n.lastAck[id]) < n.electionTimeout {
+			count++
+		}
+	}
+	return count >= n.majority()
+}
+
+func (n *Node) majority() int {
+	return len(n.members)/2 + 1
+}
+
+func (n *Node) resetElectionDeadline() {
+	jitter := time.Duration(rand.Int64N(int64(n.electionTimeout)))
+	n.electionDeadline = time.Now().Add(n.electionTimeout + jitter)
+}
+
+func (n *Node) persistState() error {
+	return n.disk.saveState(&hardState{Term: n.term, VotedFor: n.votedFor})
+}
+
+func (n *Node) lastIndex() uint64 {
+	return n.snapshot.Index + uint64(len(n.entries))
+}
+
+// termAt returns the term of the entry at index, if the log has it or the
+// snapshot ends with it.
+func (n *Node) termAt(index uint64) (uint64, bool) {
+	switch {
+	case index == n.snapshot.Index:
+		return n.snapshot.Term, true
+	case index < n.snapshot.Index || index > n.lastIndex():
+		return 0, false
+	default:
+		return n.entries[index-n.snapshot.Index-1].Term, true
+	}
+}
+
+// appendEntries persists entries and adds them to the end of the log.
+func (n *Node) appendEntries(entries []Entry) error {
+	if err := n.disk.append(entries); err != nil {
+		return err
+	}
+	n.entries = append(n.entries, entries...)
+	for _, entry := range entries {
+		if entry.Type == EntryConfiguration {
+			n.refreshMembers()
+			break
+		}
+	}
+	return nil
+}
+
+// truncate removes the entries from index on, which conflict with the
+// leader's.
+func (n *Node) truncate(index uint64) error {
+	entries := n.entries[:index-n.snapshot.Index-1]
+	if err := n.disk.rewrite(entries); err != nil {
+		return err
+	}
+	n.entries = entries
+	n.refreshMembers()
+	for i, w := range n.waiters {
+		if i >= index {
+			delete(n.waiters, i)
+			w.done <- result{err: ErrLeadershipLost}
+		}
+	}
+	return nil
+}
+
+// refreshMembers sets members to the latest configuration in the log.
+func (n *Node) refreshMembers() {
+	n.members, n.membersIndex = n.membersAt(n.lastIndex())
+}
+
+// membersAt returns the configuration in effect at index, and the index it
+// was appended at.
+func (n *Node) membersAt(index uint64) (map[string]string, uint64) {
+	for i := min(index, n.lastIndex()); i > n.snapshot.Index; i-- {
+		entry := &n.entries[i-n.snapshot.Index-1]
+		if entry.Type != EntryConfiguration {
+			continue
+		}
+		var members map[string]string
+		if err := json.Unmarshal(entry.Data, &members); err == nil {
+			return members, entry.Index
+		}
+	}
+	return n.snapshot.Members, n.snapshot.Index
+}
+
+func (n *Node) signalApply() {
+	select {
+	case n.applySignal <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Node) applyLoop(ctx context.Context) {
+	for {
+		n.applyCommitted()
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.applySignal:
+		}
+	}
+}
+
+// applyCommitted applies the committed entries not applied yet, then
+// takes a snapshot when the log has grown enough since the last one.
+func (n *Node) applyCommitted() {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+
+	for {
+		n.mu.Lock()
+		if n.lastApplied >= n.commitIndex || n.lastApplied < n.snapshot.Index {
+			n.mu.Unlock()
+			break
+		}
+		from := n.lastApplied - n.snapshot.Index
+		entries := n.entries[from : n.commitIndex-n.snapshot.Index]
+		n.mu.Unlock()
+
+		for _, entry := range entries {
+			var value any
+			if entry.Type == EntryCommand {
+				value = n.fsm.Apply(entry.Data)
+			}
+
+			n.mu.Lock()
+			n.lastApplied = entry.Index
+			if w, ok := n.waiters[entry.Index]; ok {
+				delete(n.waiters, entry.Index)
+				if w.term == entry.Term {
+					w.done <- result{value: value}
+				} else {
+					w.done <- result{err: ErrLeadershipLost}
+				}
+			}
+			n.mu.Unlock()
+		}
+
+		n.mu.Lock()
+		close(n.applied)
+		n.applied = make(chan struct{})
+		n.mu.Unlock()
+	}
+
+	n.mu.Lock()
+	due := n.lastApplied-n.snapshot.Index >= n.snapshotThreshold
+	n.mu.Unlock()
+	if due {
+		n.takeSnapshot()
+	}
+}
+
+// takeSnapshot compacts the applied entries into a snapshot. applyMu must
+// be held, so the state machine does not move on meanwhile.
+func (n *Node) takeSnapshot() {
+	data, err := n.fsm.Snapshot()
+	if err != nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	index := n.lastApplied
+	term, _ := n.termAt(index)
+	members, _ := n.membersAt(index)
+	snapshot := &Snapshot{Index: index, Term: term, Members: members, Data: data}
+	if err := n.disk.saveSnapshot(snapshot); err != nil {
+		return
+	}
+	entries := append([]Entry(nil), n.entries[index-n.snapshot.Index:]...)
+	n.snapshot = snapshot
+	n.entries = entries
+	// A stale log only holds entries the snapshot covers, which loading
+	// skips, so failing to rewrite it is harmless
+	_ = n.disk.rewrite(entries)
+}
@@ -0,0 +1,322 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// listMachine is a state machine keeping the commands applied to it.
+type listMachine struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (m *listMachine) Apply(command []byte) any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = append(m.commands, string(command))
+	return len(m.commands)
+}
+
+func (m *listMachine) Snapshot() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return json.Marshal(m.commands)
+}
+
+func (m *listMachine) Restore(snapshot []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = nil
+	return json.Unmarshal(snapshot, &m.commands)
+}
+
+func (m *listMachine) list() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.commands)
+}
+
+type testNode struct {
+	*Node
+	fsm     *listMachine
+	addr    string
+	dir     string
+	handler atomic.Pointer[http.Handler]
+	server  *httptest.Server
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+func (n *testNode) ID() string {
+	return n.id
+}
+
+type testCluster struct {
+	t     *testing.T
+	nodes map[string]*testNode
+	cfg   Config
+}
+
+// newTestCluster starts a cluster of size nodes, n1 to n<size>, each
+// behind its own HTTP server.
+func newTestCluster(t *testing.T, size int, cfg Config) *testCluster {
+	t.Helper()
+	c := &testCluster{t: t, nodes: map[string]*testNode{}, cfg: cfg}
+	peers := map[string]string{}
+	for i := 1; i <= size; i++ {
+		node := c.listen(fmt.Sprintf("n%d", i))
+		peers[node.ID()] = node.addr
+	}
+	for id := range peers {
+		c.start(id, peers)
+	}
+	return c
+}
+
+// listen creates the HTTP server of a node, which answers once the node
+// is started.
+func (c *testCluster) listen(id string) *testNode {
+	node := &testNode{dir: c.t.TempDir()}
+	node.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler := node.handler.Load()
+		if handler == nil {
+			http.Error(w, "stopped", http.StatusServiceUnavailable)
+			return
+		}
+		http.StripPrefix("/raft", *handler).ServeHTTP(w, r)
+	}))
+	c.t.Cleanup(node.server.Close)
+	node.addr = node.server.URL
+	node.Node = &Node{id: id}
+	c.nodes[id] = node
+	return node
+}
+
+func (c *testCluster) start(id string, peers map[string]string) {
+	c.t.Helper()
+	node := c.nodes[id]
+	cfg := c.cfg
+	cfg.ID = id
+	cfg.Dir = node.dir
+	cfg.Peers = peers
+	cfg.Transport = NewHTTPTransport("/raft")
+	if cfg.ElectionTimeout == 0 {
+		cfg.ElectionTimeout = 150 * time.Millisecond
+	}
+	if cfg.HeartbeatInterval == 0 {
+		cfg.HeartbeatInterval = 20 * time.Millisecond
+	}
+
+	node.fsm = &listMachine{}
+	n, err := NewNode(cfg, node.fsm)
+	if err != nil {
+		c.t.Fatalf("Failed to create node %s: %v", id, err)
+	}
+	node.Node = n
+	handler := n.Handler()
+	node.handler.Store(&handler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	node.stop = cancel
+	node.stopped = make(chan struct{})
+	go func() {
+		defer close(node.stopped)
+		n.Run(ctx)
+	}()
+	c.t.Cleanup(func() { c.stop(id) })
+}
+
+func (c *testCluster) stop(id string) {
+	node := c.nodes[id]
+	node.handler.Store(nil)
+	node.stop()
+	<-node.stopped
+}
+
+// leader waits for a single leader among the running nodes.
+func (c *testCluster) leader(except ...string) *testNode {
+	c.t.Helper()
+	var leader *testNode
+	eventually(c.t, "a leader to be elected", func() bool {
+		leader = nil
+		for id, node := range c.nodes {
+			if slices.Contains(except, id) || node.handler.Load() == nil {
+				continue
+			}
+			if node.Status().State == Leader {
+				if leader != nil && leader.Status().Term == node.Status().Term {
+					return false
+				}
+				if leader == nil || node.Status().Term > leader.Status().Term {
+					leader = node
+				}
+			}
+		}
+		return leader != nil
+	})
+	return leader
+}
+
+func (c *testCluster) propose(node *testNode, commands ...string) {
+	c.t.Helper()
+	for _, command := range commands {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := node.Propose(ctx, []byte(command))
+		cancel()
+		if err != nil {
+			c.t.Fatalf("Failed to propose %q: %v", command, err)
+		}
+	}
+}
+
+// converge waits for every running node to have applied want.
+func (c *testCluster) converge(want []string) {
+	c.t.Helper()
+	eventually(c.t, fmt.Sprintf("every node to apply %v", want), func() bool {
+		for _, node := range c.nodes {
+			if node.handler.Load() != nil && !slices.Equal(node.fsm.list(), want) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestElectsOneLeaderAndReplicates(t *testing.T) {
+	c := newTestCluster(t, 3, Config{})
+	leader := c.leader()
+
+	ctx := context.Background()
+	result, err := leader.Propose(ctx, []byte("a"))
+	if err != nil || result != 1 {
+		t.Fatalf("Expected the state machine's result 1, got %v %v", result, err)
+	}
+	c.propose(leader, "b", "c")
+	c.converge([]string{"a", "b", "c"})
+
+	for id, node := range c.nodes {
+		if id == leader.ID() {
+			continue
+		}
+		var notLeader *NotLeaderError
+		_, err := node.Propose(ctx, []byte("d"))
+		if !errors.As(err, &notLeader) || notLeader.Leader != leader.ID() || notLeader.Addr != leader.addr {
+			t.Errorf("Expected %s to point to the leader, got %v", id, err)
+		}
+	}
+}
+
+func TestLeaderFailover(t *testing.T) {
+	c := newTestCluster(t, 3, Config{})
+	old := c.leader()
+	c.propose(old, "a")
+	c.converge([]string{"a"})
+
+	c.stop(old.ID())
+	leader := c.leader(old.ID())
+	if leader.Status().Term <= old.Status().Term {
+		t.Errorf("Expected a new term, got %d after %d", leader.Status().Term, old.Status().Term)
+	}
+	c.propose(leader, "b")
+
+	// The old leader rejoins from its persisted state and catches up
+	c.start(old.ID(), nil)
+	c.converge([]string{"a", "b"})
+	if status := old.Status(); status.State != Follower || status.Leader != leader.ID() {
+		t.Errorf("Expected the old leader to follow %s, got %+v", leader.ID(), status)
+	}
+}
+
+func TestBarrierOnFollower(t *testing.T) {
+	c := newTestCluster(t, 3, Config{})
+	leader := c.leader()
+	c.propose(leader, "a", "b")
+
+	for id, node := range c.nodes {
+		if err := node.Barrier(context.Background()); err != nil {
+			t.Fatalf("Barrier on %s failed: %v", id, err)
+		}
+		// No waiting: the barrier guarantees the writes are applied
+		if got := node.fsm.list(); !slices.Equal(got, []string{"a", "b"}) {
+			t.Errorf("Expected %s to have applied both commands, got %v", id, got)
+		}
+	}
+}
+
+func TestSnapshotsAndMembership(t *testing.T) {
+	c := newTestCluster(t, 3, Config{SnapshotThreshold: 5})
+	leader := c.leader()
+
+	var want []string
+	for i := range 12 {
+		want = append(want, fmt.Sprint(i))
+	}
+	c.propose(leader, want...)
+	c.converge(want)
+	eventually(t, "the leader to compact its log", func() bool {
+		return leader.Status().SnapshotIndex > 0
+	})
+
+	// A node joining is sent the snapshot, then the entries after it
+	joining := c.listen("n4")
+	c.start("n4", nil)
+	if err := leader.AddMember(context.Background(), "n4", joining.addr); err != nil {
+		t.Fatalf("Failed to add n4: %v", err)
+	}
+	c.converge(want)
+	if members := joining.Status().Members; len(members) != 4 {
+		t.Errorf("Expected n4 to know of 4 members, got %v", members)
+	}
+
+	// Removing the leader makes the others elect a new one
+	if err := leader.RemoveMember(context.Background(), leader.ID()); err != nil {
+		t.Fatalf("Failed to remove the leader: %v", err)
+	}
+	next := c.leader(leader.ID())
+	c.propose(next, "after")
+	want = append(want, "after")
+	eventually(t, "the remaining members to apply the new command", func() bool {
+		for id, node := range c.nodes {
+			if id != leader.ID() && !slices.Equal(node.fsm.list(), want) {
+				return false
+			}
+		}
+		return true
+	})
+	if members := next.Status().Members; len(members) != 3 || members[leader.ID()] != "" {
+		t.Errorf("Expected the old leader to be removed, got %v", members)
+	}
+}
+
+func TestRestartKeepsState(t *testing.T) {
+	c := newTestCluster(t, 1, Config{SnapshotThreshold: 3})
+	c.propose(c.leader(), "a", "b", "c", "d", "e")
+	c.converge([]string{"a", "b", "c", "d", "e"})
+
+	c.stop("n1")
+	c.start("n1", nil)
+	c.converge([]string{"a", "b", "c", "d", "e"})
+	c.propose(c.leader(), "f")
+	c.converge([]string{"a", "b", "c", "d", "e", "f"})
+}
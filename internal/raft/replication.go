@@ -0,0 +1,370 @@
+package raft
+
+import (
+	"context"
+	"time"
+)
+
+// broadcast sends followers the entries they miss, or a heartbeat.
+func (n *Node) broadcast() {
+	n.lastHeartbeat = time.Now()
+	for id := range n.members {
+		if id != n.id {
+			go n.replicate(id)
+		}
+	}
+}
+
+// replicate brings a follower up to date, unless that is already under
+// way.
+func (n *Node) replicate(id string) {
+	for n.replicateOnce(id) {
+	}
+}
+
+// replicateOnce sends a follower the next entries it misses, or the
+// snapshot when the leader compacted them away, and reports whether more
+// are left to send.
+func (n *Node) replicateOnce(id string) bool {
+	n.mu.Lock()
+	addr, member := n.members[id]
+	if n.state != Leader || n.closed || !member || n.inflight[id] {
+		n.mu.Unlock()
+		return false
+	}
+	n.inflight[id] = true
+	term := n.term
+
+	next := max(n.nextIndex[id], 1)
+	if next <= n.snapshot.Index {
+		req := &SnapshotRequest{Term: term, LeaderID: n.id, Snapshot: n.snapshot}
+		n.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*n.electionTimeout)
+		resp, err := n.transport.InstallSnapshot(ctx, addr, req)
+		cancel()
+
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.inflight[id] = false
+		if err != nil || !n.acknowledged(id, term, resp.Term) {
+			return false
+		}
+		n.matchIndex[id] = max(n.matchIndex[id], req.Snapshot.Index)
+		n.nextIndex[id] = n.matchIndex[id] + 1
+		n.advanceCommit()
+		return n.nextIndex[id] <= n.lastIndex()
+	}
+
+	req := n.appendRequest(next)
+	end := min(n.lastIndex(), next-1+maxAppendEntries)
+	if end >= next {
+		// Copied, as a truncation may reuse the log's array meanwhile
+		req.Entries = append([]Entry(nil), n.entries[next-n.snapshot.Index-1:end-n.snapshot.Index]...)
+	}
+	n.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.electionTimeout)
+	resp, err := n.transport.AppendEntries(ctx, addr, req)
+	cancel()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.inflight[id] = false
+	if err != nil || !n.acknowledged(id, term, resp.Term) {
+		return false
+	}
+	if !resp.Success {
+		// Skip back to where the follower's log may match
+		n.nextIndex[id] = max(1, min(resp.ConflictIndex, next-1))
+		return true
+	}
+	n.matchIndex[id] = max(n.matchIndex[id], req.PrevLogIndex+uint64(len(req.Entries)))
+	n.nextIndex[id] = n.matchIndex[id] + 1
+	n.advanceCommit()
+	return n.nextIndex[id] <= n.lastIndex()
+}
+
+// appendRequest returns a request without entries for a follower whose
+// log should continue at next.
+func (n *Node) appendRequest(next uint64) *AppendRequest {
+	prev := max(next-1, n.snapshot.Index)
+	prevTerm, _ := n.termAt(prev)
+	return &AppendRequest{
+		Term:         n.term,
+		LeaderID:     n.id,
+		PrevLogIndex: prev,
+		PrevLogTerm:  prevTerm,
+		LeaderCommit: n.commitIndex,
+	}
+}
+
+// acknowledged handles the term of a follower's response to a request sent
+// in term, and reports whether this node still leads that term.
+func (n *Node) acknowledged(id string, term, respTerm uint64) bool {
+	if respTerm > n.term {
+		n.becomeFollower(respTerm)
+		return false
+	}
+	if n.state != Leader || n.term != term {
+		return false
+	}
+	n.lastAck[id] = time.Now()
+	return true
+}
+
+// advanceCommit commits the latest entry of the leader's term a majority
+// stored.
+func (n *Node) advanceCommit() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		// Entries of previous terms are only committed along with one of
+		// this term, as a majority storing them does not make them safe
+		if term, _ := n.termAt(index); term != n.term {
+			break
+		}
+		count := 0
+		for id := range n.members {
+			if id == n.id || n.matchIndex[id] >= index {
+				count++
+			}
+		}
+		if count >= n.majority() {
+			n.commitIndex = index
+			n.signalApply()
+			break
+		}
+	}
+
+	// A leader the committed configuration removed steps down
+	if _, member := n.members[n.id]; !member && n.commitIndex >= n.membersIndex {
+		n.leader = ""
+		n.becomeFollower(n.term)
+	}
+}
+
+// confirmLeadership checks that a majority still follows this node in
+// term, so no other leader may have committed entries it does not know of.
+func (n *Node) confirmLeadership(ctx context.Context, term uint64) error {
+	n.mu.Lock()
+	if n.state != Leader || n.term != term {
+		n.mu.Unlock()
+		return ErrLeadershipLost
+	}
+	acks, needed := 0, n.majority()
+	if _, member := n.members[n.id]; member {
+		acks++
+	}
+	requests := map[string]*AppendRequest{}
+	addrs := map[string]string{}
+	for id, addr := range n.members {
+		if id != n.id {
+			requests[id] = n.appendRequest(n.nextIndex[id])
+			addrs[id] = addr
+		}
+	}
+	n.mu.Unlock()
+	if acks >= needed {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.electionTimeout)
+	defer cancel()
+	responses := make(chan bool, len(requests))
+	for id, req := range requests {
+		go func() {
+			resp, err := n.transport.AppendEntries(ctx, addrs[id], req)
+			if err != nil {
+				responses <- false
+				return
+			}
+			n.mu.Lock()
+			ok := n.acknowledged(id, term, resp.Term)
+			n.mu.Unlock()
+			responses <- ok
+		}()
+	}
+	for range requests {
+		if <-responses {
+			acks++
+			if acks >= needed {
+				return nil
+			}
+		}
+	}
+	return ErrLeadershipLost
+}
+
+// handleVote decides whether to vote for a candidate.
+func (n *Node) handleVote(req *VoteRequest) (*VoteResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, errClosed
+	}
+	if req.Term < n.term {
+		return &VoteResponse{Term: n.term}, nil
+	}
+	// A node that hears from its leader ignores candidates, so nodes
+	// removed from the cluster or briefly cut off cannot disrupt it
+	if req.Term > n.term && n.hasLeader(time.Now()) {
+		return &VoteResponse{Term: n.term}, nil
+	}
+	if req.Term > n.term {
+		n.becomeFollower(req.Term)
+	}
+
+	lastIndex := n.lastIndex()
+	lastTerm, _ := n.termAt(lastIndex)
+	upToDate := req.LastLogTerm > lastTerm || (req.LastLogTerm == lastTerm && req.LastLogIndex >= lastIndex)
+	if (n.votedFor != "" && n.votedFor != req.CandidateID) || !upToDate {
+		return &VoteResponse{Term: n.term}, nil
+	}
+
+	n.votedFor = req.CandidateID
+	if err := n.persistState(); err != nil {
+		n.votedFor = ""
+		return nil, err
+	}
+	n.resetElectionDeadline()
+	return &VoteResponse{Term: n.term, Granted: true}, nil
+}
+
+func (n *Node) hasLeader(now time.Time) bool {
+	if n.state == Leader {
+		return true
+	}
+	return n.leader != "" && now.Sub(n.lastContact) < n.electionTimeout
+}
+
+// handleAppend appends the leader's entries to the log, once the entry
+// before them matches.
+func (n *Node) handleAppend(req *AppendRequest) (*AppendResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, errClosed
+	}
+	if req.Term < n.term {
+		return &AppendResponse{Term: n.term}, nil
+	}
+	if req.Term > n.term || n.state != Follower {
+		n.becomeFollower(req.Term)
+	}
+	n.leader = req.LeaderID
+	n.lastContact = time.Now()
+	n.resetElectionDeadline()
+
+	resp := &AppendResponse{Term: n.term}
+	if req.PrevLogIndex > n.lastIndex() {
+		resp.ConflictIndex = n.lastIndex() + 1
+		return resp, nil
+	}
+
+	prev, entries := req.PrevLogIndex, req.Entries
+	if prev < n.snapshot.Index {
+		// Entries up to the snapshot are committed, so they match
+		skip := n.snapshot.Index - prev
+		entries = entries[min(skip, uint64(len(entries))):]
+		prev = n.snapshot.Index
+	} else if term, _ := n.termAt(prev); term != req.PrevLogTerm {
+		// Skip back over the whole conflicting term at once
+		conflict := prev
+		for conflict > n.snapshot.Index+1 {
+			if t, _ := n.termAt(conflict - 1); t != term {
+				break
+			}
+			conflict--
+		}
+		resp.ConflictIndex = conflict
+		return resp, nil
+	}
+
+	for i, entry := range entries {
+		if entry.Index <= n.lastIndex() {
+			if term, _ := n.termAt(entry.Index); term == entry.Term {
+				continue
+			}
+			if err := n.truncate(entry.Index); err != nil {
+				return nil, err
+			}
+		}
+		if err := n.appendEntries(entries[i:]); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	lastNew := prev + uint64(len(entries))
+	if commit := min(req.LeaderCommit, lastNew); commit > n.commitIndex {
+		n.commitIndex = commit
+		n.signalApply()
+	}
+	resp.Success = true
+	resp.MatchIndex = lastNew
+	return resp, nil
+}
+
+// handleSnapshot replaces the state machine and the log it covers with the
+// leader's snapshot.
+func (n *Node) handleSnapshot(req *SnapshotRequest) (*SnapshotResponse, error) {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil, errClosed
+	}
+	if req.Term < n.term {
+		defer n.mu.Unlock()
+		return &SnapshotResponse{Term: n.term}, nil
+	}
+	if req.Term > n.term || n.state != Follower {
+		n.becomeFollower(req.Term)
+	}
+	n.leader = req.LeaderID
+	n.lastContact = time.Now()
+	n.resetElectionDeadline()
+	resp := &SnapshotResponse{Term: n.term}
+	n.mu.Unlock()
+
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+
+	n.mu.Lock()
+	stale := req.Snapshot.Index <= n.lastApplied
+	n.mu.Unlock()
+	if stale {
+		return resp, nil
+	}
+	if err := n.fsm.Restore(req.Snapshot.Data); err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	snapshot := req.Snapshot
+	if err := n.disk.saveSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	// Keep the entries after the snapshot when the log agrees with it
+	var entries []Entry
+	if term, ok := n.termAt(snapshot.Index); ok && term == snapshot.Term && snapshot.Index >= n.snapshot.Index {
+		entries = append(entries, n.entries[snapshot.Index-n.snapshot.Index:]...)
+	}
+	if err := n.disk.rewrite(entries); err != nil {
+		return nil, err
+	}
+	n.snapshot = snapshot
+	n.entries = entries
+	n.commitIndex = max(n.commitIndex, snapshot.Index)
+	n.lastApplied = snapshot.Index
+	n.refreshMembers()
+	for index, w := range n.waiters {
+		if index <= snapshot.Index {
+			delete(n.waiters, index)
+			w.done <- result{err: ErrLeadershipLost}
+		}
+	}
+	close(n.applied)
+	n.applied = make(chan struct{})
+	n.signalApply()
+	return resp, nil
+}
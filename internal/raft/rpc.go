@@ -0,0 +1,103 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// VoteRequest asks a node to vote for a candidate.
+type VoteRequest struct {
+	Term         uint64 `json:"term"`
+	CandidateID  string `json:"candidateId"`
+	LastLogIndex uint64 `json:"lastLogIndex"`
+	LastLogTerm  uint64 `json:"lastLogTerm"`
+}
+
+type VoteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+// AppendRequest replicates entries from the leader, or is a heartbeat when
+// it has none.
+type AppendRequest struct {
+	Term         uint64  `json:"term"`
+	LeaderID     string  `json:"leaderId"`
+	PrevLogIndex uint64  `json:"prevLogIndex"`
+	PrevLogTerm  uint64  `json:"prevLogTerm"`
+	Entries      []Entry `json:"entries,omitempty"`
+	LeaderCommit uint64  `json:"leaderCommit"`
+}
+
+// AppendResponse tells the leader whether the follower's log matched. When
+// it did not, ConflictIndex is where the leader should try next.
+type AppendResponse struct {
+	Term          uint64 `json:"term"`
+	Success       bool   `json:"success"`
+	MatchIndex    uint64 `json:"matchIndex,omitempty"`
+	ConflictIndex uint64 `json:"conflictIndex,omitempty"`
+}
+
+// SnapshotRequest sends the leader's snapshot to a follower whose log
+// lags behind the leader's compacted log.
+type SnapshotRequest struct {
+	Term     uint64    `json:"term"`
+	LeaderID string    `json:"leaderId"`
+	Snapshot *Snapshot `json:"snapshot"`
+}
+
+type SnapshotResponse struct {
+	Term uint64 `json:"term"`
+}
+
+// ReadIndexResponse is the commit index the leader confirmed being the
+// leader at.
+type ReadIndexResponse struct {
+	Index uint64 `json:"index"`
+}
+
+// Transport carries the RPCs between nodes, addressed by the addresses in
+// the cluster configuration.
+type Transport interface {
+	RequestVote(ctx context.Context, addr string, req *VoteRequest) (*VoteResponse, error)
+	AppendEntries(ctx context.Context, addr string, req *AppendRequest) (*AppendResponse, error)
+	InstallSnapshot(ctx context.Context, addr string, req *SnapshotRequest) (*SnapshotResponse, error)
+	ReadIndex(ctx context.Context, addr string) (*ReadIndexResponse, error)
+}
+
+// ErrNoLeader is returned when a node does not know of a leader, like
+// during an election.
+var ErrNoLeader = errors.New("no leader is known")
+
+// ErrLeadershipLost is returned for a proposal the leader lost its
+// leadership before committing. It may still be committed by the next one.
+var ErrLeadershipLost = errors.New("leadership was lost before the entry was committed")
+
+// ErrMembershipChangePending is returned when changing the members of the
+// cluster while a previous change is not committed yet.
+var ErrMembershipChangePending = errors.New("a membership change is already in progress")
+
+// ErrLastMember is returned when removing the only member of the cluster.
+var ErrLastMember = errors.New("cannot remove the last member of the cluster")
+
+// NotLeaderError is returned by operations only the leader performs, and
+// tells which node to ask instead.
+type NotLeaderError struct {
+	Leader string `json:"leader,omitempty"`
+	Addr   string `json:"addr,omitempty"`
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.Leader == "" {
+		return ErrNoLeader.Error()
+	}
+	return fmt.Sprintf("not the leader, the leader is %s at %s", e.Leader, e.Addr)
+}
+
+func (e *NotLeaderError) Unwrap() error {
+	if e.Leader == "" {
+		return ErrNoLeader
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HTTPTransport sends RPCs as JSON POST requests to the Handler of other
+// nodes, served under Prefix at their address.
+type HTTPTransport struct {
+	Prefix string
+	Client *http.Client
+}
+
+// NewHTTPTransport returns a transport to nodes serving their Handler
+// under prefix.
+func NewHTTPTransport(prefix string) *HTTPTransport {
+	return &HTTPTransport{Prefix: strings.TrimSuffix(prefix, "/"), Client: http.DefaultClient}
+}
+
+func (t *HTTPTransport) RequestVote(ctx context.Context, addr string, req *VoteRequest) (*VoteResponse, error) {
+	resp := &VoteResponse{}
+	return resp, t.call(ctx, addr, "vote", req, resp)
+}
+
+func (t *HTTPTransport) AppendEntries(ctx context.Context, addr string, req *AppendRequest) (*AppendResponse, error) {
+	resp := &AppendResponse{}
+	return resp, t.call(ctx, addr, "append", req, resp)
+}
+
+func (t *HTTPTransport) InstallSnapshot(ctx context.Context, addr string, req *SnapshotRequest) (*SnapshotResponse, error) {
+	resp := &SnapshotResponse{}
+	return resp, t.call(ctx, addr, "snapshot", req, resp)
+}
+
+func (t *HTTPTransport) ReadIndex(ctx context.Context, addr string) (*ReadIndexResponse, error) {
+	resp := &ReadIndexResponse{}
+	return resp, t.call(ctx, addr, "readindex", struct{}{}, resp)
+}
+
+func (t *HTTPTransport) call(ctx context.Context, addr, rpc string, req, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(addr, "/") + t.Prefix + "/" + rpc
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := t.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(httpResp.Body).Decode(resp)
+	case http.StatusMisdirectedRequest:
+		notLeader := &NotLeaderError{}
+		if err := json.NewDecoder(httpResp.Body).Decode(notLeader); err != nil {
+			return err
+		}
+		return notLeader
+	default:
+		message, _ := io.ReadAll(io.LimitReader(httpResp.Body, 1024))
+		return fmt.Errorf("raft %s to %s failed: %s %s", rpc, addr, httpResp.Status, bytes.TrimSpace(message))
+	}
+}
+
+// Handler serves the RPCs of HTTPTransport, and the node's Status on GET
+// /status.
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /vote", func(w http.ResponseWriter, r *http.Request) {
+		serveRPC(w, r, n.handleVote)
+	})
+	mux.HandleFunc("POST /append", func(w http.ResponseWriter, r *http.Request) {
+		serveRPC(w, r, n.handleAppend)
+	})
+	mux.HandleFunc("POST /snapshot", func(w http.ResponseWriter, r *http.Request) {
+		serveRPC(w, r, n.handleSnapshot)
+	})
+	mux.HandleFunc("POST /readindex", func(w http.ResponseWriter, r *http.Request) {
+		serveRPC(w, r, func(*struct{}) (*ReadIndexResponse, error) {
+			index, err := n.ReadIndex(r.Context())
+			if err != nil {
+				return nil, err
+			}
+			return &ReadIndexResponse{Index: index}, nil
+		})
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, n.Status())
+	})
+	return mux
+}
+
+func serveRPC[Req, Resp any](w http.ResponseWriter, r *http.Request, handle func(*Req) (*Resp, error)) {
+	req := new(Req)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := handle(req)
+	var notLeader *NotLeaderError
+	switch {
+	case errors.As(err, &notLeader):
+		writeJSON(w, http.StatusMisdirectedRequest, notLeader)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
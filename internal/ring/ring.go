@@ -0,0 +1,176 @@
+// Package ring places keys on nodes with consistent hashing. Each node owns
+// many points of a hash ring, its virtual nodes, so keys spread evenly and
+// only about 1/N of them move when one of N nodes joins or leaves.
+package ring
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultVirtualNodes is how many points of the ring each node owns when
+// none is configured.
+const DefaultVirtualNodes = 128
+
+// Ring maps keys to the nodes that own them.
+type Ring struct {
+	tokens       []token
+	nodes        []string
+	virtualNodes int
+}
+
+// token is a point of the ring, owned by a node.
+type token struct {
+	hash uint64
+	node string
+}
+
+// Ownership is how much of the key space a node owns.
+type Ownership struct {
+	Node   string `json:"node"`
+	Tokens int    `json:"tokens"`
+
+	// Primary is the share of keys the node is the first replica of, and
+	// Replica the share it is any replica of.
+	Primary float64 `json:"primary"`
+	Replica float64 `json:"replica"`
+}
+
+// Status describes a ring, as the nodes of a cluster serve it.
+type Status struct {
+	ReplicationFactor int         `json:"replicationFactor"`
+	VirtualNodes      int         `json:"virtualNodes"`
+	Owners            []Ownership `json:"owners"`
+
+	// Key and Replicas are set when the placement of a key was asked for.
+	Key      string   `json:"key,omitempty"`
+	Replicas []string `json:"replicas,omitempty"`
+}
+
+// Rebalance describes the moves of keys onto the nodes a changed ring
+// places them on, as the nodes of a cluster serve it.
+type Rebalance struct {
+	// Node is the node moving keys, and Running whether it is now.
+	Node    string `json:"node,omitempty"`
+	Running bool   `json:"running"`
+
+	// Checked is when keys were last compared with the ring, and Started
+	// and Finished bound the latest pass that found keys to move.
+	Checked  time.Time `json:"checked,omitzero"`
+	Started  time.Time `json:"started,omitzero"`
+	Finished time.Time `json:"finished,omitzero"`
+
+	// Keys counts the keys the pass moves and Bytes their size, of which
+	// Moved and MovedBytes are done. Skipped counts the keys that cannot
+	// be moved, and Failed those that failed to.
+	Keys       int   `json:"keys"`
+	Bytes      int64 `json:"bytes"`
+	Moved      int   `json:"moved"`
+	MovedBytes int64 `json:"movedBytes"`
+	Skipped    int   `json:"skipped"`
+	Failed     int   `json:"failed"`
+
+	// Rate caps the bytes moved per second.
+	Rate int64 `json:"rate"`
+}
+
+// New returns the ring of nodes, each owning virtualNodes points of it, or
+// DefaultVirtualNodes when virtualNodes is not positive.
+func New(nodes []string, virtualNodes int) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	r := &Ring{nodes: slices.Clone(nodes), virtualNodes: virtualNodes}
+	slices.Sort(r.nodes)
+	r.nodes = slices.Compact(r.nodes)
+	for _, node := range r.nodes {
+		for i := range virtualNodes {
+			r.tokens = append(r.tokens, token{hash: Hash(node + "#" + strconv.Itoa(i)), node: node})
+		}
+	}
+	sort.Slice(r.tokens, func(i, j int) bool {
+		if r.tokens[i].hash != r.tokens[j].hash {
+			return r.tokens[i].hash < r.tokens[j].hash
+		}
+		return r.tokens[i].node < r.tokens[j].node
+	})
+	return r
+}
+
+// Nodes returns the nodes of the ring, sorted.
+func (r *Ring) Nodes() []string {
+	return slices.Clone(r.nodes)
+}
+
+// VirtualNodes returns how many points of the ring each node owns.
+func (r *Ring) VirtualNodes() int {
+	return r.virtualNodes
+}
+
+// Lookup returns the n distinct nodes a key is placed on, or every node
+// when there are fewer: the owner of the first point at or after the key's
+// hash, then the owners of the next points clockwise.
+func (r *Ring) Lookup(key string, n int) []string {
+	if len(r.tokens) == 0 {
+		return nil
+	}
+	h := Hash(key)
+	start := sort.Search(len(r.tokens), func(i int) bool { return r.tokens[i].hash >= h })
+	return r.walk(start, n)
+}
+
+// walk collects the owners of the points from start on, until it has n
+// distinct nodes or went around the ring.
+func (r *Ring) walk(start, n int) []string {
+	n = min(n, len(r.nodes))
+	replicas := make([]string, 0, n)
+	for i := 0; i < len(r.tokens) && len(replicas) < n; i++ {
+		node := r.tokens[(start+i)%len(r.tokens)].node
+		if !slices.Contains(replicas, node) {
+			replicas = append(replicas, node)
+		}
+	}
+	return replicas
+}
+
+// Ownership returns how much of the key space each node owns when keys
+// are placed on n nodes, sorted by node.
+func (r *Ring) Ownership(n int) []Ownership {
+	owners := make([]Ownership, len(r.nodes))
+	index := map[string]int{}
+	for i, node := range r.nodes {
+		owners[i].Node = node
+		owners[i].Tokens = r.virtualNodes
+		index[node] = i
+	}
+
+	for i, t := range r.tokens {
+		// The point owns the keys hashing after the previous point, up to
+		// itself
+		var share float64
+		if len(r.tokens) == 1 {
+			share = 1
+		} else {
+			previous := r.tokens[(i+len(r.tokens)-1)%len(r.tokens)].hash
+			share = float64(t.hash-previous) / math.Exp2(64)
+		}
+		for j, node := range r.walk(i, n) {
+			if j == 0 {
+				owners[index[node]].Primary += share
+			}
+			owners[index[node]].Replica += share
+		}
+	}
+	return owners
+}
+
+// Hash returns the position of a key on the ring.
+func Hash(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,95 @@
+package ring
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodes    []string
+		n        int
+		expected int
+	}{
+		{name: "Empty ring", nodes: nil, n: 3, expected: 0},
+		{name: "Fewer nodes than replicas", nodes: []string{"n1", "n2"}, n: 3, expected: 2},
+		{name: "As many replicas as asked", nodes: []string{"n1", "n2", "n3", "n4"}, n: 3, expected: 3},
+		{name: "Duplicate nodes count once", nodes: []string{"n1", "n1"}, n: 2, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(tt.nodes, 16)
+			replicas := r.Lookup("docs/report.pdf", tt.n)
+			if len(replicas) != tt.expected {
+				t.Fatalf("Expected %d replicas, got %v", tt.expected, replicas)
+			}
+			if len(slices.Compact(slices.Sorted(slices.Values(replicas)))) != len(replicas) {
+				t.Errorf("Expected distinct replicas, got %v", replicas)
+			}
+			if again := New(tt.nodes, 16).Lookup("docs/report.pdf", tt.n); !slices.Equal(again, replicas) {
+				t.Errorf("Expected the same placement on every ring, got %v and %v", replicas, again)
+			}
+		})
+	}
+}
+
+func TestBalanceAndMovement(t *testing.T) {
+	nodes := []string{"n1", "n2", "n3", "n4"}
+	r := New(nodes, DefaultVirtualNodes)
+
+	counts := map[string]int{}
+	const keys = 20000
+	for i := range keys {
+		counts[r.Lookup(fmt.Sprintf("bucket/object-%d", i), 1)[0]]++
+	}
+	for _, node := range nodes {
+		if share := float64(counts[node]) / keys; share < 0.15 || share > 0.35 {
+			t.Errorf("Expected %s to own about a quarter of the keys, got %.2f", node, share)
+		}
+	}
+
+	// Adding a fifth node only moves the keys it takes over
+	grown := New(append(nodes, "n5"), DefaultVirtualNodes)
+	moved := 0
+	for i := range keys {
+		key := fmt.Sprintf("bucket/object-%d", i)
+		before, after := r.Lookup(key, 1)[0], grown.Lookup(key, 1)[0]
+		if before != after {
+			moved++
+			if after != "n5" {
+				t.Fatalf("Expected %s to only move to n5, moved to %s", key, after)
+			}
+		}
+	}
+	if share := float64(moved) / keys; share < 0.1 || share > 0.3 {
+		t.Errorf("Expected about a fifth of the keys to move, got %.2f", share)
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	r := New([]string{"n1", "n2", "n3"}, 64)
+	owners := r.Ownership(2)
+	if len(owners) != 3 || owners[0].Node != "n1" || owners[0].Tokens != 64 {
+		t.Fatalf("Unexpected owners %+v", owners)
+	}
+
+	var primary, replica float64
+	for _, o := range owners {
+		primary += o.Primary
+		replica += o.Replica
+		if o.Replica < o.Primary {
+			t.Errorf("Expected %s to replicate at least what it owns, got %+v", o.Node, o)
+		}
+	}
+	if math.Abs(primary-1) > 1e-9 || math.Abs(replica-2) > 1e-9 {
+		t.Errorf("Expected shares summing to 1 and 2, got %f and %f", primary, replica)
+	}
+
+	if single := New([]string{"n1"}, 1).Ownership(3); single[0].Primary != 1 || single[0].Replica != 1 {
+		t.Errorf("Expected a lone node to own everything, got %+v", single)
+	}
+}
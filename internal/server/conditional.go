@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// conditionsFromHeaders reads the If-Match, If-None-Match,
+// If-Modified-Since and If-Unmodified-Since headers, each preceded by
+// prefix, like x-amz-copy-source- for those about a copy's source. It
+// returns nil when none of them are set.
+func conditionsFromHeaders(h http.Header, prefix string) (*storage.Conditions, error) {
+	c := &storage.Conditions{
+		IfMatch:     h.Get(prefix + "if-match"),
+		IfNoneMatch: h.Get(prefix + "if-none-match"),
+	}
+	for header, t := range map[string]*time.Time{
+		prefix + "if-modified-since":   &c.IfModifiedSince,
+		prefix + "if-unmodified-since": &c.IfUnmodifiedSince,
+	} {
+		value := h.Get(header)
+		if value == "" {
+			continue
+		}
+		parsed, err := http.ParseTime(value)
+		if err != nil {
+			return nil, &apiError{http.StatusBadRequest, "InvalidArgument", "The " + header + " header must be an HTTP date"}
+		}
+		*t = parsed
+	}
+	if *c == (storage.Conditions{}) {
+		return nil, nil
+	}
+	return c, nil
+}
+
+func quoteETag(etag string) string {
+	return `"` + etag + `"`
+}
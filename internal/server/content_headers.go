@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+const (
+	userMetadataPrefix = "x-amz-meta-"
+
+	// defaultContentType is what S3 reports for objects saved without a
+	// content type.
+	defaultContentType = "binary/octet-stream"
+)
+
+// contentHeadersFromRequest turns the standard HTTP headers and the
+// x-amz-meta-* headers of a PUT into storage options.
+func contentHeadersFromRequest(h http.Header) ([]storage.Option, error) {
+	var opts []storage.Option
+	if v := h.Get("Content-Type"); v != "" {
+		opts = append(opts, storage.WithContentType(v))
+	}
+	if v := h.Get("Content-Encoding"); v != "" {
+		opts = append(opts, storage.WithContentEncoding(v))
+	}
+	if v := h.Get("Content-Disposition"); v != "" {
+		opts = append(opts, storage.WithContentDisposition(v))
+	}
+	if v := h.Get("Cache-Control"); v != "" {
+		opts = append(opts, storage.WithCacheControl(v))
+	}
+	if v := h.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return nil, &apiError{http.StatusBadRequest, "InvalidArgument", "The Expires header must be an HTTP date"}
+		}
+		opts = append(opts, storage.WithExpires(expires))
+	}
+
+	metadata := map[string]string{}
+	for name, values := range h {
+		if key, ok := strings.CutPrefix(strings.ToLower(name), userMetadataPrefix); ok {
+			metadata[key] = strings.Join(values, ",")
+		}
+	}
+	if len(metadata) > 0 {
+		opts = append(opts, storage.WithUserMetadata(metadata))
+	}
+	return opts, nil
+}
+
+// setContentHeaders returns the headers an object was saved with.
+func setContentHeaders(w http.ResponseWriter, info *storage.ObjectInfo) {
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	if info.ContentEncoding != "" {
+		w.Header().Set("Content-Encoding", info.ContentEncoding)
+	}
+	if info.ContentDisposition != "" {
+		w.Header().Set("Content-Disposition", info.ContentDisposition)
+	}
+	if info.CacheControl != "" {
+		w.Header().Set("Cache-Control", info.CacheControl)
+	}
+	if !info.Expires.IsZero() {
+		w.Header().Set("Expires", info.Expires.UTC().Format(http.TimeFormat))
+	}
+	for key, value := range info.UserMetadata {
+		// The checksum header is set by the server itself
+		if _, set := w.Header()[http.CanonicalHeaderKey(userMetadataPrefix+key)]; !set {
+			w.Header().Set(userMetadataPrefix+key, value)
+		}
+	}
+}
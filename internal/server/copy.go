@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+const (
+	headerCopySource        = "x-amz-copy-source"
+	headerMetadataDirective = "x-amz-metadata-directive"
+)
+
+type copyObjectResult struct {
+	XMLName        xml.Name `xml:"CopyObjectResult"`
+	LastModified   string   `xml:"LastModified"`
+	ETag           string   `xml:"ETag"`
+	ChecksumSHA256 string   `xml:"ChecksumSHA256,omitempty"`
+}
+
+// copyObject handles a PUT carrying x-amz-copy-source, which names the
+// object to copy as /bucket/key, URL-encoded.
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	source, err := url.PathUnescape(r.Header.Get(headerCopySource))
+	if err != nil {
+		writeError(w, &apiError{http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey"})
+		return
+	}
+	srcBucket, srcKey, ok := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	if !ok || srcBucket == "" || srcKey == "" {
+		writeError(w, &apiError{http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey"})
+		return
+	}
+	if err := s.validateBucket(srcBucket); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	opts, err := s.putOptions(r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	srcOpts, err := copySourceSSECustomerKeyFromHeaders(r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	opts = append(opts, srcOpts...)
+
+	if directive := r.Header.Get(headerMetadataDirective); directive != "" {
+		opts = append(opts, storage.WithMetadataDirective(directive))
+	}
+	conditions, err := conditionsFromHeaders(r.Header, copySourcePrefix)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if conditions != nil {
+		opts = append(opts, storage.WithCopyConditions(*conditions))
+	}
+
+	info, err := s.storage.CopyObject(srcBucket, srcKey, bucket, key, opts...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setObjectHeaders(w, info)
+	writeXML(w, http.StatusOK, copyObjectResult{
+		LastModified:   info.CreatedAt.UTC().Format(time.RFC3339),
+		ETag:           quoteETag(info.ETag),
+		ChecksumSHA256: info.Checksum,
+	})
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// apiError is an error rendered as an S3 XML error response.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errNotImplemented   = &apiError{http.StatusNotImplemented, "NotImplemented", "A header or request you provided implies functionality that is not implemented."}
+	errMethodNotAllowed = &apiError{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource."}
+	errNoSuchKey        = &apiError{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	errNotModified      = &apiError{http.StatusNotModified, "NotModified", "Not Modified"}
+	errMalformedXML     = &apiError{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema."}
+	errInternalError    = &apiError{http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again."}
+)
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+// toAPIError maps storage errors onto their S3 equivalents.
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	var invalidKey *storage.ErrInvalidSSECustomerKey
+	var invalidClass *storage.ErrInvalidStorageClass
+	var invalidLock *storage.ErrInvalidObjectLock
+	var invalidTag *storage.ErrInvalidTag
+	var invalidDirective *storage.ErrInvalidMetadataDirective
+	var invalidNotification *storage.ErrInvalidNotification
+	var invalidReplication *storage.ErrInvalidReplication
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, os.ErrNotExist):
+		return errNoSuchKey
+	case errors.Is(err, storage.ErrSSECustomerKeyMissing), errors.Is(err, storage.ErrSSECustomerKeyNotUsed):
+		return &apiError{http.StatusBadRequest, "InvalidRequest", err.Error()}
+	case errors.Is(err, storage.ErrSSECustomerKeyMismatch):
+		return &apiError{http.StatusForbidden, "AccessDenied", err.Error()}
+	case errors.As(err, &invalidKey):
+		return &apiError{http.StatusBadRequest, "InvalidArgument", err.Error()}
+	case errors.As(err, &invalidClass):
+		return &apiError{http.StatusBadRequest, "InvalidStorageClass", err.Error()}
+	case errors.Is(err, storage.ErrInvalidObjectState):
+		return &apiError{http.StatusForbidden, "InvalidObjectState", "The operation is not valid for the object's storage class"}
+	case errors.Is(err, storage.ErrInvalidRestoreDays):
+		return &apiError{http.StatusBadRequest, "InvalidArgument", err.Error()}
+	case errors.Is(err, storage.ErrObjectLocked):
+		return &apiError{http.StatusForbidden, "AccessDenied", err.Error()}
+	case errors.Is(err, storage.ErrObjectLockNotEnabled):
+		return &apiError{http.StatusBadRequest, "InvalidRequest", "Bucket is missing Object Lock Configuration"}
+	case errors.As(err, &invalidLock):
+		return &apiError{http.StatusBadRequest, "InvalidArgument", err.Error()}
+	case errors.Is(err, storage.ErrMetadataTooLarge):
+		return &apiError{http.StatusBadRequest, "MetadataTooLarge", "Your metadata headers exceed the maximum allowed metadata size."}
+	case errors.As(err, &invalidTag):
+		return &apiError{http.StatusBadRequest, "InvalidTag", err.Error()}
+	case errors.Is(err, storage.ErrPreconditionFailed):
+		return &apiError{http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold"}
+	case errors.Is(err, storage.ErrNotModified):
+		return errNotModified
+	case errors.Is(err, storage.ErrInvalidCopy):
+		return &apiError{http.StatusBadRequest, "InvalidRequest", err.Error()}
+	case errors.As(err, &invalidDirective):
+		return &apiError{http.StatusBadRequest, "InvalidArgument", err.Error()}
+	case errors.As(err, &invalidNotification):
+		return &apiError{http.StatusBadRequest, "InvalidArgument", err.Error()}
+	case errors.As(err, &invalidReplication):
+		return &apiError{http.StatusBadRequest, "InvalidRequest", err.Error()}
+	case errors.Is(err, storage.ErrInvalidRange):
+		return &apiError{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable"}
+	case errors.Is(err, storage.ErrInvalidBucketName):
+		return &apiError{http.StatusBadRequest, "InvalidBucketName", err.Error()}
+	case errors.Is(err, storage.ErrInvalidObjectKey):
+		return &apiError{http.StatusBadRequest, "InvalidArgument", err.Error()}
+	case errors.Is(err, storage.ErrNotImplemented):
+		return errNotImplemented
+	case errors.Is(err, storage.ErrUnavailable):
+		return &apiError{http.StatusServiceUnavailable, "ServiceUnavailable", err.Error()}
+	default:
+		// The details, like file paths, are for the server's logs only
+		log.Printf("mini-s3: internal error: %v", err)
+		return errInternalError
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	apiErr := toAPIError(err)
+	// A 304 response has no body
+	if apiErr.Status == http.StatusNotModified {
+		w.WriteHeader(apiErr.Status)
+		return
+	}
+	writeXML(w, apiErr.Status, errorResponse{Code: apiErr.Code, Message: apiErr.Message})
+}
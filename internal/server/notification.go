@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+type bucketNotifier interface {
+	PutBucketNotification(bucket string, cfg *storage.NotificationConfiguration) error
+	GetBucketNotification(bucket string) (*storage.NotificationConfiguration, error)
+	DeleteBucketNotification(bucket string) error
+}
+
+// bucketNotification serves the ?notification subresource. Like S3, a
+// bucket without rules has an empty configuration, and putting an empty
+// one removes them.
+func (s *Server) bucketNotification(w http.ResponseWriter, r *http.Request, bucket string) {
+	notifier, ok := s.storage.(bucketNotifier)
+	if !ok {
+		writeError(w, errNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := notifier.GetBucketNotification(bucket)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if cfg == nil {
+			cfg = &storage.NotificationConfiguration{}
+		}
+		writeXML(w, http.StatusOK, cfg)
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		cfg, err := storage.ParseNotificationConfiguration(data)
+		if err != nil {
+			writeError(w, errMalformedXML)
+			return
+		}
+		if err := checkRemoteDestinations(cfg); err != nil {
+			writeError(w, err)
+			return
+		}
+		if len(cfg.Rules) == 0 {
+			err = notifier.DeleteBucketNotification(bucket)
+		} else {
+			err = notifier.PutBucketNotification(bucket, cfg)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, errMethodNotAllowed)
+	}
+}
+
+// checkRemoteDestinations refuses file:// and unix:// destinations, which
+// would let any client write to paths on this host. Only the local CLI can
+// configure them.
+func checkRemoteDestinations(cfg *storage.NotificationConfiguration) error {
+	for _, rule := range cfg.Rules {
+		u, err := url.Parse(rule.Destination)
+		if err != nil || u.Scheme == "http" || u.Scheme == "https" {
+			// Validate reports malformed destinations
+			continue
+		}
+		if u.Scheme == "file" || u.Scheme == "unix" {
+			return &apiError{http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("Destination %q is on the local host; only http and https destinations can be configured over HTTP", rule.Destination)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+const (
+	headerObjectLockMode            = "x-amz-object-lock-mode"
+	headerObjectLockRetainUntilDate = "x-amz-object-lock-retain-until-date"
+	headerObjectLockLegalHold       = "x-amz-object-lock-legal-hold"
+	headerBypassGovernanceRetention = "x-amz-bypass-governance-retention"
+
+	legalHoldOn  = "ON"
+	legalHoldOff = "OFF"
+)
+
+type objectLocker interface {
+	PutObjectLockConfiguration(bucket string, cfg *storage.ObjectLockConfiguration) error
+	GetObjectLockConfiguration(bucket string) (*storage.ObjectLockConfiguration, error)
+	PutObjectRetention(bucket, object string, retention *storage.Retention, opts ...storage.Option) error
+	GetObjectRetention(bucket, object string) (*storage.Retention, error)
+	PutObjectLegalHold(bucket, object string, on bool) error
+	GetObjectLegalHold(bucket, object string) (bool, error)
+}
+
+var errNoSuchObjectLockConfiguration = &apiError{http.StatusNotFound, "ObjectLockConfigurationNotFoundError", "Object Lock configuration does not exist for this bucket"}
+
+type legalHold struct {
+	XMLName xml.Name `xml:"LegalHold"`
+	Status  string   `xml:"Status"`
+}
+
+// objectLockFromHeaders turns the object lock headers of a PUT into
+// storage options.
+func objectLockFromHeaders(h http.Header) ([]storage.Option, error) {
+	var opts []storage.Option
+
+	mode, until := h.Get(headerObjectLockMode), h.Get(headerObjectLockRetainUntilDate)
+	if (mode == "") != (until == "") {
+		return nil, &apiError{http.StatusBadRequest, "InvalidArgument", "x-amz-object-lock-mode and x-amz-object-lock-retain-until-date must both be supplied"}
+	}
+	if mode != "" {
+		date, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, &apiError{http.StatusBadRequest, "InvalidArgument", "The retain until date must be in ISO 8601 format"}
+		}
+		opts = append(opts, storage.WithRetention(mode, date))
+	}
+
+	switch h.Get(headerObjectLockLegalHold) {
+	case "", legalHoldOff:
+	case legalHoldOn:
+		opts = append(opts, storage.WithLegalHold())
+	default:
+		return nil, &apiError{http.StatusBadRequest, "InvalidArgument", "Legal Hold must be either of 'ON' or 'OFF'"}
+	}
+	return opts, nil
+}
+
+var errGovernanceBypassDenied = &apiError{http.StatusForbidden, "AccessDenied", "Bypassing governance retention is not allowed on this server"}
+
+// bypassFromHeaders turns x-amz-bypass-governance-retention into a storage
+// option, if the server allows it.
+func (s *Server) bypassFromHeaders(h http.Header) ([]storage.Option, error) {
+	if !strings.EqualFold(h.Get(headerBypassGovernanceRetention), "true") {
+		return nil, nil
+	}
+	if !s.governanceBypass {
+		return nil, errGovernanceBypassDenied
+	}
+	return []storage.Option{storage.WithBypassGovernanceRetention()}, nil
+}
+
+func setObjectLockHeaders(w http.ResponseWriter, info *storage.ObjectInfo) {
+	if r := info.Retention; r != nil {
+		w.Header().Set(headerObjectLockMode, r.Mode)
+		w.Header().Set(headerObjectLockRetainUntilDate, r.RetainUntilDate.UTC().Format(time.RFC3339))
+	}
+	if info.LegalHold {
+		w.Header().Set(headerObjectLockLegalHold, legalHoldOn)
+	}
+}
+
+func (s *Server) objectLockConfiguration(w http.ResponseWriter, r *http.Request, bucket string) {
+	locker, ok := s.storage.(objectLocker)
+	if !ok {
+		writeError(w, errNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := locker.GetObjectLockConfiguration(bucket)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if cfg == nil {
+			writeError(w, errNoSuchObjectLockConfiguration)
+			return
+		}
+		writeXML(w, http.StatusOK, cfg)
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		cfg, err := storage.ParseObjectLockConfiguration(data)
+		if err != nil {
+			writeError(w, errMalformedXML)
+			return
+		}
+		if err := locker.PutObjectLockConfiguration(bucket, cfg); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, errMethodNotAllowed)
+	}
+}
+
+func (s *Server) objectRetention(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	locker, ok := s.storage.(objectLocker)
+	if !ok {
+		writeError(w, errNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		retention, err := locker.GetObjectRetention(bucket, key)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if retention == nil {
+			writeError(w, &apiError{http.StatusNotFound, "NoSuchObjectLockConfiguration", "The specified object does not have a ObjectLock configuration"})
+			return
+		}
+		writeXML(w, http.StatusOK, retention)
+	case http.MethodPut:
+		var retention storage.Retention
+		if err := xml.NewDecoder(r.Body).Decode(&retention); err != nil {
+			writeError(w, errMalformedXML)
+			return
+		}
+		// A retention without a mode removes it, as the AWS CLI sends
+		var req *storage.Retention
+		if retention.Mode != "" {
+			req = &retention
+		}
+		opts, err := s.bypassFromHeaders(r.Header)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := locker.PutObjectRetention(bucket, key, req, opts...); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, errMethodNotAllowed)
+	}
+}
+
+func (s *Server) objectLegalHold(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	locker, ok := s.storage.(objectLocker)
+	if !ok {
+		writeError(w, errNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		on, err := locker.GetObjectLegalHold(bucket, key)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		status := legalHoldOff
+		if on {
+			status = legalHoldOn
+		}
+		writeXML(w, http.StatusOK, legalHold{Status: status})
+	case http.MethodPut:
+		var hold legalHold
+		if err := xml.NewDecoder(r.Body).Decode(&hold); err != nil || (hold.Status != legalHoldOn && hold.Status != legalHoldOff) {
+			writeError(w, errMalformedXML)
+			return
+		}
+		if err := locker.PutObjectLegalHold(bucket, key, hold.Status == legalHoldOn); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, errMethodNotAllowed)
+	}
+}
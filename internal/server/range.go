@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// rangeFromHeader turns a single-range Range header ("bytes=0-99",
+// "bytes=100-" or "bytes=-100") into a storage option. Like S3, multiple
+// ranges and malformed headers are ignored, returning the whole object.
+func rangeFromHeader(h http.Header) []storage.Option {
+	spec, ok := strings.CutPrefix(h.Get("Range"), "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil
+	}
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 {
+			return nil
+		}
+		return []storage.Option{storage.WithRange(-suffix, -1)}
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil
+	}
+	if last == "" {
+		return []storage.Option{storage.WithRange(start, -1)}
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return nil
+	}
+	return []storage.Option{storage.WithRange(start, end-start+1)}
+}
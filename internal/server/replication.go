@@ -0,0 +1,97 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+const headerReplicationStatus = "x-amz-replication-status"
+
+var errNoReplicationConfiguration = &apiError{http.StatusNotFound, "ReplicationConfigurationNotFoundError", "The replication configuration was not found"}
+
+type bucketReplicator interface {
+	PutBucketReplication(bucket string, cfg *storage.ReplicationConfiguration) error
+	GetBucketReplication(bucket string) (*storage.ReplicationConfiguration, error)
+	DeleteBucketReplication(bucket string) error
+}
+
+// replicaFromHeaders marks objects put by another mini-s3 replicating them
+// as replicas, so they are not replicated further.
+func replicaFromHeaders(h http.Header) []storage.Option {
+	if h.Get(headerReplicationStatus) == storage.ReplicationStatusReplica {
+		return []storage.Option{storage.WithReplica()}
+	}
+	return nil
+}
+
+// bucketReplication serves the ?replication subresource.
+func (s *Server) bucketReplication(w http.ResponseWriter, r *http.Request, bucket string) {
+	replicator, ok := s.storage.(bucketReplicator)
+	if !ok {
+		writeError(w, errNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := replicator.GetBucketReplication(bucket)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if cfg == nil {
+			writeError(w, errNoReplicationConfiguration)
+			return
+		}
+		writeXML(w, http.StatusOK, cfg)
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		cfg, err := storage.ParseReplicationConfiguration(data)
+		if err != nil {
+			writeError(w, errMalformedXML)
+			return
+		}
+		if err := checkRemoteEndpoints(cfg); err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := replicator.PutBucketReplication(bucket, cfg); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if err := replicator.DeleteBucketReplication(bucket); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, errMethodNotAllowed)
+	}
+}
+
+// checkRemoteEndpoints refuses file:// endpoints, which would let any
+// client have objects written to paths on this host. Like local
+// notification destinations, only the local CLI can configure them.
+func checkRemoteEndpoints(cfg *storage.ReplicationConfiguration) error {
+	for _, rule := range cfg.Rules {
+		u, err := url.Parse(rule.Destination.Endpoint)
+		if err != nil {
+			// Validate reports malformed endpoints
+			continue
+		}
+		if u.Scheme == "file" {
+			return &apiError{http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("Endpoint %q is on the local host; only http and https endpoints can be configured over HTTP", rule.Destination.Endpoint)}
+		}
+	}
+	return nil
+}
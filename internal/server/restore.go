@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+type objectRestorer interface {
+	RestoreObject(bucket, object string, days int) (*storage.ObjectInfo, error)
+}
+
+type restoreRequest struct {
+	XMLName xml.Name `xml:"RestoreRequest"`
+	Days    int      `xml:"Days"`
+}
+
+// restoreObject makes an archived object readable for the days given in
+// the request. The restore completes before responding, so the response
+// never reports an ongoing request.
+func (s *Server) restoreObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	restorer, ok := s.storage.(objectRestorer)
+	if !ok {
+		writeError(w, errNotImplemented)
+		return
+	}
+
+	var req restoreRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errMalformedXML)
+		return
+	}
+
+	info, err := restorer.RestoreObject(bucket, key, req.Days)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setObjectHeaders(w, info)
+	w.WriteHeader(http.StatusAccepted)
+}
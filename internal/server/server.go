@@ -0,0 +1,344 @@
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+// Server exposes a Storage through a path-style subset of the S3 REST API:
+//
+//	GET    /<bucket>         list objects
+//	PUT    /<bucket>/<key>   save an object, or copy the one named by
+//	                         x-amz-copy-source
+//	GET    /<bucket>/<key>   get an object
+//	HEAD   /<bucket>/<key>   get an object's metadata
+//	DELETE /<bucket>/<key>   delete an object
+//	POST   /<bucket>/<key>?restore   restore an archived object
+//
+// Object lock is managed through the ?object-lock subresource of buckets
+// and the ?retention and ?legal-hold subresources of objects, object tags
+// through the ?tagging subresource, and event notifications and
+// replication through the ?notification and ?replication subresources of
+// buckets. GET, HEAD and PUT honour the If-Match, If-None-Match,
+// If-Modified-Since and If-Unmodified-Since headers, compared against the
+// objects' ETags.
+//
+// Bucket names must follow the S3 naming rules, which keeps clients out of
+// the internal buckets other packages store objects in.
+type Server struct {
+	storage storage.Storage
+
+	// internal lets requests reach internal buckets too.
+	internal bool
+
+	// governanceBypass honours x-amz-bypass-governance-retention.
+	governanceBypass bool
+}
+
+func New(s storage.Storage) *Server {
+	return &Server{storage: s}
+}
+
+// NewInternal returns a Server that also serves internal buckets, for the
+// nodes of a cluster to reach each other's data.
+func NewInternal(s storage.Storage) *Server {
+	return &Server{storage: s, internal: true}
+}
+
+// AllowGovernanceBypass lets requests bypass GOVERNANCE retention with the
+// x-amz-bypass-governance-retention header. Requests are not authenticated,
+// so any client could; without this, the header is refused.
+func (s *Server) AllowGovernanceBypass() {
+	s.governanceBypass = true
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		writeError(w, errNotImplemented)
+		return
+	}
+	if err := s.validateBucket(bucket); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	if key == "" {
+		if query.Has("object-lock") {
+			s.objectLockConfiguration(w, r, bucket)
+			return
+		}
+		if query.Has("notification") {
+			s.bucketNotification(w, r, bucket)
+			return
+		}
+		if query.Has("replication") {
+			s.bucketReplication(w, r, bucket)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			s.listObjects(w, bucket)
+		default:
+			writeError(w, errMethodNotAllowed)
+		}
+		return
+	}
+
+	switch {
+	case query.Has("retention"):
+		s.objectRetention(w, r, bucket, key)
+		return
+	case query.Has("legal-hold"):
+		s.objectLegalHold(w, r, bucket, key)
+		return
+	case query.Has("tagging"):
+		s.objectTagging(w, r, bucket, key)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.putObject(w, r, bucket, key)
+	case http.MethodGet, http.MethodHead:
+		s.getObject(w, r, bucket, key)
+	case http.MethodDelete:
+		s.deleteObject(w, r, bucket, key)
+	case http.MethodPost:
+		if !query.Has("restore") {
+			writeError(w, errMethodNotAllowed)
+			return
+		}
+		s.restoreObject(w, r, bucket, key)
+	default:
+		writeError(w, errMethodNotAllowed)
+	}
+}
+
+// validateBucket checks a bucket name, leaving the rest to the storage
+// unless the server is internal.
+func (s *Server) validateBucket(bucket string) error {
+	if s.internal {
+		return nil
+	}
+	return storage.ValidateBucketName(bucket)
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	if r.Header.Get(headerCopySource) != "" {
+		s.copyObject(w, r, bucket, key)
+		return
+	}
+
+	opts, err := s.putOptions(r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	info, err := s.storage.Save(bucket, key, r.Body, opts...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setObjectHeaders(w, info)
+	w.WriteHeader(http.StatusOK)
+}
+
+// putOptions turns the headers describing a new object, shared by PUT and
+// copy, into storage options.
+func (s *Server) putOptions(h http.Header) ([]storage.Option, error) {
+	opts, err := sseCustomerKeyFromHeaders(h)
+	if err != nil {
+		return nil, err
+	}
+
+	if class := h.Get("x-amz-storage-class"); class != "" {
+		opts = append(opts, storage.WithStorageClass(class))
+	}
+
+	lockOpts, err := objectLockFromHeaders(h)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, lockOpts...)
+
+	bypassOpts, err := s.bypassFromHeaders(h)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, bypassOpts...)
+
+	tagOpts, err := taggingFromHeaders(h)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, tagOpts...)
+
+	contentOpts, err := contentHeadersFromRequest(h)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, contentOpts...)
+
+	conditions, err := conditionsFromHeaders(h, "")
+	if err != nil {
+		return nil, err
+	}
+	if conditions != nil {
+		opts = append(opts, storage.WithConditions(*conditions))
+	}
+	return append(opts, replicaFromHeaders(h)...), nil
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	opts, err := sseCustomerKeyFromHeaders(r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	opts = append(opts, rangeFromHeader(r.Header)...)
+
+	conditions, err := conditionsFromHeaders(r.Header, "")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if conditions != nil {
+		opts = append(opts, storage.WithConditions(*conditions))
+	}
+
+	// HEAD only needs the metadata, which archived objects have even when
+	// their data cannot be read
+	var body io.ReadCloser
+	var info *storage.ObjectInfo
+	if r.Method == http.MethodHead {
+		info, err = s.storage.Head(bucket, key, opts...)
+	} else {
+		body, info, err = s.storage.Get(bucket, key, opts...)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if body != nil {
+		defer body.Close()
+	}
+
+	setObjectHeaders(w, info)
+	setContentHeaders(w, info)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Last-Modified", info.CreatedAt.UTC().Format(http.TimeFormat))
+	if rng := info.Range; rng != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(rng.Length, 10))
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.Offset, rng.End(), info.Size))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = io.Copy(w, body)
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	opts, err := s.bypassFromHeaders(r.Header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	err = s.storage.Delete(bucket, key, opts...)
+	// Like S3, deleting a missing object is not an error.
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type listBucketResult struct {
+	XMLName  xml.Name         `xml:"ListBucketResult"`
+	Name     string           `xml:"Name"`
+	KeyCount int              `xml:"KeyCount"`
+	Contents []listBucketItem `xml:"Contents"`
+}
+
+type listBucketItem struct {
+	Key            string `xml:"Key"`
+	LastModified   string `xml:"LastModified"`
+	ETag           string `xml:"ETag"`
+	Size           int64  `xml:"Size"`
+	ChecksumSHA256 string `xml:"ChecksumSHA256,omitempty"`
+	StorageClass   string `xml:"StorageClass,omitempty"`
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, bucket string) {
+	objects, err := s.storage.ListObjects(bucket)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	result := listBucketResult{Name: bucket, KeyCount: len(objects)}
+	for _, obj := range objects {
+		result.Contents = append(result.Contents, listBucketItem{
+			Key:            obj.Object,
+			LastModified:   obj.CreatedAt.UTC().Format(time.RFC3339),
+			ETag:           quoteETag(obj.ETag),
+			Size:           obj.Size,
+			ChecksumSHA256: obj.Checksum,
+			StorageClass:   obj.StorageClass,
+		})
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func setObjectHeaders(w http.ResponseWriter, info *storage.ObjectInfo) {
+	if info.ETag != "" {
+		w.Header().Set("ETag", quoteETag(info.ETag))
+	}
+	if info.Checksum != "" {
+		w.Header().Set("x-amz-meta-sha256", info.Checksum)
+	}
+	// Like S3, the class is only reported when it is not the default
+	if info.StorageClass != "" && info.StorageClass != storage.StorageClassStandard {
+		w.Header().Set("x-amz-storage-class", info.StorageClass)
+	}
+	if !info.RestoreExpiresAt.IsZero() {
+		w.Header().Set("x-amz-restore", fmt.Sprintf(`ongoing-request="false", expiry-date="%s"`, info.RestoreExpiresAt.UTC().Format(http.TimeFormat)))
+	}
+	setObjectLockHeaders(w, info)
+	setTaggingHeaders(w, info)
+	if info.ReplicationStatus != "" {
+		w.Header().Set(headerReplicationStatus, info.ReplicationStatus)
+	}
+	if info.ServerSideEncryption != "" {
+		w.Header().Set("x-amz-server-side-encryption", info.ServerSideEncryption)
+	}
+	if info.SSECustomerKeyMD5 != "" {
+		w.Header().Set(headerSSECustomerAlgorithm, info.SSECustomerAlgorithm)
+		w.Header().Set(headerSSECustomerKeyMD5, info.SSECustomerKeyMD5)
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(v)
+}
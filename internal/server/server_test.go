@@ -0,0 +1,643 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	local := storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum())
+	srv := httptest.NewServer(New(local))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func do(t *testing.T, method, url string, body io.Reader, header http.Header) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func TestServer_Objects(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, _ := do(t, http.MethodPut, srv.URL+"/bucket/hello.txt", strings.NewReader("Hello World!"), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	resp, body := do(t, http.MethodGet, srv.URL+"/bucket/hello.txt", nil, nil)
+	if resp.StatusCode != http.StatusOK || body != "Hello World!" {
+		t.Errorf("Expected 200 'Hello World!', got %d '%s'", resp.StatusCode, body)
+	}
+
+	resp, body = do(t, http.MethodGet, srv.URL+"/bucket", nil, nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "<Key>hello.txt</Key>") {
+		t.Errorf("Expected listing with hello.txt, got %d '%s'", resp.StatusCode, body)
+	}
+
+	resp, _ = do(t, http.MethodDelete, srv.URL+"/bucket/hello.txt", nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+
+	resp, body = do(t, http.MethodGet, srv.URL+"/bucket/hello.txt", nil, nil)
+	if resp.StatusCode != http.StatusNotFound || !strings.Contains(body, "NoSuchKey") {
+		t.Errorf("Expected 404 NoSuchKey, got %d '%s'", resp.StatusCode, body)
+	}
+}
+
+// failingStorage fails every read with an error naming a file path.
+type failingStorage struct {
+	storage.Storage
+}
+
+func (failingStorage) Get(bucket, object string, opts ...storage.Option) (io.ReadCloser, *storage.ObjectInfo, error) {
+	return nil, nil, errors.New("open /var/lib/mini-s3/bucket/key: input/output error")
+}
+
+func TestServer_InternalError(t *testing.T) {
+	srv := httptest.NewServer(New(failingStorage{}))
+	t.Cleanup(srv.Close)
+
+	resp, body := do(t, http.MethodGet, srv.URL+"/bucket/key", nil, nil)
+	if resp.StatusCode != http.StatusInternalServerError || !strings.Contains(body, "InternalError") {
+		t.Errorf("Expected 500 InternalError, got %d '%s'", resp.StatusCode, body)
+	}
+	if strings.Contains(body, "/var/lib") {
+		t.Errorf("Expected the error details to stay on the server, got '%s'", body)
+	}
+}
+
+func TestServer_InvalidNames(t *testing.T) {
+	dir := t.TempDir()
+	srv := New(storage.NewLocalStorage(filepath.Join(dir, "data"), storage.NewValueChecksum()))
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		header   http.Header
+		wantCode string
+	}{
+		{name: "Key escaping the data directory", method: http.MethodPut, target: "/bucket/../../escaped.txt", wantCode: "InvalidArgument"},
+		{name: "Key starting with a slash", method: http.MethodPut, target: "/bucket//escaped.txt", wantCode: "InvalidArgument"},
+		{name: "Bucket escaping the data directory", method: http.MethodGet, target: "/../escaped.txt", wantCode: "InvalidBucketName"},
+		{name: "Uppercase bucket", method: http.MethodGet, target: "/Bucket", wantCode: "InvalidBucketName"},
+		{name: "Internal bucket", method: http.MethodGet, target: "/_hints", wantCode: "InvalidBucketName"},
+		{
+			name:     "Copy from an internal bucket",
+			method:   http.MethodPut,
+			target:   "/bucket/copy",
+			header:   http.Header{"X-Amz-Copy-Source": {"/_hints/object"}},
+			wantCode: "InvalidBucketName",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Sent as is, without the cleaning of an HTTP client
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader("escaped"))
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.wantCode) {
+				t.Errorf("Expected 400 %s, got %d '%s'", tt.wantCode, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "escaped.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected nothing written outside the data directory, got %v", err)
+	}
+}
+
+func sseHeaders(key []byte) http.Header {
+	h := http.Header{}
+	h.Set(headerSSECustomerAlgorithm, storage.SSECustomerAlgorithm)
+	h.Set(headerSSECustomerKey, base64.StdEncoding.EncodeToString(key))
+	h.Set(headerSSECustomerKeyMD5, storage.SSECustomerKeyMD5(key))
+	return h
+}
+
+func TestServer_SSECustomerKey(t *testing.T) {
+	srv := newTestServer(t)
+	key := bytes.Repeat([]byte("k"), 32)
+	url := srv.URL + "/bucket/secret.txt"
+
+	resp, _ := do(t, http.MethodPut, url, strings.NewReader("secret"), sseHeaders(key))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get(headerSSECustomerKeyMD5) != storage.SSECustomerKeyMD5(key) {
+		t.Errorf("Expected key MD5 header to be echoed back")
+	}
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		wantStatus int
+		wantBody   string
+	}{
+		{"right key", sseHeaders(key), http.StatusOK, "secret"},
+		{"no key", nil, http.StatusBadRequest, "InvalidRequest"},
+		{"wrong key", sseHeaders(bytes.Repeat([]byte("o"), 32)), http.StatusForbidden, "AccessDenied"},
+		{"bad key MD5", func() http.Header {
+			h := sseHeaders(key)
+			h.Set(headerSSECustomerKeyMD5, "bogus")
+			return h
+		}(), http.StatusBadRequest, "InvalidArgument"},
+		{"bad algorithm", func() http.Header {
+			h := sseHeaders(key)
+			h.Set(headerSSECustomerAlgorithm, "DES")
+			return h
+		}(), http.StatusBadRequest, "InvalidArgument"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, http.MethodGet, url, nil, tt.header)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("Expected body to contain '%s', got '%s'", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestServer_Range(t *testing.T) {
+	srv := newTestServer(t)
+	do(t, http.MethodPut, srv.URL+"/bucket/digits", strings.NewReader("0123456789"), nil)
+
+	tests := []struct {
+		name         string
+		header       string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"first bytes", "bytes=0-3", http.StatusPartialContent, "0123", "bytes 0-3/10"},
+		{"open ended", "bytes=7-", http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"suffix", "bytes=-2", http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"clamped to the end", "bytes=8-100", http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"multiple ranges are ignored", "bytes=0-1,4-5", http.StatusOK, "0123456789", ""},
+		{"past the end", "bytes=10-", http.StatusRequestedRangeNotSatisfiable, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, http.MethodGet, srv.URL+"/bucket/digits", nil, http.Header{"Range": {tt.header}})
+			if resp.StatusCode != tt.status {
+				t.Fatalf("Expected status %d, got %d '%s'", tt.status, resp.StatusCode, body)
+			}
+			if tt.body != "" && body != tt.body {
+				t.Errorf("Expected '%s', got '%s'", tt.body, body)
+			}
+			if got := resp.Header.Get("Content-Range"); got != tt.contentRange {
+				t.Errorf("Expected Content-Range '%s', got '%s'", tt.contentRange, got)
+			}
+		})
+	}
+}
+
+func TestServer_StorageClass(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, _ := do(t, http.MethodPut, srv.URL+"/bucket/cold", strings.NewReader("data"), http.Header{"X-Amz-Storage-Class": {"COLD"}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("x-amz-storage-class") != "COLD" {
+		t.Errorf("Expected 200 with class COLD, got %d '%s'", resp.StatusCode, resp.Header.Get("x-amz-storage-class"))
+	}
+
+	resp, body := do(t, http.MethodGet, srv.URL+"/bucket", nil, nil)
+	if !strings.Contains(body, "<StorageClass>COLD</StorageClass>") {
+		t.Errorf("Expected listing to report the class, got %d '%s'", resp.StatusCode, body)
+	}
+
+	resp, body = do(t, http.MethodPut, srv.URL+"/bucket/x", strings.NewReader("data"), http.Header{"X-Amz-Storage-Class": {"DEEP"}})
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "InvalidStorageClass") {
+		t.Errorf("Expected 400 InvalidStorageClass, got %d '%s'", resp.StatusCode, body)
+	}
+}
+
+func TestServer_Restore(t *testing.T) {
+	srv := newTestServer(t)
+
+	do(t, http.MethodPut, srv.URL+"/bucket/old", strings.NewReader("data"), http.Header{"X-Amz-Storage-Class": {"ARCHIVE"}})
+
+	resp, body := do(t, http.MethodGet, srv.URL+"/bucket/old", nil, nil)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "InvalidObjectState") {
+		t.Errorf("Expected 403 InvalidObjectState, got %d '%s'", resp.StatusCode, body)
+	}
+
+	resp, body = do(t, http.MethodPost, srv.URL+"/bucket/old?restore", strings.NewReader("<RestoreRequest><Days>1</Days></RestoreRequest>"), nil)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected 202, got %d '%s'", resp.StatusCode, body)
+	}
+
+	resp, body = do(t, http.MethodGet, srv.URL+"/bucket/old", nil, nil)
+	if resp.StatusCode != http.StatusOK || body != "data" || !strings.Contains(resp.Header.Get("x-amz-restore"), `ongoing-request="false"`) {
+		t.Errorf("Expected the restored object, got %d '%s' '%s'", resp.StatusCode, body, resp.Header.Get("x-amz-restore"))
+	}
+
+	resp, body = do(t, http.MethodPost, srv.URL+"/bucket/old?restore", strings.NewReader("not xml"), nil)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "MalformedXML") {
+		t.Errorf("Expected 400 MalformedXML, got %d '%s'", resp.StatusCode, body)
+	}
+}
+
+func TestServer_ObjectLock(t *testing.T) {
+	local := storage.NewLocalStorage(t.TempDir(), storage.NewValueChecksum())
+	handler := New(local)
+	handler.AllowGovernanceBypass()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	resp, body := do(t, http.MethodGet, srv.URL+"/audit?object-lock", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 without configuration, got %d '%s'", resp.StatusCode, body)
+	}
+
+	cfg := `<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled></ObjectLockConfiguration>`
+	resp, body = do(t, http.MethodPut, srv.URL+"/audit?object-lock", strings.NewReader(cfg), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d '%s'", resp.StatusCode, body)
+	}
+
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	resp, body = do(t, http.MethodPut, srv.URL+"/audit/report", strings.NewReader("data"), http.Header{
+		"X-Amz-Object-Lock-Mode":              {"GOVERNANCE"},
+		"X-Amz-Object-Lock-Retain-Until-Date": {until},
+	})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("x-amz-object-lock-retain-until-date") != until {
+		t.Fatalf("Expected 200 with the retention, got %d '%s'", resp.StatusCode, body)
+	}
+
+	resp, body = do(t, http.MethodDelete, srv.URL+"/audit/report", nil, nil)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "AccessDenied") {
+		t.Errorf("Expected 403 AccessDenied, got %d '%s'", resp.StatusCode, body)
+	}
+
+	resp, body = do(t, http.MethodPut, srv.URL+"/audit/report?legal-hold", strings.NewReader("<LegalHold><Status>ON</Status></LegalHold>"), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d '%s'", resp.StatusCode, body)
+	}
+	resp, body = do(t, http.MethodGet, srv.URL+"/audit/report?retention", nil, nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "<Mode>GOVERNANCE</Mode>") {
+		t.Errorf("Expected the retention, got %d '%s'", resp.StatusCode, body)
+	}
+
+	bypass := http.Header{"X-Amz-Bypass-Governance-Retention": {"true"}}
+	resp, body = do(t, http.MethodDelete, srv.URL+"/audit/report", nil, bypass)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the legal hold to block the delete, got %d '%s'", resp.StatusCode, body)
+	}
+
+	do(t, http.MethodPut, srv.URL+"/audit/report?legal-hold", strings.NewReader("<LegalHold><Status>OFF</Status></LegalHold>"), nil)
+	resp, body = do(t, http.MethodDelete, srv.URL+"/audit/report", nil, bypass)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 with bypass, got %d '%s'", resp.StatusCode, body)
+	}
+}
+
+func TestServer_GovernanceBypassDenied(t *testing.T) {
+	srv := newTestServer(t)
+
+	cfg := `<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled></ObjectLockConfiguration>`
+	do(t, http.MethodPut, srv.URL+"/audit?object-lock", strings.NewReader(cfg), nil)
+	resp, body := do(t, http.MethodPut, srv.URL+"/audit/report", strings.NewReader("data"), http.Header{
+		"X-Amz-Object-Lock-Mode":              {"GOVERNANCE"},
+		"X-Amz-Object-Lock-Retain-Until-Date": {time.Now().Add(time.Hour).UTC().Format(time.RFC3339)},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d '%s'", resp.StatusCode, body)
+	}
+
+	bypass := http.Header{"X-Amz-Bypass-Governance-Retention": {"true"}}
+	resp, body = do(t, http.MethodDelete, srv.URL+"/audit/report", nil, bypass)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "not allowed") {
+		t.Errorf("Expected 403 refusing the bypass, got %d '%s'", resp.StatusCode, body)
+	}
+	resp, body = do(t, http.MethodPut, srv.URL+"/audit/report?retention", strings.NewReader("<Retention></Retention>"), bypass)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "not allowed") {
+		t.Errorf("Expected 403 refusing the bypass, got %d '%s'", resp.StatusCode, body)
+	}
+	resp, body = do(t, http.MethodPut, srv.URL+"/audit/report", strings.NewReader("new"), bypass)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "not allowed") {
+		t.Errorf("Expected 403 refusing the bypass, got %d '%s'", resp.StatusCode, body)
+	}
+	resp, body = do(t, http.MethodGet, srv.URL+"/audit/report", nil, nil)
+	if resp.StatusCode != http.StatusOK || body != "data" {
+		t.Errorf("Expected the object untouched, got %d '%s'", resp.StatusCode, body)
+	}
+}
+
+func TestServer_Tagging(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, body := do(t, http.MethodPut, srv.URL+"/data/users.csv", strings.NewReader("data"), http.Header{"X-Amz-Tagging": {"team=data&sensitivity=high"}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("x-amz-tagging-count") != "2" {
+		t.Fatalf("Expected 200 with 2 tags, got %d '%s' '%s'", resp.StatusCode, body, resp.Header.Get("x-amz-tagging-count"))
+	}
+
+	resp, body = do(t, http.MethodGet, srv.URL+"/data/users.csv?tagging", nil, nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "<TagSet><Tag><Key>sensitivity</Key><Value>high</Value></Tag><Tag><Key>team</Key><Value>data</Value></Tag></TagSet>") {
+		t.Errorf("Expected the tag set, got %d '%s'", resp.StatusCode, body)
+	}
+
+	tagging := `<Tagging><TagSet><Tag><Key>aws:team</Key><Value>x</Value></Tag></TagSet></Tagging>`
+	resp, body = do(t, http.MethodPut, srv.URL+"/data/users.csv?tagging", strings.NewReader(tagging), nil)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "InvalidTag") {
+		t.Errorf("Expected 400 InvalidTag, got %d '%s'", resp.StatusCode, body)
+	}
+
+	resp, body = do(t, http.MethodDelete, srv.URL+"/data/users.csv?tagging", nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d '%s'", resp.StatusCode, body)
+	}
+	resp, _ = do(t, http.MethodHead, srv.URL+"/data/users.csv", nil, nil)
+	if resp.Header.Get("x-amz-tagging-count") != "" {
+		t.Errorf("Expected no tags left, got %s", resp.Header.Get("x-amz-tagging-count"))
+	}
+}
+
+func TestServer_ContentHeaders(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, body := do(t, http.MethodPut, srv.URL+"/site/report", strings.NewReader("a,b"), http.Header{
+		"Content-Type":        {"text/csv"},
+		"Content-Disposition": {`attachment; filename="report.csv"`},
+		"Cache-Control":       {"no-cache"},
+		"X-Amz-Meta-Source":   {"crm"},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d '%s'", resp.StatusCode, body)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		resp, _ = do(t, method, srv.URL+"/site/report", nil, nil)
+		if resp.Header.Get("Content-Type") != "text/csv" || resp.Header.Get("Content-Disposition") != `attachment; filename="report.csv"` ||
+			resp.Header.Get("Cache-Control") != "no-cache" || resp.Header.Get("x-amz-meta-source") != "crm" {
+			t.Errorf("%s: expected the saved headers, got %v", method, resp.Header)
+		}
+	}
+
+	do(t, http.MethodPut, srv.URL+"/site/index.html", strings.NewReader("<p>hi</p>"), nil)
+	resp, _ = do(t, http.MethodGet, srv.URL+"/site/index.html", nil, nil)
+	if resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("Expected a detected content type, got %s", resp.Header.Get("Content-Type"))
+	}
+
+	do(t, http.MethodPut, srv.URL+"/site/old", strings.NewReader("data"), http.Header{"X-Amz-Storage-Class": {"ARCHIVE"}})
+	resp, _ = do(t, http.MethodHead, srv.URL+"/site/old", nil, nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("x-amz-storage-class") != "ARCHIVE" {
+		t.Errorf("Expected HEAD to describe archived objects, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_Copy(t *testing.T) {
+	srv := newTestServer(t)
+
+	do(t, http.MethodPut, srv.URL+"/reports/q1.csv", strings.NewReader("a,b"), http.Header{"X-Amz-Meta-Owner": {"finance"}})
+
+	resp, body := do(t, http.MethodPut, srv.URL+"/backup/2024/q1.csv", nil, http.Header{"X-Amz-Copy-Source": {"/reports/q1.csv"}})
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "<CopyObjectResult><LastModified>") {
+		t.Fatalf("Expected 200 with a CopyObjectResult, got %d '%s'", resp.StatusCode, body)
+	}
+	resp, body = do(t, http.MethodGet, srv.URL+"/backup/2024/q1.csv", nil, nil)
+	if body != "a,b" || resp.Header.Get("x-amz-meta-owner") != "finance" {
+		t.Errorf("Expected the copied object and metadata, got '%s' %v", body, resp.Header)
+	}
+
+	resp, body = do(t, http.MethodPut, srv.URL+"/reports/q1.csv", nil, http.Header{
+		"X-Amz-Copy-Source":        {"reports/q1.csv"},
+		"X-Amz-Metadata-Directive": {"REPLACE"},
+		"X-Amz-Meta-Owner":         {"sales"},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d '%s'", resp.StatusCode, body)
+	}
+	resp, _ = do(t, http.MethodHead, srv.URL+"/reports/q1.csv", nil, nil)
+	if resp.Header.Get("x-amz-meta-owner") != "sales" {
+		t.Errorf("Expected replaced metadata, got %v", resp.Header)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+		code   string
+	}{
+		{"onto itself", http.Header{"X-Amz-Copy-Source": {"/reports/q1.csv"}}, http.StatusBadRequest, "InvalidRequest"},
+		{"failed precondition", http.Header{"X-Amz-Copy-Source": {"/reports/q1.csv"}, "X-Amz-Copy-Source-If-Match": {`"abc"`}}, http.StatusPreconditionFailed, "PreconditionFailed"},
+		{"unknown directive", http.Header{"X-Amz-Copy-Source": {"/reports/q1.csv"}, "X-Amz-Metadata-Directive": {"MERGE"}}, http.StatusBadRequest, "InvalidArgument"},
+		{"missing key", http.Header{"X-Amz-Copy-Source": {"/reports"}}, http.StatusBadRequest, "InvalidArgument"},
+		{"missing source", http.Header{"X-Amz-Copy-Source": {"/reports/nope"}}, http.StatusNotFound, "NoSuchKey"},
+	}
+	for _, tt := range tests {
+		target := srv.URL + "/reports/copy"
+		if tt.name == "onto itself" {
+			target = srv.URL + "/reports/q1.csv"
+		}
+		resp, body := do(t, http.MethodPut, target, nil, tt.header)
+		if resp.StatusCode != tt.status || !strings.Contains(body, tt.code) {
+			t.Errorf("%s: expected %d %s, got %d '%s'", tt.name, tt.status, tt.code, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestServer_CopySSECustomerKey(t *testing.T) {
+	srv := newTestServer(t)
+	key := bytes.Repeat([]byte("k"), 32)
+
+	do(t, http.MethodPut, srv.URL+"/secrets/a", strings.NewReader("secret"), sseHeaders(key))
+
+	header := http.Header{"X-Amz-Copy-Source": {"/secrets/a"}}
+	resp, body := do(t, http.MethodPut, srv.URL+"/public/a", nil, header)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without the source key, got %d '%s'", resp.StatusCode, body)
+	}
+
+	for name, values := range sseHeaders(key) {
+		header["X-Amz-Copy-Source-"+strings.TrimPrefix(name, "X-Amz-")] = values
+	}
+	resp, body = do(t, http.MethodPut, srv.URL+"/public/a", nil, header)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d '%s'", resp.StatusCode, body)
+	}
+	if _, body = do(t, http.MethodGet, srv.URL+"/public/a", nil, nil); body != "secret" {
+		t.Errorf("Expected the decrypted copy, got '%s'", body)
+	}
+}
+
+func TestServer_ConditionalRequests(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, body := do(t, http.MethodPut, srv.URL+"/config/app.json", strings.NewReader("v1"), http.Header{"If-None-Match": {"*"}})
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || len(etag) != 34 {
+		t.Fatalf("Expected 200 with a quoted ETag, got %d '%s' %q", resp.StatusCode, body, etag)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		status int
+	}{
+		{"current copy", http.MethodGet, http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{"current copy, HEAD", http.MethodHead, http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{"stale copy", http.MethodGet, http.Header{"If-None-Match": {`"abc"`}}, http.StatusOK},
+		{"unchanged since", http.MethodGet, http.Header{"If-Modified-Since": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}, http.StatusNotModified},
+		{"other If-Match", http.MethodGet, http.Header{"If-Match": {`"abc"`}}, http.StatusPreconditionFailed},
+		{"bad date", http.MethodGet, http.Header{"If-Modified-Since": {"yesterday"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, tt.method, srv.URL+"/config/app.json", nil, tt.header)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expected %d, got %d '%s'", tt.name, tt.status, resp.StatusCode, body)
+		}
+		if tt.status == http.StatusNotModified && body != "" {
+			t.Errorf("%s: expected no body, got '%s'", tt.name, body)
+		}
+	}
+
+	resp, body = do(t, http.MethodPut, srv.URL+"/config/app.json", strings.NewReader("v2"), http.Header{"If-None-Match": {"*"}})
+	if resp.StatusCode != http.StatusPreconditionFailed || !strings.Contains(body, "PreconditionFailed") {
+		t.Errorf("Expected 412 for a create-only PUT of an existing object, got %d '%s'", resp.StatusCode, body)
+	}
+	resp, _ = do(t, http.MethodPut, srv.URL+"/config/app.json", strings.NewReader("v2"), http.Header{"If-Match": {etag}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("Expected the swap to succeed with a new ETag, got %d", resp.StatusCode)
+	}
+	resp, _ = do(t, http.MethodPut, srv.URL+"/config/app.json", strings.NewReader("v3"), http.Header{"If-Match": {etag}})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for a stale ETag, got %d", resp.StatusCode)
+	}
+	if _, body = do(t, http.MethodGet, srv.URL+"/config/app.json", nil, nil); body != "v2" {
+		t.Errorf("Expected v2, got '%s'", body)
+	}
+}
+
+func TestServer_Notification(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, body := do(t, http.MethodGet, srv.URL+"/data?notification", nil, nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "<NotificationConfiguration></NotificationConfiguration>") {
+		t.Errorf("Expected an empty configuration, got %d '%s'", resp.StatusCode, body)
+	}
+
+	cfg := `<NotificationConfiguration><NotificationRule><Id>indexer</Id><Destination>http://localhost:1/hook</Destination><Event>s3:ObjectCreated:*</Event></NotificationRule></NotificationConfiguration>`
+	resp, body = do(t, http.MethodPut, srv.URL+"/data?notification", strings.NewReader(cfg), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d '%s'", resp.StatusCode, body)
+	}
+	resp, body = do(t, http.MethodGet, srv.URL+"/data?notification", nil, nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "<Destination>http://localhost:1/hook</Destination>") {
+		t.Errorf("Expected the saved rule, got %d '%s'", resp.StatusCode, body)
+	}
+
+	invalid := `<NotificationConfiguration><NotificationRule><Destination>sqs://queue</Destination><Event>s3:ObjectCreated:*</Event></NotificationRule></NotificationConfiguration>`
+	resp, body = do(t, http.MethodPut, srv.URL+"/data?notification", strings.NewReader(invalid), nil)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "InvalidArgument") {
+		t.Errorf("Expected 400 InvalidArgument, got %d '%s'", resp.StatusCode, body)
+	}
+
+	for _, destination := range []string{"file:///etc/cron.d/events", "unix:///run/app.sock"} {
+		local := `<NotificationConfiguration><NotificationRule><Destination>` + destination + `</Destination><Event>s3:ObjectCreated:*</Event></NotificationRule></NotificationConfiguration>`
+		resp, body = do(t, http.MethodPut, srv.URL+"/data?notification", strings.NewReader(local), nil)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "InvalidArgument") {
+			t.Errorf("Expected 400 InvalidArgument for %s, got %d '%s'", destination, resp.StatusCode, body)
+		}
+	}
+
+	resp, _ = do(t, http.MethodPut, srv.URL+"/data?notification", strings.NewReader(`<NotificationConfiguration/>`), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 for an empty configuration, got %d", resp.StatusCode)
+	}
+	resp, body = do(t, http.MethodGet, srv.URL+"/data?notification", nil, nil)
+	if strings.Contains(body, "NotificationRule") {
+		t.Errorf("Expected the rules to be removed, got '%s'", body)
+	}
+}
+
+func TestServer_Replication(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, body := do(t, http.MethodGet, srv.URL+"/data?replication", nil, nil)
+	if resp.StatusCode != http.StatusNotFound || !strings.Contains(body, "ReplicationConfigurationNotFoundError") {
+		t.Errorf("Expected 404 without rules, got %d '%s'", resp.StatusCode, body)
+	}
+
+	cfg := `<ReplicationConfiguration><Rule><ID>backup</ID><Status>Enabled</Status><Destination><Bucket>backup</Bucket></Destination></Rule></ReplicationConfiguration>`
+	resp, body = do(t, http.MethodPut, srv.URL+"/data?replication", strings.NewReader(cfg), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d '%s'", resp.StatusCode, body)
+	}
+	resp, body = do(t, http.MethodGet, srv.URL+"/data?replication", nil, nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "<Bucket>backup</Bucket>") {
+		t.Errorf("Expected the saved rule, got %d '%s'", resp.StatusCode, body)
+	}
+
+	invalid := `<ReplicationConfiguration><Rule><Status>Enabled</Status><Destination><Bucket>data</Bucket></Destination></Rule></ReplicationConfiguration>`
+	resp, body = do(t, http.MethodPut, srv.URL+"/data?replication", strings.NewReader(invalid), nil)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "InvalidRequest") {
+		t.Errorf("Expected 400 InvalidRequest, got %d '%s'", resp.StatusCode, body)
+	}
+
+	local := `<ReplicationConfiguration><Rule><Status>Enabled</Status><Destination><Bucket>backup</Bucket><Endpoint>file:///etc/mini-s3</Endpoint></Destination></Rule></ReplicationConfiguration>`
+	resp, body = do(t, http.MethodPut, srv.URL+"/data?replication", strings.NewReader(local), nil)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "InvalidArgument") {
+		t.Errorf("Expected 400 InvalidArgument for a file endpoint, got %d '%s'", resp.StatusCode, body)
+	}
+	resp, body = do(t, http.MethodGet, srv.URL+"/data?replication", nil, nil)
+	if strings.Contains(body, "file://") {
+		t.Errorf("Expected the file endpoint not saved, got '%s'", body)
+	}
+
+	resp, _ = do(t, http.MethodPut, srv.URL+"/data/report.csv", strings.NewReader("a,b"), nil)
+	if got := resp.Header.Get("x-amz-replication-status"); got != storage.ReplicationStatusPending {
+		t.Errorf("Expected PENDING, got %q", got)
+	}
+	resp, _ = do(t, http.MethodPut, srv.URL+"/backup/copy.csv", strings.NewReader("a,b"), http.Header{"X-Amz-Replication-Status": {"REPLICA"}})
+	if got := resp.Header.Get("x-amz-replication-status"); got != storage.ReplicationStatusReplica {
+		t.Errorf("Expected REPLICA, got %q", got)
+	}
+
+	resp, _ = do(t, http.MethodDelete, srv.URL+"/data?replication", nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+	resp, _ = do(t, http.MethodGet, srv.URL+"/data?replication", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the rules to be removed, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+const (
+	headerSSECustomerAlgorithm = "x-amz-server-side-encryption-customer-algorithm"
+	headerSSECustomerKey       = "x-amz-server-side-encryption-customer-key"
+	headerSSECustomerKeyMD5    = "x-amz-server-side-encryption-customer-key-MD5"
+
+	// copySourcePrefix turns the SSE-C headers into those carrying the key
+	// of a copy's source.
+	copySourcePrefix = "x-amz-copy-source-"
+)
+
+// sseCustomerKeyFromHeaders validates the SSE-C request headers and turns
+// them into storage options. Requests without any of them yield no options.
+func sseCustomerKeyFromHeaders(h http.Header) ([]storage.Option, error) {
+	key, err := sseCustomerKey(h, "")
+	if key == nil || err != nil {
+		return nil, err
+	}
+	return []storage.Option{storage.WithSSECustomerKey(key)}, nil
+}
+
+// copySourceSSECustomerKeyFromHeaders does the same for the key of a
+// copy's source, sent in x-amz-copy-source-server-side-encryption-customer-*.
+func copySourceSSECustomerKeyFromHeaders(h http.Header) ([]storage.Option, error) {
+	key, err := sseCustomerKey(h, copySourcePrefix)
+	if key == nil || err != nil {
+		return nil, err
+	}
+	return []storage.Option{storage.WithCopySourceSSECustomerKey(key)}, nil
+}
+
+// sseCustomerKey reads the SSE-C headers, with x-amz- replaced by prefix
+// when given. It returns a nil key when none of them are set.
+func sseCustomerKey(h http.Header, prefix string) ([]byte, error) {
+	name := func(header string) string {
+		if prefix == "" {
+			return header
+		}
+		return prefix + header[len("x-amz-"):]
+	}
+
+	algorithm := h.Get(name(headerSSECustomerAlgorithm))
+	encodedKey := h.Get(name(headerSSECustomerKey))
+	keyMD5 := h.Get(name(headerSSECustomerKeyMD5))
+	if algorithm == "" && encodedKey == "" && keyMD5 == "" {
+		return nil, nil
+	}
+
+	if algorithm != storage.SSECustomerAlgorithm {
+		return nil, invalidSSEArgument("The encryption algorithm must be " + storage.SSECustomerAlgorithm + ".")
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != 32 {
+		return nil, invalidSSEArgument("The secret key was invalid for the specified algorithm.")
+	}
+	if keyMD5 != storage.SSECustomerKeyMD5(key) {
+		return nil, invalidSSEArgument("The calculated MD5 hash of the key did not match the hash that was provided.")
+	}
+	return key, nil
+}
+
+func invalidSSEArgument(message string) *apiError {
+	return &apiError{http.StatusBadRequest, "InvalidArgument", message}
+}
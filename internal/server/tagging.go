@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/iamthiago/mini-s3/internal/storage"
+)
+
+const (
+	headerTagging      = "x-amz-tagging"
+	headerTaggingCount = "x-amz-tagging-count"
+)
+
+type objectTagger interface {
+	PutObjectTagging(bucket, object string, tags map[string]string) error
+	GetObjectTagging(bucket, object string) (map[string]string, error)
+	DeleteObjectTagging(bucket, object string) error
+}
+
+type tagging struct {
+	XMLName xml.Name      `xml:"Tagging"`
+	TagSet  []storage.Tag `xml:"TagSet>Tag"`
+}
+
+// taggingFromHeaders reads the tags of a PUT, sent URL-encoded like a query
+// string in x-amz-tagging.
+func taggingFromHeaders(h http.Header) ([]storage.Option, error) {
+	value := h.Get(headerTagging)
+	if value == "" {
+		return nil, nil
+	}
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		return nil, &apiError{http.StatusBadRequest, "InvalidArgument", "The header 'x-amz-tagging' shall be encoded as UTF-8 then URLEncoded URL query parameters without tag name duplicates."}
+	}
+	tags := map[string]string{}
+	for key, values := range query {
+		if len(values) > 1 {
+			return nil, &apiError{http.StatusBadRequest, "InvalidTag", "Cannot provide multiple Tags with the same key"}
+		}
+		tags[key] = values[0]
+	}
+	return []storage.Option{storage.WithTags(tags)}, nil
+}
+
+func setTaggingHeaders(w http.ResponseWriter, info *storage.ObjectInfo) {
+	if len(info.Tags) > 0 {
+		w.Header().Set(headerTaggingCount, strconv.Itoa(len(info.Tags)))
+	}
+}
+
+func (s *Server) objectTagging(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	tagger, ok := s.storage.(objectTagger)
+	if !ok {
+		writeError(w, errNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tags, err := tagger.GetObjectTagging(bucket, key)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeXML(w, http.StatusOK, tagging{TagSet: storage.TagSet(tags)})
+	case http.MethodPut:
+		var req tagging
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, errMalformedXML)
+			return
+		}
+		tags := map[string]string{}
+		for _, tag := range req.TagSet {
+			if _, dup := tags[tag.Key]; dup {
+				writeError(w, &apiError{http.StatusBadRequest, "InvalidTag", "Cannot provide multiple Tags with the same key"})
+				return
+			}
+			tags[tag.Key] = tag.Value
+		}
+		if err := tagger.PutObjectTagging(bucket, key, tags); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if err := tagger.DeleteObjectTagging(bucket, key); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, errMethodNotAllowed)
+	}
+}
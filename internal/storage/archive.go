@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxPackSize is the size past which the archive starts a new pack file.
+const maxPackSize = 256 << 20
+
+// archiveBackend packs objects into large append-only files, each entry
+// compressed as its own zstd frame so it can be read back on its own. It
+// favours few files and small size over access speed, which is what the
+// ARCHIVE class is for: its objects are only read through restored copies.
+//
+// Removed entries are appended to dead.log and their space is not
+// reclaimed in place.
+type archiveBackend struct {
+	lockRoot string
+	dir      string
+}
+
+func newArchiveBackend(lockRoot, dir string) *archiveBackend {
+	return &archiveBackend{lockRoot: lockRoot, dir: dir}
+}
+
+// archiveLocator points at an entry: the pack file, and where in it the
+// compressed entry starts and how long it is.
+type archiveLocator struct {
+	pack   string
+	offset int64
+	length int64
+}
+
+func (a archiveLocator) String() string {
+	return fmt.Sprintf("%s:%d:%d", a.pack, a.offset, a.length)
+}
+
+func parseArchiveLocator(locator string) (archiveLocator, error) {
+	parts := strings.Split(locator, ":")
+	if len(parts) != 3 {
+		return archiveLocator{}, fmt.Errorf("invalid archive locator %q", locator)
+	}
+	offset, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return archiveLocator{}, fmt.Errorf("invalid archive locator %q", locator)
+	}
+	length, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return archiveLocator{}, fmt.Errorf("invalid archive locator %q", locator)
+	}
+	return archiveLocator{pack: parts[0], offset: offset, length: length}, nil
+}
+
+func (a *archiveBackend) Put(bucket, object, path, digest string) (string, error) {
+	defer os.Remove(path)
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	// Appends to a pack are serialised across processes
+	unlock, err := lockKey(a.lockRoot, lockDomainArchive, a.dir, true)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	pack, err := a.currentPack()
+	if err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(filepath.Join(a.dir, pack), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Write at the end, and cut back to there if anything fails, so a
+	// failed append never leaves a broken entry behind
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	if err := a.writeEntry(file, src); err != nil {
+		_ = file.Truncate(offset)
+		return "", err
+	}
+	end, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	if err := file.Sync(); err != nil {
+		return "", err
+	}
+
+	return archiveLocator{pack: pack, offset: offset, length: end - offset}.String(), file.Close()
+}
+
+func (a *archiveBackend) writeEntry(dst io.Writer, src io.Reader) error {
+	enc, err := zstd.NewWriter(dst, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(enc, src); err != nil {
+		enc.Close()
+		return err
+	}
+	return enc.Close()
+}
+
+// currentPack returns the name of the pack to append to, starting a new
+// one once the last is full.
+func (a *archiveBackend) currentPack() (string, error) {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return "", err
+	}
+	packs, err := filepath.Glob(filepath.Join(a.dir, "pack-*.zst"))
+	if err != nil {
+		return "", err
+	}
+	if len(packs) == 0 {
+		return packName(1), nil
+	}
+
+	sort.Strings(packs)
+	last := packs[len(packs)-1]
+	info, err := os.Stat(last)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() < maxPackSize {
+		return filepath.Base(last), nil
+	}
+
+	var n int
+	if _, err := fmt.Sscanf(filepath.Base(last), "pack-%06d.zst", &n); err != nil {
+		return "", err
+	}
+	return packName(n + 1), nil
+}
+
+func packName(n int) string {
+	return fmt.Sprintf("pack-%06d.zst", n)
+}
+
+func (a *archiveBackend) Open(locator string) (io.ReadCloser, error) {
+	loc, err := parseArchiveLocator(locator)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(a.dir, loc.pack))
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := newDecompressReader(io.NewSectionReader(file, loc.offset, loc.length), CompressionZstd)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return readCloser{Reader: dec, Closer: multiCloser{dec, file}}, nil
+}
+
+func (a *archiveBackend) Remove(bucket, object, locator string) error {
+	unlock, err := lockKey(a.lockRoot, lockDomainArchive, a.dir, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return err
+	}
+	log, err := os.OpenFile(filepath.Join(a.dir, "dead.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(log, "%s %s/%s\n", locator, bucket, object); err != nil {
+		log.Close()
+		return err
+	}
+	return log.Close()
+}
+
+func (a *archiveBackend) Path(locator string) string {
+	return ""
+}
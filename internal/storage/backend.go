@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Backend stores the bytes of objects. LocalStorage keeps the metadata and
+// hands a Backend the finished data file, already compressed and encrypted
+// as configured; the Backend decides where those bytes live.
+type Backend interface {
+	// Put takes ownership of the data file at path, whose contents hash to
+	// digest (hex SHA-256), and returns the locator to read it back with.
+	Put(bucket, object, path, digest string) (string, error)
+	// Open returns the stored bytes.
+	Open(locator string) (io.ReadCloser, error)
+	// Remove releases the bytes stored for bucket/object under locator.
+	Remove(bucket, object, locator string) error
+	// Path returns the file holding the bytes, or "" if there is no single
+	// such file.
+	Path(locator string) string
+}
+
+const (
+	backendFile    = "file"
+	backendBlob    = "blob"
+	backendChunk   = "chunk"
+	backendErasure = "erasure"
+	backendJBOD    = "jbod"
+	backendCold    = "cold"
+	// backendArchive holds ARCHIVE objects, and backendRestored the
+	// temporary copies restored from it.
+	backendArchive  = "archive"
+	backendRestored = "restored"
+)
+
+// fileBackend stores every object as a plain file named after it, inside
+// its bucket directory.
+type fileBackend struct {
+	root string
+}
+
+func newFileBackend(root string) *fileBackend {
+	return &fileBackend{root: root}
+}
+
+func (f *fileBackend) Put(bucket, object, path, digest string) (string, error) {
+	locator := bucket + "/" + object
+	dst := f.Path(locator)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	return locator, moveFile(path, dst)
+}
+
+func (f *fileBackend) Open(locator string) (io.ReadCloser, error) {
+	return os.Open(f.Path(locator))
+}
+
+func (f *fileBackend) Remove(bucket, object, locator string) error {
+	return os.Remove(f.Path(locator))
+}
+
+func (f *fileBackend) Path(locator string) string {
+	return filepath.Join(f.root, filepath.FromSlash(locator))
+}
+
+// moveFile renames src to dst, copying the data instead when they are on
+// different file systems, like a storage class on another disk.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"io"
+	"os"
+)
+
+// blobBackend is a content-addressed backend: data files are kept once per
+// distinct content, named after their SHA-256, no matter how many objects
+// point at them. Each blob references the objects using it as
+// "bucket/object", and blobs left without references are deleted by
+// CollectGarbage.
+type blobBackend struct {
+	store *contentStore
+}
+
+func newBlobBackend(root string) *blobBackend {
+	return &blobBackend{store: newContentStore(root, "blobs", lockDomainBlob)}
+}
+
+func (b *blobBackend) Put(bucket, object, path, digest string) (string, error) {
+	return digest, b.store.putFile(digest, bucket+"/"+object, path)
+}
+
+func (b *blobBackend) Open(locator string) (io.ReadCloser, error) {
+	return os.Open(b.Path(locator))
+}
+
+func (b *blobBackend) Remove(bucket, object, locator string) error {
+	return b.store.dropRef(locator, bucket+"/"+object)
+}
+
+func (b *blobBackend) Path(locator string) string {
+	return b.store.path(locator)
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// bucketConfigDir is the hidden directory inside each bucket holding its
+// settings, one JSON file per feature.
+const bucketConfigDir = ".config"
+
+func (l *LocalStorage) bucketConfigPath(bucket, name string) string {
+	return filepath.Join(l.path, bucket, bucketConfigDir, name+".json")
+}
+
+// readBucketConfig decodes the named bucket setting into v. It reports false
+// when the setting was never configured.
+func (l *LocalStorage) readBucketConfig(bucket, name string, v any) (bool, error) {
+	if err := validateBucket(bucket); err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(l.bucketConfigPath(bucket, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *LocalStorage) writeBucketConfig(bucket, name string, v any) error {
+	if err := validateBucket(bucket); err != nil {
+		return err
+	}
+	path := l.bucketConfigPath(bucket, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (l *LocalStorage) deleteBucketConfig(bucket, name string) error {
+	if err := validateBucket(bucket); err != nil {
+		return err
+	}
+	err := os.Remove(l.bucketConfigPath(bucket, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
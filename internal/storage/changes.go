@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Change types reported by the change feed.
+const (
+	ChangeCreated     = "created"
+	ChangeOverwritten = "overwritten"
+	ChangeDeleted     = "deleted"
+)
+
+const (
+	// The change journal is split into segments of about
+	// maxChangeSegmentSize bytes, of which the newest maxChangeSegments are
+	// kept.
+	maxChangeSegmentSize = 4 << 20
+	maxChangeSegments    = 16
+
+	// changePollInterval is how often subscribers look for changes made by
+	// other processes sharing the data directory. Changes made by this one
+	// wake them right away.
+	changePollInterval = 200 * time.Millisecond
+)
+
+// ErrChangeSequenceOutOfRange is returned when subscribing from a sequence
+// the change feed no longer retains, or has not reached yet.
+var ErrChangeSequenceOutOfRange = errors.New("sequence is outside the retained change feed")
+
+// Change is an entry of the change feed.
+type Change struct {
+	// Sequence is the change's position in the feed. Sequences increase
+	// but are not contiguous; subscribing from a change's sequence resumes
+	// right after it.
+	Sequence int64  `json:"-"`
+	Type     string `json:"type"`
+	Bucket   string `json:"bucket"`
+	Object   string `json:"object"`
+	// Size and ETag describe the object written, and are empty for
+	// deletions.
+	Size int64     `json:"size,omitempty"`
+	ETag string    `json:"etag,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// ChangeFilter selects the changes of a subscription. Empty fields match
+// everything.
+type ChangeFilter struct {
+	Bucket string
+	Prefix string
+}
+
+func (f ChangeFilter) matches(c *Change) bool {
+	return (f.Bucket == "" || c.Bucket == f.Bucket) && strings.HasPrefix(c.Object, f.Prefix)
+}
+
+// changeFeed wakes this process' subscribers when a change is journaled.
+type changeFeed struct {
+	mu      sync.Mutex
+	updated chan struct{}
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{updated: make(chan struct{})}
+}
+
+// wait returns a channel closed at the next change.
+func (f *changeFeed) wait() <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.updated
+}
+
+func (f *changeFeed) broadcast() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	close(f.updated)
+	f.updated = make(chan struct{})
+}
+
+func (l *LocalStorage) changesDir() string {
+	return filepath.Join(l.path, systemDir, "changes")
+}
+
+// changeSegments lists the bases of the journal's segments, oldest first.
+// A segment's base is the sequence its first change starts at.
+func (l *LocalStorage) changeSegments() ([]int64, error) {
+	entries, err := os.ReadDir(l.changesDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var bases []int64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".jsonl")
+		if !ok {
+			continue
+		}
+		base, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		bases = append(bases, base)
+	}
+	sort.Slice(bases, func(i, j int) bool { return bases[i] < bases[j] })
+	return bases, nil
+}
+
+func (l *LocalStorage) changeSegmentPath(base int64) string {
+	return filepath.Join(l.changesDir(), fmt.Sprintf("%020d.jsonl", base))
+}
+
+// journalChange appends a change to the journal and sets its sequence: the
+// offset of the end of its line in the journal as a whole, so sequences
+// need no state beyond the journal itself and are shared by every process
+// appending to it.
+func (l *LocalStorage) journalChange(change *Change) error {
+	line, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	unlock, err := lockKey(l.path, lockDomainChanges, "journal", true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.MkdirAll(l.changesDir(), 0755); err != nil {
+		return err
+	}
+	bases, err := l.changeSegments()
+	if err != nil {
+		return err
+	}
+	var base int64
+	if len(bases) > 0 {
+		base = bases[len(bases)-1]
+	}
+
+	file, err := os.OpenFile(l.changeSegmentPath(base), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if size >= maxChangeSegmentSize {
+		if err := file.Close(); err != nil {
+			return err
+		}
+		base += size
+		if file, err = os.OpenFile(l.changeSegmentPath(base), os.O_CREATE|os.O_RDWR, 0644); err != nil {
+			return err
+		}
+		defer file.Close()
+		size = 0
+		bases = append(bases, base)
+		for len(bases) > maxChangeSegments {
+			if err := os.Remove(l.changeSegmentPath(bases[0])); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			bases = bases[1:]
+		}
+	} else if size > 0 {
+		// A process that crashed mid-append leaves a partial line behind;
+		// end it so that it is skipped instead of corrupting this one
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, size-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+
+	if _, err := file.Write(line); err != nil {
+		return err
+	}
+	change.Sequence = base + size + int64(len(line))
+	l.changes.broadcast()
+	return nil
+}
+
+// ChangeFeedHead returns the sequence of the latest change, subscribing
+// from which only reports changes that happen from now on.
+func (l *LocalStorage) ChangeFeedHead() (int64, error) {
+	bases, err := l.changeSegments()
+	if err != nil || len(bases) == 0 {
+		return 0, err
+	}
+	base := bases[len(bases)-1]
+	info, err := os.Stat(l.changeSegmentPath(base))
+	if err != nil {
+		return 0, err
+	}
+	return base + info.Size(), nil
+}
+
+// SubscribeChanges calls handle with every change to an object matching
+// filter after sequence from, in order, including those made by other
+// processes sharing the data directory. A from of 0 starts at the oldest
+// change retained. It blocks until ctx is done, returning ctx.Err(), or
+// handle fails, returning its error.
+func (l *LocalStorage) SubscribeChanges(ctx context.Context, filter ChangeFilter, from int64, handle func(Change) error) error {
+	r, err := l.openChanges(from)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	for {
+		// Take the wake-up channel before reading, so a change journaled
+		// in between is not missed
+		updated := l.changes.wait()
+		for {
+			change, err := r.next()
+			if err != nil {
+				return err
+			}
+			if change == nil {
+				break
+			}
+			if !filter.matches(change) {
+				continue
+			}
+			if err := handle(*change); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-updated:
+		case <-time.After(changePollInterval):
+		}
+	}
+}
+
+// changeReader tails the journal from a sequence, following it from
+// segment to segment.
+type changeReader struct {
+	l      *LocalStorage
+	base   int64
+	offset int64
+	file   *os.File
+	reader *bufio.Reader
+	// partial holds the start of a line still being appended.
+	partial []byte
+}
+
+func (l *LocalStorage) openChanges(from int64) (*changeReader, error) {
+	bases, err := l.changeSegments()
+	if err != nil {
+		return nil, err
+	}
+	r := &changeReader{l: l}
+	if len(bases) == 0 {
+		if from != 0 {
+			return nil, ErrChangeSequenceOutOfRange
+		}
+		return r, nil
+	}
+	if from == 0 {
+		from = bases[0]
+	}
+	if from < bases[0] {
+		return nil, ErrChangeSequenceOutOfRange
+	}
+
+	head, err := l.ChangeFeedHead()
+	if err != nil {
+		return nil, err
+	}
+	if from > head {
+		return nil, ErrChangeSequenceOutOfRange
+	}
+	for _, base := range bases {
+		if base <= from {
+			r.base = base
+		}
+	}
+	r.offset = from - r.base
+	return r, nil
+}
+
+// next returns the next complete change, or nil when there is none yet.
+// Lines that cannot be decoded, left by interrupted appends, are skipped.
+func (r *changeReader) next() (*Change, error) {
+	for {
+		if r.file == nil {
+			file, err := os.Open(r.l.changeSegmentPath(r.base))
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if _, err := file.Seek(r.offset, io.SeekStart); err != nil {
+				file.Close()
+				return nil, err
+			}
+			r.file, r.reader = file, bufio.NewReader(file)
+		}
+
+		data, err := r.reader.ReadBytes('\n')
+		r.partial = append(r.partial, data...)
+		if errors.Is(err, io.EOF) {
+			if len(r.partial) > 0 {
+				return nil, nil
+			}
+			// The writer moves on to the next segment once this one is
+			// full, so there is more to read only if it exists
+			next := r.base + r.offset
+			if _, err := os.Stat(r.l.changeSegmentPath(next)); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return nil, nil
+				}
+				return nil, err
+			}
+			r.close()
+			r.base, r.offset = next, 0
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line := r.partial
+		r.partial = nil
+		r.offset += int64(len(line))
+
+		var change Change
+		if err := json.Unmarshal(line, &change); err != nil {
+			continue
+		}
+		change.Sequence = r.base + r.offset
+		return &change, nil
+	}
+}
+
+func (r *changeReader) close() {
+	if r.file != nil {
+		r.file.Close()
+		r.file, r.reader = nil, nil
+	}
+}
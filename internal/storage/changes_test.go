@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// collectChanges subscribes from a sequence and returns the first n changes
+// matching filter, failing the test if they do not arrive in time.
+func collectChanges(t *testing.T, l *LocalStorage, filter ChangeFilter, from int64, n int) []Change {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var changes []Change
+	done := errors.New("done")
+	err := l.SubscribeChanges(ctx, filter, from, func(c Change) error {
+		changes = append(changes, c)
+		if len(changes) == n {
+			return done
+		}
+		return nil
+	})
+	if !errors.Is(err, done) {
+		t.Fatalf("Got %d of %d changes: %v", len(changes), n, err)
+	}
+	return changes
+}
+
+func TestLocalStorage_SubscribeChanges(t *testing.T) {
+	save := func(t *testing.T, l *LocalStorage, bucket, object, content string) {
+		t.Helper()
+		if _, err := l.Save(bucket, object, strings.NewReader(content)); err != nil {
+			t.Fatalf("Failed to save %s: %v", object, err)
+		}
+	}
+
+	t.Run("Reports creates, overwrites and deletes in order", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		save(t, l, "photos", "2024/a.jpg", "a")
+		save(t, l, "photos", "2024/a.jpg", "aa")
+		save(t, l, "photos", "2023/b.jpg", "b")
+		save(t, l, "docs", "2024/c.txt", "c")
+		if err := l.Delete("photos", "2024/a.jpg"); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+
+		changes := collectChanges(t, l, ChangeFilter{Bucket: "photos", Prefix: "2024/"}, 0, 3)
+		want := []string{ChangeCreated, ChangeOverwritten, ChangeDeleted}
+		for i, c := range changes {
+			if c.Type != want[i] || c.Bucket != "photos" || c.Object != "2024/a.jpg" {
+				t.Errorf("Change %d: expected %s of photos/2024/a.jpg, got %s of %s/%s", i, want[i], c.Type, c.Bucket, c.Object)
+			}
+			if i > 0 && c.Sequence <= changes[i-1].Sequence {
+				t.Errorf("Sequences should increase, got %d after %d", c.Sequence, changes[i-1].Sequence)
+			}
+		}
+		if changes[1].Size != 2 || changes[1].ETag == "" {
+			t.Errorf("Expected the overwrite to describe the new object, got size %d and ETag %q", changes[1].Size, changes[1].ETag)
+		}
+	})
+
+	t.Run("Resumes after a sequence", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		save(t, l, "bucket", "a", "a")
+		save(t, l, "bucket", "b", "b")
+		save(t, l, "bucket", "c", "c")
+
+		first := collectChanges(t, l, ChangeFilter{}, 0, 1)
+		rest := collectChanges(t, l, ChangeFilter{}, first[0].Sequence, 2)
+		if rest[0].Object != "b" || rest[1].Object != "c" {
+			t.Errorf("Expected b and c after a, got %s and %s", rest[0].Object, rest[1].Object)
+		}
+	})
+
+	t.Run("Follows changes as they happen, from other processes too", func(t *testing.T) {
+		dir := t.TempDir()
+		l := NewLocalStorage(dir, NewValueChecksum())
+		save(t, l, "bucket", "old", "old")
+		head, err := l.ChangeFeedHead()
+		if err != nil {
+			t.Fatalf("Failed to get head: %v", err)
+		}
+
+		// A second instance stands in for another process, so the
+		// subscriber is not woken up but has to notice on its own
+		other := NewLocalStorage(dir, NewValueChecksum())
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			if _, err := other.Save("bucket", "new", strings.NewReader("new")); err != nil {
+				t.Errorf("Failed to save new: %v", err)
+			}
+		}()
+
+		changes := collectChanges(t, l, ChangeFilter{Bucket: "bucket"}, head, 1)
+		if changes[0].Object != "new" || changes[0].Type != ChangeCreated {
+			t.Errorf("Expected new to be created, got %s of %s", changes[0].Type, changes[0].Object)
+		}
+	})
+
+	t.Run("Skips lines left by interrupted appends", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		save(t, l, "bucket", "a", "a")
+		f, err := os.OpenFile(l.changeSegmentPath(0), os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("Failed to open journal: %v", err)
+		}
+		_, _ = f.WriteString(`{"type":"crea`)
+		f.Close()
+		save(t, l, "bucket", "b", "b")
+
+		changes := collectChanges(t, l, ChangeFilter{}, 0, 2)
+		if changes[0].Object != "a" || changes[1].Object != "b" {
+			t.Errorf("Expected a and b, got %s and %s", changes[0].Object, changes[1].Object)
+		}
+	})
+
+	t.Run("Rejects sequences outside the feed", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		save(t, l, "bucket", "a", "a")
+		err := l.SubscribeChanges(context.Background(), ChangeFilter{}, 1<<40, func(Change) error { return nil })
+		if !errors.Is(err, ErrChangeSequenceOutOfRange) {
+			t.Errorf("Expected ErrChangeSequenceOutOfRange, got %v", err)
+		}
+	})
+
+	t.Run("Stops when the context is done", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := l.SubscribeChanges(ctx, ChangeFilter{}, 0, func(Change) error { return nil })
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// Content-defined chunking cuts where a rolling hash of the last bytes hits
+// a fixed pattern, so boundaries follow the content rather than offsets: an
+// insertion only changes the chunks around it, and the rest still match
+// chunks already stored.
+const (
+	chunkMinSize = 16 << 10
+	chunkMaxSize = 256 << 10
+	// chunkMask tests the top bits of the gear hash, which depend on the
+	// last 64 bytes. With 16 bits, cuts land about 64KiB past the minimum.
+	chunkMask = uint64(0xffff) << 48
+)
+
+// gearTable maps every byte to a random value for the gear hash. It must
+// never change, or stored chunks would stop matching new ones.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	// splitmix64, from a fixed seed
+	seed := uint64(0x6d696e692d7333)
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// cutPoint returns the length of the first chunk in data.
+func cutPoint(data []byte) int {
+	n := len(data)
+	if n <= chunkMinSize {
+		return n
+	}
+	if n > chunkMaxSize {
+		n = chunkMaxSize
+	}
+
+	var h uint64
+	for i := chunkMinSize; i < n; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&chunkMask == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// chunker splits a stream into content-defined chunks.
+type chunker struct {
+	r    io.Reader
+	buf  []byte
+	n    int
+	cut  int
+	done bool
+}
+
+func newChunker(r io.Reader) *chunker {
+	return &chunker{r: r, buf: make([]byte, chunkMaxSize)}
+}
+
+// next returns the next chunk, or io.EOF after the last one. The chunk is
+// only valid until the following call.
+func (c *chunker) next() ([]byte, error) {
+	c.n = copy(c.buf, c.buf[c.cut:c.n])
+	c.cut = 0
+
+	for c.n < len(c.buf) && !c.done {
+		n, err := c.r.Read(c.buf[c.n:])
+		c.n += n
+		if errors.Is(err, io.EOF) {
+			c.done = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.n == 0 {
+		return nil, io.EOF
+	}
+
+	c.cut = cutPoint(c.buf[:c.n])
+	return c.buf[:c.cut], nil
+}
+
+// chunkBackend splits stored bytes into content-defined chunks and keeps
+// each distinct chunk once, so objects that only partly match still share
+// storage.
+//
+// Each object's bytes are described by a manifest, itself kept in a
+// content store under the digest of the whole data: manifests reference
+// the objects using them as "bucket/object", and chunks reference the
+// manifests using them by digest. CollectGarbage deletes manifests no
+// object uses any more, then chunks no manifest uses.
+type chunkBackend struct {
+	manifests *contentStore
+	chunks    *contentStore
+}
+
+// chunkManifest lists the chunks an object's bytes are made of, in order.
+type chunkManifest struct {
+	Size   int64      `json:"size"`
+	Chunks []chunkRef `json:"chunks"`
+}
+
+type chunkRef struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+func newChunkBackend(root string) *chunkBackend {
+	return &chunkBackend{
+		manifests: newContentStore(root, "manifests", lockDomainManifest),
+		chunks:    newContentStore(root, "chunks", lockDomainChunk),
+	}
+}
+
+func (c *chunkBackend) Put(bucket, object, path, digest string) (string, error) {
+	defer os.Remove(path)
+
+	// Identical data is already chunked, so only the reference is missing
+	ref := bucket + "/" + object
+	if exists, err := c.manifests.addRef(digest, ref); err != nil || exists {
+		return digest, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Chunks are stored before the manifest, so a manifest never points at
+	// a missing chunk. Until it exists, the grace period of CollectGarbage
+	// keeps them alive.
+	manifest := &chunkManifest{}
+	chunker := newChunker(file)
+	for {
+		chunk, err := chunker.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		sum := sha256.Sum256(chunk)
+		chunkDigest := hex.EncodeToString(sum[:])
+		if err := c.chunks.putBytes(chunkDigest, digest, chunk); err != nil {
+			return "", err
+		}
+		manifest.Chunks = append(manifest.Chunks, chunkRef{Digest: chunkDigest, Size: int64(len(chunk))})
+		manifest.Size += int64(len(chunk))
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	return digest, c.manifests.putBytes(digest, ref, data)
+}
+
+func (c *chunkBackend) Open(locator string) (io.ReadCloser, error) {
+	return c.OpenRange(locator, 0, -1)
+}
+
+// OpenRange reads length bytes (or up to the end, if negative) starting at
+// offset, opening only the chunks that overlap the range.
+func (c *chunkBackend) OpenRange(locator string, offset, length int64) (io.ReadCloser, error) {
+	manifest, err := c.manifest(locator)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the chunk holding offset from the cumulative chunk ends
+	ends := make([]int64, len(manifest.Chunks))
+	var end int64
+	for i, chunk := range manifest.Chunks {
+		end += chunk.Size
+		ends[i] = end
+	}
+	first := sort.Search(len(ends), func(i int) bool { return ends[i] > offset })
+
+	var skip int64
+	if first > 0 {
+		skip = offset - ends[first-1]
+	} else {
+		skip = offset
+	}
+	remaining := manifest.Size - offset
+	if length >= 0 && length < remaining {
+		remaining = length
+	}
+	return &chunkReader{store: c.chunks, chunks: manifest.Chunks[first:], skip: skip, remaining: max(remaining, 0)}, nil
+}
+
+func (c *chunkBackend) Remove(bucket, object, locator string) error {
+	return c.manifests.dropRef(locator, bucket+"/"+object)
+}
+
+func (c *chunkBackend) Path(locator string) string {
+	return ""
+}
+
+func (c *chunkBackend) manifest(digest string) (*chunkManifest, error) {
+	data, err := os.ReadFile(c.manifests.path(digest))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &chunkManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// chunkReader reassembles an object's bytes, opening one chunk at a time.
+type chunkReader struct {
+	store     *contentStore
+	chunks    []chunkRef
+	skip      int64
+	remaining int64
+	current   *os.File
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for r.remaining > 0 {
+		if r.current == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+			file, err := os.Open(r.store.path(r.chunks[0].Digest))
+			if err != nil {
+				return 0, err
+			}
+			r.chunks = r.chunks[1:]
+			if r.skip > 0 {
+				if _, err := file.Seek(r.skip, io.SeekStart); err != nil {
+					file.Close()
+					return 0, err
+				}
+				r.skip = 0
+			}
+			r.current = file
+		}
+
+		if int64(len(p)) > r.remaining {
+			p = p[:r.remaining]
+		}
+		n, err := r.current.Read(p)
+		r.remaining -= int64(n)
+		if errors.Is(err, io.EOF) {
+			r.current.Close()
+			r.current = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, io.EOF
+}
+
+func (r *chunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func chunkSizes(t *testing.T, data []byte) []int {
+	t.Helper()
+	var sizes []int
+	c := newChunker(bytes.NewReader(data))
+	for {
+		chunk, err := c.next()
+		if errors.Is(err, io.EOF) {
+			return sizes
+		}
+		if err != nil {
+			t.Fatalf("Failed to chunk: %v", err)
+		}
+		sizes = append(sizes, len(chunk))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	data := randomBytes(1, 2<<20)
+
+	t.Run("Chunks stay within bounds and cover the data", func(t *testing.T) {
+		sizes := chunkSizes(t, data)
+		total := 0
+		for i, size := range sizes {
+			total += size
+			if size > chunkMaxSize || (size < chunkMinSize && i != len(sizes)-1) {
+				t.Errorf("Chunk %d has size %d", i, size)
+			}
+		}
+		if total != len(data) {
+			t.Errorf("Expected chunks to cover %d bytes, got %d", len(data), total)
+		}
+		if len(sizes) < 4 {
+			t.Errorf("Expected several chunks, got %v", sizes)
+		}
+	})
+
+	t.Run("Boundaries resynchronise after an insertion", func(t *testing.T) {
+		edited := append(append(append([]byte{}, data[:1000]...), "inserted"...), data[1000:]...)
+		original, shifted := chunkSizes(t, data), chunkSizes(t, edited)
+
+		// Only the first chunk grows; every later one is unchanged
+		if shifted[0] != original[0]+len("inserted") {
+			t.Errorf("Expected the first chunk to absorb the insertion, got %d and %d", original[0], shifted[0])
+		}
+		if !slices.Equal(original[1:], shifted[1:]) {
+			t.Errorf("Expected later chunks to match, got %v and %v", original, shifted)
+		}
+	})
+}
+
+func readRange(t *testing.T, storage *LocalStorage, bucket, object string, offset, length int64, opts ...Option) []byte {
+	t.Helper()
+	reader, info, err := storage.Get(bucket, object, append(opts, WithRange(offset, length))...)
+	if err != nil {
+		t.Fatalf("Failed to get range: %v", err)
+	}
+	defer reader.Close()
+	if info.Range == nil {
+		t.Fatalf("Expected the range to be reported")
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to read range: %v", err)
+	}
+	return data
+}
+
+func TestLocalStorage_ChunkedDeduplication(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum(), WithChunkedDeduplication())
+	original := randomBytes(2, 1<<20)
+	edited := append(append(append([]byte{}, original[:500000]...), "a small edit"...), original[500000:]...)
+
+	if _, err := storage.Save("datasets", "v1.bin", bytes.NewReader(original)); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	info, err := storage.Save("datasets", "v2.bin", bytes.NewReader(edited))
+	if err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if info.Path != "" {
+		t.Errorf("Expected no single file for a chunked object, got %s", info.Path)
+	}
+
+	t.Run("Reassembles objects", func(t *testing.T) {
+		if got := readObject(t, storage, "datasets", "v2.bin"); got != string(edited) {
+			t.Errorf("Content does not match")
+		}
+	})
+
+	t.Run("Shares chunks between similar objects", func(t *testing.T) {
+		stats, err := storage.DedupStats()
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.ChunkedObjects != 2 {
+			t.Errorf("Expected 2 chunked objects, got %+v", stats)
+		}
+		// Only the chunk around the edit is stored twice
+		if stats.PhysicalBytes > int64(len(original))+2*chunkMaxSize {
+			t.Errorf("Expected most chunks to be shared, got %+v", stats)
+		}
+	})
+
+	t.Run("Serves ranged reads", func(t *testing.T) {
+		tests := []struct {
+			name           string
+			offset, length int64
+			expected       []byte
+		}{
+			{"within one chunk", 10, 100, edited[10:110]},
+			{"across chunks", 100000, 400000, edited[100000:500000]},
+			{"to the end", 1000000, -1, edited[1000000:]},
+			{"suffix", -5, -1, edited[len(edited)-5:]},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := readRange(t, storage, "datasets", "v2.bin", tt.offset, tt.length); !bytes.Equal(got, tt.expected) {
+					t.Errorf("Expected %d bytes, got %d that differ", len(tt.expected), len(got))
+				}
+			})
+		}
+
+		if _, _, err := storage.Get("datasets", "v2.bin", WithRange(int64(len(edited)), -1)); !errors.Is(err, ErrInvalidRange) {
+			t.Errorf("Expected ErrInvalidRange, got %v", err)
+		}
+	})
+
+	t.Run("Deduplicates encrypted objects whole", func(t *testing.T) {
+		key := bytes.Repeat([]byte("k"), 32)
+		info, err := storage.Save("datasets", "secret.bin", bytes.NewReader(original), WithSSECustomerKey(key))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if info.Path == "" {
+			t.Errorf("Expected the encrypted object kept as a blob")
+		}
+		if got := readRange(t, storage, "datasets", "secret.bin", 70000, 100, WithSSECustomerKey(key)); !bytes.Equal(got, original[70000:70100]) {
+			t.Errorf("Range does not match")
+		}
+	})
+
+	t.Run("Deduplicates compressed objects whole", func(t *testing.T) {
+		if err := storage.PutBucketCompression("compressed", &CompressionConfig{Algorithm: CompressionGzip}); err != nil {
+			t.Fatalf("Failed to enable compression: %v", err)
+		}
+		text := bytes.Repeat([]byte("compressible "), 100000)
+		var paths []string
+		for _, object := range []string{"a.txt", "b.txt"} {
+			info, err := storage.Save("compressed", object, bytes.NewReader(text))
+			if err != nil {
+				t.Fatalf("Failed to save file: %v", err)
+			}
+			if info.Compression == "" || info.Path == "" {
+				t.Fatalf("Expected a compressed object kept as a blob, got %+v", info)
+			}
+			paths = append(paths, info.Path)
+		}
+		if paths[0] != paths[1] {
+			t.Errorf("Expected identical content to share a blob, got %v", paths)
+		}
+		if got := readObject(t, storage, "compressed", "b.txt"); got != string(text) {
+			t.Errorf("Content does not match")
+		}
+		for _, object := range []string{"a.txt", "b.txt"} {
+			if err := storage.Delete("compressed", object); err != nil {
+				t.Fatalf("Failed to delete file: %v", err)
+			}
+		}
+	})
+
+	t.Run("Collects chunks once unreferenced", func(t *testing.T) {
+		for _, object := range []string{"v1.bin", "secret.bin"} {
+			if err := storage.Delete("datasets", object); err != nil {
+				t.Fatalf("Failed to delete file: %v", err)
+			}
+		}
+
+		gc, err := storage.CollectGarbage(0)
+		if err != nil {
+			t.Fatalf("Failed to collect garbage: %v", err)
+		}
+		if gc.Manifests != 1 || gc.Chunks == 0 || gc.Blobs != 2 {
+			t.Errorf("Expected 1 manifest, its own chunks and 2 blobs freed, got %+v", gc)
+		}
+		if got := readObject(t, storage, "datasets", "v2.bin"); got != string(edited) {
+			t.Errorf("Expected v2.bin to survive garbage collection")
+		}
+
+		if err := storage.Delete("datasets", "v2.bin"); err != nil {
+			t.Fatalf("Failed to delete file: %v", err)
+		}
+		if _, err := storage.CollectGarbage(0); err != nil {
+			t.Fatalf("Failed to collect garbage: %v", err)
+		}
+		stats, err := storage.DedupStats()
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.Chunks != 0 {
+			t.Errorf("Expected every chunk to be collected, got %+v", stats)
+		}
+	})
+}
+
+func TestLocalStorage_RangeOnFileBackend(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+	data := randomBytes(3, 1000)
+	if _, err := storage.Save("bucket", "plain", bytes.NewReader(data)); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if got := readRange(t, storage, "bucket", "plain", 900, 50); !bytes.Equal(got, data[900:950]) {
+		t.Errorf("Range does not match")
+	}
+}
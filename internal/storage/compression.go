@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionGzip   = "gzip"
+	CompressionZstd   = "zstd"
+	CompressionSnappy = "snappy"
+)
+
+// CompressionConfig enables transparent compression for a bucket.
+type CompressionConfig struct {
+	Algorithm string `json:"algorithm"`
+}
+
+type ErrUnsupportedCompression struct {
+	Algorithm string
+}
+
+func (e *ErrUnsupportedCompression) Error() string {
+	return fmt.Sprintf("unsupported compression algorithm %q, expected one of gzip, zstd, snappy", e.Algorithm)
+}
+
+func validateCompression(algorithm string) error {
+	switch algorithm {
+	case CompressionGzip, CompressionZstd, CompressionSnappy:
+		return nil
+	default:
+		return &ErrUnsupportedCompression{Algorithm: algorithm}
+	}
+}
+
+// PutBucketCompression enables compression of objects saved to bucket from
+// now on. Existing objects are left as they are.
+func (l *LocalStorage) PutBucketCompression(bucket string, cfg *CompressionConfig) error {
+	if err := validateCompression(cfg.Algorithm); err != nil {
+		return err
+	}
+	return l.writeBucketConfig(bucket, "compression", cfg)
+}
+
+// GetBucketCompression returns the bucket's compression settings, or nil
+// when compression is disabled.
+func (l *LocalStorage) GetBucketCompression(bucket string) (*CompressionConfig, error) {
+	var cfg CompressionConfig
+	found, err := l.readBucketConfig(bucket, "compression", &cfg)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// DeleteBucketCompression disables compression for new objects. Compressed
+// objects stay readable.
+func (l *LocalStorage) DeleteBucketCompression(bucket string) error {
+	return l.deleteBucketConfig(bucket, "compression")
+}
+
+// incompressibleTypes are content types that are already compressed, so
+// compressing them again only burns CPU.
+var incompressibleTypes = []string{
+	"image/", "video/", "audio/",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"application/x-bzip2", "application/x-xz", "application/x-7z-compressed",
+	"application/vnd.rar", "application/x-rar-compressed", "application/pdf",
+	"font/woff", "font/woff2",
+}
+
+var incompressibleExtensions = map[string]bool{
+	".gz": true, ".tgz": true, ".zst": true, ".zip": true, ".bz2": true, ".xz": true,
+	".7z": true, ".rar": true, ".br": true, ".lz4": true, ".sz": true, ".snappy": true,
+}
+
+// isCompressible guesses whether an object is worth compressing, from its
+// name and from the first bytes of its content.
+func isCompressible(object string, head []byte) bool {
+	ext := strings.ToLower(filepath.Ext(object))
+	if incompressibleExtensions[ext] {
+		return false
+	}
+
+	for _, contentType := range []string{mime.TypeByExtension(ext), http.DetectContentType(head)} {
+		for _, prefix := range incompressibleTypes {
+			if strings.HasPrefix(contentType, prefix) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compressionFor picks the algorithm to store a new object with, or "" to
+// store it uncompressed. It returns a reader replaying the sniffed bytes.
+func (l *LocalStorage) compressionFor(bucket, object string, r io.Reader) (string, io.Reader, error) {
+	cfg, err := l.GetBucketCompression(bucket)
+	if err != nil || cfg == nil {
+		return "", r, err
+	}
+
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", nil, err
+	}
+	if !isCompressible(object, head) {
+		return "", br, nil
+	}
+	return cfg.Algorithm, br, nil
+}
+
+func newCompressWriter(w io.Writer, algorithm string) (io.WriteCloser, error) {
+	switch algorithm {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	case CompressionSnappy:
+		return snappy.NewBufferedWriter(w), nil
+	default:
+		return nil, &ErrUnsupportedCompression{Algorithm: algorithm}
+	}
+}
+
+func newDecompressReader(r io.Reader, algorithm string) (io.ReadCloser, error) {
+	switch algorithm {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case CompressionSnappy:
+		return io.NopCloser(snappy.NewReader(r)), nil
+	default:
+		return nil, &ErrUnsupportedCompression{Algorithm: algorithm}
+	}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
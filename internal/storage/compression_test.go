@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorage_Compression(t *testing.T) {
+	tempDir := t.TempDir()
+	storage := NewLocalStorage(tempDir, NewValueChecksum())
+	checksum := NewValueChecksum()
+
+	content := strings.Repeat(`{"level":"info","msg":"request served","status":200}`+"\n", 1000)
+	expectedChecksum, _ := checksum.Generate(strings.NewReader(content))
+
+	for _, algorithm := range []string{CompressionGzip, CompressionZstd, CompressionSnappy} {
+		t.Run(algorithm, func(t *testing.T) {
+			bucket := algorithm + "-bucket"
+			if err := storage.PutBucketCompression(bucket, &CompressionConfig{Algorithm: algorithm}); err != nil {
+				t.Fatalf("Failed to enable compression: %v", err)
+			}
+
+			info, err := storage.Save(bucket, "app.log", strings.NewReader(content))
+			if err != nil {
+				t.Fatalf("Failed to save file: %v", err)
+			}
+
+			if info.Compression != algorithm {
+				t.Errorf("Expected compression '%s', got '%s'", algorithm, info.Compression)
+			}
+			if info.Size != int64(len(content)) {
+				t.Errorf("Expected logical size %d, got %d", len(content), info.Size)
+			}
+			if info.Checksum != expectedChecksum {
+				t.Errorf("Expected checksum of the logical object, got '%s'", info.Checksum)
+			}
+
+			stat, err := os.Stat(info.Path)
+			if err != nil {
+				t.Fatalf("Failed to stat saved file: %v", err)
+			}
+			if stat.Size() != info.CompressedSize || stat.Size() >= info.Size {
+				t.Errorf("Expected %d compressed bytes on disk, got %d", info.CompressedSize, stat.Size())
+			}
+
+			file, objInfo, err := storage.Get(bucket, "app.log")
+			if err != nil {
+				t.Fatalf("Failed to get file: %v", err)
+			}
+			defer file.Close()
+			got, err := io.ReadAll(file)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(got) != content {
+				t.Errorf("Decompressed content does not match")
+			}
+			if objInfo.Size != int64(len(content)) {
+				t.Errorf("Expected logical size %d, got %d", len(content), objInfo.Size)
+			}
+
+			listed, err := storage.ListObjects(bucket)
+			if err != nil {
+				t.Fatalf("Failed to list objects: %v", err)
+			}
+			if len(listed) != 1 || listed[0].CompressedSize != info.CompressedSize {
+				t.Errorf("Expected listing to report the compressed size, got %+v", listed)
+			}
+		})
+	}
+
+	t.Run("Skips already compressed content", func(t *testing.T) {
+		if err := storage.PutBucketCompression("images", &CompressionConfig{Algorithm: CompressionZstd}); err != nil {
+			t.Fatalf("Failed to enable compression: %v", err)
+		}
+
+		png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 1024)...)
+		for _, object := range []string{"photo.jpg", "archive.tar.gz", "noextension"} {
+			body := []byte(content)
+			if object == "noextension" {
+				body = png
+			}
+			info, err := storage.Save("images", object, bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to save file: %v", err)
+			}
+			if info.Compression != "" {
+				t.Errorf("Expected %s to be stored uncompressed, got '%s'", object, info.Compression)
+			}
+		}
+	})
+
+	t.Run("Compresses and encrypts together", func(t *testing.T) {
+		key := bytes.Repeat([]byte("k"), 32)
+		info, err := storage.Save(CompressionZstd+"-bucket", "secret.log", strings.NewReader(content), WithSSECustomerKey(key))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if info.Compression != CompressionZstd {
+			t.Errorf("Expected zstd compression, got '%s'", info.Compression)
+		}
+
+		file, _, err := storage.Get(CompressionZstd+"-bucket", "secret.log", WithSSECustomerKey(key))
+		if err != nil {
+			t.Fatalf("Failed to get file: %v", err)
+		}
+		defer file.Close()
+		got, _ := io.ReadAll(file)
+		if string(got) != content {
+			t.Errorf("Content does not match after decrypt and decompress")
+		}
+	})
+
+	t.Run("Rejects unknown algorithms", func(t *testing.T) {
+		err := storage.PutBucketCompression("bucket", &CompressionConfig{Algorithm: "lzma"})
+		var unsupported *ErrUnsupportedCompression
+		if !errors.As(err, &unsupported) {
+			t.Errorf("Expected ErrUnsupportedCompression, got %v", err)
+		}
+	})
+}
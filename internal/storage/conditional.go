@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrPreconditionFailed is returned when the conditions of a request do not
+// hold for the object.
+var ErrPreconditionFailed = errors.New("at least one of the preconditions did not hold")
+
+// ErrNotModified is returned by a conditional Get or Head when the caller's
+// copy of the object is still current.
+var ErrNotModified = errors.New("the object was not modified")
+
+// Conditions make a request depend on the current state of an object, like
+// the If-Match, If-None-Match, If-Modified-Since and If-Unmodified-Since
+// headers of HTTP. IfMatch and IfNoneMatch take a comma-separated list of
+// ETags, quoted or not, or *.
+//
+// On Save, IfNoneMatch "*" only creates the object if it does not exist,
+// and IfMatch replaces it only if it still has the given ETag. Both are
+// checked under the object's lock, so concurrent writers cannot interleave.
+type Conditions struct {
+	IfMatch           string
+	IfNoneMatch       string
+	IfModifiedSince   time.Time
+	IfUnmodifiedSince time.Time
+}
+
+// Check evaluates the conditions against an object described by info, nil
+// when it does not exist, for Storage implementations keeping metadata of
+// their own. It fails like Get and Head when read is set, and like Save
+// otherwise.
+func (c *Conditions) Check(info *ObjectInfo, read bool) error {
+	if info == nil {
+		return c.check(nil, read)
+	}
+	return c.check(&objectMeta{ETag: info.ETag, CreatedAt: info.CreatedAt}, read)
+}
+
+// check evaluates the conditions against an object, whose metadata is nil
+// when it does not exist. Like S3, a matching If-Match overrides
+// If-Unmodified-Since, and a failing If-None-Match overrides
+// If-Modified-Since.
+//
+// When reading, a failing If-None-Match or If-Modified-Since means the
+// caller's copy is current and yields ErrNotModified. Every other failure
+// yields ErrPreconditionFailed.
+func (c *Conditions) check(meta *objectMeta, read bool) error {
+	if meta == nil {
+		// Nothing matches a missing object, and it has no dates
+		if c.IfMatch != "" {
+			return ErrPreconditionFailed
+		}
+		return nil
+	}
+
+	etag := meta.etag()
+	// HTTP dates have a precision of one second
+	modified := meta.CreatedAt.Truncate(time.Second)
+
+	if c.IfMatch != "" {
+		if !matchesETag(c.IfMatch, etag) {
+			return ErrPreconditionFailed
+		}
+	} else if !c.IfUnmodifiedSince.IsZero() && modified.After(c.IfUnmodifiedSince) {
+		return ErrPreconditionFailed
+	}
+
+	notModified := ErrPreconditionFailed
+	if read {
+		notModified = ErrNotModified
+	}
+	if c.IfNoneMatch != "" {
+		if matchesETag(c.IfNoneMatch, etag) {
+			return notModified
+		}
+	} else if !c.IfModifiedSince.IsZero() && !modified.After(c.IfModifiedSince) {
+		return notModified
+	}
+	return nil
+}
+
+// matchesETag reports whether a comma-separated list of quoted or bare
+// ETags includes etag, or is *. Weak ETags compare like strong ones, since
+// every ETag of an object is strong.
+func matchesETag(list, etag string) bool {
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+		value = strings.Trim(value, `"`)
+		if value == "*" || value == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etag returns the object's ETag. Objects saved before ETags were stored
+// get one derived from their checksum or, lacking that too, from their
+// size and modification time.
+func (m *objectMeta) etag() string {
+	switch {
+	case m.ETag != "":
+		return m.ETag
+	case len(m.Checksum) >= 32:
+		return m.Checksum[:32]
+	default:
+		return fmt.Sprintf("%x-%x", m.CreatedAt.UnixNano(), m.Size)
+	}
+}
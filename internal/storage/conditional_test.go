@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage_ETag(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+	sum := md5.Sum([]byte("v1"))
+
+	info, err := storage.Save("config", "app.json", strings.NewReader("v1"))
+	if err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if info.ETag != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected the MD5 of the content as ETag, got %q", info.ETag)
+	}
+
+	if err := storage.PutObjectTagging("config", "app.json", map[string]string{"env": "prod"}); err != nil {
+		t.Fatalf("Failed to tag: %v", err)
+	}
+	head, err := storage.Head("config", "app.json")
+	if err != nil {
+		t.Fatalf("Failed to head: %v", err)
+	}
+	if head.ETag != info.ETag {
+		t.Errorf("Expected metadata changes to keep the ETag, got %q", head.ETag)
+	}
+
+	updated, err := storage.Save("config", "app.json", strings.NewReader("v2"))
+	if err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if updated.ETag == info.ETag {
+		t.Errorf("Expected new content to change the ETag")
+	}
+}
+
+func TestLocalStorage_ConditionalGet(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+	info, err := storage.Save("config", "app.json", strings.NewReader("v1"))
+	if err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	hour := time.Hour
+
+	tests := []struct {
+		name       string
+		conditions Conditions
+		wantErr    error
+	}{
+		{"matching If-Match", Conditions{IfMatch: `"` + info.ETag + `"`}, nil},
+		{"other If-Match", Conditions{IfMatch: `"abc", "def"`}, ErrPreconditionFailed},
+		{"If-Match in a list", Conditions{IfMatch: `"abc", "` + info.ETag + `"`}, nil},
+		{"matching If-None-Match", Conditions{IfNoneMatch: info.ETag}, ErrNotModified},
+		{"weak If-None-Match", Conditions{IfNoneMatch: `W/"` + info.ETag + `"`}, ErrNotModified},
+		{"If-None-Match *", Conditions{IfNoneMatch: "*"}, ErrNotModified},
+		{"other If-None-Match", Conditions{IfNoneMatch: "abc"}, nil},
+		{"modified since", Conditions{IfModifiedSince: info.CreatedAt.Add(-hour)}, nil},
+		{"not modified since", Conditions{IfModifiedSince: info.CreatedAt.Add(hour)}, ErrNotModified},
+		{"unmodified since", Conditions{IfUnmodifiedSince: info.CreatedAt.Add(hour)}, nil},
+		{"modified after", Conditions{IfUnmodifiedSince: info.CreatedAt.Add(-hour)}, ErrPreconditionFailed},
+		{"If-None-Match overrides If-Modified-Since", Conditions{IfNoneMatch: "abc", IfModifiedSince: info.CreatedAt.Add(hour)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, _, err := storage.Get("config", "app.json", WithConditions(tt.conditions))
+			if reader != nil {
+				reader.Close()
+			}
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Get: expected %v, got %v", tt.wantErr, err)
+			}
+			if _, err := storage.Head("config", "app.json", WithConditions(tt.conditions)); !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Head: expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLocalStorage_ConditionalSave(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+
+	t.Run("Creates only once with If-None-Match *", func(t *testing.T) {
+		createOnly := WithConditions(Conditions{IfNoneMatch: "*"})
+		if _, err := storage.Save("config", "lock", strings.NewReader("owner-a"), createOnly); err != nil {
+			t.Fatalf("Failed to create: %v", err)
+		}
+		if _, err := storage.Save("config", "lock", strings.NewReader("owner-b"), createOnly); !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+		}
+		if got := readObject(t, storage, "config", "lock"); got != "owner-a" {
+			t.Errorf("Expected the first writer to win, got %q", got)
+		}
+	})
+
+	t.Run("Compares and swaps with If-Match", func(t *testing.T) {
+		v1, err := storage.Save("config", "app.json", strings.NewReader("v1"))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if _, err := storage.Save("config", "app.json", strings.NewReader("v2"), WithConditions(Conditions{IfMatch: v1.ETag})); err != nil {
+			t.Fatalf("Failed to swap: %v", err)
+		}
+		if _, err := storage.Save("config", "app.json", strings.NewReader("v3"), WithConditions(Conditions{IfMatch: v1.ETag})); !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("Expected a stale ETag to fail, got %v", err)
+		}
+		if _, err := storage.Save("config", "missing.json", strings.NewReader("v1"), WithConditions(Conditions{IfMatch: "*"})); !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("Expected If-Match on a missing object to fail, got %v", err)
+		}
+		if got := readObject(t, storage, "config", "app.json"); got != "v2" {
+			t.Errorf("Expected v2, got %q", got)
+		}
+	})
+
+	t.Run("Lets one of concurrent writers win", func(t *testing.T) {
+		base, err := storage.Save("config", "counter", strings.NewReader("0"))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		won := 0
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := storage.Save("config", "counter", strings.NewReader(string(rune('1'+i))), WithConditions(Conditions{IfMatch: base.ETag}))
+				if err == nil {
+					mu.Lock()
+					won++
+					mu.Unlock()
+				} else if !errors.Is(err, ErrPreconditionFailed) {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if won != 1 {
+			t.Errorf("Expected exactly one writer to win, got %d", won)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxUserMetadataSize is the S3 limit on the combined size of the keys and
+// values of an object's user-defined metadata.
+const maxUserMetadataSize = 2 << 10
+
+// ErrMetadataTooLarge is returned by Save when the user-defined metadata is
+// larger than 2 KiB.
+var ErrMetadataTooLarge = errors.New("user-defined metadata is larger than 2 KiB")
+
+// contentHeaders are the standard HTTP headers and user-defined metadata
+// stored with an object and returned when it is read.
+type contentHeaders struct {
+	ContentType        string            `json:"contentType,omitempty"`
+	ContentEncoding    string            `json:"contentEncoding,omitempty"`
+	ContentDisposition string            `json:"contentDisposition,omitempty"`
+	CacheControl       string            `json:"cacheControl,omitempty"`
+	Expires            *time.Time        `json:"expires,omitempty"`
+	UserMetadata       map[string]string `json:"userMetadata,omitempty"`
+}
+
+// newContentHeaders collects the headers given to Save, with user-defined
+// metadata keys lowercased as HTTP carries them.
+func newContentHeaders(o *Options) (contentHeaders, error) {
+	h := contentHeaders{
+		ContentType:        o.ContentType,
+		ContentEncoding:    o.ContentEncoding,
+		ContentDisposition: o.ContentDisposition,
+		CacheControl:       o.CacheControl,
+	}
+	if !o.Expires.IsZero() {
+		expires := o.Expires.UTC()
+		h.Expires = &expires
+	}
+
+	size := 0
+	for key, value := range o.UserMetadata {
+		if h.UserMetadata == nil {
+			h.UserMetadata = map[string]string{}
+		}
+		key = strings.ToLower(key)
+		h.UserMetadata[key] = value
+		size += len(key) + len(value)
+	}
+	if size > maxUserMetadataSize {
+		return contentHeaders{}, ErrMetadataTooLarge
+	}
+	return h, nil
+}
+
+// DetectContentType guesses the MIME type of an object from its extension,
+// or else from its first bytes. It returns a reader replaying the sniffed
+// bytes.
+func DetectContentType(object string, r io.Reader) (string, io.Reader, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(object)); contentType != "" {
+		return contentType, r, nil
+	}
+
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", nil, err
+	}
+	return http.DetectContentType(head), br, nil
+}
+
+func (info *ObjectInfo) setContentHeaders(h contentHeaders) {
+	info.ContentType = h.ContentType
+	info.ContentEncoding = h.ContentEncoding
+	info.ContentDisposition = h.ContentDisposition
+	info.CacheControl = h.CacheControl
+	if h.Expires != nil {
+		info.Expires = *h.Expires
+	}
+	info.UserMetadata = h.UserMetadata
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage_ContentHeaders(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+
+	t.Run("Detects the content type", func(t *testing.T) {
+		tests := []struct {
+			object  string
+			content string
+			opts    []Option
+			want    string
+		}{
+			{"page.html", "plain words", nil, "text/html; charset=utf-8"},
+			{"data.json", "{}", nil, "application/json"},
+			{"noext", "<html><body>hi</body></html>", nil, "text/html; charset=utf-8"},
+			{"blob", "\x00\x01\x02", nil, "application/octet-stream"},
+			{"given.txt", "x", []Option{WithContentType("application/x-custom")}, "application/x-custom"},
+		}
+		for _, tt := range tests {
+			info, err := storage.Save("site", tt.object, strings.NewReader(tt.content), tt.opts...)
+			if err != nil {
+				t.Fatalf("Failed to save %s: %v", tt.object, err)
+			}
+			if info.ContentType != tt.want {
+				t.Errorf("%s: expected %q, got %q", tt.object, tt.want, info.ContentType)
+			}
+			if got := readObject(t, storage, "site", tt.object); got != tt.content {
+				t.Errorf("%s: sniffing changed the content to %q", tt.object, got)
+			}
+		}
+	})
+
+	t.Run("Returns the saved headers and metadata", func(t *testing.T) {
+		expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		_, err := storage.Save("site", "report.csv.gz", strings.NewReader("x"),
+			WithContentType("text/csv"),
+			WithContentEncoding("gzip"),
+			WithContentDisposition(`attachment; filename="report.csv"`),
+			WithCacheControl("max-age=3600"),
+			WithExpires(expires),
+			WithUserMetadata(map[string]string{"Source": "crm"}),
+		)
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+
+		_, info, err := storage.Get("site", "report.csv.gz")
+		if err != nil {
+			t.Fatalf("Failed to get file: %v", err)
+		}
+		if info.ContentType != "text/csv" || info.ContentEncoding != "gzip" || info.ContentDisposition != `attachment; filename="report.csv"` ||
+			info.CacheControl != "max-age=3600" || !info.Expires.Equal(expires) {
+			t.Errorf("Expected the saved headers, got %+v", info)
+		}
+		if len(info.UserMetadata) != 1 || info.UserMetadata["source"] != "crm" {
+			t.Errorf("Expected lowercased metadata, got %v", info.UserMetadata)
+		}
+	})
+
+	t.Run("Rejects metadata over 2 KiB", func(t *testing.T) {
+		metadata := map[string]string{"big": strings.Repeat("x", 2048)}
+		if _, err := storage.Save("site", "x", strings.NewReader("x"), WithUserMetadata(metadata)); !errors.Is(err, ErrMetadataTooLarge) {
+			t.Errorf("Expected ErrMetadataTooLarge, got %v", err)
+		}
+	})
+}
+
+func TestLocalStorage_Head(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+
+	t.Run("Describes archived objects", func(t *testing.T) {
+		if _, err := storage.Save("bucket", "old-notes", strings.NewReader("archived"), WithStorageClass(StorageClassArchive)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		info, err := storage.Head("bucket", "old-notes")
+		if err != nil {
+			t.Fatalf("Failed to head file: %v", err)
+		}
+		if info.Size != 8 || info.StorageClass != StorageClassArchive || info.ContentType != "text/plain; charset=utf-8" {
+			t.Errorf("Expected the archived object's metadata, got %+v", info)
+		}
+	})
+
+	t.Run("Needs the customer key of SSE-C objects", func(t *testing.T) {
+		key := []byte(strings.Repeat("k", 32))
+		if _, err := storage.Save("bucket", "secret", strings.NewReader("x"), WithSSECustomerKey(key)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if _, err := storage.Head("bucket", "secret"); !errors.Is(err, ErrSSECustomerKeyMissing) {
+			t.Errorf("Expected ErrSSECustomerKeyMissing, got %v", err)
+		}
+		if _, err := storage.Head("bucket", "secret", WithSSECustomerKey(key)); err != nil {
+			t.Errorf("Expected head with the key to work, got %v", err)
+		}
+	})
+
+	t.Run("Fails on missing objects", func(t *testing.T) {
+		if _, err := storage.Head("bucket", "missing"); err == nil {
+			t.Errorf("Expected an error")
+		}
+	})
+}
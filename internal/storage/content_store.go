@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// contentStore keeps files named after the SHA-256 of their content, so
+// every distinct content is stored once.
+//
+// Next to every entry, a .refs file lists what references it, one per line.
+// Keeping the references themselves rather than a bare counter makes adding
+// and dropping them idempotent, so storing the same content twice under the
+// same reference, or retrying after a crash, never skews the count. Entries
+// whose reference list becomes empty are left for garbage collection.
+type contentStore struct {
+	root   string
+	dir    string
+	domain string
+}
+
+// newContentStore keeps entries under .mini-s3/<name>, locking them within
+// the given lock domain.
+func newContentStore(root, name, domain string) *contentStore {
+	return &contentStore{root: root, dir: filepath.Join(root, systemDir, name), domain: domain}
+}
+
+func (c *contentStore) lock(digest string) (func(), error) {
+	return lockKey(c.root, c.domain, digest, true)
+}
+
+func (c *contentStore) path(digest string) string {
+	return filepath.Join(c.dir, digest[:2], digest)
+}
+
+func (c *contentStore) refsPath(digest string) string {
+	return c.path(digest) + ".refs"
+}
+
+// putFile moves the file at path into the store under digest, unless that
+// content is already stored, and adds ref to its references.
+func (c *contentStore) putFile(digest, ref, path string) error {
+	unlock, err := c.lock(digest)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dst := c.path(digest)
+	if _, err := os.Stat(dst); err == nil {
+		// Same content is already stored, so the new copy is not needed
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	} else if errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(path, dst); err != nil {
+			return err
+		}
+	} else {
+		return err
+	}
+
+	return c.addRefLocked(digest, ref)
+}
+
+// putBytes stores data under digest, unless it is already stored, and adds
+// ref to its references.
+func (c *contentStore) putBytes(digest, ref string, data []byte) error {
+	if exists, err := c.addRef(digest, ref); err != nil || exists {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path(digest)), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path(digest)), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return c.putFile(digest, ref, tmp.Name())
+}
+
+// addRef adds ref to an entry if it exists, and reports whether it did.
+func (c *contentStore) addRef(digest, ref string) (bool, error) {
+	unlock, err := c.lock(digest)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(c.path(digest)); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, c.addRefLocked(digest, ref)
+}
+
+func (c *contentStore) addRefLocked(digest, ref string) error {
+	refs, err := c.readRefs(digest)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(refs, ref) {
+		refs = append(refs, ref)
+	}
+	// Rewritten even when unchanged, which tells garbage collection the
+	// entry was just used
+	return c.writeRefs(digest, refs)
+}
+
+// dropRef removes ref from an entry's references.
+func (c *contentStore) dropRef(digest, ref string) error {
+	unlock, err := c.lock(digest)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	refs, err := c.readRefs(digest)
+	if err != nil {
+		return err
+	}
+	return c.writeRefs(digest, slices.DeleteFunc(refs, func(r string) bool { return r == ref }))
+}
+
+func (c *contentStore) readRefs(digest string) ([]string, error) {
+	file, err := os.Open(c.refsPath(digest))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var refs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			refs = append(refs, line)
+		}
+	}
+	return refs, scanner.Err()
+}
+
+func (c *contentStore) writeRefs(digest string, refs []string) error {
+	data := strings.Join(refs, "\n")
+	if len(refs) > 0 {
+		data += "\n"
+	}
+	path := c.refsPath(digest)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// contentEntry describes one stored entry.
+type contentEntry struct {
+	digest  string
+	size    int64
+	refs    []string
+	refTime time.Time
+}
+
+// entries lists everything in the store.
+func (c *contentStore) entries() ([]contentEntry, error) {
+	var entries []contentEntry
+	err := filepath.WalkDir(c.dir, func(path string, d os.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.Contains(d.Name(), ".") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := contentEntry{digest: d.Name(), size: info.Size(), refTime: info.ModTime()}
+		if refsInfo, err := os.Stat(c.refsPath(entry.digest)); err == nil {
+			entry.refTime = refsInfo.ModTime()
+		}
+		if entry.refs, err = c.readRefs(entry.digest); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// prune drops the given stale references from an entry and deletes it once
+// nothing references it any more. It gives up if the references changed
+// after cutoff, since the staleness check may no longer hold. It reports
+// whether the entry was deleted.
+func (c *contentStore) prune(digest string, stale []string, cutoff time.Time) (bool, error) {
+	unlock, err := c.lock(digest)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if info, err := os.Stat(c.refsPath(digest)); err == nil && info.ModTime().After(cutoff) {
+		return false, nil
+	}
+
+	refs, err := c.readRefs(digest)
+	if err != nil {
+		return false, err
+	}
+	refs = slices.DeleteFunc(refs, func(r string) bool { return slices.Contains(stale, r) })
+	if len(refs) > 0 {
+		return false, c.writeRefs(digest, refs)
+	}
+
+	if err := os.Remove(c.path(digest)); err != nil {
+		return false, err
+	}
+	if err := os.Remove(c.refsPath(digest)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	return true, nil
+}
+
+// collectStats reports what collect removed from one store.
+type collectStats struct {
+	deleted    int
+	freedBytes int64
+	staleRefs  int
+	skipped    int
+}
+
+// collect checks every reference of every entry with isLive, drops the
+// stale ones and deletes entries left without references. Entries whose
+// references changed after cutoff are skipped.
+func (c *contentStore) collect(cutoff time.Time, isLive func(digest, ref string) (bool, error)) (*collectStats, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &collectStats{}
+	for _, entry := range entries {
+		if entry.refTime.After(cutoff) {
+			stats.skipped++
+			continue
+		}
+
+		var stale []string
+		for _, ref := range entry.refs {
+			live, err := isLive(entry.digest, ref)
+			if err != nil {
+				return stats, err
+			}
+			if !live {
+				stale = append(stale, ref)
+			}
+		}
+		if len(stale) == 0 && len(entry.refs) > 0 {
+			continue
+		}
+
+		deleted, err := c.prune(entry.digest, stale, cutoff)
+		if err != nil {
+			return stats, err
+		}
+		stats.staleRefs += len(stale)
+		if deleted {
+			stats.deleted++
+			stats.freedBytes += entry.size
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,365 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// MetadataDirectiveCopy keeps the source's content headers and
+	// user-defined metadata on the copy.
+	MetadataDirectiveCopy = "COPY"
+	// MetadataDirectiveReplace takes them from the copy request instead.
+	MetadataDirectiveReplace = "REPLACE"
+)
+
+// ErrInvalidCopy is returned when copying an object onto itself without
+// changing anything.
+var ErrInvalidCopy = errors.New("an object can only be copied onto itself to change its metadata or storage class")
+
+type ErrInvalidMetadataDirective struct {
+	Directive string
+}
+
+func (e *ErrInvalidMetadataDirective) Error() string {
+	return fmt.Sprintf("invalid metadata directive %q, expected %s or %s", e.Directive, MetadataDirectiveCopy, MetadataDirectiveReplace)
+}
+
+// CopyObject copies an object, within a bucket or across buckets, without
+// the data leaving the storage.
+//
+// The stored bytes are reused as they are whenever the copy keeps the
+// source's encryption: plain files are reflinked or hard linked, and
+// deduplicated objects only gain a reference. Otherwise, like when the
+// copy is encrypted with another customer key, the object is read and
+// saved again.
+//
+// Content headers and user-defined metadata follow the metadata directive;
+// tags are copied unless WithTags gives new ones. Like S3, the copy is
+// STANDARD unless WithStorageClass says otherwise, and gets the object lock
+// settings of the destination bucket rather than those of the source.
+func (l *LocalStorage) CopyObject(srcBucket, srcObject, dstBucket, dstObject string, opts ...Option) (*ObjectInfo, error) {
+	if err := validateObjectName(srcBucket, srcObject); err != nil {
+		return nil, err
+	}
+	if err := validateObjectName(dstBucket, dstObject); err != nil {
+		return nil, err
+	}
+	o := NewOptions(opts...)
+
+	directive := o.MetadataDirective
+	if directive == "" {
+		directive = MetadataDirectiveCopy
+	}
+	if directive != MetadataDirectiveCopy && directive != MetadataDirectiveReplace {
+		return nil, &ErrInvalidMetadataDirective{Directive: directive}
+	}
+	if srcBucket == dstBucket && srcObject == dstObject && directive == MetadataDirectiveCopy && o.StorageClass == "" {
+		return nil, ErrInvalidCopy
+	}
+
+	class := StorageClassStandard
+	if o.StorageClass != "" {
+		class = o.StorageClass
+	}
+	if err := validateStorageClass(class); err != nil {
+		return nil, err
+	}
+	if err := ValidateTags(o.Tags); err != nil {
+		return nil, err
+	}
+	retention, legalHold, err := l.lockSettings(dstBucket, o, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	staged, err := l.stageCopy(srcBucket, srcObject, o)
+	if err != nil {
+		return nil, err
+	}
+	if staged.path == "" {
+		return l.copyBySaving(srcBucket, srcObject, dstBucket, dstObject, staged.meta, directive, o)
+	}
+	defer os.Remove(staged.path)
+
+	src := staged.meta
+	meta := &objectMeta{
+		Size:           src.Size,
+		Checksum:       src.Checksum,
+		ETag:           src.etag(),
+		CreatedAt:      time.Now(),
+		Encryption:     src.Encryption,
+		Compression:    src.Compression,
+		CompressedSize: src.CompressedSize,
+		Retention:      retention,
+		LegalHold:      legalHold,
+		Tags:           src.Tags,
+		contentHeaders: src.contentHeaders,
+	}
+	if class != StorageClassStandard {
+		meta.StorageClass = class
+	}
+	if len(o.Tags) > 0 {
+		meta.Tags = o.Tags
+	}
+	if directive == MetadataDirectiveReplace {
+		if meta.contentHeaders, err = replacedHeaders(dstObject, src, o); err != nil {
+			return nil, err
+		}
+	}
+
+	unlock, err := l.lockObject(dstBucket, dstObject, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	previous, err := l.loadMeta(dstBucket, dstObject)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if o.Conditions != nil {
+		if err := o.Conditions.check(previous, false); err != nil {
+			return nil, err
+		}
+	}
+	if previous != nil {
+		if err := previous.checkLock(time.Now(), o.BypassGovernanceRetention); err != nil {
+			return nil, err
+		}
+	}
+
+	meta.Backend = l.backendFor(class)
+	digest := staged.digest
+	if digest == "" {
+		if digest, err = fileDigest(staged.path); err != nil {
+			return nil, err
+		}
+	}
+	if meta.Locator, err = l.backends[meta.Backend].Put(dstBucket, dstObject, staged.path, digest); err != nil {
+		return nil, err
+	}
+	if err := l.writeMeta(dstBucket, dstObject, meta); err != nil {
+		return nil, err
+	}
+	if err := l.releasePrevious(dstBucket, dstObject, previous, meta); err != nil {
+		return nil, err
+	}
+	l.publish(dstBucket, dstObject, EventObjectCreatedCopy, previous, meta)
+	return l.newObjectInfo(dstBucket, dstObject, meta), nil
+}
+
+// stagedCopy is the source of a copy, read under the source's lock.
+type stagedCopy struct {
+	meta *objectMeta
+	// path holds the source's stored bytes, ready to hand to a backend, or
+	// is empty when the copy has to be saved again.
+	path string
+	// digest is the hex SHA-256 of the stored bytes, or empty if it is not
+	// known without reading them.
+	digest string
+}
+
+// stageCopy checks the source of a copy against the request, and links or
+// copies its stored bytes into a temporary file. The source lock is only
+// held meanwhile, so a copy never holds two object locks at once.
+func (l *LocalStorage) stageCopy(bucket, object string, o *Options) (*stagedCopy, error) {
+	unlock, err := l.lockObject(bucket, object, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	if o.CopyConditions != nil {
+		if err := o.CopyConditions.check(meta, false); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := l.dataKey(meta, &Options{SSECustomerKey: o.CopySourceSSECustomerKey}); err != nil {
+		return nil, err
+	}
+	backend, locator, err := meta.readLocation(bucket, object, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.keepsEncryption(meta, o) {
+		return &stagedCopy{meta: meta}, nil
+	}
+
+	file, err := l.createTemp()
+	if err != nil {
+		return nil, err
+	}
+	path := file.Name()
+	file.Close()
+
+	if src := l.backends[backend].Path(locator); src != "" {
+		err = cloneFile(src, path)
+	} else {
+		err = l.copyStored(backend, locator, path)
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	staged := &stagedCopy{meta: meta, path: path}
+	// Content-addressed backends locate bytes by their digest
+	if backend == backendBlob || backend == backendChunk {
+		staged.digest = locator
+	}
+	return staged, nil
+}
+
+// keepsEncryption reports whether a copy is encrypted the same way as its
+// source, so the stored bytes can be reused.
+func (l *LocalStorage) keepsEncryption(meta *objectMeta, o *Options) bool {
+	if enc := meta.Encryption; enc != nil && enc.KeyMD5 != "" {
+		return o.SSECustomerKey != nil && SSECustomerKeyMD5(o.SSECustomerKey) == enc.KeyMD5
+	}
+	if o.SSECustomerKey != nil {
+		return false
+	}
+	// Unencrypted objects get encrypted once encryption at rest is on
+	return meta.Encryption != nil || l.keyring == nil
+}
+
+// copyStored writes the stored bytes behind locator to path.
+func (l *LocalStorage) copyStored(backend, locator, path string) error {
+	src, err := l.backends[backend].Open(locator)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// copyBySaving copies an object by reading it and saving it again, for
+// copies that change its encryption.
+func (l *LocalStorage) copyBySaving(srcBucket, srcObject, dstBucket, dstObject string, src *objectMeta, directive string, o *Options) (*ObjectInfo, error) {
+	reader, _, err := l.Get(srcBucket, srcObject, WithSSECustomerKey(o.CopySourceSSECustomerKey))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	dst := *o
+	dst.CopyConditions = nil
+	dst.event = EventObjectCreatedCopy
+	// Conditions on the destination are left for Save to check under its lock
+	if len(dst.Tags) == 0 {
+		dst.Tags = src.Tags
+	}
+	headers := src.contentHeaders
+	if directive == MetadataDirectiveReplace {
+		if headers, err = replacedHeaders(dstObject, src, o); err != nil {
+			return nil, err
+		}
+	}
+	dst.ContentType = headers.ContentType
+	dst.ContentEncoding = headers.ContentEncoding
+	dst.ContentDisposition = headers.ContentDisposition
+	dst.CacheControl = headers.CacheControl
+	dst.Expires = time.Time{}
+	if headers.Expires != nil {
+		dst.Expires = *headers.Expires
+	}
+	dst.UserMetadata = headers.UserMetadata
+
+	return l.Save(dstBucket, dstObject, reader, func(opts *Options) { *opts = dst })
+}
+
+// replacedHeaders returns the content headers a copy gets under the
+// REPLACE directive: those of the request, with the content type guessed
+// from the destination key, or kept from the source, when not given.
+func replacedHeaders(object string, src *objectMeta, o *Options) (contentHeaders, error) {
+	headers, err := newContentHeaders(o)
+	if err != nil {
+		return contentHeaders{}, err
+	}
+	if headers.ContentType == "" {
+		headers.ContentType = mime.TypeByExtension(filepath.Ext(object))
+	}
+	if headers.ContentType == "" {
+		headers.ContentType = src.ContentType
+	}
+	return headers, nil
+}
+
+// cloneFile makes dst a copy of src as cheaply as the file system allows:
+// a reflink sharing src's extents, else a hard link, else a full copy.
+// Stored objects are never modified in place, so sharing their data is
+// safe.
+func cloneFile(src, dst string) error {
+	if err := os.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := reflink(out, in); err == nil {
+		return out.Close()
+	}
+	out.Close()
+	if err := os.Remove(dst); err != nil {
+		return err
+	}
+
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	out, err = os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// fileDigest returns the hex SHA-256 of a file's contents.
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage_CopyObject(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+	content := "quarterly numbers"
+
+	src, err := storage.Save("reports", "q1.csv", strings.NewReader(content),
+		WithContentType("text/csv"),
+		WithUserMetadata(map[string]string{"owner": "finance"}),
+		WithTags(map[string]string{"team": "finance"}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	t.Run("Copies content, metadata and tags", func(t *testing.T) {
+		info, err := storage.CopyObject("reports", "q1.csv", "backup", "2024/q1.csv")
+		if err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+		if got := readObject(t, storage, "backup", "2024/q1.csv"); got != content {
+			t.Errorf("Expected %q, got %q", content, got)
+		}
+		if info.Checksum != src.Checksum || info.Size != src.Size {
+			t.Errorf("Expected checksum %s and size %d, got %+v", src.Checksum, src.Size, info)
+		}
+		if info.ContentType != "text/csv" || info.UserMetadata["owner"] != "finance" || info.Tags["team"] != "finance" {
+			t.Errorf("Expected the source's metadata, got %+v", info)
+		}
+		if !info.CreatedAt.After(src.CreatedAt) {
+			t.Errorf("Expected the copy to be newer than its source")
+		}
+	})
+
+	t.Run("Shares the stored file and survives the source's deletion", func(t *testing.T) {
+		info, err := storage.CopyObject("reports", "q1.csv", "reports", "q1-copy.csv")
+		if err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+		srcStat, err := os.Stat(src.Path)
+		if err != nil {
+			t.Fatalf("Failed to stat source: %v", err)
+		}
+		dstStat, err := os.Stat(info.Path)
+		if err != nil {
+			t.Fatalf("Failed to stat copy: %v", err)
+		}
+		// A reflink gets its own inode, a hard link shares the source's
+		if !os.SameFile(srcStat, dstStat) && dstStat.Size() != srcStat.Size() {
+			t.Errorf("Expected the copy to share the source's bytes")
+		}
+
+		if _, err := storage.Save("scratch", "tmp", strings.NewReader(content)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if _, err := storage.CopyObject("scratch", "tmp", "scratch", "kept"); err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+		if err := storage.Delete("scratch", "tmp"); err != nil {
+			t.Fatalf("Failed to delete source: %v", err)
+		}
+		if got := readObject(t, storage, "scratch", "kept"); got != content {
+			t.Errorf("Expected the copy to outlive its source, got %q", got)
+		}
+	})
+
+	t.Run("Replaces metadata with the REPLACE directive", func(t *testing.T) {
+		info, err := storage.CopyObject("reports", "q1.csv", "reports", "q1.csv",
+			WithMetadataDirective(MetadataDirectiveReplace),
+			WithUserMetadata(map[string]string{"reviewed": "yes"}),
+		)
+		if err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+		if info.UserMetadata["reviewed"] != "yes" || info.UserMetadata["owner"] != "" {
+			t.Errorf("Expected only the new metadata, got %v", info.UserMetadata)
+		}
+		if !strings.HasPrefix(info.ContentType, "text/csv") {
+			t.Errorf("Expected the content type from the key, got %q", info.ContentType)
+		}
+		if info.Tags["team"] != "finance" {
+			t.Errorf("Expected tags to be kept, got %v", info.Tags)
+		}
+		if got := readObject(t, storage, "reports", "q1.csv"); got != content {
+			t.Errorf("Expected %q, got %q", content, got)
+		}
+	})
+
+	t.Run("Rejects invalid copies", func(t *testing.T) {
+		if _, err := storage.CopyObject("reports", "q1.csv", "reports", "q1.csv"); !errors.Is(err, ErrInvalidCopy) {
+			t.Errorf("Expected ErrInvalidCopy, got %v", err)
+		}
+		var invalid *ErrInvalidMetadataDirective
+		if _, err := storage.CopyObject("reports", "q1.csv", "reports", "x", WithMetadataDirective("MERGE")); !errors.As(err, &invalid) {
+			t.Errorf("Expected ErrInvalidMetadataDirective, got %v", err)
+		}
+		if _, err := storage.CopyObject("reports", "missing", "reports", "x"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected os.ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("Checks the copy conditions", func(t *testing.T) {
+		current, err := storage.Head("reports", "q1.csv")
+		if err != nil {
+			t.Fatalf("Failed to head: %v", err)
+		}
+		hour := time.Hour
+		tests := []struct {
+			name       string
+			conditions Conditions
+			wantErr    bool
+		}{
+			{"matching If-Match", Conditions{IfMatch: `"` + current.ETag + `"`}, false},
+			{"other If-Match", Conditions{IfMatch: "abc"}, true},
+			{"If-Match *", Conditions{IfMatch: "*"}, false},
+			{"matching If-None-Match", Conditions{IfNoneMatch: current.ETag}, true},
+			{"modified since", Conditions{IfModifiedSince: current.CreatedAt.Add(-hour)}, false},
+			{"not modified since", Conditions{IfModifiedSince: current.CreatedAt.Add(hour)}, true},
+			{"unmodified since", Conditions{IfUnmodifiedSince: current.CreatedAt.Add(hour)}, false},
+			{"modified after", Conditions{IfUnmodifiedSince: current.CreatedAt.Add(-hour)}, true},
+			{"If-Match overrides If-Unmodified-Since", Conditions{IfMatch: current.ETag, IfUnmodifiedSince: current.CreatedAt.Add(-hour)}, false},
+		}
+		for _, tt := range tests {
+			_, err := storage.CopyObject("reports", "q1.csv", "reports", "conditional", WithCopyConditions(tt.conditions))
+			if tt.wantErr != errors.Is(err, ErrPreconditionFailed) || (!tt.wantErr && err != nil) {
+				t.Errorf("%s: wantErr %v, got %v", tt.name, tt.wantErr, err)
+			}
+		}
+	})
+
+	t.Run("Refuses archived sources", func(t *testing.T) {
+		if _, err := storage.Save("reports", "2019.csv", strings.NewReader("old"), WithStorageClass(StorageClassArchive)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if _, err := storage.CopyObject("reports", "2019.csv", "reports", "2019-copy.csv"); !errors.Is(err, ErrInvalidObjectState) {
+			t.Errorf("Expected ErrInvalidObjectState, got %v", err)
+		}
+	})
+
+	t.Run("Respects object lock on the destination", func(t *testing.T) {
+		cfg := &ObjectLockConfiguration{ObjectLockEnabled: ObjectLockEnabled}
+		if err := storage.PutObjectLockConfiguration("vault", cfg); err != nil {
+			t.Fatalf("Failed to enable object lock: %v", err)
+		}
+		if _, err := storage.CopyObject("reports", "q1.csv", "vault", "q1.csv", WithLegalHold()); err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+		if _, err := storage.CopyObject("reports", "q1.csv", "vault", "q1.csv"); !errors.Is(err, ErrObjectLocked) {
+			t.Errorf("Expected ErrObjectLocked, got %v", err)
+		}
+	})
+}
+
+func TestLocalStorage_CopyObjectDeduplicated(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum(), WithDeduplication())
+	content := strings.Repeat("artifact ", 100)
+
+	src, err := storage.Save("artifacts", "a.bin", strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	info, err := storage.CopyObject("artifacts", "a.bin", "releases", "a.bin")
+	if err != nil {
+		t.Fatalf("Failed to copy: %v", err)
+	}
+	if info.Path != src.Path {
+		t.Errorf("Expected the copy to share blob %s, got %s", src.Path, info.Path)
+	}
+
+	stats, err := storage.DedupStats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Objects != 2 || stats.Blobs != 1 {
+		t.Errorf("Expected 2 objects in 1 blob, got %+v", stats)
+	}
+}
+
+func TestLocalStorage_CopyObjectSSECustomerKey(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+	key := bytes.Repeat([]byte("k"), 32)
+	otherKey := bytes.Repeat([]byte("o"), 32)
+	content := "top secret content"
+
+	if _, err := storage.Save("secrets", "a", strings.NewReader(content), WithSSECustomerKey(key)); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	t.Run("Needs the source key", func(t *testing.T) {
+		if _, err := storage.CopyObject("secrets", "a", "secrets", "b"); !errors.Is(err, ErrSSECustomerKeyMissing) {
+			t.Errorf("Expected ErrSSECustomerKeyMissing, got %v", err)
+		}
+	})
+
+	t.Run("Keeps the key", func(t *testing.T) {
+		info, err := storage.CopyObject("secrets", "a", "secrets", "b", WithCopySourceSSECustomerKey(key), WithSSECustomerKey(key))
+		if err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+		if info.SSECustomerKeyMD5 != SSECustomerKeyMD5(key) {
+			t.Errorf("Expected the copy under the same key, got %q", info.SSECustomerKeyMD5)
+		}
+		if got := readObject(t, storage, "secrets", "b", WithSSECustomerKey(key)); got != content {
+			t.Errorf("Expected %q, got %q", content, got)
+		}
+	})
+
+	t.Run("Re-encrypts under a new key", func(t *testing.T) {
+		if _, err := storage.CopyObject("secrets", "a", "secrets", "c", WithCopySourceSSECustomerKey(key), WithSSECustomerKey(otherKey)); err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+		if got := readObject(t, storage, "secrets", "c", WithSSECustomerKey(otherKey)); got != content {
+			t.Errorf("Expected %q, got %q", content, got)
+		}
+		if _, _, err := storage.Get("secrets", "c", WithSSECustomerKey(key)); !errors.Is(err, ErrSSECustomerKeyMismatch) {
+			t.Errorf("Expected ErrSSECustomerKeyMismatch with the old key, got %v", err)
+		}
+	})
+
+	t.Run("Decrypts when no key is given", func(t *testing.T) {
+		if _, err := storage.CopyObject("secrets", "a", "public", "a", WithCopySourceSSECustomerKey(key)); err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+		if got := readObject(t, storage, "public", "a"); got != content {
+			t.Errorf("Expected %q, got %q", content, got)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Encrypted objects are stored as a sequence of AES-256-GCM sealed segments.
+// Every object gets its own random data key, so the nonce only has to be
+// unique within the object: it is built from the segment index and a flag
+// marking the final segment, which also protects against truncation.
+const (
+	dataKeySize = 32
+	segmentSize = 64 * 1024
+)
+
+var ErrDecrypt = errors.New("object data could not be decrypted")
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newDataKey() ([]byte, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// sealKey wraps a data key with a key-encryption key.
+func sealKey(kek, dataKey []byte) ([]byte, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+// openKey unwraps a data key sealed with sealKey.
+func openKey(kek, sealed []byte) ([]byte, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return dataKey, nil
+}
+
+func segmentNonce(size int, index uint32, final bool) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint32(nonce[size-5:], index)
+	if final {
+		nonce[size-1] = 1
+	}
+	return nonce
+}
+
+type encryptWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	index uint32
+}
+
+// newEncryptWriter returns a writer that encrypts everything written to it
+// into w. Close must be called to flush the final segment; it does not
+// close w.
+func newEncryptWriter(w io.Writer, dataKey []byte) (io.WriteCloser, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, segmentSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full segment is only flushed once more data arrives, so that the
+		// last one can always be marked as final on Close.
+		if len(e.buf) == segmentSize {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):segmentSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) flush(final bool) error {
+	nonce := segmentNonce(e.aead.NonceSize(), e.index, final)
+	sealed := e.aead.Seal(nil, nonce, e.buf, nil)
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.index++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.flush(true)
+}
+
+type decryptReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	plain []byte
+	index uint32
+	done  bool
+}
+
+// newDecryptReader returns a reader yielding the plaintext of data written by
+// an encryptWriter with the same data key.
+func newDecryptReader(r io.Reader, dataKey []byte) (io.Reader, error) {
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		r:    bufio.NewReader(r),
+		aead: aead,
+		buf:  make([]byte, segmentSize+aead.Overhead()),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.r, d.buf)
+	final := false
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		final = true
+	case err == io.EOF:
+		// Every stream ends with a final segment, so running out of data
+		// here means it was truncated.
+		return ErrDecrypt
+	case err != nil:
+		return err
+	default:
+		if _, err := d.r.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	nonce := segmentNonce(d.aead.NonceSize(), d.index, final)
+	plain, err := d.aead.Open(d.buf[:0], nonce, d.buf[:n], nil)
+	if err != nil {
+		return ErrDecrypt
+	}
+	d.plain = plain
+	d.index++
+	d.done = final
+	return nil
+}
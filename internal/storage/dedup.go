@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultGarbageGrace is how long an unreferenced blob or chunk is kept
+// before CollectGarbage deletes it. It covers saves that have stored their
+// data but not yet written the metadata pointing at it.
+const DefaultGarbageGrace = 10 * time.Minute
+
+// DedupStats compares the bytes objects represent with the bytes they take.
+type DedupStats struct {
+	Objects int
+	// LogicalBytes is the total size of all objects as clients see them.
+	LogicalBytes int64
+	// StoredBytes is what the objects' data would take without
+	// deduplication, after compression.
+	StoredBytes int64
+	// PhysicalBytes is what the objects' data actually takes on disk.
+	PhysicalBytes int64
+
+	Blobs             int
+	DedupedObjects    int
+	UnreferencedBlobs int
+
+	Chunks             int
+	ChunkedObjects     int
+	UnreferencedChunks int
+
+	ReclaimableBytes int64
+}
+
+// Ratio is the deduplication ratio, stored over physical bytes.
+func (s *DedupStats) Ratio() float64 {
+	if s.PhysicalBytes == 0 {
+		return 1
+	}
+	return float64(s.StoredBytes) / float64(s.PhysicalBytes)
+}
+
+// GarbageStats reports what CollectGarbage removed.
+type GarbageStats struct {
+	Blobs      int
+	Manifests  int
+	Chunks     int
+	FreedBytes int64
+	StaleRefs  int
+	// Skipped counts entries left alone because their references changed
+	// within the grace period.
+	Skipped int
+}
+
+// dedupBackend reports whether a backend shares identical stored bytes
+// between objects.
+func dedupBackend(name string) bool {
+	return name == backendBlob || name == backendChunk
+}
+
+func (l *LocalStorage) blobs() *blobBackend {
+	return l.backends[backendBlob].(*blobBackend)
+}
+
+func (l *LocalStorage) chunks() *chunkBackend {
+	return l.backends[backendChunk].(*chunkBackend)
+}
+
+// DedupStats walks every object, blob and chunk and reports how much space
+// deduplication saves.
+func (l *LocalStorage) DedupStats() (*DedupStats, error) {
+	blobs, err := l.blobs().store.entries()
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := l.chunks().chunks.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DedupStats{Blobs: len(blobs), Chunks: len(chunks)}
+	blobSizes := map[string]int64{}
+	for _, blob := range blobs {
+		blobSizes[blob.digest] = blob.size
+		stats.PhysicalBytes += blob.size
+		if len(blob.refs) == 0 {
+			stats.UnreferencedBlobs++
+			stats.ReclaimableBytes += blob.size
+		}
+	}
+	for _, chunk := range chunks {
+		stats.PhysicalBytes += chunk.size
+		if len(chunk.refs) == 0 {
+			stats.UnreferencedChunks++
+			stats.ReclaimableBytes += chunk.size
+		}
+	}
+
+	err = l.walkObjects("", "", func(bucket, object string) error {
+		meta, err := l.loadMeta(bucket, object)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		stats.Objects++
+		stats.LogicalBytes += meta.Size
+
+		backend, locator := meta.location(bucket, object)
+		switch backend {
+		case backendBlob:
+			stats.DedupedObjects++
+			stats.StoredBytes += blobSizes[locator]
+			return nil
+		case backendChunk:
+			manifest, err := l.chunks().manifest(locator)
+			if err != nil {
+				return err
+			}
+			stats.ChunkedObjects++
+			stats.StoredBytes += manifest.Size
+			return nil
+		}
+
+		path := l.backends[backend].Path(locator)
+		if path == "" {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		stats.StoredBytes += info.Size()
+		stats.PhysicalBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// CollectGarbage deletes blobs and chunk manifests that no object
+// references any more, then chunks that no manifest references any more.
+// Each reference is checked against what it names, which also repairs
+// references leaked by saves that crashed halfway. Entries whose references
+// changed within the grace period are left alone, so an in-flight save
+// never loses its data.
+func (l *LocalStorage) CollectGarbage(grace time.Duration) (*GarbageStats, error) {
+	cutoff := time.Now().Add(-grace)
+	stats := &GarbageStats{}
+	add := func(collected *collectStats) {
+		stats.FreedBytes += collected.freedBytes
+		stats.StaleRefs += collected.staleRefs
+		stats.Skipped += collected.skipped
+	}
+
+	blobs, err := l.blobs().store.collect(cutoff, func(digest, ref string) (bool, error) {
+		return l.references(ref, backendBlob, digest)
+	})
+	if err != nil {
+		return stats, err
+	}
+	add(blobs)
+	stats.Blobs = blobs.deleted
+
+	// Manifests go before chunks, so the chunks of a manifest deleted now
+	// are collected in the same run
+	chunkStore := l.chunks()
+	manifests, err := chunkStore.manifests.collect(cutoff, func(digest, ref string) (bool, error) {
+		return l.references(ref, backendChunk, digest)
+	})
+	if err != nil {
+		return stats, err
+	}
+	add(manifests)
+	stats.Manifests = manifests.deleted
+
+	chunks, err := chunkStore.chunks.collect(cutoff, func(digest, ref string) (bool, error) {
+		_, err := os.Stat(chunkStore.manifests.path(ref))
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return stats, err
+	}
+	add(chunks)
+	stats.Chunks = chunks.deleted
+	return stats, nil
+}
+
+// references reports whether the object named by ref ("bucket/object")
+// currently points at locator in the given backend.
+func (l *LocalStorage) references(ref, backend, locator string) (bool, error) {
+	bucket, object, ok := strings.Cut(ref, "/")
+	if !ok {
+		return false, nil
+	}
+
+	unlock, err := l.lockObject(bucket, object, false)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	meta, err := l.readMeta(bucket, object)
+	if err != nil || meta == nil {
+		return false, err
+	}
+	return meta.Backend == backend && meta.Locator == locator, nil
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorage_Deduplication(t *testing.T) {
+	tempDir := t.TempDir()
+	storage := NewLocalStorage(tempDir, NewValueChecksum(), WithDeduplication())
+	content := strings.Repeat("artifact ", 1000)
+
+	var first *ObjectInfo
+	for _, object := range []string{"a.bin", "b.bin", "c.bin"} {
+		info, err := storage.Save("artifacts", object, strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if first == nil {
+			first = info
+		}
+		if info.Path != first.Path {
+			t.Errorf("Expected %s to share blob %s, got %s", object, first.Path, info.Path)
+		}
+	}
+
+	t.Run("Stores identical content once", func(t *testing.T) {
+		stats, err := storage.DedupStats()
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		size := int64(len(content))
+		if stats.Objects != 3 || stats.Blobs != 1 {
+			t.Errorf("Expected 3 objects in 1 blob, got %+v", stats)
+		}
+		if stats.LogicalBytes != 3*size || stats.StoredBytes != 3*size || stats.PhysicalBytes != size {
+			t.Errorf("Expected logical %d, stored %d, physical %d, got %+v", 3*size, 3*size, size, stats)
+		}
+		if got := readObject(t, storage, "artifacts", "b.bin"); got != content {
+			t.Errorf("Content does not match")
+		}
+	})
+
+	t.Run("Overwriting with the same content keeps one reference", func(t *testing.T) {
+		if _, err := storage.Save("artifacts", "a.bin", strings.NewReader(content)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		refs, err := storage.blobs().store.readRefs(first.Checksum)
+		if err != nil {
+			t.Fatalf("Failed to read refs: %v", err)
+		}
+		if len(refs) != 3 {
+			t.Errorf("Expected 3 references, got %v", refs)
+		}
+	})
+
+	t.Run("Collects blobs once unreferenced", func(t *testing.T) {
+		for _, object := range []string{"a.bin", "b.bin"} {
+			if err := storage.Delete("artifacts", object); err != nil {
+				t.Fatalf("Failed to delete file: %v", err)
+			}
+		}
+		if _, err := storage.Save("artifacts", "c.bin", strings.NewReader("new content")); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+
+		stats, err := storage.DedupStats()
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.UnreferencedBlobs != 1 || stats.ReclaimableBytes != int64(len(content)) {
+			t.Errorf("Expected the old blob to be reclaimable, got %+v", stats)
+		}
+
+		gc, err := storage.CollectGarbage(0)
+		if err != nil {
+			t.Fatalf("Failed to collect garbage: %v", err)
+		}
+		if gc.Blobs != 1 || gc.FreedBytes != int64(len(content)) {
+			t.Errorf("Expected 1 blob freed, got %+v", gc)
+		}
+		if _, err := os.Stat(first.Path); !os.IsNotExist(err) {
+			t.Errorf("Expected blob to be deleted, got %v", err)
+		}
+		if got := readObject(t, storage, "artifacts", "c.bin"); got != "new content" {
+			t.Errorf("Expected 'new content', got '%s'", got)
+		}
+	})
+
+	t.Run("Repairs references leaked by interrupted saves", func(t *testing.T) {
+		info, err := storage.Save("artifacts", "d.bin", strings.NewReader("leaky"))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		digest := info.Checksum
+		if err := storage.blobs().store.writeRefs(digest, []string{"artifacts/d.bin", "artifacts/ghost.bin"}); err != nil {
+			t.Fatalf("Failed to write refs: %v", err)
+		}
+
+		gc, err := storage.CollectGarbage(0)
+		if err != nil {
+			t.Fatalf("Failed to collect garbage: %v", err)
+		}
+		if gc.StaleRefs != 1 || gc.Blobs != 0 {
+			t.Errorf("Expected 1 stale reference and no blob freed, got %+v", gc)
+		}
+		refs, _ := storage.blobs().store.readRefs(digest)
+		if len(refs) != 1 || refs[0] != "artifacts/d.bin" {
+			t.Errorf("Expected only artifacts/d.bin to remain, got %v", refs)
+		}
+	})
+
+	t.Run("Shares encrypted objects only under the same key", func(t *testing.T) {
+		key := bytes.Repeat([]byte("k"), 32)
+		other := bytes.Repeat([]byte("o"), 32)
+		a, err := storage.Save("secrets", "a", strings.NewReader(content), WithSSECustomerKey(key))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		b, err := storage.Save("secrets", "b", strings.NewReader(content), WithSSECustomerKey(key))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		c, err := storage.Save("secrets", "c", strings.NewReader(content), WithSSECustomerKey(other))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if a.Path != b.Path {
+			t.Errorf("Expected objects encrypted with the same key to share a blob")
+		}
+		if a.Path == c.Path || c.Path == first.Path {
+			t.Errorf("Expected objects encrypted with another key, or not at all, stored separately")
+		}
+		if got := readObject(t, storage, "secrets", "b", WithSSECustomerKey(key)); got != content {
+			t.Errorf("Content does not match")
+		}
+		if _, _, err := storage.Get("secrets", "c", WithSSECustomerKey(key)); err == nil {
+			t.Errorf("Expected another key to be refused")
+		}
+	})
+}
+
+func TestLocalStorage_DeduplicationEncryptedAtRest(t *testing.T) {
+	keyring, err := LoadKeyring(filepath.Join(t.TempDir(), "keyring.json"))
+	if err != nil {
+		t.Fatalf("Failed to load keyring: %v", err)
+	}
+	if _, err := keyring.Rotate(); err != nil {
+		t.Fatalf("Failed to create a key: %v", err)
+	}
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum(), WithKeyring(keyring), WithDeduplication())
+	if err := storage.PutBucketCompression("artifacts", &CompressionConfig{Algorithm: CompressionZstd}); err != nil {
+		t.Fatalf("Failed to enable compression: %v", err)
+	}
+	content := strings.Repeat("artifact ", 1000)
+
+	var paths []string
+	for _, object := range []string{"a.txt", "b.txt"} {
+		info, err := storage.Save("artifacts", object, strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if info.ServerSideEncryption == "" || info.Compression == "" {
+			t.Fatalf("Expected the object compressed and encrypted, got %+v", info)
+		}
+		paths = append(paths, info.Path)
+	}
+	if paths[0] != paths[1] {
+		t.Errorf("Expected identical content to share a blob, got %v", paths)
+	}
+
+	// Rotation rewraps each object's data key, which stays the same
+	if _, err := storage.RotateKeys(); err != nil {
+		t.Fatalf("Failed to rotate keys: %v", err)
+	}
+	for _, object := range []string{"a.txt", "b.txt"} {
+		if got := readObject(t, storage, "artifacts", object); got != content {
+			t.Errorf("Content of %s does not match after rotation", object)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd || dragonfly)
+
+package storage
+
+import "errors"
+
+// Without statfs, free space is unknown, so placing objects by free space
+// falls back to hashing.
+func diskSpace(path string) (free, total int64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
+
+// Only failed health checks take disks offline here.
+func diskFailure(err error) bool {
+	return false
+}
@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package storage
+
+import (
+	"errors"
+	"syscall"
+)
+
+// diskSpace returns the bytes free and in all on the file system holding
+// path.
+func diskSpace(path string) (free, total int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), int64(st.Blocks) * int64(st.Bsize), nil
+}
+
+// diskFailure reports whether err comes from the disk itself failing, or
+// being gone, rather than from the request.
+func diskFailure(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.EROFS) ||
+		errors.Is(err, syscall.ENODEV) || errors.Is(err, syscall.ENXIO) || errors.Is(err, syscall.ESTALE)
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+)
+
+// ServerSideEncryptionAES256 is reported for objects encrypted at rest with
+// a master key, mirroring S3's SSE-S3.
+const ServerSideEncryptionAES256 = "AES256"
+
+var ErrNoKeyring = errors.New("object is encrypted at rest, but no keyring is configured")
+
+// newEncryption decides how a new object is encrypted: with the customer key
+// when one is supplied, otherwise with the active master key when encryption
+// at rest is enabled. It returns a nil data key for plaintext objects.
+func (l *LocalStorage) newEncryption(o *Options) (*encryptionMeta, []byte, error) {
+	if o.SSECustomerKey != nil {
+		return newSSECustomerEncryption(o.SSECustomerKey)
+	}
+	if l.keyring == nil {
+		return nil, nil, nil
+	}
+
+	if err := l.keyring.refresh(); err != nil {
+		return nil, nil, err
+	}
+	master := l.keyring.ActiveKey()
+	if master == nil {
+		return nil, nil, nil
+	}
+
+	dataKey, err := newDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed, err := sealKey(master.Key, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc := &encryptionMeta{
+		Algorithm:  ServerSideEncryptionAES256,
+		KeyVersion: master.Version,
+		SealedKey:  sealed,
+	}
+	return enc, dataKey, nil
+}
+
+// dataKey returns the key needed to decrypt an object, or nil when it is
+// stored in plaintext.
+func (l *LocalStorage) dataKey(meta *objectMeta, o *Options) ([]byte, error) {
+	if meta == nil || meta.Encryption == nil || meta.Encryption.KeyVersion == 0 {
+		return sseCustomerDataKey(meta, o.SSECustomerKey)
+	}
+	if o.SSECustomerKey != nil {
+		return nil, ErrSSECustomerKeyNotUsed
+	}
+	master, err := l.masterKey(meta.Encryption.KeyVersion)
+	if err != nil {
+		return nil, err
+	}
+	return openKey(master.Key, meta.Encryption.SealedKey)
+}
+
+func (l *LocalStorage) masterKey(version int) (*MasterKey, error) {
+	if l.keyring == nil {
+		return nil, ErrNoKeyring
+	}
+	master, err := l.keyring.Key(version)
+	if err == nil {
+		return master, nil
+	}
+	// The key may have been added by another process since we last looked.
+	if err := l.keyring.refresh(); err != nil {
+		return nil, err
+	}
+	return l.keyring.Key(version)
+}
+
+// convergeEncryption re-encrypts the stored bytes at path, written with
+// dataKey, with a data key derived from the object's logical content, and
+// seals that key in enc instead. Identical content saved with the same
+// master key version or customer key then has identical stored bytes,
+// which lets content-addressed backends share them; segment nonces only
+// have to be unique per key, and a key only ever encrypts one content. It
+// returns the digest of the new stored bytes.
+func (l *LocalStorage) convergeEncryption(path string, enc *encryptionMeta, dataKey []byte, o *Options, compression string, logical []byte) (string, error) {
+	kek := o.SSECustomerKey
+	if enc.KeyVersion != 0 {
+		master, err := l.masterKey(enc.KeyVersion)
+		if err != nil {
+			return "", err
+		}
+		kek = master.Key
+	}
+	mac := hmac.New(sha256.New, kek)
+	mac.Write([]byte("mini-s3 content data key\x00" + compression + "\x00"))
+	mac.Write(logical)
+	contentKey := mac.Sum(nil)
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	plain, err := newDecryptReader(src, dataKey)
+	if err != nil {
+		return "", err
+	}
+	dst, err := l.createTemp()
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+
+	// Still compressed, so only encryption is redone
+	w, err := newObjectWriter(dst, contentKey, "")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(w, plain); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(dst.Name(), path); err != nil {
+		return "", err
+	}
+
+	if enc.SealedKey, err = sealKey(kek, contentKey); err != nil {
+		return "", err
+	}
+	return w.digest(), nil
+}
@@ -0,0 +1,655 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/iamthiago/mini-s3/internal/erasure"
+)
+
+// erasureBlockSize is how many bytes of each data shard a stripe holds.
+// Stored bytes are encoded a stripe at a time, so reading and rebuilding
+// them never needs more than a stripe in memory.
+const erasureBlockSize = 64 << 10
+
+// erasureBackend splits stored bytes into data shards and computes parity
+// shards from them with a Reed-Solomon code, keeping each shard in a file
+// of its own, spread over disks. The bytes stay readable as long as no
+// more shards are lost than there are parity shards, and Heal rebuilds
+// the lost ones.
+//
+// A manifest in the data directory tells where each shard is, along with
+// its SHA-256 and a CRC-32C of each of its stripes. Reads check stripes as
+// they go, so corrupted ones are told apart from good ones without reading
+// whole shards first, and Heal checks whole shards. Every Put gets a new
+// locator, so overwriting an object never touches the shards of the
+// previous version while it may still be read.
+type erasureBackend struct {
+	coder *erasure.Coder
+	dir   string
+
+	// disks returns the directories new shards go to, and available
+	// whether the shards in one can be read.
+	disks     func() []string
+	available func(disk string) bool
+}
+
+// erasureManifest describes the shards of stored bytes. The layout is kept
+// with them, so they stay readable when the configured one changes.
+type erasureManifest struct {
+	Size   int64      `json:"size"`
+	Data   int        `json:"data"`
+	Parity int        `json:"parity"`
+	Shards []shardRef `json:"shards"`
+}
+
+type shardRef struct {
+	Disk     string `json:"disk"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+	// Stripes holds the CRC-32C of each stripe of the shard. Manifests
+	// written before there were stripe checksums have none.
+	Stripes []uint32 `json:"stripes,omitempty"`
+}
+
+var stripeTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksummed reports whether the manifest has stripe checksums.
+func (m *erasureManifest) checksummed() bool {
+	return len(m.Shards) > 0 && m.Shards[0].Stripes != nil
+}
+
+// WithErasureCoding stores object data erasure-coded with coder, its
+// shards spread over disks. Without disks, they go to the online disks of
+// WithDisks, given before, or stay in the data directory. Disks are best
+// given at least as many as there are shards, so losing one loses at most
+// one shard of each object.
+func WithErasureCoding(coder *erasure.Coder, disks ...string) LocalStorageOption {
+	return func(l *LocalStorage) {
+		l.backends[backendErasure] = newErasureBackend(l.path, coder, disks, l.disks)
+		l.defaultBackend = backendErasure
+	}
+}
+
+func newErasureBackend(root string, coder *erasure.Coder, disks []string, set *diskSet) *erasureBackend {
+	e := &erasureBackend{coder: coder, dir: filepath.Join(root, systemDir, "erasure")}
+	if len(disks) == 0 && set != nil {
+		shards := func(d *disk) string { return filepath.Join(d.path, systemDir, "shards") }
+		e.disks = func() []string {
+			var dirs []string
+			for _, d := range set.disks {
+				if d.isOnline() {
+					dirs = append(dirs, shards(d))
+				}
+			}
+			return dirs
+		}
+		e.available = func(dir string) bool {
+			for _, d := range set.disks {
+				if shards(d) == dir {
+					return d.isOnline()
+				}
+			}
+			return true
+		}
+		return e
+	}
+
+	if len(disks) == 0 {
+		disks = []string{filepath.Join(root, systemDir, "shards")}
+	}
+	e.disks = func() []string { return disks }
+	e.available = func(string) bool { return true }
+	return e
+}
+
+func (e *erasureBackend) manifestPath(locator string) string {
+	return filepath.Join(e.dir, locator[:2], locator+".json")
+}
+
+func shardPath(disk, locator string, i int) string {
+	return filepath.Join(disk, locator[:2], fmt.Sprintf("%s.%d", locator, i))
+}
+
+func (e *erasureBackend) Put(bucket, object, path, digest string) (string, error) {
+	defer os.Remove(path)
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	locator := hex.EncodeToString(id)
+
+	disks := e.disks()
+	if len(disks) == 0 {
+		return "", fmt.Errorf("%w: no disk is online for shards", ErrUnavailable)
+	}
+	// Shards start on a disk picked by the locator, so the first shards of
+	// every object do not all land on the first disks
+	h := fnv.New32a()
+	h.Write(id)
+	first := int(h.Sum32() % uint32(len(disks)))
+
+	manifest := &erasureManifest{Data: e.coder.DataShards(), Parity: e.coder.ParityShards()}
+	files := make([]*os.File, e.coder.Shards())
+	writers := make([]io.Writer, len(files))
+	hashes := make([]hash.Hash, len(files))
+	ok := false
+	defer func() {
+		for i, file := range files {
+			if file == nil {
+				continue
+			}
+			file.Close()
+			if !ok {
+				os.Remove(shardPath(manifest.Shards[i].Disk, locator, i))
+			}
+		}
+	}()
+	for i := range files {
+		disk := disks[(first+i)%len(disks)]
+		manifest.Shards = append(manifest.Shards, shardRef{Disk: disk})
+		dst := shardPath(disk, locator, i)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return "", err
+		}
+		if files[i], err = os.Create(dst); err != nil {
+			return "", err
+		}
+		hashes[i] = sha256.New()
+		writers[i] = io.MultiWriter(files[i], hashes[i])
+	}
+
+	stripe := make([]byte, e.coder.DataShards()*erasureBlockSize)
+	shards := make([][]byte, e.coder.Shards())
+	for {
+		n, err := io.ReadFull(src, stripe)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", err
+		}
+		manifest.Size += int64(n)
+
+		piece := e.split(stripe, n, shards)
+		if err := e.coder.Encode(shards); err != nil {
+			return "", err
+		}
+		for i, shard := range shards {
+			if _, err := writers[i].Write(shard); err != nil {
+				return "", err
+			}
+			manifest.Shards[i].Size += int64(piece)
+			manifest.Shards[i].Stripes = append(manifest.Shards[i].Stripes, crc32.Checksum(shard, stripeTable))
+		}
+		if n < len(stripe) {
+			break
+		}
+	}
+
+	for i, file := range files {
+		if err := file.Sync(); err != nil {
+			return "", err
+		}
+		manifest.Shards[i].Checksum = hex.EncodeToString(hashes[i].Sum(nil))
+	}
+	if err := e.writeManifest(locator, manifest); err != nil {
+		return "", err
+	}
+	ok = true
+	return locator, nil
+}
+
+// split cuts the first n bytes of a stripe into data shards of equal size,
+// zero padded, and returns that size.
+func (e *erasureBackend) split(stripe []byte, n int, shards [][]byte) int {
+	data := e.coder.DataShards()
+	piece := (n + data - 1) / data
+	clear(stripe[n : piece*data])
+	for i := range data {
+		shards[i] = stripe[i*piece : (i+1)*piece]
+	}
+	return piece
+}
+
+func (e *erasureBackend) writeManifest(locator string, manifest *erasureManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	path := e.manifestPath(locator)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (e *erasureBackend) manifest(locator string) (*erasureManifest, error) {
+	if len(locator) < 2 {
+		return nil, fmt.Errorf("invalid erasure locator %q", locator)
+	}
+	data, err := os.ReadFile(e.manifestPath(locator))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &erasureManifest{}
+	return manifest, json.Unmarshal(data, manifest)
+}
+
+// checkShard reports whether a shard is there with the size and checksum
+// it was stored with, on a disk that is online.
+func (e *erasureBackend) checkShard(locator string, i int, ref shardRef) bool {
+	if !e.available(ref.Disk) {
+		return false
+	}
+	file, err := os.Open(shardPath(ref.Disk, locator, i))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, file)
+	return err == nil && n == ref.Size && hex.EncodeToString(h.Sum(nil)) == ref.Checksum
+}
+
+// Open reads the stored bytes back. Shards that are missing, or on disks
+// that are offline, are left out; those of manifests without stripe
+// checksums are checked against their SHA-256 first, as they cannot be
+// checked stripe by stripe.
+func (e *erasureBackend) Open(locator string) (io.ReadCloser, error) {
+	manifest, err := e.manifest(locator)
+	if err != nil {
+		return nil, err
+	}
+	coder, err := erasure.New(manifest.Data, manifest.Parity)
+	if err != nil {
+		return nil, err
+	}
+
+	r := e.newReader(locator, manifest, coder)
+	good := 0
+	for i, ref := range manifest.Shards {
+		switch {
+		case r.failed[i]:
+		case manifest.checksummed():
+			info, err := os.Stat(r.paths[i])
+			r.failed[i] = err != nil || info.Size() != ref.Size
+		case good == manifest.Data:
+			// Any data shards are enough, so only that many are checked
+			r.failed[i] = true
+		default:
+			r.failed[i] = !e.checkShard(locator, i, ref)
+		}
+		if !r.failed[i] {
+			good++
+		}
+	}
+	if good < manifest.Data {
+		r.Close()
+		return nil, fmt.Errorf("%w: %d of the %d shards of %s are intact, %d needed", erasure.ErrTooFewShards, good, len(manifest.Shards), locator, manifest.Data)
+	}
+	return r, nil
+}
+
+// erasureReader reads stored bytes back a stripe at a time. Each stripe
+// is read from the data shards when their pieces of it match their
+// checksums, and rebuilt from parity shards, opened as they are first
+// needed, only when some do not.
+type erasureReader struct {
+	coder   *erasure.Coder
+	locator string
+	refs    []shardRef
+	paths   []string
+	files   []*os.File
+	// failed marks the shards that cannot be read, or cannot be trusted.
+	failed []bool
+
+	stripe    int
+	remaining int64
+	shards    [][]byte
+	buf       []byte
+}
+
+func (e *erasureBackend) newReader(locator string, manifest *erasureManifest, coder *erasure.Coder) *erasureReader {
+	r := &erasureReader{
+		coder:     coder,
+		locator:   locator,
+		refs:      slices.Clone(manifest.Shards),
+		paths:     make([]string, len(manifest.Shards)),
+		files:     make([]*os.File, len(manifest.Shards)),
+		failed:    make([]bool, len(manifest.Shards)),
+		remaining: manifest.Size,
+	}
+	for i, ref := range manifest.Shards {
+		r.paths[i] = shardPath(ref.Disk, locator, i)
+		r.failed[i] = !e.available(ref.Disk)
+	}
+	return r
+}
+
+func (r *erasureReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.remaining == 0 {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// next reads the following stripe into buf, and leaves in shards the data
+// shards' pieces of it, and the parity shards' pieces that were read.
+func (r *erasureReader) next() error {
+	data := r.coder.DataShards()
+	n := min(r.remaining, int64(data*erasureBlockSize))
+	piece := int((n + int64(data) - 1) / int64(data))
+
+	if r.shards == nil {
+		r.shards = make([][]byte, len(r.refs))
+	}
+	good := 0
+	for i := range r.shards {
+		r.shards[i] = nil
+		if good < data {
+			if r.shards[i] = r.readPiece(i, piece); r.shards[i] != nil {
+				good++
+			}
+		}
+	}
+	if good < data {
+		return fmt.Errorf("%w: %d of the %d shards of %s are intact in stripe %d, %d needed", erasure.ErrTooFewShards, good, len(r.refs), r.locator, r.stripe, data)
+	}
+	if err := r.coder.ReconstructData(r.shards); err != nil {
+		return err
+	}
+
+	stripe := make([]byte, 0, data*piece)
+	for _, shard := range r.shards[:data] {
+		stripe = append(stripe, shard...)
+	}
+	r.buf = stripe[:n]
+	r.remaining -= n
+	r.stripe++
+	return nil
+}
+
+// readPiece reads shard i's piece of the current stripe, or returns nil
+// when it cannot be read or does not match its checksum.
+func (r *erasureReader) readPiece(i, size int) []byte {
+	if r.failed[i] {
+		return nil
+	}
+	if r.files[i] == nil {
+		file, err := os.Open(r.paths[i])
+		if err != nil {
+			r.failed[i] = true
+			return nil
+		}
+		r.files[i] = file
+	}
+	piece := make([]byte, size)
+	if _, err := r.files[i].ReadAt(piece, int64(r.stripe)*erasureBlockSize); err != nil {
+		return nil
+	}
+	if sums := r.refs[i].Stripes; sums != nil && (r.stripe >= len(sums) || crc32.Checksum(piece, stripeTable) != sums[r.stripe]) {
+		return nil
+	}
+	return piece
+}
+
+func (r *erasureReader) Close() error {
+	var err error
+	for _, file := range r.files {
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+	}
+	return err
+}
+
+// Remove removes the shards and the manifest of stored bytes. Nothing is
+// removed while a disk holding a shard is offline, so the manifest is
+// there to find every shard once it is back.
+func (e *erasureBackend) Remove(bucket, object, locator string) error {
+	manifest, err := e.manifest(locator)
+	if err != nil {
+		return err
+	}
+	for _, ref := range manifest.Shards {
+		if !e.available(ref.Disk) {
+			return fmt.Errorf("%w: a disk holding a shard of %s is offline", ErrUnavailable, locator)
+		}
+	}
+	for i, ref := range manifest.Shards {
+		if err := os.Remove(shardPath(ref.Disk, locator, i)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Remove(e.manifestPath(locator))
+}
+
+func (e *erasureBackend) Path(locator string) string {
+	return ""
+}
+
+// heal rebuilds the shards of stored bytes that are missing or corrupted,
+// and returns how many it rebuilt.
+func (e *erasureBackend) heal(locator string) (int, error) {
+	manifest, err := e.manifest(locator)
+	if err != nil {
+		return 0, err
+	}
+	coder, err := erasure.New(manifest.Data, manifest.Parity)
+	if err != nil {
+		return 0, err
+	}
+
+	var lost []int
+	for i, ref := range manifest.Shards {
+		if !e.checkShard(locator, i, ref) {
+			lost = append(lost, i)
+		}
+	}
+	if len(lost) == 0 {
+		return 0, nil
+	}
+
+	// Stripes of corrupted shards that match their checksums still help
+	// rebuild the others. Without stripe checksums, only intact shards
+	// can be trusted.
+	r := e.newReader(locator, manifest, coder)
+	defer r.Close()
+	if !manifest.checksummed() {
+		if len(manifest.Shards)-len(lost) < manifest.Data {
+			return 0, fmt.Errorf("%w: %d of the %d shards of %s are intact, %d needed", erasure.ErrTooFewShards, len(manifest.Shards)-len(lost), len(manifest.Shards), locator, manifest.Data)
+		}
+		for _, i := range lost {
+			r.failed[i] = true
+		}
+	}
+
+	// Every shard is rebuilt next to where it belongs, and only moved in
+	// place once it matches its checksum
+	rebuilt := make([]*os.File, len(manifest.Shards))
+	hashes := make([]hash.Hash, len(manifest.Shards))
+	defer func() {
+		for _, file := range rebuilt {
+			if file != nil {
+				file.Close()
+				os.Remove(file.Name())
+			}
+		}
+	}()
+	// Shards of disks that are offline are rebuilt on others, preferably
+	// ones holding no other shard of the object
+	moved := false
+	for _, i := range lost {
+		if e.available(manifest.Shards[i].Disk) {
+			continue
+		}
+		disk, err := e.replacementDisk(manifest)
+		if err != nil {
+			return 0, err
+		}
+		manifest.Shards[i].Disk = disk
+		moved = true
+	}
+	for _, i := range lost {
+		dir := filepath.Dir(shardPath(manifest.Shards[i].Disk, locator, i))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return 0, err
+		}
+		if rebuilt[i], err = os.CreateTemp(dir, ".tmp-*"); err != nil {
+			return 0, err
+		}
+		hashes[i] = sha256.New()
+	}
+
+	for r.remaining > 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+		if err := coder.Reconstruct(r.shards); err != nil {
+			return 0, err
+		}
+		for _, i := range lost {
+			if _, err := io.MultiWriter(rebuilt[i], hashes[i]).Write(r.shards[i]); err != nil {
+				return 0, err
+			}
+		}
+	}
+	for _, i := range lost {
+		ref := manifest.Shards[i]
+		if sum := hex.EncodeToString(hashes[i].Sum(nil)); sum != ref.Checksum {
+			return 0, fmt.Errorf("rebuilt shard %d of %s: %w", i, locator, &ErrInvalidChecksum{Got: sum, Expected: ref.Checksum})
+		}
+		if err := rebuilt[i].Sync(); err != nil {
+			return 0, err
+		}
+		if err := os.Rename(rebuilt[i].Name(), shardPath(ref.Disk, locator, i)); err != nil {
+			return 0, err
+		}
+	}
+	if moved {
+		if err := e.writeManifest(locator, manifest); err != nil {
+			return 0, err
+		}
+	}
+	return len(lost), nil
+}
+
+// replacementDisk returns an online disk for a shard, one holding the
+// fewest shards of the object.
+func (e *erasureBackend) replacementDisk(manifest *erasureManifest) (string, error) {
+	disks := e.disks()
+	if len(disks) == 0 {
+		return "", fmt.Errorf("%w: no disk is online for shards", ErrUnavailable)
+	}
+	held := map[string]int{}
+	for _, ref := range manifest.Shards {
+		held[ref.Disk]++
+	}
+	best := disks[0]
+	for _, disk := range disks[1:] {
+		if held[disk] < held[best] {
+			best = disk
+		}
+	}
+	return best, nil
+}
+
+// HealReport counts what Heal did.
+type HealReport struct {
+	// Objects counts the erasure-coded objects checked, of which Healed
+	// had Shards rebuilt, and Lost too few shards left to rebuild them.
+	Objects int
+	Healed  int
+	Shards  int
+	Lost    int
+	// Stale counts the data of replaced versions of objects, left on
+	// disks while they were offline, that was removed.
+	Stale int
+}
+
+// Heal checks the shards of every erasure-coded object against their
+// checksums, and rebuilds those missing or corrupted from the others, like
+// after a disk was replaced. Objects that lost more shards than they have
+// parity shards are counted and left as they are. Heal also removes the
+// data of replaced versions left on disks that were offline.
+func (l *LocalStorage) Heal() (*HealReport, error) {
+	report := &HealReport{}
+	var err error
+	if report.Stale, err = l.removeStale(); err != nil {
+		return nil, err
+	}
+	err = l.walkObjects("", "", func(bucket, object string) error {
+		unlock, err := l.lockObject(bucket, object, false)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		meta, err := l.readMeta(bucket, object)
+		if err != nil || meta == nil || meta.Backend != backendErasure {
+			return err
+		}
+		backend, ok := l.backends[backendErasure].(*erasureBackend)
+		if !ok {
+			return nil
+		}
+
+		report.Objects++
+		shards, err := backend.heal(meta.Locator)
+		if errors.Is(err, erasure.ErrTooFewShards) {
+			report.Lost++
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("healing %s/%s: %w", bucket, object, err)
+		}
+		if shards > 0 {
+			report.Healed++
+			report.Shards += shards
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/erasure"
+)
+
+// newErasureStorage returns a storage erasure-coding objects 4+2 over six
+// disks.
+func newErasureStorage(t *testing.T) (*LocalStorage, []string) {
+	t.Helper()
+	coder, err := erasure.New(4, 2)
+	if err != nil {
+		t.Fatalf("Failed to create coder: %v", err)
+	}
+	disks := make([]string, 6)
+	for i := range disks {
+		disks[i] = t.TempDir()
+	}
+	return NewLocalStorage(t.TempDir(), NewValueChecksum(), WithErasureCoding(coder, disks...)), disks
+}
+
+// shardFiles returns the shard files of an object, by shard.
+func shardFiles(t *testing.T, l *LocalStorage, bucket, object string) []string {
+	t.Helper()
+	meta, err := l.readMeta(bucket, object)
+	if err != nil || meta == nil {
+		t.Fatalf("Failed to read the metadata of %s: %v", object, err)
+	}
+	backend := l.backends[backendErasure].(*erasureBackend)
+	manifest, err := backend.manifest(meta.Locator)
+	if err != nil {
+		t.Fatalf("Failed to read the manifest of %s: %v", object, err)
+	}
+	paths := make([]string, len(manifest.Shards))
+	for i, ref := range manifest.Shards {
+		paths[i] = shardPath(ref.Disk, meta.Locator, i)
+	}
+	return paths
+}
+
+func readAll(t *testing.T, l *LocalStorage, bucket, object string) ([]byte, error) {
+	t.Helper()
+	body, _, err := l.Get(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func TestErasureCoding(t *testing.T) {
+	l, disks := newErasureStorage(t)
+
+	t.Run("Objects of any size read back", func(t *testing.T) {
+		for _, size := range []int{0, 1, 1000, 4 * erasureBlockSize, 4*erasureBlockSize*3 + 17} {
+			data := randomBytes(int64(size), size)
+			object := fmt.Sprintf("size-%d.bin", size)
+			if _, err := l.Save("erasure", object, bytes.NewReader(data)); err != nil {
+				t.Fatalf("Failed to save %d bytes: %v", size, err)
+			}
+			got, err := readAll(t, l, "erasure", object)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("Expected %d bytes back, got %d: %v", size, len(got), err)
+			}
+		}
+	})
+
+	t.Run("Shards are spread over the disks", func(t *testing.T) {
+		used := map[string]bool{}
+		for _, path := range shardFiles(t, l, "erasure", "size-1000.bin") {
+			for _, disk := range disks {
+				if filepath.Dir(filepath.Dir(path)) == disk {
+					used[disk] = true
+				}
+			}
+		}
+		if len(used) != len(disks) {
+			t.Errorf("Expected a shard on each of the %d disks, got %d", len(disks), len(used))
+		}
+	})
+
+	data := randomBytes(7, 4*erasureBlockSize*2+100)
+	if _, err := l.Save("erasure", "object.bin", bytes.NewReader(data)); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		damage  func(shards []string)
+		wantErr error
+		healed  int
+	}{
+		{
+			name:   "A missing data shard is rebuilt",
+			damage: func(shards []string) { os.Remove(shards[0]) },
+			healed: 1,
+		},
+		{
+			name: "A corrupted shard is told by its checksum",
+			damage: func(shards []string) {
+				content, _ := os.ReadFile(shards[2])
+				content[10] ^= 0xff
+				os.WriteFile(shards[2], content, 0644)
+			},
+			healed: 1,
+		},
+		{
+			name: "As many lost shards as parity shards",
+			damage: func(shards []string) {
+				os.Remove(shards[1])
+				os.Remove(shards[5])
+			},
+			healed: 2,
+		},
+		{
+			name: "Corrupted stripes of more shards than parity shards",
+			damage: func(shards []string) {
+				// Each stripe is rebuilt from the parity shards on its own
+				for i := range 3 {
+					content, _ := os.ReadFile(shards[i])
+					content[i*erasureBlockSize+10] ^= 0xff
+					os.WriteFile(shards[i], content, 0644)
+				}
+			},
+			healed: 3,
+		},
+		{
+			name: "More lost shards than parity shards",
+			damage: func(shards []string) {
+				os.Remove(shards[0])
+				os.Remove(shards[1])
+				os.Remove(shards[4])
+			},
+			wantErr: erasure.ErrTooFewShards,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := l.Save("erasure", "object.bin", bytes.NewReader(data)); err != nil {
+				t.Fatalf("Failed to save: %v", err)
+			}
+			shards := shardFiles(t, l, "erasure", "object.bin")
+			tt.damage(shards)
+
+			got, err := readAll(t, l, "erasure", "object.bin")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && !bytes.Equal(got, data) {
+				t.Error("Expected the data to be reconstructed")
+			}
+
+			report, err := l.Heal()
+			if err != nil {
+				t.Fatalf("Failed to heal: %v", err)
+			}
+			if tt.wantErr != nil {
+				if report.Lost != 1 {
+					t.Errorf("Expected the object reported lost, got %+v", report)
+				}
+				return
+			}
+			if report.Healed != 1 || report.Shards != tt.healed || report.Lost != 0 {
+				t.Errorf("Expected %d shards healed, got %+v", tt.healed, report)
+			}
+			backend := l.backends[backendErasure].(*erasureBackend)
+			meta, _ := l.readMeta("erasure", "object.bin")
+			manifest, _ := backend.manifest(meta.Locator)
+			for i, ref := range manifest.Shards {
+				if !backend.checkShard(meta.Locator, i, ref) {
+					t.Errorf("Expected shard %d intact after healing", i)
+				}
+			}
+		})
+	}
+
+	t.Run("Manifests without stripe checksums still read", func(t *testing.T) {
+		if _, err := l.Save("erasure", "object.bin", bytes.NewReader(data)); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		backend := l.backends[backendErasure].(*erasureBackend)
+		meta, _ := l.readMeta("erasure", "object.bin")
+		manifest, _ := backend.manifest(meta.Locator)
+		for i := range manifest.Shards {
+			manifest.Shards[i].Stripes = nil
+		}
+		if err := backend.writeManifest(meta.Locator, manifest); err != nil {
+			t.Fatalf("Failed to write the manifest: %v", err)
+		}
+
+		shards := shardFiles(t, l, "erasure", "object.bin")
+		content, _ := os.ReadFile(shards[0])
+		content[10] ^= 0xff
+		os.WriteFile(shards[0], content, 0644)
+		if got, err := readAll(t, l, "erasure", "object.bin"); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Expected the data to be reconstructed, got %v", err)
+		}
+	})
+
+	t.Run("Overwriting and deleting remove the shards", func(t *testing.T) {
+		old := shardFiles(t, l, "erasure", "object.bin")
+		if _, err := l.Save("erasure", "object.bin", bytes.NewReader(data)); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		current := shardFiles(t, l, "erasure", "object.bin")
+		if err := l.Delete("erasure", "object.bin"); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+		for _, path := range append(old, current...) {
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Expected %s removed, got %v", path, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,539 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How WithDisks places objects on its disks.
+const (
+	// PlacementHash picks a disk from a hash of the object's key, so
+	// objects spread evenly, and only those of a disk going offline land
+	// elsewhere.
+	PlacementHash = "hash"
+	// PlacementFreeSpace picks the disk with the most free space, so disks
+	// of different sizes fill up together.
+	PlacementFreeSpace = "free-space"
+)
+
+// diskMarker is the file identifying a data disk, in its root. A disk
+// known to have one that lost it is unmounted or replaced, and is not
+// written to so its mount point does not fill up instead.
+const diskMarker = ".mini-s3-disk"
+
+// DiskStatus describes a data disk of a storage spread over several.
+type DiskStatus struct {
+	ID   string
+	Path string
+
+	// Online tells whether objects are read from and written to the disk.
+	// Reason tells why an offline disk is, and Since when the disk last
+	// changed state.
+	Online bool
+	Reason string
+	Since  time.Time
+
+	// Free and Total are the bytes free and in all on the disk, when
+	// known.
+	Free  int64
+	Total int64
+}
+
+type disk struct {
+	path string
+
+	mu     sync.Mutex
+	id     string
+	online bool
+	reason string
+	since  time.Time
+}
+
+func (d *disk) status() DiskStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return DiskStatus{ID: d.id, Path: d.path, Online: d.online, Reason: d.reason, Since: d.since}
+}
+
+// setState changes the state of a disk, and reports whether it changed.
+func (d *disk) setState(online bool, reason string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	changed := d.online != online
+	if changed || d.since.IsZero() {
+		d.since = time.Now()
+	}
+	d.online, d.reason = online, reason
+	return changed
+}
+
+func (d *disk) isOnline() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.online
+}
+
+// diskSet is the set of data disks of a storage. Which disks it has known
+// is recorded in the data directory, so a disk that comes back empty, or
+// not at all, is told apart from a new one.
+type diskSet struct {
+	root      string
+	placement string
+	disks     []*disk
+}
+
+// diskRegistry records the disks a storage has known, by ID.
+type diskRegistry struct {
+	Disks map[string]string `json:"disks"`
+}
+
+func newDiskSet(root, placement string, paths []string) *diskSet {
+	s := &diskSet{root: root, placement: placement}
+	for _, path := range paths {
+		s.disks = append(s.disks, &disk{path: path})
+	}
+	s.check()
+	return s
+}
+
+func (s *diskSet) registryPath() string {
+	return filepath.Join(s.root, systemDir, "disks.json")
+}
+
+func (s *diskSet) loadRegistry() (*diskRegistry, error) {
+	registry := &diskRegistry{Disks: map[string]string{}}
+	data, err := os.ReadFile(s.registryPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, registry); err != nil {
+		return nil, err
+	}
+	if registry.Disks == nil {
+		registry.Disks = map[string]string{}
+	}
+	return registry, nil
+}
+
+func (s *diskSet) saveRegistry(registry *diskRegistry) error {
+	data, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := s.registryPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// check finds out which disks are online, formatting the new ones, and
+// returns the status of those whose state changed.
+func (s *diskSet) check() []DiskStatus {
+	var changed []DiskStatus
+	unlock, err := lockKey(s.root, lockDomainDisks, "registry", true)
+	if err != nil {
+		for _, d := range s.disks {
+			if d.setState(false, fmt.Sprintf("reading the disk registry: %v", err)) {
+				changed = append(changed, d.status())
+			}
+		}
+		return changed
+	}
+	defer unlock()
+
+	registry, err := s.loadRegistry()
+	if err != nil {
+		registry = nil
+	}
+	updated := false
+	for _, d := range s.disks {
+		online, reason := true, ""
+		if registry == nil {
+			online, reason = false, fmt.Sprintf("reading the disk registry: %v", err)
+		} else if err := s.checkDisk(d, registry, &updated); err != nil {
+			online, reason = false, err.Error()
+		}
+		if d.setState(online, reason) {
+			changed = append(changed, d.status())
+		}
+	}
+	if updated {
+		if err := s.saveRegistry(registry); err != nil {
+			for _, d := range s.disks {
+				d.setState(false, fmt.Sprintf("recording the disks: %v", err))
+			}
+		}
+	}
+	return changed
+}
+
+// checkDisk finds out the ID of a disk, formatting it if it is new, and
+// tests that it can be written to.
+func (s *diskSet) checkDisk(d *disk, registry *diskRegistry, updated *bool) error {
+	marker := filepath.Join(d.path, diskMarker)
+	data, err := os.ReadFile(marker)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		for id, path := range registry.Disks {
+			if path == d.path {
+				return fmt.Errorf("disk %s lost its marker, it may be unmounted or replaced", id)
+			}
+		}
+		if err := s.format(d); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		id := strings.TrimSpace(string(data))
+		d.mu.Lock()
+		known := d.id
+		d.mu.Unlock()
+		if known != "" && id != known {
+			return fmt.Errorf("another disk (%s) is mounted where disk %s was", id, known)
+		}
+		d.mu.Lock()
+		d.id = id
+		d.mu.Unlock()
+	}
+
+	d.mu.Lock()
+	id := d.id
+	d.mu.Unlock()
+	if registry.Disks[id] != d.path {
+		registry.Disks[id] = d.path
+		*updated = true
+	}
+
+	// A disk can fail on writes only, or be remounted read-only
+	probe, err := os.CreateTemp(d.path, ".probe-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(probe.Name())
+	if _, err := probe.WriteString(id); err != nil {
+		probe.Close()
+		return err
+	}
+	if err := probe.Sync(); err != nil {
+		probe.Close()
+		return err
+	}
+	return probe.Close()
+}
+
+// format gives a new disk an ID, in its marker.
+func (s *diskSet) format(d *disk) error {
+	if err := os.MkdirAll(d.path, 0755); err != nil {
+		return err
+	}
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	id := hex.EncodeToString(raw)
+	if err := os.WriteFile(filepath.Join(d.path, diskMarker), []byte(id+"\n"), 0644); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.id = id
+	d.mu.Unlock()
+	return nil
+}
+
+// fail takes a disk offline when err tells it failed, and reports whether
+// it did.
+func (s *diskSet) fail(d *disk, err error) bool {
+	if !diskFailure(err) {
+		return false
+	}
+	d.setState(false, err.Error())
+	return true
+}
+
+// lost takes a disk offline when it lost its marker, as when it is
+// unmounted, and reports whether it did.
+func (s *diskSet) lost(d *disk) bool {
+	if _, err := os.Stat(filepath.Join(d.path, diskMarker)); err == nil {
+		return false
+	}
+	d.setState(false, "the disk lost its marker, it may be unmounted or replaced")
+	return true
+}
+
+func (s *diskSet) byID(id string) *disk {
+	for _, d := range s.disks {
+		d.mu.Lock()
+		match := d.id == id
+		d.mu.Unlock()
+		if match {
+			return d
+		}
+	}
+	return nil
+}
+
+// online returns the online disks in the order objects of key are placed
+// on them.
+func (s *diskSet) online(key string) []*disk {
+	var disks []*disk
+	for _, d := range s.disks {
+		if d.isOnline() {
+			disks = append(disks, d)
+		}
+	}
+
+	if s.placement == PlacementFreeSpace {
+		free := map[*disk]int64{}
+		known := true
+		for _, d := range disks {
+			var err error
+			if free[d], _, err = diskSpace(d.path); err != nil {
+				known = false
+			}
+		}
+		if known {
+			slices.SortStableFunc(disks, func(a, b *disk) int { return cmp.Compare(free[b], free[a]) })
+			return disks
+		}
+	}
+
+	// Rendezvous hashing: the disks scoring highest for a key keep it,
+	// whichever others there are
+	score := map[*disk]uint64{}
+	for _, d := range disks {
+		sum := sha256.Sum256([]byte(d.status().ID + "/" + key))
+		score[d] = binary.BigEndian.Uint64(sum[:8])
+	}
+	slices.SortStableFunc(disks, func(a, b *disk) int { return cmp.Compare(score[b], score[a]) })
+	return disks
+}
+
+func offlineError(d *disk) error {
+	status := d.status()
+	return fmt.Errorf("%w: disk %s is offline: %s", ErrUnavailable, status.Path, status.Reason)
+}
+
+// jbodBackend keeps every object as a plain file on one of several disks,
+// picked by the placement of its disk set. Disks that fail are taken
+// offline: objects on them cannot be read until they are back, and new
+// ones go to the others.
+type jbodBackend struct {
+	disks *diskSet
+}
+
+// WithDisks spreads object data over several disks, each given by the
+// directory it is mounted at, placing objects on them by placement,
+// PlacementHash by default. Metadata stays in the data directory. Disks
+// are checked when the storage is created and by RunDiskCheck, and taken
+// offline when they fail.
+func WithDisks(placement string, paths ...string) LocalStorageOption {
+	return func(l *LocalStorage) {
+		if placement == "" {
+			placement = PlacementHash
+		}
+		l.disks = newDiskSet(l.path, placement, paths)
+		l.backends[backendJBOD] = &jbodBackend{disks: l.disks}
+		l.defaultBackend = backendJBOD
+	}
+}
+
+func (j *jbodBackend) Put(bucket, object, path, digest string) (string, error) {
+	key := bucket + "/" + object
+	for _, d := range j.disks.online(key) {
+		dst := filepath.Join(d.path, filepath.FromSlash(key))
+		err := os.MkdirAll(filepath.Dir(dst), 0755)
+		if err == nil {
+			err = moveFile(path, dst)
+		}
+		if err == nil {
+			return d.status().ID + "/" + key, nil
+		}
+		if !j.disks.fail(d, err) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: no data disk is online", ErrUnavailable)
+}
+
+// locate returns the disk of a locator and the file on it.
+func (j *jbodBackend) locate(locator string) (*disk, string, error) {
+	id, key, ok := strings.Cut(locator, "/")
+	d := j.disks.byID(id)
+	if !ok || d == nil {
+		return nil, "", fmt.Errorf("%w: no data disk holds %s", ErrUnavailable, locator)
+	}
+	return d, filepath.Join(d.path, filepath.FromSlash(key)), nil
+}
+
+func (j *jbodBackend) Open(locator string) (io.ReadCloser, error) {
+	d, path, err := j.locate(locator)
+	if err != nil {
+		return nil, err
+	}
+	if !d.isOnline() {
+		return nil, offlineError(d)
+	}
+	file, err := os.Open(path)
+	if err != nil && (j.disks.fail(d, err) || (errors.Is(err, os.ErrNotExist) && j.disks.lost(d))) {
+		return nil, offlineError(d)
+	}
+	return file, err
+}
+
+func (j *jbodBackend) Remove(bucket, object, locator string) error {
+	d, path, err := j.locate(locator)
+	if err != nil {
+		// The disk was replaced, and the data went with it. Unlike
+		// reads, which cannot tell, there is nothing left to wait for.
+		return fmt.Errorf("%w: no data disk holds %s", os.ErrNotExist, locator)
+	}
+	if !d.isOnline() {
+		return offlineError(d)
+	}
+	err = os.Remove(path)
+	if err != nil && j.disks.fail(d, err) {
+		return offlineError(d)
+	}
+	return err
+}
+
+func (j *jbodBackend) Path(locator string) string {
+	d, path, err := j.locate(locator)
+	if err != nil || !d.isOnline() {
+		return ""
+	}
+	return path
+}
+
+// Disks returns the status of the data disks, or nil when object data is
+// not spread over several.
+func (l *LocalStorage) Disks() []DiskStatus {
+	if l.disks == nil {
+		return nil
+	}
+	statuses := make([]DiskStatus, len(l.disks.disks))
+	for i, d := range l.disks.disks {
+		statuses[i] = d.status()
+		statuses[i].Free, statuses[i].Total, _ = diskSpace(d.path)
+	}
+	return statuses
+}
+
+// CheckDisks checks every data disk, taking those that failed offline and
+// bringing those back that recovered, and returns the status of the disks
+// whose state changed. The data of replaced versions of objects that was
+// left on disks while they were offline is removed once they are back.
+func (l *LocalStorage) CheckDisks() []DiskStatus {
+	if l.disks == nil {
+		return nil
+	}
+	changed := l.disks.check()
+	if _, err := l.removeStale(); err != nil {
+		log.Printf("mini-s3: %v", err)
+	}
+	return changed
+}
+
+// RunDiskCheck checks the data disks each interval until ctx is done,
+// handing each disk whose state changed to report.
+func (l *LocalStorage) RunDiskCheck(ctx context.Context, interval time.Duration, report func(DiskStatus)) {
+	if l.disks == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, status := range l.CheckDisks() {
+				report(status)
+			}
+		}
+	}
+}
+
+// ReplaceDisk formats the data disk at path again, like after it was
+// replaced, so it is used again. The objects kept on it before are gone,
+// except erasure-coded ones, whose shards Heal rebuilds.
+func (l *LocalStorage) ReplaceDisk(path string) error {
+	if l.disks == nil {
+		return errors.New("object data is not spread over several disks")
+	}
+	if err := l.disks.forget(path); err != nil {
+		return err
+	}
+	l.disks.check()
+	if status := l.disks.find(path).status(); !status.Online {
+		return fmt.Errorf("disk %s is still offline: %s", path, status.Reason)
+	}
+	return nil
+}
+
+func (s *diskSet) find(path string) *disk {
+	for _, d := range s.disks {
+		if d.path == path {
+			return d
+		}
+	}
+	return nil
+}
+
+// forget drops what is known of the disk at path, so the next check
+// formats it as a new one.
+func (s *diskSet) forget(path string) error {
+	d := s.find(path)
+	if d == nil {
+		return fmt.Errorf("%s is not a data disk", path)
+	}
+	unlock, err := lockKey(s.root, lockDomainDisks, "registry", true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	registry, err := s.loadRegistry()
+	if err != nil {
+		return err
+	}
+	for id, known := range registry.Disks {
+		if known == path {
+			delete(registry.Disks, id)
+		}
+	}
+	if err := s.saveRegistry(registry); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(path, diskMarker)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	d.mu.Lock()
+	d.id = ""
+	d.mu.Unlock()
+	return nil
+}
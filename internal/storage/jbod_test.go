@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamthiago/mini-s3/internal/erasure"
+)
+
+// diskOf returns the path of the disk holding an object.
+func diskOf(t *testing.T, l *LocalStorage, bucket, object string) string {
+	t.Helper()
+	meta, err := l.readMeta(bucket, object)
+	if err != nil || meta == nil {
+		t.Fatalf("Failed to read the metadata of %s: %v", object, err)
+	}
+	id, _, _ := strings.Cut(meta.Locator, "/")
+	d := l.disks.byID(id)
+	if d == nil {
+		t.Fatalf("Expected %s on a disk, got locator %s", object, meta.Locator)
+	}
+	return d.path
+}
+
+// unmount makes a disk look unmounted: its directory is left empty.
+func unmount(t *testing.T, path string) func() {
+	t.Helper()
+	moved := path + ".unmounted"
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatalf("Failed to unmount %s: %v", path, err)
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatalf("Failed to recreate %s: %v", path, err)
+	}
+	return func() {
+		os.RemoveAll(path)
+		if err := os.Rename(moved, path); err != nil {
+			t.Fatalf("Failed to mount %s back: %v", path, err)
+		}
+	}
+}
+
+func newDisks(t *testing.T, n int) []string {
+	disks := make([]string, n)
+	for i := range disks {
+		disks[i] = filepath.Join(t.TempDir(), "disk")
+	}
+	return disks
+}
+
+func TestJBOD(t *testing.T) {
+	disks := newDisks(t, 3)
+	l := NewLocalStorage(t.TempDir(), NewValueChecksum(), WithDisks(PlacementHash, disks...))
+
+	t.Run("New disks are formatted", func(t *testing.T) {
+		for _, status := range l.Disks() {
+			if !status.Online || status.ID == "" {
+				t.Errorf("Expected %s online with an ID, got %+v", status.Path, status)
+			}
+			if _, err := os.Stat(filepath.Join(status.Path, diskMarker)); err != nil {
+				t.Errorf("Expected a marker on %s: %v", status.Path, err)
+			}
+		}
+	})
+
+	used := map[string][]string{}
+	for i := range 30 {
+		object := fmt.Sprintf("object-%d", i)
+		if _, err := l.Save("jbod", object, strings.NewReader(object)); err != nil {
+			t.Fatalf("Failed to save %s: %v", object, err)
+		}
+		disk := diskOf(t, l, "jbod", object)
+		used[disk] = append(used[disk], object)
+	}
+
+	t.Run("Objects spread over the disks by hash", func(t *testing.T) {
+		if len(used) != len(disks) {
+			t.Errorf("Expected objects on each of the %d disks, got %d", len(disks), len(used))
+		}
+		for disk, objects := range used {
+			for _, object := range objects {
+				if _, err := l.Save("jbod", object, strings.NewReader(object)); err != nil {
+					t.Fatalf("Failed to save %s: %v", object, err)
+				}
+				if got := diskOf(t, l, "jbod", object); got != disk {
+					t.Errorf("Expected %s to stay on %s, got %s", object, disk, got)
+				}
+			}
+		}
+	})
+
+	t.Run("An unmounted disk is taken offline", func(t *testing.T) {
+		mount := unmount(t, disks[0])
+		defer mount()
+
+		for _, object := range used[disks[0]] {
+			if _, err := readAll(t, l, "jbod", object); !errors.Is(err, ErrUnavailable) {
+				t.Errorf("Expected %s unavailable, got %v", object, err)
+			}
+		}
+		for _, object := range used[disks[1]] {
+			got, err := readAll(t, l, "jbod", object)
+			if err != nil || string(got) != object {
+				t.Errorf("Expected %s still readable, got %q: %v", object, got, err)
+			}
+		}
+		if status := l.Disks()[0]; status.Online || status.Reason == "" {
+			t.Errorf("Expected %s offline with a reason, got %+v", disks[0], status)
+		}
+
+		// New objects go to the other disks, and the empty mount point is
+		// not formatted as a new disk
+		if _, err := l.Save("jbod", "while-offline", strings.NewReader("data")); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		if disk := diskOf(t, l, "jbod", "while-offline"); disk == disks[0] {
+			t.Error("Expected the object saved on an online disk")
+		}
+		l.CheckDisks()
+		if l.Disks()[0].Online {
+			t.Error("Expected the unmounted disk to stay offline")
+		}
+	})
+
+	t.Run("A disk mounted back is brought online", func(t *testing.T) {
+		changed := l.CheckDisks()
+		if len(changed) != 1 || changed[0].Path != disks[0] || !changed[0].Online {
+			t.Fatalf("Expected %s back online, got %+v", disks[0], changed)
+		}
+		for _, object := range used[disks[0]] {
+			got, err := readAll(t, l, "jbod", object)
+			if err != nil || string(got) != object {
+				t.Errorf("Expected %s readable again, got %q: %v", object, got, err)
+			}
+		}
+	})
+
+	t.Run("Overwriting or deleting an object on an offline disk defers removing its data", func(t *testing.T) {
+		mount := unmount(t, disks[0])
+		l.CheckDisks()
+		object := used[disks[0]][0]
+		if _, err := l.Save("jbod", object, strings.NewReader("new")); err != nil {
+			t.Fatalf("Expected the overwrite to succeed, got %v", err)
+		}
+		if disk := diskOf(t, l, "jbod", object); disk == disks[0] {
+			t.Fatal("Expected the new version saved on an online disk")
+		}
+		deleted := used[disks[0]][1]
+		if err := l.Delete("jbod", deleted); err != nil {
+			t.Fatalf("Expected the delete to succeed, got %v", err)
+		}
+		if exists, _ := l.Exists("jbod", deleted); exists {
+			t.Error("Expected the object deleted")
+		}
+		if entries, _ := os.ReadDir(l.staleDir()); len(entries) != 2 {
+			t.Errorf("Expected both copies recorded, got %d entries", len(entries))
+		}
+		mount()
+
+		for _, name := range []string{object, deleted} {
+			if _, err := os.Stat(filepath.Join(disks[0], "jbod", name)); err != nil {
+				t.Fatalf("Expected the copy of %s still there, got %v", name, err)
+			}
+		}
+		l.CheckDisks()
+		for _, name := range []string{object, deleted} {
+			if _, err := os.Stat(filepath.Join(disks[0], "jbod", name)); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Expected the copy of %s removed once the disk is back, got %v", name, err)
+			}
+		}
+		if entries, _ := os.ReadDir(l.staleDir()); len(entries) != 0 {
+			t.Errorf("Expected nothing left to remove, got %d entries", len(entries))
+		}
+		got, err := readAll(t, l, "jbod", object)
+		if err != nil || string(got) != "new" {
+			t.Errorf("Expected the new version, got %q: %v", got, err)
+		}
+	})
+
+	t.Run("A replaced disk is put back in use empty", func(t *testing.T) {
+		old := l.Disks()[2].ID
+		os.RemoveAll(disks[2])
+		if err := os.Mkdir(disks[2], 0755); err != nil {
+			t.Fatalf("Failed to recreate %s: %v", disks[2], err)
+		}
+		l.CheckDisks()
+		if l.Disks()[2].Online {
+			t.Fatal("Expected the replaced disk offline until told so")
+		}
+
+		if err := l.ReplaceDisk(disks[2]); err != nil {
+			t.Fatalf("Failed to replace disk: %v", err)
+		}
+		if status := l.Disks()[2]; !status.Online || status.ID == old {
+			t.Errorf("Expected the disk online with a new ID, got %+v", status)
+		}
+		for _, object := range used[disks[2]] {
+			if _, err := readAll(t, l, "jbod", object); !errors.Is(err, ErrUnavailable) {
+				t.Errorf("Expected %s lost with the disk, got %v", object, err)
+			}
+		}
+
+		// The old copies went with the disk, so none is left to remove
+		for _, object := range used[disks[2]] {
+			if _, err := l.Save("jbod", object, strings.NewReader(object)); err != nil {
+				t.Fatalf("Failed to overwrite %s: %v", object, err)
+			}
+		}
+		if _, err := l.removeStale(); err != nil {
+			t.Fatalf("Failed to remove stale data: %v", err)
+		}
+		if entries, _ := os.ReadDir(l.staleDir()); len(entries) != 0 {
+			t.Errorf("Expected no stale data left, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("Disks are known again on restart", func(t *testing.T) {
+		before := l.Disks()
+		reopened := NewLocalStorage(l.path, NewValueChecksum(), WithDisks(PlacementHash, disks...))
+		for i, status := range reopened.Disks() {
+			if status.ID != before[i].ID || !status.Online {
+				t.Errorf("Expected disk %s as before, got %+v", status.Path, status)
+			}
+		}
+		got, err := readAll(t, reopened, "jbod", used[disks[1]][0])
+		if err != nil || string(got) != used[disks[1]][0] {
+			t.Errorf("Expected objects readable after restart, got %q: %v", got, err)
+		}
+	})
+}
+
+func TestJBODFreeSpace(t *testing.T) {
+	disks := newDisks(t, 2)
+	l := NewLocalStorage(t.TempDir(), NewValueChecksum(), WithDisks(PlacementFreeSpace, disks...))
+
+	if _, _, err := diskSpace(disks[0]); err != nil {
+		t.Skipf("Free space is not known here: %v", err)
+	}
+	data := []byte("placed by free space")
+	if _, err := l.Save("jbod", "object", bytes.NewReader(data)); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	got, err := readAll(t, l, "jbod", "object")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected the object back, got %q: %v", got, err)
+	}
+	for _, status := range l.Disks() {
+		if status.Total <= 0 || status.Free > status.Total {
+			t.Errorf("Expected the space of %s, got %d free of %d", status.Path, status.Free, status.Total)
+		}
+	}
+}
+
+func TestJBODErasureCoding(t *testing.T) {
+	coder, err := erasure.New(2, 1)
+	if err != nil {
+		t.Fatalf("Failed to create coder: %v", err)
+	}
+	disks := newDisks(t, 4)
+	l := NewLocalStorage(t.TempDir(), NewValueChecksum(), WithDisks(PlacementHash, disks...), WithErasureCoding(coder))
+
+	data := randomBytes(3, 2*erasureBlockSize+10)
+	if _, err := l.Save("erasure", "object", bytes.NewReader(data)); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	// Take offline a disk holding a shard
+	var offline string
+	for _, path := range shardFiles(t, l, "erasure", "object") {
+		for _, disk := range disks {
+			if strings.HasPrefix(path, disk+string(filepath.Separator)) {
+				offline = disk
+			}
+		}
+	}
+	if offline == "" {
+		t.Fatal("Expected the shards on the disks")
+	}
+	mount := unmount(t, offline)
+	defer mount()
+	l.CheckDisks()
+
+	got, err := readAll(t, l, "erasure", "object")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Expected the object read with a disk offline, got %d bytes: %v", len(got), err)
+	}
+
+	report, err := l.Heal()
+	if err != nil {
+		t.Fatalf("Failed to heal: %v", err)
+	}
+	if report.Healed != 1 || report.Shards != 1 || report.Lost != 0 {
+		t.Errorf("Expected the shard of the offline disk rebuilt, got %+v", report)
+	}
+	for _, path := range shardFiles(t, l, "erasure", "object") {
+		if strings.HasPrefix(path, offline+string(filepath.Separator)) {
+			t.Errorf("Expected no shard left on the offline disk, got %s", path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected shard %s rebuilt: %v", path, err)
+		}
+	}
+
+	if _, err := l.Save("erasure", "new", bytes.NewReader(data)); err != nil {
+		t.Fatalf("Expected objects saved with a disk offline: %v", err)
+	}
+}
+
+func TestJBODErasureCodingRemove(t *testing.T) {
+	coder, err := erasure.New(2, 1)
+	if err != nil {
+		t.Fatalf("Failed to create coder: %v", err)
+	}
+	// As many disks as shards, so each disk holds a shard of every object
+	disks := newDisks(t, 3)
+	l := NewLocalStorage(t.TempDir(), NewValueChecksum(), WithDisks(PlacementHash, disks...), WithErasureCoding(coder))
+
+	if _, err := l.Save("erasure", "object", bytes.NewReader(randomBytes(4, 1000))); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	shards := shardFiles(t, l, "erasure", "object")
+	meta, _ := l.readMeta("erasure", "object")
+	manifest := l.backends[backendErasure].(*erasureBackend).manifestPath(meta.Locator)
+
+	mount := unmount(t, disks[0])
+	l.CheckDisks()
+	if err := l.Delete("erasure", "object"); err != nil {
+		t.Fatalf("Expected the delete to succeed with a disk offline, got %v", err)
+	}
+	if _, err := os.Stat(manifest); err != nil {
+		t.Fatalf("Expected the manifest kept while a disk is offline, got %v", err)
+	}
+	if entries, _ := os.ReadDir(l.staleDir()); len(entries) != 1 {
+		t.Errorf("Expected the shards recorded as stale, got %d entries", len(entries))
+	}
+
+	mount()
+	l.CheckDisks()
+	for _, path := range append(shards, manifest) {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected %s removed once the disk is back, got %v", path, err)
+		}
+	}
+	if entries, _ := os.ReadDir(l.staleDir()); len(entries) != 0 {
+		t.Errorf("Expected no stale data left, got %d entries", len(entries))
+	}
+}
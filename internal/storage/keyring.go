@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// MasterKey is one version of the key used to wrap object data keys for
+// encryption at rest.
+type MasterKey struct {
+	Version   int       `json:"version"`
+	Key       []byte    `json:"key"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Keyring holds every master key version ever created. Only the active one
+// wraps new data keys; older versions are kept so objects that have not been
+// rewrapped yet stay readable.
+//
+// The keyring file is re-read whenever it changes on disk, so a rotation
+// performed by another process is picked up without a restart.
+type Keyring struct {
+	mu      sync.RWMutex
+	path    string
+	modTime time.Time
+	Active  int         `json:"active"`
+	Keys    []MasterKey `json:"keys"`
+}
+
+type ErrMasterKeyNotFound struct {
+	Version int
+}
+
+func (e *ErrMasterKeyNotFound) Error() string {
+	return fmt.Sprintf("master key version %d not found in keyring", e.Version)
+}
+
+// LoadKeyring reads the keyring at path. A missing file yields an empty
+// keyring, which leaves encryption at rest disabled until the first key is
+// created with Rotate.
+func LoadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Keyring) reload() error {
+	info, err := os.Stat(k.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(k.modTime) {
+		return nil
+	}
+	// Master keys decrypt every object, so only their owner may read them
+	if perm := info.Mode().Perm(); perm&0077 != 0 && runtime.GOOS != "windows" {
+		return fmt.Errorf("the keyring %s is accessible by group or others (mode %#o), restrict it with chmod 600", k.path, perm)
+	}
+
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+	var loaded Keyring
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+	k.Active = loaded.Active
+	k.Keys = loaded.Keys
+	k.modTime = info.ModTime()
+	return nil
+}
+
+// refresh picks up changes made to the keyring file by other processes.
+func (k *Keyring) refresh() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.reload()
+}
+
+// ActiveKey returns the key new objects are encrypted with, or nil when the
+// keyring is empty.
+func (k *Keyring) ActiveKey() *MasterKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.find(k.Active)
+}
+
+// Key returns the given master key version.
+func (k *Keyring) Key(version int) (*MasterKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if key := k.find(version); key != nil {
+		return key, nil
+	}
+	return nil, &ErrMasterKeyNotFound{Version: version}
+}
+
+func (k *Keyring) find(version int) *MasterKey {
+	for i := range k.Keys {
+		if k.Keys[i].Version == version {
+			return &k.Keys[i]
+		}
+	}
+	return nil
+}
+
+// Rotate generates a new master key, makes it the active one and persists
+// the keyring.
+func (k *Keyring) Rotate() (*MasterKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	version := 1
+	for _, existing := range k.Keys {
+		if existing.Version >= version {
+			version = existing.Version + 1
+		}
+	}
+	k.Keys = append(k.Keys, MasterKey{Version: version, Key: key, CreatedAt: time.Now()})
+	k.Active = version
+
+	if err := k.save(); err != nil {
+		return nil, err
+	}
+	return k.find(version), nil
+}
+
+func (k *Keyring) save() error {
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, k.path); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return err
+	}
+	k.modTime = info.ModTime()
+	return nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLoadKeyring_Permissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("File modes do not restrict access on Windows")
+	}
+
+	tests := []struct {
+		name    string
+		mode    os.FileMode
+		wantErr bool
+	}{
+		{name: "Owner only", mode: 0600},
+		{name: "Readable by group", mode: 0640, wantErr: true},
+		{name: "Readable by others", mode: 0604, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keyring.json")
+			keyring, err := LoadKeyring(path)
+			if err != nil {
+				t.Fatalf("Failed to load keyring: %v", err)
+			}
+			if _, err := keyring.Rotate(); err != nil {
+				t.Fatalf("Failed to create a key: %v", err)
+			}
+			if err := os.Chmod(path, tt.mode); err != nil {
+				t.Fatalf("Failed to change mode: %v", err)
+			}
+
+			_, err = LoadKeyring(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateKeyringPath(t *testing.T) {
+	root := t.TempDir()
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "Outside the data directory", path: filepath.Join(filepath.Dir(root), "keyring.json")},
+		{name: "Sibling sharing a prefix", path: root + "-keys/keyring.json"},
+		{name: "Inside the data directory", path: filepath.Join(root, "keyring.json"), wantErr: true},
+		{name: "Former default", path: LegacyKeyringPath(root), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateKeyringPath(root, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,481 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	LifecycleStatusEnabled  = "Enabled"
+	LifecycleStatusDisabled = "Disabled"
+
+	// LifecycleActionExpire deletes the current version of an object.
+	LifecycleActionExpire = "Expire"
+	// LifecycleActionTransition moves an object to a colder storage class.
+	LifecycleActionTransition = "Transition"
+
+	maxLifecycleRules = 1000
+)
+
+// LifecycleConfiguration holds the lifecycle rules of a bucket. It follows
+// the S3 format, and reads and writes both its XML and JSON forms.
+type LifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration" json:"-"`
+	Rules   []LifecycleRule `xml:"Rule" json:"Rules"`
+}
+
+// LifecycleRule applies its actions to the objects selected by its filter.
+type LifecycleRule struct {
+	ID     string `xml:"ID,omitempty" json:"ID,omitempty"`
+	Status string `xml:"Status" json:"Status"`
+	// Prefix is the legacy way of selecting objects, before Filter.
+	Prefix string           `xml:"Prefix,omitempty" json:"Prefix,omitempty"`
+	Filter *LifecycleFilter `xml:"Filter,omitempty" json:"Filter,omitempty"`
+
+	Expiration                     *LifecycleExpiration            `xml:"Expiration,omitempty" json:"Expiration,omitempty"`
+	Transitions                    []LifecycleTransition           `xml:"Transition" json:"Transitions,omitempty"`
+	NoncurrentVersionExpiration    *NoncurrentVersionExpiration    `xml:"NoncurrentVersionExpiration,omitempty" json:"NoncurrentVersionExpiration,omitempty"`
+	AbortIncompleteMultipartUpload *AbortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload,omitempty" json:"AbortIncompleteMultipartUpload,omitempty"`
+}
+
+// LifecycleFilter selects objects by key prefix, tag or size. Only one of
+// its conditions may be set; And combines several.
+type LifecycleFilter struct {
+	Prefix                string        `xml:"Prefix,omitempty" json:"Prefix,omitempty"`
+	Tag                   *Tag          `xml:"Tag,omitempty" json:"Tag,omitempty"`
+	ObjectSizeGreaterThan int64         `xml:"ObjectSizeGreaterThan,omitempty" json:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    int64         `xml:"ObjectSizeLessThan,omitempty" json:"ObjectSizeLessThan,omitempty"`
+	And                   *LifecycleAnd `xml:"And,omitempty" json:"And,omitempty"`
+}
+
+// LifecycleAnd selects objects matching all of its conditions.
+type LifecycleAnd struct {
+	Prefix                string `xml:"Prefix,omitempty" json:"Prefix,omitempty"`
+	Tags                  []Tag  `xml:"Tag" json:"Tags,omitempty"`
+	ObjectSizeGreaterThan int64  `xml:"ObjectSizeGreaterThan,omitempty" json:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    int64  `xml:"ObjectSizeLessThan,omitempty" json:"ObjectSizeLessThan,omitempty"`
+}
+
+// LifecycleExpiration expires objects a number of days after they were
+// created, or on a date.
+type LifecycleExpiration struct {
+	Days int        `xml:"Days,omitempty" json:"Days,omitempty"`
+	Date *time.Time `xml:"Date,omitempty" json:"Date,omitempty"`
+}
+
+// LifecycleTransition moves objects to a colder storage class a number of
+// days after they were created, or on a date.
+type LifecycleTransition struct {
+	Days         int        `xml:"Days,omitempty" json:"Days,omitempty"`
+	Date         *time.Time `xml:"Date,omitempty" json:"Date,omitempty"`
+	StorageClass string     `xml:"StorageClass" json:"StorageClass"`
+}
+
+// NoncurrentVersionExpiration expires versions some days after they stop
+// being current.
+type NoncurrentVersionExpiration struct {
+	NoncurrentDays          int `xml:"NoncurrentDays" json:"NoncurrentDays"`
+	NewerNoncurrentVersions int `xml:"NewerNoncurrentVersions,omitempty" json:"NewerNoncurrentVersions,omitempty"`
+}
+
+// AbortIncompleteMultipartUpload aborts multipart uploads not completed
+// some days after they started.
+type AbortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation" json:"DaysAfterInitiation"`
+}
+
+type ErrInvalidLifecycle struct {
+	Rule   string
+	Reason string
+}
+
+func (e *ErrInvalidLifecycle) Error() string {
+	if e.Rule == "" {
+		return "invalid lifecycle configuration: " + e.Reason
+	}
+	return fmt.Sprintf("invalid lifecycle rule %q: %s", e.Rule, e.Reason)
+}
+
+// ParseLifecycleConfiguration reads a lifecycle configuration in S3 XML or
+// JSON form, telling them apart by the first character.
+func ParseLifecycleConfiguration(data []byte) (*LifecycleConfiguration, error) {
+	cfg := &LifecycleConfiguration{}
+	data = bytes.TrimSpace(data)
+	var err error
+	if bytes.HasPrefix(data, []byte("<")) {
+		err = xml.Unmarshal(data, cfg)
+	} else {
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return nil, &ErrInvalidLifecycle{Reason: err.Error()}
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration against the rules S3 enforces.
+func (c *LifecycleConfiguration) Validate() error {
+	if len(c.Rules) == 0 {
+		return &ErrInvalidLifecycle{Reason: "at least one rule is required"}
+	}
+	if len(c.Rules) > maxLifecycleRules {
+		return &ErrInvalidLifecycle{Reason: fmt.Sprintf("at most %d rules are allowed", maxLifecycleRules)}
+	}
+
+	ids := map[string]bool{}
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.ID != "" {
+			if ids[rule.ID] {
+				return &ErrInvalidLifecycle{Rule: rule.ID, Reason: "rule IDs must be unique"}
+			}
+			ids[rule.ID] = true
+		}
+		if err := rule.validate(); err != nil {
+			return &ErrInvalidLifecycle{Rule: rule.name(i), Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+func (r *LifecycleRule) name(i int) string {
+	if r.ID != "" {
+		return r.ID
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+func (r *LifecycleRule) validate() error {
+	if len(r.ID) > 255 {
+		return errors.New("ID is longer than 255 characters")
+	}
+	if r.Status != LifecycleStatusEnabled && r.Status != LifecycleStatusDisabled {
+		return fmt.Errorf("status must be %s or %s", LifecycleStatusEnabled, LifecycleStatusDisabled)
+	}
+	if r.Prefix != "" && r.Filter != nil {
+		return errors.New("Prefix and Filter cannot both be set")
+	}
+	if f := r.Filter; f != nil {
+		conditions := 0
+		for _, set := range []bool{f.Prefix != "", f.Tag != nil, f.ObjectSizeGreaterThan != 0, f.ObjectSizeLessThan != 0, f.And != nil} {
+			if set {
+				conditions++
+			}
+		}
+		if conditions > 1 {
+			return errors.New("Filter can only have one condition, use And to combine them")
+		}
+	}
+	if r.Expiration == nil && len(r.Transitions) == 0 && r.NoncurrentVersionExpiration == nil && r.AbortIncompleteMultipartUpload == nil {
+		return errors.New("at least one action is required")
+	}
+
+	if e := r.Expiration; e != nil {
+		if (e.Days == 0) == (e.Date == nil) {
+			return errors.New("Expiration needs exactly one of Days or Date")
+		}
+		if e.Days < 0 {
+			return errors.New("Expiration days must be positive")
+		}
+		if e.Date != nil && !isMidnightUTC(*e.Date) {
+			return errors.New("Expiration date must be at midnight UTC")
+		}
+	}
+	for _, t := range r.Transitions {
+		if err := validateStorageClass(t.StorageClass); err != nil {
+			return err
+		}
+		if t.StorageClass == StorageClassStandard {
+			return errors.New("objects cannot transition to " + StorageClassStandard)
+		}
+		if t.Days < 0 || (t.Days != 0 && t.Date != nil) {
+			return errors.New("Transition needs one of Days or Date")
+		}
+		if t.Date != nil && !isMidnightUTC(*t.Date) {
+			return errors.New("Transition date must be at midnight UTC")
+		}
+	}
+	if n := r.NoncurrentVersionExpiration; n != nil && n.NoncurrentDays <= 0 {
+		return errors.New("NoncurrentDays must be positive")
+	}
+	if a := r.AbortIncompleteMultipartUpload; a != nil && a.DaysAfterInitiation <= 0 {
+		return errors.New("DaysAfterInitiation must be positive")
+	}
+	return nil
+}
+
+// matches reports whether the rule's filter selects the object.
+func (r *LifecycleRule) matches(object string, size int64, tags map[string]string) bool {
+	if r.Filter == nil {
+		return strings.HasPrefix(object, r.Prefix)
+	}
+
+	f := r.Filter
+	prefix, greater, less := f.Prefix, f.ObjectSizeGreaterThan, f.ObjectSizeLessThan
+	var wanted []Tag
+	if f.Tag != nil {
+		wanted = append(wanted, *f.Tag)
+	}
+	if f.And != nil {
+		prefix, greater, less = f.And.Prefix, f.And.ObjectSizeGreaterThan, f.And.ObjectSizeLessThan
+		wanted = f.And.Tags
+	}
+
+	if !strings.HasPrefix(object, prefix) {
+		return false
+	}
+	if greater != 0 && size <= greater {
+		return false
+	}
+	if less != 0 && size >= less {
+		return false
+	}
+	for _, tag := range wanted {
+		if value, ok := tags[tag.Key]; !ok || value != tag.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// expiresAt is when an object created at createdAt expires under the rule,
+// or the zero time if the rule does not expire objects.
+func (r *LifecycleRule) expiresAt(createdAt time.Time) time.Time {
+	if r.Expiration == nil {
+		return time.Time{}
+	}
+	return dueAt(createdAt, r.Expiration.Days, r.Expiration.Date)
+}
+
+// dueAt is when an action set to happen a number of days after createdAt,
+// or on a date, is due. Like S3, actions set in days happen at the first
+// midnight UTC after that many days.
+func dueAt(createdAt time.Time, days int, date *time.Time) time.Time {
+	if date != nil {
+		return *date
+	}
+	due := createdAt.UTC().Add(time.Duration(days) * 24 * time.Hour)
+	midnight := due.Truncate(24 * time.Hour)
+	if midnight.Before(due) {
+		midnight = midnight.Add(24 * time.Hour)
+	}
+	return midnight
+}
+
+func isMidnightUTC(t time.Time) bool {
+	return t.UTC().Equal(t.UTC().Truncate(24 * time.Hour))
+}
+
+// PutBucketLifecycle replaces the lifecycle rules of a bucket.
+func (l *LocalStorage) PutBucketLifecycle(bucket string, cfg *LifecycleConfiguration) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	return l.writeBucketConfig(bucket, "lifecycle", cfg)
+}
+
+// GetBucketLifecycle returns the lifecycle rules of a bucket, or nil when it
+// has none.
+func (l *LocalStorage) GetBucketLifecycle(bucket string) (*LifecycleConfiguration, error) {
+	var cfg LifecycleConfiguration
+	found, err := l.readBucketConfig(bucket, "lifecycle", &cfg)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// DeleteBucketLifecycle removes every lifecycle rule of a bucket.
+func (l *LocalStorage) DeleteBucketLifecycle(bucket string) error {
+	return l.deleteBucketConfig(bucket, "lifecycle")
+}
+
+// LifecycleAction is an action a lifecycle rule took, or would take in a
+// dry run, on an object.
+type LifecycleAction struct {
+	Bucket string
+	Object string
+	RuleID string
+	Action string
+	// StorageClass is the class a transition moves the object to.
+	StorageClass string
+	Size         int64
+}
+
+// LifecycleReport describes a pass over the lifecycle rules.
+type LifecycleReport struct {
+	Buckets int
+	Scanned int
+	Actions []LifecycleAction
+	// Retained counts the objects due to expire that object lock kept.
+	Retained int
+	// ExpiredRestores counts the restored copies of archived objects that
+	// expired and were deleted.
+	ExpiredRestores int
+	// Notes explains rules that could not do anything, like those acting
+	// on features this storage does not have.
+	Notes []string
+}
+
+// ApplyLifecycle evaluates the lifecycle rules of bucket, or of every
+// bucket if it is empty, as of now, and deletes restored copies of archived
+// objects that expired. In a dry run, the actions are reported but not
+// taken.
+func (l *LocalStorage) ApplyLifecycle(bucket string, now time.Time, dryRun bool) (*LifecycleReport, error) {
+	buckets := []string{bucket}
+	if bucket == "" {
+		var err error
+		if buckets, err = l.listBuckets(); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &LifecycleReport{}
+	for _, bucket := range buckets {
+		expired, err := l.expireRestores(bucket, now, dryRun)
+		report.ExpiredRestores += expired
+		if err != nil {
+			return report, err
+		}
+
+		cfg, err := l.GetBucketLifecycle(bucket)
+		if err != nil {
+			return report, err
+		}
+		if cfg == nil {
+			continue
+		}
+		report.Buckets++
+		if err := l.applyBucketLifecycle(bucket, cfg, now, dryRun, report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (l *LocalStorage) applyBucketLifecycle(bucket string, cfg *LifecycleConfiguration, now time.Time, dryRun bool, report *LifecycleReport) error {
+	var rules []*LifecycleRule
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.Status != LifecycleStatusEnabled {
+			continue
+		}
+		rules = append(rules, rule)
+
+		// Buckets are not versioned and uploads are never multipart, so
+		// these actions never find anything to act on
+		if rule.NoncurrentVersionExpiration != nil {
+			report.Notes = append(report.Notes, fmt.Sprintf("%s: rule %s: NoncurrentVersionExpiration has no effect, objects are not versioned", bucket, rule.name(i)))
+		}
+		if rule.AbortIncompleteMultipartUpload != nil {
+			report.Notes = append(report.Notes, fmt.Sprintf("%s: rule %s: AbortIncompleteMultipartUpload has no effect, multipart uploads are not supported", bucket, rule.name(i)))
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	objects, err := l.ListObjects(bucket)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		report.Scanned++
+		action := lifecycleActionFor(obj, rules, now)
+		if action == nil {
+			continue
+		}
+		if action.Action == LifecycleActionExpire && obj.locked(now) {
+			// Like S3, expiration never removes locked objects; they are
+			// picked up again once released
+			report.Retained++
+			continue
+		}
+		if !dryRun {
+			taken, err := l.takeLifecycleAction(obj, action)
+			if err != nil {
+				return err
+			}
+			if !taken {
+				continue
+			}
+		}
+		report.Actions = append(report.Actions, *action)
+	}
+	return nil
+}
+
+// lifecycleActionFor picks what the rules do to an object as of now, if
+// anything. Like S3, expiration wins over transitions, and among due
+// transitions the coldest class wins.
+func lifecycleActionFor(obj *ObjectInfo, rules []*LifecycleRule, now time.Time) *LifecycleAction {
+	var transition *LifecycleAction
+	for _, rule := range rules {
+		if !rule.matches(obj.Object, obj.Size, obj.Tags) {
+			continue
+		}
+
+		if expiry := rule.expiresAt(obj.CreatedAt); !expiry.IsZero() && !expiry.After(now) {
+			return &LifecycleAction{Bucket: obj.Bucket, Object: obj.Object, RuleID: rule.ID, Action: LifecycleActionExpire, Size: obj.Size}
+		}
+
+		for _, t := range rule.Transitions {
+			if dueAt(obj.CreatedAt, t.Days, t.Date).After(now) || !colder(t.StorageClass, obj.StorageClass) {
+				continue
+			}
+			if transition == nil || colder(t.StorageClass, transition.StorageClass) {
+				transition = &LifecycleAction{
+					Bucket: obj.Bucket, Object: obj.Object, RuleID: rule.ID,
+					Action: LifecycleActionTransition, StorageClass: t.StorageClass, Size: obj.Size,
+				}
+			}
+		}
+	}
+	return transition
+}
+
+// takeLifecycleAction applies an action to the object, as long as it is
+// still the version that was evaluated. It reports whether it did.
+func (l *LocalStorage) takeLifecycleAction(obj *ObjectInfo, action *LifecycleAction) (bool, error) {
+	unchanged := func(meta *objectMeta) bool {
+		return meta.CreatedAt.Equal(obj.CreatedAt)
+	}
+
+	var taken bool
+	var err error
+	switch action.Action {
+	case LifecycleActionExpire:
+		taken, err = l.remove(obj.Bucket, obj.Object, EventLifecycleExpirationDelete, func(meta *objectMeta) bool {
+			return unchanged(meta) && meta.checkLock(time.Now(), false) == nil
+		})
+	case LifecycleActionTransition:
+		taken, err = l.transition(obj.Bucket, obj.Object, action.StorageClass, unchanged)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		// Deleted since it was listed
+		return false, nil
+	}
+	return taken, err
+}
+
+// RunLifecycle applies the lifecycle rules of every bucket each interval,
+// until ctx is done. Each pass is handed to report.
+func (l *LocalStorage) RunLifecycle(ctx context.Context, interval time.Duration, report func(*LifecycleReport, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			report(l.ApplyLifecycle("", now, false))
+		}
+	}
+}
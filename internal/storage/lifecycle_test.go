@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const lifecycleXML = `<?xml version="1.0" encoding="UTF-8"?>
+<LifecycleConfiguration>
+  <Rule>
+    <ID>expire-logs</ID>
+    <Filter><Prefix>logs/</Prefix></Filter>
+    <Status>Enabled</Status>
+    <Expiration><Days>30</Days></Expiration>
+  </Rule>
+  <Rule>
+    <ID>cleanup</ID>
+    <Filter>
+      <And>
+        <Prefix>tmp/</Prefix>
+        <Tag><Key>temp</Key><Value>true</Value></Tag>
+      </And>
+    </Filter>
+    <Status>Enabled</Status>
+    <NoncurrentVersionExpiration><NoncurrentDays>7</NoncurrentDays></NoncurrentVersionExpiration>
+    <AbortIncompleteMultipartUpload><DaysAfterInitiation>1</DaysAfterInitiation></AbortIncompleteMultipartUpload>
+  </Rule>
+</LifecycleConfiguration>`
+
+const lifecycleJSON = `{
+  "Rules": [
+    {"ID": "expire-logs", "Filter": {"Prefix": "logs/"}, "Status": "Enabled", "Expiration": {"Days": 30}},
+    {
+      "ID": "cleanup",
+      "Filter": {"And": {"Prefix": "tmp/", "Tags": [{"Key": "temp", "Value": "true"}]}},
+      "Status": "Enabled",
+      "NoncurrentVersionExpiration": {"NoncurrentDays": 7},
+      "AbortIncompleteMultipartUpload": {"DaysAfterInitiation": 1}
+    }
+  ]
+}`
+
+func TestParseLifecycleConfiguration(t *testing.T) {
+	for name, data := range map[string]string{"XML": lifecycleXML, "JSON": lifecycleJSON} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := ParseLifecycleConfiguration([]byte(data))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Expected a valid configuration, got %v", err)
+			}
+			if len(cfg.Rules) != 2 || cfg.Rules[0].Expiration.Days != 30 || cfg.Rules[0].Filter.Prefix != "logs/" {
+				t.Errorf("Unexpected first rule: %+v", cfg.Rules[0])
+			}
+			and := cfg.Rules[1].Filter.And
+			if and == nil || and.Prefix != "tmp/" || len(and.Tags) != 1 || and.Tags[0].Key != "temp" {
+				t.Errorf("Unexpected And filter: %+v", and)
+			}
+			if cfg.Rules[1].NoncurrentVersionExpiration.NoncurrentDays != 7 {
+				t.Errorf("Unexpected second rule: %+v", cfg.Rules[1])
+			}
+		})
+	}
+}
+
+func TestLifecycleConfiguration_Validate(t *testing.T) {
+	date := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		rule   LifecycleRule
+		reason string
+	}{
+		{"unknown status", LifecycleRule{Status: "On", Expiration: &LifecycleExpiration{Days: 1}}, "status must be"},
+		{"no action", LifecycleRule{Status: LifecycleStatusEnabled}, "at least one action"},
+		{"days and date", LifecycleRule{Status: LifecycleStatusEnabled, Expiration: &LifecycleExpiration{Days: 1, Date: &date}}, "exactly one of Days or Date"},
+		{"date not at midnight", LifecycleRule{Status: LifecycleStatusEnabled, Expiration: &LifecycleExpiration{Date: &date}}, "midnight UTC"},
+		{"two filter conditions", LifecycleRule{Status: LifecycleStatusEnabled, Filter: &LifecycleFilter{Prefix: "a", Tag: &Tag{Key: "k"}}, Expiration: &LifecycleExpiration{Days: 1}}, "use And"},
+		{"no noncurrent days", LifecycleRule{Status: LifecycleStatusEnabled, NoncurrentVersionExpiration: &NoncurrentVersionExpiration{}}, "NoncurrentDays must be positive"},
+		{"no days after initiation", LifecycleRule{Status: LifecycleStatusEnabled, AbortIncompleteMultipartUpload: &AbortIncompleteMultipartUpload{DaysAfterInitiation: -1}}, "DaysAfterInitiation must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &LifecycleConfiguration{Rules: []LifecycleRule{tt.rule}}
+			var invalid *ErrInvalidLifecycle
+			if err := cfg.Validate(); !errors.As(err, &invalid) || !strings.Contains(invalid.Reason, tt.reason) {
+				t.Errorf("Expected error containing '%s', got %v", tt.reason, err)
+			}
+		})
+	}
+}
+
+// backdate pretends an object was created at the given time.
+func backdate(t *testing.T, storage *LocalStorage, bucket, object string, createdAt time.Time) {
+	t.Helper()
+	meta, err := storage.readMeta(bucket, object)
+	if err != nil || meta == nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	meta.CreatedAt = createdAt
+	if err := storage.writeMeta(bucket, object, meta); err != nil {
+		t.Fatalf("Failed to write metadata: %v", err)
+	}
+}
+
+func TestLocalStorage_ApplyLifecycle(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+	now := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)
+	for object, age := range map[string]time.Duration{
+		"logs/old.log":   40 * 24 * time.Hour,
+		"logs/new.log":   2 * 24 * time.Hour,
+		"tmp/scratch":    40 * 24 * time.Hour,
+		"data/keep.json": 40 * 24 * time.Hour,
+	} {
+		if _, err := storage.Save("app", object, strings.NewReader("content")); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		backdate(t, storage, "app", object, now.Add(-age))
+	}
+
+	cfg, err := ParseLifecycleConfiguration([]byte(lifecycleJSON))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if err := storage.PutBucketLifecycle("app", cfg); err != nil {
+		t.Fatalf("Failed to set lifecycle: %v", err)
+	}
+
+	t.Run("Keeps actions it has nothing to act on", func(t *testing.T) {
+		stored, err := storage.GetBucketLifecycle("app")
+		if err != nil {
+			t.Fatalf("Failed to get lifecycle: %v", err)
+		}
+		cleanup := stored.Rules[1]
+		if cleanup.NoncurrentVersionExpiration == nil || cleanup.NoncurrentVersionExpiration.NoncurrentDays != 7 ||
+			cleanup.AbortIncompleteMultipartUpload == nil || cleanup.AbortIncompleteMultipartUpload.DaysAfterInitiation != 1 {
+			t.Errorf("Unexpected cleanup rule: %+v", cleanup)
+		}
+	})
+
+	t.Run("Dry run reports without deleting", func(t *testing.T) {
+		report, err := storage.ApplyLifecycle("", now, true)
+		if err != nil {
+			t.Fatalf("Failed to apply lifecycle: %v", err)
+		}
+		if len(report.Actions) != 1 || report.Actions[0].Object != "logs/old.log" || report.Actions[0].RuleID != "expire-logs" {
+			t.Errorf("Expected logs/old.log to expire, got %+v", report.Actions)
+		}
+		if len(report.Notes) != 2 {
+			t.Errorf("Expected notes about versioning and multipart, got %v", report.Notes)
+		}
+		if exists, _ := storage.Exists("app", "logs/old.log"); !exists {
+			t.Errorf("Expected dry run to keep the object")
+		}
+	})
+
+	t.Run("Expires matching objects", func(t *testing.T) {
+		report, err := storage.ApplyLifecycle("app", now, false)
+		if err != nil {
+			t.Fatalf("Failed to apply lifecycle: %v", err)
+		}
+		if len(report.Actions) != 1 || report.Scanned != 4 {
+			t.Errorf("Expected 1 of 4 objects expired, got %+v", report)
+		}
+		for object, expected := range map[string]bool{"logs/old.log": false, "logs/new.log": true, "tmp/scratch": true, "data/keep.json": true} {
+			if exists, _ := storage.Exists("app", object); exists != expected {
+				t.Errorf("Expected %s to exist: %v", object, expected)
+			}
+		}
+	})
+
+	t.Run("Expires on a date", func(t *testing.T) {
+		date := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		cfg := &LifecycleConfiguration{Rules: []LifecycleRule{
+			{ID: "cutoff", Status: LifecycleStatusEnabled, Prefix: "data/", Expiration: &LifecycleExpiration{Date: &date}},
+		}}
+		if err := storage.PutBucketLifecycle("app", cfg); err != nil {
+			t.Fatalf("Failed to set lifecycle: %v", err)
+		}
+
+		report, err := storage.ApplyLifecycle("app", date.Add(-time.Hour), false)
+		if err != nil || len(report.Actions) != 0 {
+			t.Errorf("Expected nothing to expire before the date, got %+v, %v", report, err)
+		}
+		report, err = storage.ApplyLifecycle("app", date, false)
+		if err != nil || len(report.Actions) != 1 || report.Actions[0].Object != "data/keep.json" {
+			t.Errorf("Expected data/keep.json to expire on the date, got %+v, %v", report, err)
+		}
+	})
+}
+
+func TestLifecycleRule_ExpiresAt(t *testing.T) {
+	rule := &LifecycleRule{Expiration: &LifecycleExpiration{Days: 1}}
+	created := time.Date(2024, 1, 1, 15, 30, 0, 0, time.UTC)
+	expected := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	if got := rule.expiresAt(created); !got.Equal(expected) {
+		t.Errorf("Expected expiry at %v, got %v", expected, got)
+	}
+}
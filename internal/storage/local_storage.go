@@ -1,10 +1,17 @@
 package storage
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,12 +22,76 @@ type ObjectInfo struct {
 	Checksum  string
 	CreatedAt time.Time
 	Path      string
+
+	// ETag identifies the object's content: the hex MD5 of it, like S3 for
+	// objects uploaded in one part. It changes whenever the object is
+	// overwritten with other content, which makes it the value to give
+	// conditional requests.
+	ETag string
+
+	// ServerSideEncryption is set when the object is encrypted at rest with
+	// a master key, and KeyVersion tells which version wraps its data key.
+	ServerSideEncryption string
+	KeyVersion           int
+
+	// Compression is the algorithm the object is stored with, and
+	// CompressedSize its size after compression. Size and Checksum always
+	// describe the uncompressed object.
+	Compression    string
+	CompressedSize int64
+
+	// SSECustomerAlgorithm and SSECustomerKeyMD5 are set when the object is
+	// encrypted with a customer-provided key.
+	SSECustomerAlgorithm string
+	SSECustomerKeyMD5    string
+
+	// StorageClass is the tier the object's data is kept in.
+	StorageClass string
+	// RestoreExpiresAt is set while an archived object has a restored copy,
+	// and tells when that copy goes away.
+	RestoreExpiresAt time.Time
+
+	// Retention is set while the object is under object lock retention,
+	// and LegalHold while it is under legal hold.
+	Retention *Retention
+	LegalHold bool
+
+	// Tags are the object's tags, nil when it has none.
+	Tags map[string]string
+
+	// ContentType and the other standard HTTP headers are returned as they
+	// were saved. UserMetadata holds the user-defined metadata, keyed by
+	// lowercase name without the x-amz-meta- prefix.
+	ContentType        string
+	ContentEncoding    string
+	ContentDisposition string
+	CacheControl       string
+	Expires            time.Time
+	UserMetadata       map[string]string
+
+	// ReplicationStatus tells how far replicating the object has got:
+	// PENDING, COMPLETED or FAILED, or REPLICA for the copies. It is empty
+	// for objects no replication rule selected.
+	ReplicationStatus string
+
+	// Range is the part of the object returned by a ranged Get.
+	Range *ByteRange
 }
 
+// ErrUnavailable is returned by Storage implementations spread over
+// several nodes when too few of them can be reached to serve a request.
+var ErrUnavailable = errors.New("the storage is temporarily unavailable")
+
+// ErrNotImplemented is returned by Storage implementations for options
+// they do not support.
+var ErrNotImplemented = errors.New("the storage does not implement this option")
+
 type Storage interface {
-	Save(bucket, object string, r io.Reader) (*ObjectInfo, error)
-	Get(bucket, object string) (io.ReadCloser, *ObjectInfo, error)
-	Delete(bucket, object string) error
+	Save(bucket, object string, r io.Reader, opts ...Option) (*ObjectInfo, error)
+	Get(bucket, object string, opts ...Option) (io.ReadCloser, *ObjectInfo, error)
+	Head(bucket, object string, opts ...Option) (*ObjectInfo, error)
+	Delete(bucket, object string, opts ...Option) error
+	CopyObject(srcBucket, srcObject, dstBucket, dstObject string, opts ...Option) (*ObjectInfo, error)
 	Exists(bucket, object string) (bool, error)
 	ListObjects(bucket string) ([]*ObjectInfo, error)
 }
@@ -28,28 +99,181 @@ type Storage interface {
 type LocalStorage struct {
 	path     string
 	checksum Checksum
+	keyring  *Keyring
+
+	// backends holds every Backend objects may be stored in, so objects
+	// stay readable when the default changes. New objects go to
+	// defaultBackend.
+	backends       map[string]Backend
+	defaultBackend string
+	// disks is set when object data is spread over several disks.
+	disks *diskSet
+
+	notifier *notifier
+	changes  *changeFeed
+	// unpublished is set while changes may wait in the unpublished
+	// directory, which is the case until the first look at it.
+	unpublished atomic.Bool
+
+	// replication sequences and wakes up replication like notifier does
+	// notifications, and openRemote opens the Storage of http(s)://
+	// replication endpoints.
+	replication *notifier
+	openRemote  func(endpoint string) (Storage, error)
+}
+
+// LocalStorageOption configures optional LocalStorage features.
+type LocalStorageOption func(*LocalStorage)
+
+// WithKeyring enables encryption at rest: objects saved without a customer
+// key are encrypted with a data key wrapped by the keyring's active master
+// key.
+func WithKeyring(keyring *Keyring) LocalStorageOption {
+	return func(l *LocalStorage) {
+		l.keyring = keyring
+	}
+}
+
+// WithDeduplication stores object data in a content-addressed blob store,
+// so identical content saved under many keys is only kept once.
+func WithDeduplication() LocalStorageOption {
+	return func(l *LocalStorage) {
+		l.defaultBackend = backendBlob
+	}
+}
+
+// WithChunkedDeduplication splits object data into content-defined chunks
+// and stores each distinct chunk once, so objects that only partly match,
+// like successive versions of a file, still share storage. Compressed and
+// encrypted objects are deduplicated whole instead, like with
+// WithDeduplication.
+func WithChunkedDeduplication() LocalStorageOption {
+	return func(l *LocalStorage) {
+		l.defaultBackend = backendChunk
+	}
+}
+
+func NewLocalStorage(path string, checkSum Checksum, opts ...LocalStorageOption) *LocalStorage {
+	l := &LocalStorage{
+		path:     path,
+		checksum: checkSum,
+		backends: map[string]Backend{
+			backendFile:     newFileBackend(path),
+			backendBlob:     newBlobBackend(path),
+			backendChunk:    newChunkBackend(path),
+			backendCold:     newClassBackend(path, StorageClassCold, DefaultStorageClassRoot(path, StorageClassCold)),
+			backendArchive:  newClassBackend(path, StorageClassArchive, DefaultStorageClassRoot(path, StorageClassArchive)),
+			backendRestored: newFileBackend(filepath.Join(path, systemDir, "restored")),
+		},
+		defaultBackend: backendFile,
+		notifier:       newNotifier(),
+		changes:        newChangeFeed(),
+		replication:    newNotifier(),
+	}
+	l.unpublished.Store(true)
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// DefaultKeyringPath is where the keyring lives unless configured
+// otherwise: in the user's configuration directory, away from the data it
+// protects.
+func DefaultKeyringPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mini-s3", "keyring.json"), nil
+}
+
+// LegacyKeyringPath is where the keyring used to live by default, inside
+// the data directory root.
+func LegacyKeyringPath(root string) string {
+	return filepath.Join(root, systemDir, "keyring.json")
+}
+
+// ValidateKeyringPath refuses keyring paths inside the data directory
+// root, where anyone able to copy the data would get the keys decrypting
+// it along.
+func ValidateKeyringPath(root, path string) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(absRoot, absPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("the keyring %s must be kept outside the data directory %s", path, root)
+	}
+	return nil
 }
 
-func NewLocalStorage(path string, checkSum Checksum) *LocalStorage {
-	return &LocalStorage{path: path, checksum: checkSum}
+// DefaultRaftDir returns where a cluster node keeps its Raft log, next to
+// the object data it holds under root.
+func DefaultRaftDir(root string) string {
+	return filepath.Join(root, systemDir, "raft")
 }
 
-func (l *LocalStorage) Save(bucket, object string, r io.Reader) (*ObjectInfo, error) {
+func (l *LocalStorage) Save(bucket, object string, r io.Reader, opts ...Option) (*ObjectInfo, error) {
+	if err := validateObjectName(bucket, object); err != nil {
+		return nil, err
+	}
+	o := NewOptions(opts...)
 	createdAt := time.Now()
 
+	class := StorageClassStandard
+	if o.StorageClass != "" {
+		class = o.StorageClass
+	}
+	if err := validateStorageClass(class); err != nil {
+		return nil, err
+	}
+
+	retention, legalHold, err := l.lockSettings(bucket, o, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateTags(o.Tags); err != nil {
+		return nil, err
+	}
+
+	headers, err := newContentHeaders(o)
+	if err != nil {
+		return nil, err
+	}
+	if headers.ContentType == "" {
+		if headers.ContentType, r, err = DetectContentType(object, r); err != nil {
+			return nil, err
+		}
+	}
+
+	enc, dataKey, err := l.newEncryption(o)
+	if err != nil {
+		return nil, err
+	}
+
+	compression, r, err := l.compressionFor(bucket, object, r)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create bucket directory
 	path := filepath.Join(l.path, bucket)
-	err := os.MkdirAll(path, 0755)
+	err = os.MkdirAll(path, 0755)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create file
-	filePath := filepath.Join(path, object)
-	file, err := os.Create(filePath)
+	// Write to a temporary file, handed over to the backend once complete
+	file, err := l.createTemp()
 	if err != nil {
 		return nil, err
 	}
+	defer os.Remove(file.Name())
 	defer file.Close()
 
 	// Split the stream with a pipe
@@ -69,15 +293,28 @@ func (l *LocalStorage) Save(bucket, object string, r io.Reader) (*ObjectInfo, er
 		checksumCh <- checksum
 	}()
 
-	// Write to file and pipe it
-	teeReader := io.TeeReader(r, pw)
-	size, err := io.Copy(file, teeReader)
+	// Compress and encrypt on the way to disk, as configured
+	w, err := newObjectWriter(file, dataKey, compression)
+	if err != nil {
+		return nil, err
+	}
+
+	// Write to file and pipe it, computing the ETag and the digest of the
+	// content on the way
+	etag := md5.New()
+	logical := sha256.New()
+	teeReader := io.TeeReader(r, io.MultiWriter(pw, etag, logical))
+	size, err := io.Copy(w, teeReader)
 	pw.Close()
 
 	if err != nil {
 		return nil, err
 	}
 
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
 	// Wait for checksum to be computed
 	var checksum string
 	select {
@@ -86,52 +323,287 @@ func (l *LocalStorage) Save(bucket, object string, r io.Reader) (*ObjectInfo, er
 		return nil, err
 	}
 
-	newObj := &ObjectInfo{
-		Bucket:    bucket,
-		Object:    object,
-		Size:      size,
-		Checksum:  checksum,
-		CreatedAt: createdAt,
-		Path:      filePath,
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	backendName := l.backendFor(class)
+	if backendName == backendChunk && (dataKey != nil || compression != "") {
+		// Compressed and encrypted bytes change all along for an edit, so
+		// chunking them finds nothing to share: they are deduplicated whole
+		backendName = backendBlob
+	}
+	digest := w.digest()
+	if dataKey != nil && dedupBackend(backendName) {
+		// A random data key would make every copy of the content differ
+		digest, err = l.convergeEncryption(file.Name(), enc, dataKey, o, compression, logical.Sum(nil))
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return newObj, nil
+	unlock, err := l.lockObject(bucket, object, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	previous, err := l.loadMeta(bucket, object)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if o.Conditions != nil {
+		if err := o.Conditions.check(previous, false); err != nil {
+			return nil, err
+		}
+	}
+	if previous != nil {
+		// Objects are not versioned, so overwriting destroys the previous
+		// one
+		if err := previous.checkLock(time.Now(), o.BypassGovernanceRetention); err != nil {
+			return nil, err
+		}
+	}
+
+	locator, err := l.backends[backendName].Put(bucket, object, file.Name(), digest)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &objectMeta{
+		Size:       size,
+		Checksum:   checksum,
+		ETag:       hex.EncodeToString(etag.Sum(nil)),
+		CreatedAt:  createdAt,
+		Encryption: enc,
+		Backend:    backendName,
+		Locator:    locator,
+		Retention:  retention,
+		LegalHold:  legalHold,
+
+		contentHeaders: headers,
+	}
+	if len(o.Tags) > 0 {
+		meta.Tags = o.Tags
+	}
+	if o.Replica {
+		meta.ReplicationStatus = ReplicationStatusReplica
+	}
+	if class != StorageClassStandard {
+		meta.StorageClass = class
+	}
+	if compression != "" {
+		meta.Compression = compression
+		meta.CompressedSize = w.storedSize()
+	}
+	if err := l.writeMeta(bucket, object, meta); err != nil {
+		return nil, err
+	}
+
+	if err := l.releasePrevious(bucket, object, previous, meta); err != nil {
+		return nil, err
+	}
+
+	event := o.event
+	if event == "" {
+		event = EventObjectCreatedPut
+	}
+	l.publish(bucket, object, event, previous, meta)
+	return l.newObjectInfo(bucket, object, meta), nil
+}
+
+// releasePrevious releases the bytes of the version of an object that meta
+// replaced, if there was one, unless the backend replaced them in place.
+// Bytes on a disk that is offline are left for removeStale.
+func (l *LocalStorage) releasePrevious(bucket, object string, previous, meta *objectMeta) error {
+	if previous == nil {
+		return nil
+	}
+	oldBackend, oldLocator := previous.location(bucket, object)
+	if oldBackend != meta.Backend || oldLocator != meta.Locator {
+		err := l.backends[oldBackend].Remove(bucket, object, oldLocator)
+		if errors.Is(err, ErrUnavailable) {
+			l.deferRemoval(&staleData{Bucket: bucket, Object: object, Backend: oldBackend, Locator: oldLocator})
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return l.releaseRestore(bucket, object, previous)
 }
 
-func (l *LocalStorage) Get(bucket, object string) (io.ReadCloser, *ObjectInfo, error) {
-	filepath := filepath.Join(l.path, bucket, object)
+func (l *LocalStorage) Get(bucket, object string, opts ...Option) (io.ReadCloser, *ObjectInfo, error) {
+	if err := validateObjectName(bucket, object); err != nil {
+		return nil, nil, err
+	}
+	o := NewOptions(opts...)
+
+	// Hold a shared lock so the data and metadata come from the same write
+	unlock, err := l.lockObject(bucket, object, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	file, err := os.Open(filepath)
+	dataKey, err := l.dataKey(meta, o)
 	if err != nil {
 		return nil, nil, err
 	}
+	// Checked once the caller proved it may read the object
+	if o.Conditions != nil {
+		if err := o.Conditions.check(meta, true); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	objInfo := l.newObjectInfo(bucket, object, meta)
+	if o.Range != nil {
+		if objInfo.Range, err = o.Range.resolve(meta.Size); err != nil {
+			return nil, nil, err
+		}
+	}
 
-	info, err := file.Stat()
+	backend, locator, err := meta.readLocation(bucket, object, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if dataKey == nil && objInfo.Compression == "" {
+		// Stored bytes are the object itself, so a range maps onto them
+		if objInfo.Range != nil {
+			file, err := openRange(l.backends[backend], locator, objInfo.Range)
+			if err != nil {
+				return nil, nil, err
+			}
+			return file, objInfo, nil
+		}
+		file, err := l.backends[backend].Open(locator)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, objInfo, nil
+	}
+
+	file, err := l.backends[backend].Open(locator)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := newObjectReader(file, dataKey, objInfo.Compression)
 	if err != nil {
 		file.Close()
 		return nil, nil, err
 	}
+	if objInfo.Range != nil {
+		sliced, err := sliceReader(reader, objInfo.Range)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sliced, objInfo, nil
+	}
+	return reader, objInfo, nil
+}
+
+// Head returns an object's information without reading it. Unlike Get, it
+// works on archived objects that are not restored. Objects encrypted with a
+// customer key still need the key.
+func (l *LocalStorage) Head(bucket, object string, opts ...Option) (*ObjectInfo, error) {
+	if err := validateObjectName(bucket, object); err != nil {
+		return nil, err
+	}
+	o := NewOptions(opts...)
+
+	unlock, err := l.lockObject(bucket, object, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.dataKey(meta, o); err != nil {
+		return nil, err
+	}
+	if o.Conditions != nil {
+		if err := o.Conditions.check(meta, true); err != nil {
+			return nil, err
+		}
+	}
+
+	info := l.newObjectInfo(bucket, object, meta)
+	if o.Range != nil {
+		if info.Range, err = o.Range.resolve(meta.Size); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
 
-	objInfo := &ObjectInfo{
-		Bucket:    bucket,
-		Object:    object,
-		Size:      info.Size(),
-		Checksum:  "",
-		CreatedAt: info.ModTime(),
-		Path:      filepath,
+// Delete removes an object, unless object lock protects it.
+func (l *LocalStorage) Delete(bucket, object string, opts ...Option) error {
+	if err := validateObjectName(bucket, object); err != nil {
+		return err
 	}
+	o := NewOptions(opts...)
 
-	return file, objInfo, nil
+	var lockErr error
+	_, err := l.remove(bucket, object, EventObjectRemovedDelete, func(meta *objectMeta) bool {
+		lockErr = meta.checkLock(time.Now(), o.BypassGovernanceRetention)
+		return lockErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return lockErr
 }
 
-func (l *LocalStorage) Delete(bucket, object string) error {
-	filePath := filepath.Join(l.path, bucket, object)
-	return os.Remove(filePath)
+// remove deletes an object if match, when given, accepts its current
+// metadata, and publishes the deletion as an event of type event. It
+// reports whether the object was deleted. Like releasePrevious, it leaves
+// data on a disk that is offline for removeStale.
+func (l *LocalStorage) remove(bucket, object, event string, match func(*objectMeta) bool) (bool, error) {
+	unlock, err := l.lockObject(bucket, object, true)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return false, err
+	}
+	if match != nil && !match(meta) {
+		return false, nil
+	}
+
+	backend, locator := meta.location(bucket, object)
+	err = l.backends[backend].Remove(bucket, object, locator)
+	unavailable := errors.Is(err, ErrUnavailable)
+	if err != nil && !unavailable && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	if err := l.releaseRestore(bucket, object, meta); err != nil {
+		return false, err
+	}
+	if err := l.deleteMeta(bucket, object); err != nil {
+		return false, err
+	}
+	if unavailable {
+		l.deferRemoval(&staleData{Bucket: bucket, Object: object, Backend: backend, Locator: locator})
+	}
+	l.publish(bucket, object, event, meta, nil)
+	return true, nil
 }
 
 func (l *LocalStorage) Exists(bucket, object string) (bool, error) {
-	filePath := filepath.Join(l.path, bucket, object)
-	_, err := os.Stat(filePath)
+	if err := validateObjectName(bucket, object); err != nil {
+		return false, err
+	}
+	_, err := l.loadMeta(bucket, object)
 	if err == nil {
 		return true, nil
 	}
@@ -142,36 +614,140 @@ func (l *LocalStorage) Exists(bucket, object string) (bool, error) {
 }
 
 func (l *LocalStorage) ListObjects(bucket string) ([]*ObjectInfo, error) {
-	filePath := filepath.Join(l.path, bucket)
-	files, err := os.ReadDir(filePath)
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+	names, err := l.objectNames(bucket)
 	if err != nil {
 		return nil, err
 	}
 
 	var infos []*ObjectInfo
-	for _, file := range files {
-		if file.IsDir() {
+	for _, name := range names {
+		meta, err := l.loadMeta(bucket, name)
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted while listing
 			continue
 		}
-
-		objectPath := filepath.Join(filePath, file.Name())
-		fileInfo, err := file.Info()
 		if err != nil {
 			return nil, err
 		}
-		infos = append(infos, &ObjectInfo{
-			Bucket:    bucket,
-			Object:    file.Name(),
-			Size:      fileInfo.Size(),
-			Checksum:  "",
-			CreatedAt: fileInfo.ModTime(),
-			Path:      objectPath,
-		})
+		infos = append(infos, l.newObjectInfo(bucket, name, meta))
 	}
 
 	return infos, nil
 }
 
+// objectNames returns the sorted names of all objects in a bucket: those
+// with a metadata sidecar, plus plain files saved before sidecars existed.
+// Keys containing slashes live in subdirectories, which are walked too.
+func (l *LocalStorage) objectNames(bucket string) ([]string, error) {
+	bucketPath := filepath.Join(l.path, bucket)
+	if _, err := os.Stat(bucketPath); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	err := walkFiles(bucketPath, func(name string) {
+		// Plain files can only take a reserved name if written behind
+		// our back; they are not objects
+		if !isReservedKey(name) {
+			seen[name] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = walkFiles(filepath.Join(bucketPath, metaDir), func(name string) {
+		if name, ok := strings.CutSuffix(name, ".json"); ok {
+			seen[name] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// walkFiles calls fn with the slash-separated path, relative to root, of
+// every file below root. Hidden directories directly under root hold
+// metadata and settings rather than objects, so they are skipped.
+func walkFiles(root string, fn func(name string)) error {
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if rel != "." && filepath.Dir(rel) == "." && strings.HasPrefix(rel, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fn(filepath.ToSlash(rel))
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// newObjectInfo builds an ObjectInfo from the object's metadata.
+func (l *LocalStorage) newObjectInfo(bucket, object string, meta *objectMeta) *ObjectInfo {
+	backend, locator := meta.location(bucket, object)
+	info := &ObjectInfo{
+		Bucket: bucket,
+		Object: object,
+		Path:   l.backends[backend].Path(locator),
+	}
+
+	info.Size = meta.Size
+	info.Checksum = meta.Checksum
+	info.ETag = meta.etag()
+	info.CreatedAt = meta.CreatedAt
+	info.Compression = meta.Compression
+	info.CompressedSize = meta.CompressedSize
+	info.StorageClass = meta.storageClass()
+	if meta.Restore != nil {
+		info.RestoreExpiresAt = meta.Restore.ExpiresAt
+	}
+	info.Retention = meta.Retention
+	info.LegalHold = meta.LegalHold
+	info.Tags = meta.Tags
+	info.ReplicationStatus = meta.ReplicationStatus
+	info.setContentHeaders(meta.contentHeaders)
+	if enc := meta.Encryption; enc != nil {
+		if enc.KeyMD5 != "" {
+			info.SSECustomerAlgorithm = enc.Algorithm
+			info.SSECustomerKeyMD5 = enc.KeyMD5
+		} else {
+			info.ServerSideEncryption = enc.Algorithm
+			info.KeyVersion = enc.KeyVersion
+		}
+	}
+	return info
+}
+
+// createTemp creates a file in the system directory, which lives on the same
+// file system as the buckets so it can be renamed into place.
+func (l *LocalStorage) createTemp() (*os.File, error) {
+	dir := filepath.Join(l.path, systemDir, "tmp")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, "upload-*")
+}
+
 type ErrInvalidChecksum struct {
 	Got      string
 	Expected string
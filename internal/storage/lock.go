@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Locks are striped over a fixed set of lock files so that locking never
+// has to create anything inside a bucket, and the number of files stays
+// bounded no matter how many keys there are.
+const lockStripes = 256
+
+// Lock domains keep unrelated locks on separate stripes, so a lock from one
+// domain can be taken while holding one from another. Nesting is always
+// object, then one of the content store domains or the change journal, or
+// object, then publish, then the change journal.
+const (
+	lockDomainObject   = "object"
+	lockDomainBlob     = "blob"
+	lockDomainManifest = "manifest"
+	lockDomainChunk    = "chunk"
+	lockDomainArchive  = "archive"
+	lockDomainChanges  = "changes"
+	lockDomainDisks    = "disks"
+	lockDomainPublish  = "publish"
+)
+
+// processLocks complement the file locks, which are only advisory between
+// processes on some platforms.
+var (
+	processLocksMu sync.Mutex
+	processLocks   = map[string]*[lockStripes]sync.RWMutex{}
+)
+
+func stripeMutex(domain string, stripe uint32) *sync.RWMutex {
+	processLocksMu.Lock()
+	defer processLocksMu.Unlock()
+	stripes, ok := processLocks[domain]
+	if !ok {
+		stripes = &[lockStripes]sync.RWMutex{}
+		processLocks[domain] = stripes
+	}
+	return &stripes[stripe]
+}
+
+// lockObject serialises changes to an object's data and metadata, both
+// within this process and against other processes sharing the data
+// directory. Readers take a shared lock, writers an exclusive one. The
+// returned function releases the lock.
+func (l *LocalStorage) lockObject(bucket, object string, exclusive bool) (func(), error) {
+	return lockKey(l.path, lockDomainObject, bucket+"/"+object, exclusive)
+}
+
+// lockKey locks key within domain under the data directory at root.
+func lockKey(root, domain, key string, exclusive bool) (func(), error) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	stripe := h.Sum32() % lockStripes
+
+	dir := filepath.Join(root, systemDir, "locks")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%s-%03d.lock", domain, stripe)), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	mu := stripeMutex(domain, stripe)
+	if exclusive {
+		mu.Lock()
+	} else {
+		mu.RLock()
+	}
+	if err := lockFile(file, exclusive); err != nil {
+		if exclusive {
+			mu.Unlock()
+		} else {
+			mu.RUnlock()
+		}
+		file.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = unlockFile(file)
+		file.Close()
+		if exclusive {
+			mu.Unlock()
+		} else {
+			mu.RUnlock()
+		}
+	}, nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// Without flock, objects are only locked within the current process.
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// metaDir is the hidden directory inside each bucket holding one JSON
+	// sidecar per object. ListObjects skips directories, so it never shows
+	// up as an object.
+	metaDir = ".meta"
+
+	// systemDir holds state that does not belong to any bucket. Bucket
+	// names cannot start with a dot, so it never clashes with one.
+	systemDir = ".mini-s3"
+)
+
+// objectMeta is what gets persisted next to every object.
+type objectMeta struct {
+	Size       int64           `json:"size"`
+	Checksum   string          `json:"checksum"`
+	ETag       string          `json:"etag,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	Encryption *encryptionMeta `json:"encryption,omitempty"`
+
+	// Compression is empty for objects stored as is.
+	Compression    string `json:"compression,omitempty"`
+	CompressedSize int64  `json:"compressedSize,omitempty"`
+
+	// Backend and Locator tell where the object's bytes are stored. Both
+	// are empty for objects saved before backends existed, which live in
+	// the file backend under their own name.
+	Backend string `json:"backend,omitempty"`
+	Locator string `json:"locator,omitempty"`
+
+	// StorageClass is empty for standard objects.
+	StorageClass string `json:"storageClass,omitempty"`
+
+	// Restore is set while an archived object has a readable copy.
+	Restore *restoreMeta `json:"restore,omitempty"`
+
+	// Retention and LegalHold are the object lock protecting the object.
+	Retention *Retention `json:"retention,omitempty"`
+	LegalHold bool       `json:"legalHold,omitempty"`
+
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// ReplicationStatus is empty for objects no replication rule selected.
+	ReplicationStatus string `json:"replicationStatus,omitempty"`
+
+	contentHeaders
+}
+
+// location returns the backend and locator of the object's bytes.
+func (m *objectMeta) location(bucket, object string) (string, string) {
+	if m.Backend == "" {
+		return backendFile, bucket + "/" + object
+	}
+	return m.Backend, m.Locator
+}
+
+type encryptionMeta struct {
+	Algorithm string `json:"algorithm"`
+	// KeyMD5 identifies the customer key for SSE-C; the key itself is
+	// never stored.
+	KeyMD5 string `json:"keyMD5,omitempty"`
+	// KeyVersion is the master key version the data key is wrapped with
+	// when the object is encrypted at rest.
+	KeyVersion int    `json:"keyVersion,omitempty"`
+	SealedKey  []byte `json:"sealedKey"`
+}
+
+func (l *LocalStorage) metaPath(bucket, object string) string {
+	return filepath.Join(l.path, bucket, metaDir, object+".json")
+}
+
+// readMeta loads the sidecar of an object. It returns nil without error for
+// objects written before metadata was persisted.
+func (l *LocalStorage) readMeta(bucket, object string) (*objectMeta, error) {
+	data, err := os.ReadFile(l.metaPath(bucket, object))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var meta objectMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// loadMeta returns an object's metadata, synthesising it from the data file
+// for objects saved before metadata was persisted. The error wraps
+// os.ErrNotExist when the object does not exist.
+func (l *LocalStorage) loadMeta(bucket, object string) (*objectMeta, error) {
+	meta, err := l.readMeta(bucket, object)
+	if err != nil || meta != nil {
+		return meta, err
+	}
+
+	path := filepath.Join(l.path, bucket, object)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return &objectMeta{Size: info.Size(), CreatedAt: info.ModTime()}, nil
+}
+
+func (l *LocalStorage) writeMeta(bucket, object string, meta *objectMeta) error {
+	path := l.metaPath(bucket, object)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial sidecar.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (l *LocalStorage) deleteMeta(bucket, object string) error {
+	err := os.Remove(l.metaPath(bucket, object))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidBucketName is returned for bucket names S3 would not accept.
+var ErrInvalidBucketName = errors.New("the specified bucket is not valid")
+
+// ErrInvalidObjectKey is returned for object keys that could lead outside
+// their bucket once mapped onto the file system.
+var ErrInvalidObjectKey = errors.New("the specified object key is not valid")
+
+// maxKeyLength is the longest object key S3 accepts, in bytes.
+const maxKeyLength = 1024
+
+// ValidateBucketName checks a bucket name against the S3 naming rules: 3
+// to 63 lowercase letters, digits, dots and hyphens, starting and ending
+// with a letter or digit, without two dots in a row, and not formatted as
+// an IP address. Names following them cannot clash with the hidden
+// directories of the data directory, nor lead outside of it.
+func ValidateBucketName(bucket string) error {
+	if len(bucket) < 3 || len(bucket) > 63 {
+		return fmt.Errorf("%w: %q must be 3 to 63 characters long", ErrInvalidBucketName, bucket)
+	}
+	for _, c := range bucket {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '.' && c != '-' {
+			return fmt.Errorf("%w: %q may only hold lowercase letters, digits, dots and hyphens", ErrInvalidBucketName, bucket)
+		}
+	}
+	if !isAlphanumeric(bucket[0]) || !isAlphanumeric(bucket[len(bucket)-1]) {
+		return fmt.Errorf("%w: %q must start and end with a letter or digit", ErrInvalidBucketName, bucket)
+	}
+	if strings.Contains(bucket, "..") {
+		return fmt.Errorf("%w: %q must not hold two dots in a row", ErrInvalidBucketName, bucket)
+	}
+	if _, err := netip.ParseAddr(bucket); err == nil {
+		return fmt.Errorf("%w: %q must not be formatted as an IP address", ErrInvalidBucketName, bucket)
+	}
+	return nil
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
+
+// reservedKeys are the hidden directories kept next to the objects of a
+// bucket. Keys under them would overwrite metadata and settings.
+var reservedKeys = []string{metaDir, bucketConfigDir, systemDir}
+
+// ValidateObjectKey checks that an object key can be stored: it must not
+// be empty or longer than 1024 bytes, start with a slash, hold a NUL byte,
+// have "." or ".." as a path segment, or start with a reserved segment.
+func ValidateObjectKey(key string) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("%w: the key is empty", ErrInvalidObjectKey)
+	case len(key) > maxKeyLength:
+		return fmt.Errorf("%w: the key is longer than %d bytes", ErrInvalidObjectKey, maxKeyLength)
+	case strings.HasPrefix(key, "/"):
+		return fmt.Errorf("%w: %q starts with a slash", ErrInvalidObjectKey, key)
+	case strings.ContainsRune(key, 0):
+		return fmt.Errorf("%w: %q holds a NUL byte", ErrInvalidObjectKey, key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("%w: %q has a %q segment", ErrInvalidObjectKey, key, segment)
+		}
+	}
+	if isReservedKey(key) {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidObjectKey, key)
+	}
+	return nil
+}
+
+// isReservedKey reports whether the first segment of key is reserved.
+func isReservedKey(key string) bool {
+	first, _, _ := strings.Cut(key, "/")
+	return slices.Contains(reservedKeys, first)
+}
+
+// validateBucket accepts the bucket names ValidateBucketName does, and
+// those of internal buckets: an underscore followed by a valid name. Other
+// packages keep their own objects in those, which the server never lets
+// clients reach.
+func validateBucket(bucket string) error {
+	if name, ok := strings.CutPrefix(bucket, "_"); ok && ValidateBucketName(name) == nil {
+		return nil
+	}
+	return ValidateBucketName(bucket)
+}
+
+// validateObjectName checks both the bucket and the key of an object.
+func validateObjectName(bucket, object string) error {
+	if err := validateBucket(bucket); err != nil {
+		return err
+	}
+	return ValidateObjectKey(object)
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateBucketName(t *testing.T) {
+	tests := []struct {
+		name    string
+		bucket  string
+		wantErr bool
+	}{
+		{name: "Lowercase letters and digits", bucket: "photos2024"},
+		{name: "Dots and hyphens", bucket: "my-bucket.example"},
+		{name: "Too short", bucket: "ab", wantErr: true},
+		{name: "Too long", bucket: strings.Repeat("a", 64), wantErr: true},
+		{name: "Uppercase", bucket: "Photos", wantErr: true},
+		{name: "Underscore", bucket: "my_bucket", wantErr: true},
+		{name: "Starting with a dot", bucket: ".meta", wantErr: true},
+		{name: "Ending with a hyphen", bucket: "bucket-", wantErr: true},
+		{name: "Parent directory", bucket: "..", wantErr: true},
+		{name: "Two dots in a row", bucket: "my..bucket", wantErr: true},
+		{name: "Slash", bucket: "a/b/c", wantErr: true},
+		{name: "IP address", bucket: "192.168.5.4", wantErr: true},
+		{name: "Internal bucket", bucket: "_hints", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBucketName(tt.bucket)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidBucketName) {
+				t.Errorf("Expected ErrInvalidBucketName, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateObjectKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "Plain key", key: "report.pdf"},
+		{name: "Nested key", key: "2024/01/report.pdf"},
+		{name: "Dots within a segment", key: "archive/..hidden/file..txt"},
+		{name: "Empty", key: "", wantErr: true},
+		{name: "Leading slash", key: "/etc/passwd", wantErr: true},
+		{name: "Parent segment", key: "../../escaped.txt", wantErr: true},
+		{name: "Inner parent segment", key: "docs/../../escaped.txt", wantErr: true},
+		{name: "Trailing parent segment", key: "docs/..", wantErr: true},
+		{name: "Current directory segment", key: "docs/./report.pdf", wantErr: true},
+		{name: "NUL byte", key: "report\x00.pdf", wantErr: true},
+		{name: "Too long", key: strings.Repeat("a", 1025), wantErr: true},
+		{name: "Metadata directory", key: ".meta/doc.txt.json", wantErr: true},
+		{name: "Config directory", key: ".config/object-lock.json", wantErr: true},
+		{name: "System directory", key: ".mini-s3", wantErr: true},
+		{name: "Reserved name deeper down", key: "docs/.meta/report.pdf"},
+		{name: "Other hidden key", key: ".metadata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateObjectKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidObjectKey) {
+				t.Errorf("Expected ErrInvalidObjectKey, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLocalStorage_RejectsPathTraversal(t *testing.T) {
+	parent := t.TempDir()
+	l := NewLocalStorage(filepath.Join(parent, "data"), NewValueChecksum())
+
+	if _, err := l.Save("bucket", "../../escaped.txt", strings.NewReader("data")); !errors.Is(err, ErrInvalidObjectKey) {
+		t.Errorf("Expected ErrInvalidObjectKey, got %v", err)
+	}
+	if _, err := l.Save("..", "escaped.txt", strings.NewReader("data")); !errors.Is(err, ErrInvalidBucketName) {
+		t.Errorf("Expected ErrInvalidBucketName, got %v", err)
+	}
+	if _, _, err := l.Get("bucket", "../../escaped.txt"); !errors.Is(err, ErrInvalidObjectKey) {
+		t.Errorf("Expected ErrInvalidObjectKey from Get, got %v", err)
+	}
+	if err := l.Delete("bucket", "/escaped.txt"); !errors.Is(err, ErrInvalidObjectKey) {
+		t.Errorf("Expected ErrInvalidObjectKey from Delete, got %v", err)
+	}
+	if _, err := l.CopyObject("bucket", "../x", "bucket", "y"); !errors.Is(err, ErrInvalidObjectKey) {
+		t.Errorf("Expected ErrInvalidObjectKey from CopyObject, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "escaped.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected nothing written outside the data directory, got %v", err)
+	}
+
+	// Other packages keep objects in internal buckets
+	if _, err := l.Save("_hints", "object", strings.NewReader("data")); err != nil {
+		t.Errorf("Expected internal buckets accepted, got %v", err)
+	}
+}
+
+func TestLocalStorage_RejectsReservedKeys(t *testing.T) {
+	l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+	if err := l.PutObjectLockConfiguration("audit", &ObjectLockConfiguration{ObjectLockEnabled: ObjectLockEnabled}); err != nil {
+		t.Fatalf("Failed to enable object lock: %v", err)
+	}
+	if _, err := l.Save("audit", "doc.txt", strings.NewReader("x"), WithRetention(RetentionModeCompliance, time.Now().Add(time.Hour))); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	// Overwriting the sidecar would drop the retention
+	if _, err := l.Save("audit", ".meta/doc.txt.json", strings.NewReader("{}")); !errors.Is(err, ErrInvalidObjectKey) {
+		t.Errorf("Expected ErrInvalidObjectKey from Save, got %v", err)
+	}
+	if _, err := l.CopyObject("audit", "doc.txt", "audit", ".config/object-lock.json"); !errors.Is(err, ErrInvalidObjectKey) {
+		t.Errorf("Expected ErrInvalidObjectKey from CopyObject, got %v", err)
+	}
+	if err := l.Delete("audit", ".meta/doc.txt.json"); !errors.Is(err, ErrInvalidObjectKey) {
+		t.Errorf("Expected ErrInvalidObjectKey from Delete, got %v", err)
+	}
+	if err := l.Delete("audit", "doc.txt"); !errors.Is(err, ErrObjectLocked) {
+		t.Errorf("Expected the object still locked, got %v", err)
+	}
+
+	// Files written behind our back are not listed
+	if err := os.WriteFile(filepath.Join(l.path, "audit", ".mini-s3"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	objects, err := l.ListObjects("audit")
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Object != "doc.txt" {
+		t.Errorf("Expected only doc.txt, got %v", objects)
+	}
+}
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iamthiago/mini-s3/internal/notify"
+)
+
+// Event types notifications can be configured for. The types ending in *
+// select every event of their kind.
+const (
+	EventObjectCreatedAll          = "s3:ObjectCreated:*"
+	EventObjectCreatedPut          = "s3:ObjectCreated:Put"
+	EventObjectCreatedCopy         = "s3:ObjectCreated:Copy"
+	EventObjectRemovedAll          = "s3:ObjectRemoved:*"
+	EventObjectRemovedDelete       = "s3:ObjectRemoved:Delete"
+	EventLifecycleExpirationAll    = "s3:LifecycleExpiration:*"
+	EventLifecycleExpirationDelete = "s3:LifecycleExpiration:Delete"
+
+	maxNotificationRules = 100
+)
+
+var eventTypes = map[string]bool{
+	EventObjectCreatedAll:          true,
+	EventObjectCreatedPut:          true,
+	EventObjectCreatedCopy:         true,
+	EventObjectRemovedAll:          true,
+	EventObjectRemovedDelete:       true,
+	EventLifecycleExpirationAll:    true,
+	EventLifecycleExpirationDelete: true,
+}
+
+// NotificationConfiguration holds the notification rules of a bucket. It
+// follows the shape of the S3 format, with a destination URI in place of
+// an ARN, and reads and writes both its XML and JSON forms.
+type NotificationConfiguration struct {
+	XMLName xml.Name           `xml:"NotificationConfiguration" json:"-"`
+	Rules   []NotificationRule `xml:"NotificationRule" json:"Rules"`
+}
+
+// NotificationRule sends the events of the given types, on objects
+// selected by its filter, to a destination: an http(s):// webhook, a
+// file:// JSON Lines file or a unix:// socket.
+type NotificationRule struct {
+	ID          string              `xml:"Id,omitempty" json:"Id,omitempty"`
+	Destination string              `xml:"Destination" json:"Destination"`
+	Events      []string            `xml:"Event" json:"Events"`
+	Filter      *NotificationFilter `xml:"Filter,omitempty" json:"Filter,omitempty"`
+}
+
+// NotificationFilter selects objects by key prefix and suffix.
+type NotificationFilter struct {
+	Key KeyFilter `xml:"S3Key" json:"Key"`
+}
+
+type KeyFilter struct {
+	FilterRules []FilterRule `xml:"FilterRule" json:"FilterRules"`
+}
+
+// FilterRule is a prefix or suffix objects keys must have.
+type FilterRule struct {
+	Name  string `xml:"Name" json:"Name"`
+	Value string `xml:"Value" json:"Value"`
+}
+
+type ErrInvalidNotification struct {
+	Rule   string
+	Reason string
+}
+
+func (e *ErrInvalidNotification) Error() string {
+	if e.Rule == "" {
+		return "invalid notification configuration: " + e.Reason
+	}
+	return fmt.Sprintf("invalid notification rule %q: %s", e.Rule, e.Reason)
+}
+
+// ParseNotificationConfiguration reads a notification configuration in XML
+// or JSON form, telling them apart by the first character.
+func ParseNotificationConfiguration(data []byte) (*NotificationConfiguration, error) {
+	cfg := &NotificationConfiguration{}
+	data = bytes.TrimSpace(data)
+	var err error
+	if bytes.HasPrefix(data, []byte("<")) {
+		err = xml.Unmarshal(data, cfg)
+	} else {
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return nil, &ErrInvalidNotification{Reason: err.Error()}
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration against the rules S3 enforces, and
+// that every destination is one a target can deliver to.
+func (c *NotificationConfiguration) Validate() error {
+	if len(c.Rules) == 0 {
+		return &ErrInvalidNotification{Reason: "at least one rule is required"}
+	}
+	if len(c.Rules) > maxNotificationRules {
+		return &ErrInvalidNotification{Reason: fmt.Sprintf("at most %d rules are allowed", maxNotificationRules)}
+	}
+
+	ids := map[string]bool{}
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		name := rule.ID
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if rule.ID != "" {
+			if ids[rule.ID] {
+				return &ErrInvalidNotification{Rule: name, Reason: "rule IDs must be unique"}
+			}
+			ids[rule.ID] = true
+		}
+		if err := rule.validate(); err != nil {
+			return &ErrInvalidNotification{Rule: name, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+func (r *NotificationRule) validate() error {
+	if _, err := notify.NewTarget(r.Destination); err != nil {
+		return err
+	}
+	if len(r.Events) == 0 {
+		return errors.New("at least one event type is required")
+	}
+	for _, event := range r.Events {
+		if !eventTypes[event] {
+			return fmt.Errorf("unknown event type %q", event)
+		}
+	}
+	if r.Filter != nil {
+		seen := map[string]bool{}
+		for _, fr := range r.Filter.Key.FilterRules {
+			name := strings.ToLower(fr.Name)
+			if name != "prefix" && name != "suffix" {
+				return fmt.Errorf("filter rule name must be prefix or suffix, got %q", fr.Name)
+			}
+			if seen[name] {
+				return fmt.Errorf("filter rule %s is given more than once", name)
+			}
+			seen[name] = true
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule selects an event of the given type on
+// an object.
+func (r *NotificationRule) matches(eventType, object string) bool {
+	selected := false
+	for _, event := range r.Events {
+		if event == eventType || (strings.HasSuffix(event, ":*") && strings.HasPrefix(eventType, strings.TrimSuffix(event, "*"))) {
+			selected = true
+			break
+		}
+	}
+	if !selected || r.Filter == nil {
+		return selected
+	}
+
+	for _, fr := range r.Filter.Key.FilterRules {
+		switch strings.ToLower(fr.Name) {
+		case "prefix":
+			if !strings.HasPrefix(object, fr.Value) {
+				return false
+			}
+		case "suffix":
+			if !strings.HasSuffix(object, fr.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// PutBucketNotification replaces the notification rules of a bucket.
+func (l *LocalStorage) PutBucketNotification(bucket string, cfg *NotificationConfiguration) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	return l.writeBucketConfig(bucket, "notification", cfg)
+}
+
+// GetBucketNotification returns the notification rules of a bucket, or nil
+// when it has none.
+func (l *LocalStorage) GetBucketNotification(bucket string) (*NotificationConfiguration, error) {
+	var cfg NotificationConfiguration
+	found, err := l.readBucketConfig(bucket, "notification", &cfg)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// DeleteBucketNotification removes every notification rule of a bucket.
+// Events already queued are still delivered.
+func (l *LocalStorage) DeleteBucketNotification(bucket string) error {
+	return l.deleteBucketConfig(bucket, "notification")
+}
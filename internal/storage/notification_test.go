@@ -0,0 +1,387 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/notify"
+)
+
+func TestNotificationConfiguration_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     string
+		wantErr bool
+	}{
+		{"valid", `{"Rules": [{"Id": "a", "Destination": "file:///tmp/e.jsonl", "Events": ["s3:ObjectCreated:*"], "Filter": {"Key": {"FilterRules": [{"Name": "prefix", "Value": "images/"}, {"Name": "Suffix", "Value": ".jpg"}]}}}]}`, false},
+		{"no rules", `{"Rules": []}`, true},
+		{"duplicate IDs", `{"Rules": [{"Id": "a", "Destination": "file:///e", "Events": ["s3:ObjectCreated:*"]}, {"Id": "a", "Destination": "file:///e", "Events": ["s3:ObjectRemoved:*"]}]}`, true},
+		{"no events", `{"Rules": [{"Destination": "file:///e"}]}`, true},
+		{"unknown event", `{"Rules": [{"Destination": "file:///e", "Events": ["s3:ObjectRestore:*"]}]}`, true},
+		{"bad destination", `{"Rules": [{"Destination": "sqs://queue", "Events": ["s3:ObjectCreated:*"]}]}`, true},
+		{"unknown filter", `{"Rules": [{"Destination": "file:///e", "Events": ["s3:ObjectCreated:*"], "Filter": {"Key": {"FilterRules": [{"Name": "regex", "Value": "x"}]}}}]}`, true},
+		{"repeated filter", `{"Rules": [{"Destination": "file:///e", "Events": ["s3:ObjectCreated:*"], "Filter": {"Key": {"FilterRules": [{"Name": "prefix", "Value": "a"}, {"Name": "prefix", "Value": "b"}]}}}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseNotificationConfiguration([]byte(tt.cfg))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			var invalid *ErrInvalidNotification
+			if err := cfg.Validate(); tt.wantErr != errors.As(err, &invalid) {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("Reads the XML form", func(t *testing.T) {
+		cfg, err := ParseNotificationConfiguration([]byte(`<NotificationConfiguration>
+  <NotificationRule>
+    <Id>indexer</Id>
+    <Destination>http://localhost:8080/hook</Destination>
+    <Event>s3:ObjectCreated:Put</Event>
+    <Event>s3:ObjectRemoved:*</Event>
+    <Filter><S3Key><FilterRule><Name>prefix</Name><Value>logs/</Value></FilterRule></S3Key></Filter>
+  </NotificationRule>
+</NotificationConfiguration>`))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("Expected a valid configuration, got %v", err)
+		}
+		rule := cfg.Rules[0]
+		if rule.ID != "indexer" || len(rule.Events) != 2 || rule.Filter.Key.FilterRules[0].Value != "logs/" {
+			t.Errorf("Unexpected rule %+v", rule)
+		}
+	})
+}
+
+func TestNotificationRule_Matches(t *testing.T) {
+	rule := NotificationRule{
+		Events: []string{EventObjectCreatedAll, EventObjectRemovedDelete},
+		Filter: &NotificationFilter{Key: KeyFilter{FilterRules: []FilterRule{{Name: "prefix", Value: "images/"}, {Name: "suffix", Value: ".jpg"}}}},
+	}
+	tests := []struct {
+		event  string
+		object string
+		want   bool
+	}{
+		{EventObjectCreatedPut, "images/a.jpg", true},
+		{EventObjectCreatedCopy, "images/b.jpg", true},
+		{EventObjectRemovedDelete, "images/a.jpg", true},
+		{EventLifecycleExpirationDelete, "images/a.jpg", false},
+		{EventObjectCreatedPut, "docs/a.jpg", false},
+		{EventObjectCreatedPut, "images/a.png", false},
+	}
+	for _, tt := range tests {
+		if got := rule.matches(tt.event, tt.object); got != tt.want {
+			t.Errorf("%s on %s: expected %v, got %v", tt.event, tt.object, tt.want, got)
+		}
+	}
+}
+
+// readEvents returns the records of a JSON Lines sink.
+func readEvents(t *testing.T, path string) []notify.Record {
+	t.Helper()
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("Failed to open sink: %v", err)
+	}
+	defer file.Close()
+
+	var records []notify.Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message notify.Message
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			t.Fatalf("Failed to decode %q: %v", scanner.Text(), err)
+		}
+		records = append(records, message.Records...)
+	}
+	return records
+}
+
+func TestLocalStorage_Notifications(t *testing.T) {
+	root := t.TempDir()
+	storage := NewLocalStorage(root, NewValueChecksum())
+	sink := filepath.Join(t.TempDir(), "events.jsonl")
+
+	cfg := &NotificationConfiguration{Rules: []NotificationRule{
+		{ID: "created", Destination: "file://" + sink, Events: []string{EventObjectCreatedAll}},
+		{ID: "removed-logs", Destination: "file://" + sink, Events: []string{EventObjectRemovedAll},
+			Filter: &NotificationFilter{Key: KeyFilter{FilterRules: []FilterRule{{Name: "prefix", Value: "logs/"}}}}},
+	}}
+	if err := storage.PutBucketNotification("data", cfg); err != nil {
+		t.Fatalf("Failed to set notification rules: %v", err)
+	}
+
+	info, err := storage.Save("data", "logs/app.log", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if _, err := storage.CopyObject("data", "logs/app.log", "data", "docs/app.log"); err != nil {
+		t.Fatalf("Failed to copy: %v", err)
+	}
+	if err := storage.Delete("data", "docs/app.log"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := storage.Delete("data", "logs/app.log"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := storage.Save("other", "x", strings.NewReader("x")); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	t.Run("Queues events until delivered", func(t *testing.T) {
+		status, err := storage.GetNotificationStatus()
+		if err != nil {
+			t.Fatalf("Failed to get status: %v", err)
+		}
+		if status.Pending != 3 {
+			t.Errorf("Expected 3 queued events, got %+v", status)
+		}
+		if records := readEvents(t, sink); len(records) != 0 {
+			t.Errorf("Expected nothing delivered yet, got %d records", len(records))
+		}
+	})
+
+	t.Run("Delivers queued events after a restart, in order", func(t *testing.T) {
+		restarted := NewLocalStorage(root, NewValueChecksum())
+		report, err := restarted.DeliverNotifications(context.Background(), time.Now())
+		if err != nil {
+			t.Fatalf("Failed to deliver: %v", err)
+		}
+		if report.Delivered != 3 {
+			t.Errorf("Expected 3 deliveries, got %+v", report)
+		}
+
+		records := readEvents(t, sink)
+		var got []string
+		for _, r := range records {
+			got = append(got, r.EventName+" "+r.S3.Object.Key)
+		}
+		want := []string{"ObjectCreated:Put logs/app.log", "ObjectCreated:Copy docs/app.log", "ObjectRemoved:Delete logs/app.log"}
+		if strings.Join(got, ", ") != strings.Join(want, ", ") {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+		if len(records) > 0 {
+			first := records[0].S3
+			if first.Bucket.Name != "data" || first.Object.ETag != info.ETag || first.Object.Size != 5 || first.ConfigurationID != "created" {
+				t.Errorf("Unexpected record %+v", first)
+			}
+		}
+		for i := 1; i < len(records); i++ {
+			if records[i].S3.Object.Sequencer <= records[i-1].S3.Object.Sequencer {
+				t.Errorf("Expected increasing sequencers, got %v", records)
+			}
+		}
+
+		status, _ := restarted.GetNotificationStatus()
+		if status.Pending != 0 {
+			t.Errorf("Expected an empty outbox, got %+v", status)
+		}
+	})
+
+	t.Run("Stops notifying once the rules are removed", func(t *testing.T) {
+		if err := storage.DeleteBucketNotification("data"); err != nil {
+			t.Fatalf("Failed to remove rules: %v", err)
+		}
+		if _, err := storage.Save("data", "logs/later.log", strings.NewReader("x")); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		status, _ := storage.GetNotificationStatus()
+		if status.Pending != 0 {
+			t.Errorf("Expected no queued events, got %+v", status)
+		}
+	})
+}
+
+func TestLocalStorage_NotificationRetries(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+
+	var mu sync.Mutex
+	var received []string
+	failing := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var message notify.Message
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		received = append(received, message.Records[0].S3.Object.Key)
+	}))
+	defer srv.Close()
+
+	cfg := &NotificationConfiguration{Rules: []NotificationRule{{Destination: srv.URL, Events: []string{EventObjectCreatedAll}}}}
+	if err := storage.PutBucketNotification("data", cfg); err != nil {
+		t.Fatalf("Failed to set notification rules: %v", err)
+	}
+	for _, object := range []string{"a", "b"} {
+		if _, err := storage.Save("data", object, strings.NewReader(object)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+
+	now := time.Now()
+	report, err := storage.DeliverNotifications(context.Background(), now)
+	if err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+	if report.Delivered != 0 || report.Retrying != 2 {
+		t.Errorf("Expected both events held back after a failure, got %+v", report)
+	}
+
+	t.Run("Backs off before retrying", func(t *testing.T) {
+		mu.Lock()
+		failing = false
+		mu.Unlock()
+		report, _ := storage.DeliverNotifications(context.Background(), now.Add(notificationBackoff/2))
+		if report.Delivered != 0 {
+			t.Errorf("Expected no delivery before the backoff, got %+v", report)
+		}
+		report, _ = storage.DeliverNotifications(context.Background(), now.Add(notificationBackoff))
+		if report.Delivered != 2 {
+			t.Errorf("Expected both deliveries after the backoff, got %+v", report)
+		}
+		if strings.Join(received, ",") != "a,b" {
+			t.Errorf("Expected the events in order, got %v", received)
+		}
+	})
+
+	t.Run("Gives up after too many attempts", func(t *testing.T) {
+		mu.Lock()
+		failing = true
+		mu.Unlock()
+		if _, err := storage.Save("data", "c", strings.NewReader("c")); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+
+		at := now
+		failed := 0
+		for i := 0; i < maxNotificationAttempts; i++ {
+			at = at.Add(maxNotificationBackoff)
+			report, err := storage.DeliverNotifications(context.Background(), at)
+			if err != nil {
+				t.Fatalf("Failed to deliver: %v", err)
+			}
+			failed += report.Failed
+		}
+		status, _ := storage.GetNotificationStatus()
+		if failed != 1 || status.Pending != 0 || status.Failed != 1 {
+			t.Errorf("Expected the event to be given up on, got %d failed, %+v", failed, status)
+		}
+
+		mu.Lock()
+		failing = false
+		mu.Unlock()
+		if n, err := storage.RetryFailedNotifications(); err != nil || n != 1 {
+			t.Fatalf("Expected 1 event queued again, got %d, %v", n, err)
+		}
+		report, _ := storage.DeliverNotifications(context.Background(), time.Now())
+		if report.Delivered != 1 {
+			t.Errorf("Expected the retried event to be delivered, got %+v", report)
+		}
+	})
+}
+
+func TestLocalStorage_PublishFailures(t *testing.T) {
+	root := t.TempDir()
+	storage := NewLocalStorage(root, NewValueChecksum())
+	sink := filepath.Join(t.TempDir(), "events.jsonl")
+
+	cfg := &NotificationConfiguration{Rules: []NotificationRule{{Destination: "file://" + sink, Events: []string{EventObjectCreatedAll}}}}
+	if err := storage.PutBucketNotification("data", cfg); err != nil {
+		t.Fatalf("Failed to set notification rules: %v", err)
+	}
+	// A file in place of the outbox makes queueing the event fail
+	if err := os.MkdirAll(filepath.Dir(storage.outboxDir()), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(storage.outboxDir(), nil, 0644); err != nil {
+		t.Fatalf("Failed to block the outbox: %v", err)
+	}
+
+	t.Run("Does not fail the committed write", func(t *testing.T) {
+		if _, err := storage.Save("data", "report.pdf", strings.NewReader("data")); err != nil {
+			t.Fatalf("Expected the save to succeed, got %v", err)
+		}
+		if exists, _ := storage.Exists("data", "report.pdf"); !exists {
+			t.Error("Expected the object to be saved")
+		}
+	})
+
+	t.Run("Still journals the change", func(t *testing.T) {
+		bases, err := storage.changeSegments()
+		if err != nil || len(bases) != 1 {
+			t.Fatalf("Expected a journal segment, got %v, %v", bases, err)
+		}
+		data, _ := os.ReadFile(storage.changeSegmentPath(bases[0]))
+		if !strings.Contains(string(data), "report.pdf") {
+			t.Errorf("Expected the change journaled, got '%s'", data)
+		}
+	})
+
+	t.Run("Queues the event once the outbox is back", func(t *testing.T) {
+		entries, _ := os.ReadDir(storage.unpublishedDir())
+		if len(entries) != 1 {
+			t.Fatalf("Expected the change kept for a retry, got %d entries", len(entries))
+		}
+		if err := os.Remove(storage.outboxDir()); err != nil {
+			t.Fatalf("Failed to unblock the outbox: %v", err)
+		}
+
+		report, err := storage.DeliverNotifications(context.Background(), time.Now())
+		if err != nil {
+			t.Fatalf("Failed to deliver: %v", err)
+		}
+		if report.Delivered != 1 {
+			t.Errorf("Expected the event delivered, got %+v", report)
+		}
+		if records := readEvents(t, sink); len(records) != 1 || records[0].S3.Object.Key != "report.pdf" {
+			t.Errorf("Expected the event for report.pdf, got %v", records)
+		}
+		if entries, _ := os.ReadDir(storage.unpublishedDir()); len(entries) != 0 {
+			t.Errorf("Expected nothing left to retry, got %d entries", len(entries))
+		}
+		bases, _ := storage.changeSegments()
+		data, _ := os.ReadFile(storage.changeSegmentPath(bases[0]))
+		if n := strings.Count(string(data), "report.pdf"); n != 1 {
+			t.Errorf("Expected the change journaled once, got %d times", n)
+		}
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{20, maxNotificationBackoff},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("attempt %d: expected %v, got %v", tt.attempts, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ObjectLockEnabled = "Enabled"
+
+	// RetentionModeGovernance protects an object from everyone but callers
+	// that explicitly bypass governance retention.
+	RetentionModeGovernance = "GOVERNANCE"
+	// RetentionModeCompliance protects an object from everyone until its
+	// retention date. The retention can be extended but never shortened.
+	RetentionModeCompliance = "COMPLIANCE"
+)
+
+// ErrObjectLocked is returned when overwriting or deleting an object under
+// retention or legal hold.
+var ErrObjectLocked = errors.New("the object is protected by object lock")
+
+// ErrObjectLockNotEnabled is returned when setting a retention or legal hold
+// on an object whose bucket does not have object lock enabled.
+var ErrObjectLockNotEnabled = errors.New("object lock is not enabled for this bucket")
+
+type ErrInvalidObjectLock struct {
+	Reason string
+}
+
+func (e *ErrInvalidObjectLock) Error() string {
+	return "invalid object lock setting: " + e.Reason
+}
+
+// ObjectLockConfiguration enables object lock on a bucket, optionally with
+// a retention applied to every new object. It follows the S3 format, in XML
+// or JSON.
+type ObjectLockConfiguration struct {
+	XMLName           xml.Name        `xml:"ObjectLockConfiguration" json:"-"`
+	ObjectLockEnabled string          `xml:"ObjectLockEnabled" json:"ObjectLockEnabled"`
+	Rule              *ObjectLockRule `xml:"Rule,omitempty" json:"Rule,omitempty"`
+}
+
+type ObjectLockRule struct {
+	DefaultRetention DefaultRetention `xml:"DefaultRetention" json:"DefaultRetention"`
+}
+
+// DefaultRetention retains new objects for a number of days or years after
+// they are saved. Exactly one of Days and Years is set.
+type DefaultRetention struct {
+	Mode  string `xml:"Mode" json:"Mode"`
+	Days  int    `xml:"Days,omitempty" json:"Days,omitempty"`
+	Years int    `xml:"Years,omitempty" json:"Years,omitempty"`
+}
+
+// Retention protects an object until RetainUntilDate.
+type Retention struct {
+	XMLName         xml.Name  `xml:"Retention" json:"-"`
+	Mode            string    `xml:"Mode" json:"Mode"`
+	RetainUntilDate time.Time `xml:"RetainUntilDate" json:"RetainUntilDate"`
+}
+
+// ParseObjectLockConfiguration reads an object lock configuration in S3 XML
+// or JSON form, telling them apart by the first character.
+func ParseObjectLockConfiguration(data []byte) (*ObjectLockConfiguration, error) {
+	cfg := &ObjectLockConfiguration{}
+	data = bytes.TrimSpace(data)
+	var err error
+	if bytes.HasPrefix(data, []byte("<")) {
+		err = xml.Unmarshal(data, cfg)
+	} else {
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return nil, &ErrInvalidObjectLock{Reason: err.Error()}
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration against the rules S3 enforces.
+func (c *ObjectLockConfiguration) Validate() error {
+	if c.ObjectLockEnabled != ObjectLockEnabled {
+		return &ErrInvalidObjectLock{Reason: "ObjectLockEnabled must be " + ObjectLockEnabled}
+	}
+	if c.Rule == nil {
+		return nil
+	}
+	d := c.Rule.DefaultRetention
+	if err := validateRetentionMode(d.Mode); err != nil {
+		return err
+	}
+	if (d.Days == 0) == (d.Years == 0) {
+		return &ErrInvalidObjectLock{Reason: "DefaultRetention needs exactly one of Days or Years"}
+	}
+	if d.Days < 0 || d.Years < 0 {
+		return &ErrInvalidObjectLock{Reason: "DefaultRetention period must be positive"}
+	}
+	return nil
+}
+
+func validateRetentionMode(mode string) error {
+	if mode != RetentionModeGovernance && mode != RetentionModeCompliance {
+		return &ErrInvalidObjectLock{Reason: fmt.Sprintf("mode must be %s or %s", RetentionModeGovernance, RetentionModeCompliance)}
+	}
+	return nil
+}
+
+// retention returns the default retention of an object saved at t, or nil
+// if the configuration has none.
+func (c *ObjectLockConfiguration) retention(t time.Time) *Retention {
+	if c == nil || c.Rule == nil {
+		return nil
+	}
+	d := c.Rule.DefaultRetention
+	return &Retention{Mode: d.Mode, RetainUntilDate: t.AddDate(d.Years, 0, d.Days).UTC()}
+}
+
+// PutObjectLockConfiguration enables object lock on a bucket and sets its
+// default retention. Like S3, object lock cannot be disabled once enabled;
+// only the default retention can change.
+func (l *LocalStorage) PutObjectLockConfiguration(bucket string, cfg *ObjectLockConfiguration) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	return l.writeBucketConfig(bucket, "object-lock", cfg)
+}
+
+// GetObjectLockConfiguration returns the object lock configuration of a
+// bucket, or nil when object lock is not enabled.
+func (l *LocalStorage) GetObjectLockConfiguration(bucket string) (*ObjectLockConfiguration, error) {
+	var cfg ObjectLockConfiguration
+	found, err := l.readBucketConfig(bucket, "object-lock", &cfg)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// lockSettings works out the retention and legal hold of an object about
+// to be saved at now: those requested, or the bucket's default retention.
+func (l *LocalStorage) lockSettings(bucket string, o *Options, now time.Time) (*Retention, bool, error) {
+	cfg, err := l.GetObjectLockConfiguration(bucket)
+	if err != nil {
+		return nil, false, err
+	}
+	if o.Retention == nil && !o.LegalHold {
+		return cfg.retention(now), false, nil
+	}
+	if cfg == nil {
+		return nil, false, ErrObjectLockNotEnabled
+	}
+
+	retention := o.Retention
+	if retention == nil {
+		retention = cfg.retention(now)
+	} else if err := validateRetention(retention, now); err != nil {
+		return nil, false, err
+	}
+	return retention, o.LegalHold, nil
+}
+
+func validateRetention(r *Retention, now time.Time) error {
+	if err := validateRetentionMode(r.Mode); err != nil {
+		return err
+	}
+	if !r.RetainUntilDate.After(now) {
+		return &ErrInvalidObjectLock{Reason: "the retain until date must be in the future"}
+	}
+	return nil
+}
+
+// checkLock returns an error wrapping ErrObjectLocked if the object may not
+// be overwritten or deleted as of now. Governance retention gives way to
+// callers that bypass it; compliance retention and legal holds never do.
+func (m *objectMeta) checkLock(now time.Time, bypassGovernance bool) error {
+	if m.LegalHold {
+		return fmt.Errorf("%w: it is under legal hold", ErrObjectLocked)
+	}
+	r := m.Retention
+	if r == nil || !now.Before(r.RetainUntilDate) {
+		return nil
+	}
+	if r.Mode == RetentionModeGovernance && bypassGovernance {
+		return nil
+	}
+	return fmt.Errorf("%w: it is retained in %s mode until %s", ErrObjectLocked, r.Mode, r.RetainUntilDate.UTC().Format(time.RFC3339))
+}
+
+// locked reports whether object lock keeps the object from being deleted
+// as of now.
+func (o *ObjectInfo) locked(now time.Time) bool {
+	return o.LegalHold || (o.Retention != nil && now.Before(o.Retention.RetainUntilDate))
+}
+
+// PutObjectRetention sets or, when retention is nil, removes the retention
+// of an object. Retention can always be extended; shortening or removing it
+// needs WithBypassGovernanceRetention in governance mode, and is never
+// allowed in compliance mode.
+func (l *LocalStorage) PutObjectRetention(bucket, object string, retention *Retention, opts ...Option) error {
+	if err := validateObjectName(bucket, object); err != nil {
+		return err
+	}
+	o := NewOptions(opts...)
+	now := time.Now()
+
+	cfg, err := l.GetObjectLockConfiguration(bucket)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		return ErrObjectLockNotEnabled
+	}
+	if retention != nil {
+		if err := validateRetention(retention, now); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := l.lockObject(bucket, object, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return err
+	}
+
+	if current := meta.Retention; current != nil && now.Before(current.RetainUntilDate) {
+		extends := retention != nil && retention.Mode == current.Mode && !retention.RetainUntilDate.Before(current.RetainUntilDate)
+		// Moving from governance to compliance only makes it stricter
+		tightens := retention != nil && current.Mode == RetentionModeGovernance && retention.Mode == RetentionModeCompliance &&
+			!retention.RetainUntilDate.Before(current.RetainUntilDate)
+		if !extends && !tightens {
+			if current.Mode == RetentionModeCompliance || !o.BypassGovernanceRetention {
+				return fmt.Errorf("%w: its retention can only be extended", ErrObjectLocked)
+			}
+		}
+	}
+
+	if retention != nil {
+		retention = &Retention{Mode: retention.Mode, RetainUntilDate: retention.RetainUntilDate.UTC()}
+	}
+	meta.Retention = retention
+	return l.writeMeta(bucket, object, meta)
+}
+
+// GetObjectRetention returns the retention of an object, or nil if it has
+// none.
+func (l *LocalStorage) GetObjectRetention(bucket, object string) (*Retention, error) {
+	if err := validateObjectName(bucket, object); err != nil {
+		return nil, err
+	}
+	unlock, err := l.lockObject(bucket, object, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Retention, nil
+}
+
+// PutObjectLegalHold places or lifts a legal hold on an object. A legal
+// hold protects the object regardless of its retention, until lifted.
+func (l *LocalStorage) PutObjectLegalHold(bucket, object string, on bool) error {
+	if err := validateObjectName(bucket, object); err != nil {
+		return err
+	}
+	cfg, err := l.GetObjectLockConfiguration(bucket)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		return ErrObjectLockNotEnabled
+	}
+
+	unlock, err := l.lockObject(bucket, object, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return err
+	}
+	meta.LegalHold = on
+	return l.writeMeta(bucket, object, meta)
+}
+
+// GetObjectLegalHold reports whether an object is under legal hold.
+func (l *LocalStorage) GetObjectLegalHold(bucket, object string) (bool, error) {
+	if err := validateObjectName(bucket, object); err != nil {
+		return false, err
+	}
+	unlock, err := l.lockObject(bucket, object, false)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return false, err
+	}
+	return meta.LegalHold, nil
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage_ObjectLock(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+	future := time.Now().Add(24 * time.Hour)
+
+	t.Run("Requires object lock on the bucket", func(t *testing.T) {
+		_, err := storage.Save("audit", "x", strings.NewReader("x"), WithRetention(RetentionModeCompliance, future))
+		if !errors.Is(err, ErrObjectLockNotEnabled) {
+			t.Errorf("Expected ErrObjectLockNotEnabled, got %v", err)
+		}
+	})
+
+	t.Run("Validates the configuration", func(t *testing.T) {
+		tests := []struct {
+			name string
+			cfg  *ObjectLockConfiguration
+		}{
+			{"not enabled", &ObjectLockConfiguration{}},
+			{"unknown mode", &ObjectLockConfiguration{ObjectLockEnabled: ObjectLockEnabled, Rule: &ObjectLockRule{DefaultRetention{Mode: "STRICT", Days: 1}}}},
+			{"days and years", &ObjectLockConfiguration{ObjectLockEnabled: ObjectLockEnabled, Rule: &ObjectLockRule{DefaultRetention{Mode: RetentionModeGovernance, Days: 1, Years: 1}}}},
+			{"no period", &ObjectLockConfiguration{ObjectLockEnabled: ObjectLockEnabled, Rule: &ObjectLockRule{DefaultRetention{Mode: RetentionModeGovernance}}}},
+		}
+		for _, tt := range tests {
+			var invalid *ErrInvalidObjectLock
+			if err := storage.PutObjectLockConfiguration("audit", tt.cfg); !errors.As(err, &invalid) {
+				t.Errorf("%s: expected ErrInvalidObjectLock, got %v", tt.name, err)
+			}
+		}
+	})
+
+	cfg, err := ParseObjectLockConfiguration([]byte(`<ObjectLockConfiguration>
+  <ObjectLockEnabled>Enabled</ObjectLockEnabled>
+  <Rule><DefaultRetention><Mode>GOVERNANCE</Mode><Days>7</Days></DefaultRetention></Rule>
+</ObjectLockConfiguration>`))
+	if err != nil {
+		t.Fatalf("Failed to parse configuration: %v", err)
+	}
+	if err := storage.PutObjectLockConfiguration("audit", cfg); err != nil {
+		t.Fatalf("Failed to enable object lock: %v", err)
+	}
+
+	t.Run("Applies the default retention", func(t *testing.T) {
+		info, err := storage.Save("audit", "default.log", strings.NewReader("v1"))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if info.Retention == nil || info.Retention.Mode != RetentionModeGovernance || !info.Retention.RetainUntilDate.After(time.Now().Add(6*24*time.Hour)) {
+			t.Fatalf("Expected 7 days of governance retention, got %+v", info.Retention)
+		}
+	})
+
+	t.Run("Governance retention blocks overwrites and deletes unless bypassed", func(t *testing.T) {
+		if _, err := storage.Save("audit", "default.log", strings.NewReader("v2")); !errors.Is(err, ErrObjectLocked) {
+			t.Errorf("Expected ErrObjectLocked on overwrite, got %v", err)
+		}
+		if err := storage.Delete("audit", "default.log"); !errors.Is(err, ErrObjectLocked) {
+			t.Errorf("Expected ErrObjectLocked on delete, got %v", err)
+		}
+		if got := readObject(t, storage, "audit", "default.log"); got != "v1" {
+			t.Errorf("Expected 'v1', got '%s'", got)
+		}
+		if err := storage.Delete("audit", "default.log", WithBypassGovernanceRetention()); err != nil {
+			t.Errorf("Expected bypass to delete, got %v", err)
+		}
+	})
+
+	t.Run("Compliance retention cannot be bypassed or shortened", func(t *testing.T) {
+		if _, err := storage.Save("audit", "ledger", strings.NewReader("x"), WithRetention(RetentionModeCompliance, future)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if err := storage.Delete("audit", "ledger", WithBypassGovernanceRetention()); !errors.Is(err, ErrObjectLocked) {
+			t.Errorf("Expected ErrObjectLocked, got %v", err)
+		}
+		shorter := &Retention{Mode: RetentionModeCompliance, RetainUntilDate: future.Add(-time.Hour)}
+		if err := storage.PutObjectRetention("audit", "ledger", shorter, WithBypassGovernanceRetention()); !errors.Is(err, ErrObjectLocked) {
+			t.Errorf("Expected ErrObjectLocked when shortening, got %v", err)
+		}
+		if err := storage.PutObjectRetention("audit", "ledger", nil, WithBypassGovernanceRetention()); !errors.Is(err, ErrObjectLocked) {
+			t.Errorf("Expected ErrObjectLocked when removing, got %v", err)
+		}
+		longer := &Retention{Mode: RetentionModeCompliance, RetainUntilDate: future.Add(time.Hour)}
+		if err := storage.PutObjectRetention("audit", "ledger", longer); err != nil {
+			t.Errorf("Expected the retention to be extended, got %v", err)
+		}
+		retention, err := storage.GetObjectRetention("audit", "ledger")
+		if err != nil || !retention.RetainUntilDate.Equal(longer.RetainUntilDate) {
+			t.Errorf("Expected the extended retention, got %+v, %v", retention, err)
+		}
+	})
+
+	t.Run("Retention ends at its date", func(t *testing.T) {
+		if _, err := storage.Save("audit", "short", strings.NewReader("x"), WithRetention(RetentionModeCompliance, time.Now().Add(50*time.Millisecond))); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if err := storage.Delete("audit", "short"); err != nil {
+			t.Errorf("Expected expired retention to allow deletes, got %v", err)
+		}
+	})
+
+	t.Run("Legal hold blocks deletes until lifted", func(t *testing.T) {
+		if _, err := storage.Save("audit", "evidence", strings.NewReader("x"), WithLegalHold(), WithRetention(RetentionModeGovernance, future)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if err := storage.Delete("audit", "evidence", WithBypassGovernanceRetention()); !errors.Is(err, ErrObjectLocked) {
+			t.Errorf("Expected ErrObjectLocked, got %v", err)
+		}
+		if err := storage.PutObjectLegalHold("audit", "evidence", false); err != nil {
+			t.Fatalf("Failed to lift legal hold: %v", err)
+		}
+		if on, _ := storage.GetObjectLegalHold("audit", "evidence"); on {
+			t.Errorf("Expected the legal hold to be lifted")
+		}
+		if err := storage.Delete("audit", "evidence", WithBypassGovernanceRetention()); err != nil {
+			t.Errorf("Expected bypass to delete, got %v", err)
+		}
+	})
+
+	t.Run("Lifecycle does not expire locked objects", func(t *testing.T) {
+		if _, err := storage.Save("audit", "old", strings.NewReader("x")); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		backdate(t, storage, "audit", "old", time.Now().Add(-60*24*time.Hour))
+		lifecycle := &LifecycleConfiguration{Rules: []LifecycleRule{{
+			ID: "expire", Status: LifecycleStatusEnabled, Expiration: &LifecycleExpiration{Days: 30},
+		}}}
+		if err := storage.PutBucketLifecycle("audit", lifecycle); err != nil {
+			t.Fatalf("Failed to set lifecycle: %v", err)
+		}
+
+		report, err := storage.ApplyLifecycle("audit", time.Now(), false)
+		if err != nil {
+			t.Fatalf("Failed to apply lifecycle: %v", err)
+		}
+		if len(report.Actions) != 0 || report.Retained != 1 {
+			t.Errorf("Expected old to be retained, got %+v", report)
+		}
+		if exists, _ := storage.Exists("audit", "old"); !exists {
+			t.Errorf("Expected old to still exist")
+		}
+	})
+}
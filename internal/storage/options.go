@@ -0,0 +1,214 @@
+package storage
+
+import "time"
+
+// Options carries the optional, per-request parameters accepted by Storage
+// operations. Callers build it through Option functions.
+type Options struct {
+	// SSECustomerKey is the 256-bit key supplied by the caller for SSE-C.
+	SSECustomerKey []byte
+
+	// Range limits Get to part of the object.
+	Range *ByteRange
+
+	// StorageClass is the tier Save stores the object in.
+	StorageClass string
+
+	// Retention and LegalHold lock the object Save stores, in a bucket
+	// with object lock enabled.
+	Retention *Retention
+	LegalHold bool
+
+	// Tags are attached to the object Save stores.
+	Tags map[string]string
+
+	// ContentType and the other standard HTTP headers, and UserMetadata,
+	// are stored with the object Save stores and returned when reading it.
+	// ContentType is detected when not given.
+	ContentType        string
+	ContentEncoding    string
+	ContentDisposition string
+	CacheControl       string
+	Expires            time.Time
+	UserMetadata       map[string]string
+
+	// MetadataDirective tells CopyObject whether to copy the source's
+	// content headers and metadata or replace them. CopySourceSSECustomerKey
+	// decrypts a source encrypted with a customer key, and CopyConditions
+	// must hold for the source.
+	MetadataDirective        string
+	CopySourceSSECustomerKey []byte
+	CopyConditions           *Conditions
+
+	// Conditions must hold for the object Get and Head read, or the one
+	// Save and CopyObject replace.
+	Conditions *Conditions
+
+	// BypassGovernanceRetention lets Save, Delete and PutObjectRetention
+	// override governance-mode retention.
+	BypassGovernanceRetention bool
+
+	// Replica marks the object Save stores as a replica, which replication
+	// rules do not replicate further.
+	Replica bool
+
+	// event is the type of the event Save notifies, when it saves on behalf
+	// of another operation.
+	event string
+}
+
+// Option configures a single Storage operation.
+type Option func(*Options)
+
+// NewOptions applies opts in order and returns the resulting Options.
+func NewOptions(opts ...Option) *Options {
+	o := &Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithSSECustomerKey encrypts (on Save) or decrypts (on Get) the object with
+// a customer-provided key. The key itself is never persisted.
+func WithSSECustomerKey(key []byte) Option {
+	return func(o *Options) {
+		o.SSECustomerKey = key
+	}
+}
+
+// WithRange makes Get return length bytes starting at offset. A negative
+// length reads to the end of the object, and a negative offset selects the
+// last -offset bytes.
+func WithRange(offset, length int64) Option {
+	return func(o *Options) {
+		o.Range = &ByteRange{Offset: offset, Length: length}
+	}
+}
+
+// WithStorageClass saves the object in the given storage class instead of
+// STANDARD.
+func WithStorageClass(class string) Option {
+	return func(o *Options) {
+		o.StorageClass = class
+	}
+}
+
+// WithRetention retains the object Save stores in the given mode until the
+// given date, instead of the bucket's default retention.
+func WithRetention(mode string, until time.Time) Option {
+	return func(o *Options) {
+		o.Retention = &Retention{Mode: mode, RetainUntilDate: until}
+	}
+}
+
+// WithLegalHold places the object Save stores under legal hold.
+func WithLegalHold() Option {
+	return func(o *Options) {
+		o.LegalHold = true
+	}
+}
+
+// WithBypassGovernanceRetention allows overwriting or deleting an object,
+// or shortening its retention, despite governance-mode retention.
+func WithBypassGovernanceRetention() Option {
+	return func(o *Options) {
+		o.BypassGovernanceRetention = true
+	}
+}
+
+// WithTags attaches tags to the object Save stores.
+func WithTags(tags map[string]string) Option {
+	return func(o *Options) {
+		o.Tags = tags
+	}
+}
+
+// WithContentType sets the MIME type of the object Save stores.
+func WithContentType(contentType string) Option {
+	return func(o *Options) {
+		o.ContentType = contentType
+	}
+}
+
+// WithContentEncoding records the encoding the object Save stores is in,
+// like gzip. It is returned as is, and has nothing to do with compression
+// at rest.
+func WithContentEncoding(encoding string) Option {
+	return func(o *Options) {
+		o.ContentEncoding = encoding
+	}
+}
+
+// WithContentDisposition sets how the object Save stores is presented when
+// downloaded, like attachment; filename="report.pdf".
+func WithContentDisposition(disposition string) Option {
+	return func(o *Options) {
+		o.ContentDisposition = disposition
+	}
+}
+
+// WithCacheControl sets the caching directives returned with the object
+// Save stores.
+func WithCacheControl(cacheControl string) Option {
+	return func(o *Options) {
+		o.CacheControl = cacheControl
+	}
+}
+
+// WithExpires sets when caches should consider the object Save stores
+// stale.
+func WithExpires(expires time.Time) Option {
+	return func(o *Options) {
+		o.Expires = expires
+	}
+}
+
+// WithUserMetadata attaches user-defined metadata, the x-amz-meta-* pairs
+// of S3, to the object Save stores.
+func WithUserMetadata(metadata map[string]string) Option {
+	return func(o *Options) {
+		o.UserMetadata = metadata
+	}
+}
+
+// WithMetadataDirective makes CopyObject copy the source's content headers
+// and user-defined metadata (COPY, the default) or take them from the
+// request (REPLACE).
+func WithMetadataDirective(directive string) Option {
+	return func(o *Options) {
+		o.MetadataDirective = directive
+	}
+}
+
+// WithReplica saves the object as the replica of one in another bucket.
+func WithReplica() Option {
+	return func(o *Options) {
+		o.Replica = true
+	}
+}
+
+// WithCopySourceSSECustomerKey decrypts the source of CopyObject with a
+// customer-provided key.
+func WithCopySourceSSECustomerKey(key []byte) Option {
+	return func(o *Options) {
+		o.CopySourceSSECustomerKey = key
+	}
+}
+
+// WithCopyConditions makes CopyObject fail with ErrPreconditionFailed
+// unless the conditions hold for the source.
+func WithCopyConditions(conditions Conditions) Option {
+	return func(o *Options) {
+		o.CopyConditions = &conditions
+	}
+}
+
+// WithConditions makes Get and Head fail with ErrNotModified or
+// ErrPreconditionFailed, and Save and CopyObject with ErrPreconditionFailed,
+// unless the conditions hold for the current object.
+func WithConditions(conditions Conditions) Option {
+	return func(o *Options) {
+		o.Conditions = &conditions
+	}
+}
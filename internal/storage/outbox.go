@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamthiago/mini-s3/internal/notify"
+)
+
+const (
+	// maxNotificationAttempts is how often a message is tried before it is
+	// moved aside to the failed messages.
+	maxNotificationAttempts = 15
+	// Retries back off exponentially from notificationBackoff up to
+	// maxNotificationBackoff, about 40 minutes in all.
+	notificationBackoff    = time.Second
+	maxNotificationBackoff = 5 * time.Minute
+)
+
+// notifier is the state shared by the writers queueing notifications and
+// the dispatcher delivering them.
+type notifier struct {
+	mu   sync.Mutex
+	last int64
+	// wake is signaled when messages are queued, so the dispatcher does
+	// not wait for its next tick to deliver them.
+	wake chan struct{}
+}
+
+func newNotifier() *notifier {
+	return &notifier{wake: make(chan struct{}, 1)}
+}
+
+// sequence returns an increasing, fixed-width sequencer for an event
+// happening at now.
+func (n *notifier) sequence(now time.Time) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	seq := now.UnixNano()
+	if seq <= n.last {
+		seq = n.last + 1
+	}
+	n.last = seq
+	return fmt.Sprintf("%016X", seq)
+}
+
+func (n *notifier) signal() {
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// outboxEntry is a queued message, kept in its own file until delivered.
+type outboxEntry struct {
+	Destination string          `json:"destination"`
+	Message     json.RawMessage `json:"message"`
+	Attempts    int             `json:"attempts,omitempty"`
+	NextAttempt time.Time       `json:"nextAttempt,omitempty"`
+	LastError   string          `json:"lastError,omitempty"`
+}
+
+// NotificationReport describes a pass over the outbox.
+type NotificationReport struct {
+	Delivered int
+	// Retrying counts the messages left for a later pass, after a failed
+	// delivery to their destination.
+	Retrying int
+	// Failed counts the messages given up on in this pass.
+	Failed int
+}
+
+// NotificationStatus counts the messages waiting in the outbox and those
+// given up on.
+type NotificationStatus struct {
+	Pending int
+	Failed  int
+}
+
+func (l *LocalStorage) outboxDir() string {
+	return filepath.Join(l.path, systemDir, "notifications", "outbox")
+}
+
+func (l *LocalStorage) failedNotificationsDir() string {
+	return filepath.Join(l.path, systemDir, "notifications", "failed")
+}
+
+// notifyEvent queues a message for every notification rule of the bucket
+// selecting an event on an object. meta describes the object created, and
+// is nil for removals. Callers hold the object's lock, so the events of a
+// key are sequenced in the order they happened.
+func (l *LocalStorage) notifyEvent(bucket, object, eventType string, meta *objectMeta) error {
+	cfg, err := l.GetBucketNotification(bucket)
+	if err != nil || cfg == nil {
+		return err
+	}
+
+	now := time.Now()
+	seq := l.notifier.sequence(now)
+	queued := false
+	for i, rule := range cfg.Rules {
+		if !rule.matches(eventType, object) {
+			continue
+		}
+		var size int64
+		var etag string
+		if meta != nil {
+			size, etag = meta.Size, meta.etag()
+		}
+		message, err := notify.Marshal(notify.NewRecord(eventType, rule.ID, bucket, object, size, etag, seq, now))
+		if err != nil {
+			return err
+		}
+		// Other processes sharing the data directory queue messages too
+		name := fmt.Sprintf("%s-%03d-%d.json", seq, i, os.Getpid())
+		if err := writeOutboxEntry(filepath.Join(l.outboxDir(), name), &outboxEntry{Destination: rule.Destination, Message: message}); err != nil {
+			return err
+		}
+		queued = true
+	}
+	if queued {
+		l.notifier.signal()
+	}
+	return nil
+}
+
+func writeOutboxEntry(path string, entry any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// outboxNames lists the messages of a directory in the order they were
+// queued.
+func outboxNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DeliverNotifications makes one pass over the outbox, delivering the
+// messages that are due in the order they were queued. A failed delivery
+// is retried with exponential backoff, and holds back the later messages
+// to the same destination so they arrive in order. Messages are removed
+// once delivered, so they may be delivered again if the process stops in
+// between. Changes whose messages could not be queued with them are
+// retried first.
+func (l *LocalStorage) DeliverNotifications(ctx context.Context, now time.Time) (*NotificationReport, error) {
+	l.retryUnpublished()
+	names, err := outboxNames(l.outboxDir())
+	if err != nil {
+		return nil, err
+	}
+
+	report := &NotificationReport{}
+	targets := map[string]notify.Target{}
+	held := map[string]bool{}
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+
+		path := filepath.Join(l.outboxDir(), name)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		var entry outboxEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return report, fmt.Errorf("reading queued notification %s: %w", name, err)
+		}
+
+		if held[entry.Destination] || entry.NextAttempt.After(now) {
+			held[entry.Destination] = true
+			report.Retrying++
+			continue
+		}
+
+		target, ok := targets[entry.Destination]
+		if !ok {
+			target, err = notify.NewTarget(entry.Destination)
+			if err != nil {
+				return report, err
+			}
+			targets[entry.Destination] = target
+		}
+
+		sendErr := target.Send(ctx, entry.Message)
+		if sendErr == nil {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return report, err
+			}
+			report.Delivered++
+			continue
+		}
+
+		entry.Attempts++
+		entry.LastError = sendErr.Error()
+		if entry.Attempts >= maxNotificationAttempts {
+			if err := writeOutboxEntry(filepath.Join(l.failedNotificationsDir(), name), &entry); err != nil {
+				return report, err
+			}
+			if err := os.Remove(path); err != nil {
+				return report, err
+			}
+			report.Failed++
+			continue
+		}
+		entry.NextAttempt = now.Add(retryDelay(entry.Attempts))
+		if err := writeOutboxEntry(path, &entry); err != nil {
+			return report, err
+		}
+		held[entry.Destination] = true
+		report.Retrying++
+	}
+	return report, nil
+}
+
+// retryDelay is how long to wait before the next attempt at delivering a
+// message, or replicating a change, that failed attempts times.
+func retryDelay(attempts int) time.Duration {
+	delay := notificationBackoff
+	for i := 1; i < attempts && delay < maxNotificationBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxNotificationBackoff)
+}
+
+// RunNotifications delivers queued notifications each interval, and as
+// soon as new ones are queued, until ctx is done. Each pass is handed to
+// report.
+func (l *LocalStorage) RunNotifications(ctx context.Context, interval time.Duration, report func(*NotificationReport, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-l.notifier.wake:
+		}
+		report(l.DeliverNotifications(ctx, time.Now()))
+	}
+}
+
+// GetNotificationStatus counts the messages waiting in the outbox and those
+// given up on.
+func (l *LocalStorage) GetNotificationStatus() (*NotificationStatus, error) {
+	pending, err := outboxNames(l.outboxDir())
+	if err != nil {
+		return nil, err
+	}
+	failed, err := outboxNames(l.failedNotificationsDir())
+	if err != nil {
+		return nil, err
+	}
+	return &NotificationStatus{Pending: len(pending), Failed: len(failed)}, nil
+}
+
+// RetryFailedNotifications queues the messages given up on again, with
+// their attempts reset. It returns how many there were.
+func (l *LocalStorage) RetryFailedNotifications() (int, error) {
+	names, err := outboxNames(l.failedNotificationsDir())
+	if err != nil {
+		return 0, err
+	}
+	for i, name := range names {
+		path := filepath.Join(l.failedNotificationsDir(), name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return i, err
+		}
+		var entry outboxEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return i, err
+		}
+		entry.Attempts, entry.NextAttempt, entry.LastError = 0, time.Time{}, ""
+		if err := writeOutboxEntry(filepath.Join(l.outboxDir(), name), &entry); err != nil {
+			return i, err
+		}
+		if err := os.Remove(path); err != nil {
+			return i, err
+		}
+	}
+	if len(names) > 0 {
+		l.notifier.signal()
+	}
+	return len(names), nil
+}
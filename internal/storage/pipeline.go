@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// objectWriter turns the logical bytes of an object into what is stored on
+// disk: they are compressed first, then encrypted.
+type objectWriter struct {
+	w        io.Writer
+	closers  []io.Closer
+	stored   *countingWriter
+	physical hash.Hash
+}
+
+func newObjectWriter(dst io.Writer, dataKey []byte, compression string) (*objectWriter, error) {
+	ow := &objectWriter{physical: sha256.New()}
+	dst = io.MultiWriter(dst, ow.physical)
+
+	if dataKey != nil {
+		enc, err := newEncryptWriter(dst, dataKey)
+		if err != nil {
+			return nil, err
+		}
+		ow.closers = append(ow.closers, enc)
+		dst = enc
+	}
+
+	ow.stored = &countingWriter{w: dst}
+	ow.w = ow.stored
+
+	if compression != "" {
+		comp, err := newCompressWriter(ow.stored, compression)
+		if err != nil {
+			return nil, err
+		}
+		ow.closers = append(ow.closers, comp)
+		ow.w = comp
+	}
+	return ow, nil
+}
+
+func (ow *objectWriter) Write(p []byte) (int, error) {
+	return ow.w.Write(p)
+}
+
+// Close flushes every layer, innermost (compression) first.
+func (ow *objectWriter) Close() error {
+	for i := len(ow.closers) - 1; i >= 0; i-- {
+		if err := ow.closers[i].Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storedSize is the size after compression and before encryption.
+func (ow *objectWriter) storedSize() int64 {
+	return ow.stored.n
+}
+
+// digest is the hex SHA-256 of the bytes written to disk, which is what
+// backends address content by. It is only complete after Close.
+func (ow *objectWriter) digest() string {
+	return hex.EncodeToString(ow.physical.Sum(nil))
+}
+
+// newObjectReader reverses newObjectWriter. Closing the returned reader also
+// closes src.
+func newObjectReader(src io.ReadCloser, dataKey []byte, compression string) (io.ReadCloser, error) {
+	var r io.Reader = src
+	closers := multiCloser{src}
+
+	if dataKey != nil {
+		plain, err := newDecryptReader(r, dataKey)
+		if err != nil {
+			return nil, err
+		}
+		r = plain
+	}
+
+	if compression != "" {
+		decomp, err := newDecompressReader(r, compression)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(multiCloser{decomp}, closers...)
+		r = decomp
+	}
+
+	return readCloser{Reader: r, Closer: closers}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// multiCloser closes all of its closers, returning the first error.
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var first error
+	for _, c := range m {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
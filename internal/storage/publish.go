@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// unpublishedChange is a change whose journal entry, replication or event
+// notifications could not be written along with the object. It is kept in
+// the unpublished directory until retryUnpublished writes what is missing.
+type unpublishedChange struct {
+	Bucket   string      `json:"bucket"`
+	Object   string      `json:"object"`
+	Event    string      `json:"event"`
+	Previous *objectMeta `json:"previous,omitempty"`
+	Meta     *objectMeta `json:"meta,omitempty"`
+
+	// Journal, Replicate and Notify say which steps are still missing.
+	// Change is the journal entry, so it keeps the time of the write.
+	Change    *Change `json:"change,omitempty"`
+	Journal   bool    `json:"journal,omitempty"`
+	Replicate bool    `json:"replicate,omitempty"`
+	Notify    bool    `json:"notify,omitempty"`
+	LastError string  `json:"lastError"`
+}
+
+func (l *LocalStorage) unpublishedDir() string {
+	return filepath.Join(l.path, systemDir, "unpublished")
+}
+
+// publish records that an object was written or removed, in the change
+// feed, as event notifications and in the replication queue. previous is
+// the object's metadata before the change, nil when it did not exist, and
+// meta after it, nil when it was removed. Callers hold the object's lock.
+//
+// The write is committed by then, so publish does not fail it: each step
+// is tried on its own, and those that fail are logged and kept for
+// retryUnpublished, which runs first so changes waiting there go out
+// before this one.
+func (l *LocalStorage) publish(bucket, object, eventType string, previous, meta *objectMeta) {
+	l.retryUnpublished()
+
+	change := &Change{Type: ChangeCreated, Bucket: bucket, Object: object, Time: time.Now()}
+	switch {
+	case meta == nil:
+		change.Type = ChangeDeleted
+	case previous != nil:
+		change.Type = ChangeOverwritten
+	}
+	if meta != nil {
+		change.Size, change.ETag = meta.Size, meta.etag()
+	}
+
+	pending := &unpublishedChange{Bucket: bucket, Object: object, Event: eventType, Previous: previous, Meta: meta, Change: change}
+	if err := l.publishSteps(pending, true, true, true); err != nil {
+		log.Printf("mini-s3: publishing %s/%s, will retry: %v", bucket, object, err)
+		l.keepUnpublished(pending)
+	}
+}
+
+// publishSteps runs the given steps of publishing a change, each whether
+// or not the others succeed. It leaves in pending the steps that failed,
+// and returns their errors.
+func (l *LocalStorage) publishSteps(pending *unpublishedChange, journal, replicate, notify bool) error {
+	var errs []error
+	pending.Journal, pending.Replicate, pending.Notify = false, false, false
+	if journal {
+		if err := l.journalChange(pending.Change); err != nil {
+			pending.Journal = true
+			errs = append(errs, fmt.Errorf("journaling the change: %w", err))
+		}
+	}
+	if replicate {
+		if err := l.queueReplication(pending.Bucket, pending.Object, pending.Previous, pending.Meta); err != nil {
+			pending.Replicate = true
+			errs = append(errs, fmt.Errorf("queueing replication: %w", err))
+		}
+	}
+	if notify {
+		if err := l.notifyEvent(pending.Bucket, pending.Object, pending.Event, pending.Meta); err != nil {
+			pending.Notify = true
+			errs = append(errs, fmt.Errorf("queueing notifications: %w", err))
+		}
+	}
+	err := errors.Join(errs...)
+	if err != nil {
+		pending.LastError = err.Error()
+	}
+	return err
+}
+
+// keepUnpublished stores a change with missing steps for a later retry.
+func (l *LocalStorage) keepUnpublished(pending *unpublishedChange) {
+	// Other processes sharing the data directory keep changes too
+	name := fmt.Sprintf("%s-%d.json", l.notifier.sequence(time.Now()), os.Getpid())
+	if err := writeOutboxEntry(filepath.Join(l.unpublishedDir(), name), pending); err != nil {
+		log.Printf("mini-s3: keeping the change to %s/%s for a retry: %v", pending.Bucket, pending.Object, err)
+		return
+	}
+	l.unpublished.Store(true)
+}
+
+// retryUnpublished retries the missing steps of the changes publish could
+// not complete, oldest first, and forgets those that now succeed.
+func (l *LocalStorage) retryUnpublished() {
+	if !l.unpublished.Load() {
+		return
+	}
+	unlock, err := lockKey(l.path, lockDomainPublish, "unpublished", true)
+	if err != nil {
+		log.Printf("mini-s3: retrying unpublished changes: %v", err)
+		return
+	}
+	defer unlock()
+
+	names, err := outboxNames(l.unpublishedDir())
+	if err != nil {
+		log.Printf("mini-s3: retrying unpublished changes: %v", err)
+		return
+	}
+	remaining := false
+	for _, name := range names {
+		if !l.retryUnpublishedChange(filepath.Join(l.unpublishedDir(), name)) {
+			remaining = true
+		}
+	}
+	l.unpublished.Store(remaining)
+}
+
+// retryUnpublishedChange retries one kept change, and reports whether it
+// is done with.
+func (l *LocalStorage) retryUnpublishedChange(path string) bool {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	if err != nil {
+		log.Printf("mini-s3: retrying unpublished change %s: %v", filepath.Base(path), err)
+		return false
+	}
+	var pending unpublishedChange
+	if err := json.Unmarshal(data, &pending); err != nil {
+		log.Printf("mini-s3: retrying unpublished change %s: %v", filepath.Base(path), err)
+		return false
+	}
+
+	if err := l.publishSteps(&pending, pending.Journal, pending.Replicate, pending.Notify); err != nil {
+		if err := writeOutboxEntry(path, &pending); err != nil {
+			log.Printf("mini-s3: retrying unpublished change %s: %v", filepath.Base(path), err)
+		}
+		return false
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("mini-s3: retrying unpublished change %s: %v", filepath.Base(path), err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package storage
+
+import "fmt"
+
+// QuorumConfiguration sets how many replicas of a bucket's objects a
+// cluster waits for. Write is how many replicas must store an object and
+// verify its checksum before a write succeeds, and Read how many must hold
+// the version and checksum an object was committed with before a read
+// returns it. Zero leaves the cluster's default.
+type QuorumConfiguration struct {
+	Write int `json:"Write,omitempty"`
+	Read  int `json:"Read,omitempty"`
+}
+
+// Validate checks the quorums against the number of replicas objects are
+// written to.
+func (q *QuorumConfiguration) Validate(replicas int) error {
+	for _, quorum := range []struct {
+		name  string
+		value int
+	}{{"write", q.Write}, {"read", q.Read}} {
+		if quorum.value < 0 || quorum.value > replicas {
+			return fmt.Errorf("%s quorum must be between 1 and the %d replicas of each object, got %d", quorum.name, replicas, quorum.value)
+		}
+	}
+	return nil
+}
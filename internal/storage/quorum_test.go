@@ -0,0 +1,25 @@
+package storage
+
+import "testing"
+
+func TestQuorumConfiguration_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		quorum  QuorumConfiguration
+		wantErr bool
+	}{
+		{name: "Defaults", quorum: QuorumConfiguration{}},
+		{name: "Every replica", quorum: QuorumConfiguration{Write: 3, Read: 3}},
+		{name: "More writes than replicas", quorum: QuorumConfiguration{Write: 4}, wantErr: true},
+		{name: "More reads than replicas", quorum: QuorumConfiguration{Read: 4}, wantErr: true},
+		{name: "Negative", quorum: QuorumConfiguration{Read: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.quorum.Validate(3); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
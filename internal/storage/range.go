@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrInvalidRange is returned by Get when the requested range starts past
+// the end of the object.
+var ErrInvalidRange = errors.New("the requested range is not satisfiable")
+
+// ByteRange selects part of an object.
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// End is the offset of the last byte in the range.
+func (r *ByteRange) End() int64 {
+	return r.Offset + r.Length - 1
+}
+
+// resolve turns a requested range into absolute offsets within an object of
+// the given size, clamping it to the end of the object.
+func (r *ByteRange) resolve(size int64) (*ByteRange, error) {
+	offset, length := r.Offset, r.Length
+	if offset < 0 {
+		// Suffix range: the last -offset bytes
+		offset = max(size+offset, 0)
+		length = size - offset
+	}
+	if offset >= size || length == 0 {
+		return nil, ErrInvalidRange
+	}
+	if length < 0 || offset+length > size {
+		length = size - offset
+	}
+	return &ByteRange{Offset: offset, Length: length}, nil
+}
+
+// rangeOpener is implemented by backends that can start reading stored
+// bytes at an offset without reading what comes before.
+type rangeOpener interface {
+	OpenRange(locator string, offset, length int64) (io.ReadCloser, error)
+}
+
+// openRange opens part of the stored bytes, seeking where the backend
+// allows it.
+func openRange(backend Backend, locator string, rng *ByteRange) (io.ReadCloser, error) {
+	if opener, ok := backend.(rangeOpener); ok {
+		return opener.OpenRange(locator, rng.Offset, rng.Length)
+	}
+
+	file, err := backend.Open(locator)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := file.(*os.File); ok {
+		if _, err := f.Seek(rng.Offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return readCloser{Reader: io.LimitReader(f, rng.Length), Closer: f}, nil
+	}
+	return sliceReader(file, rng)
+}
+
+// sliceReader narrows a stream to the range by discarding what comes
+// before it. It is the fallback when the stored bytes cannot be seeked,
+// because they are compressed or encrypted.
+func sliceReader(r io.ReadCloser, rng *ByteRange) (io.ReadCloser, error) {
+	if _, err := io.CopyN(io.Discard, r, rng.Offset); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return readCloser{Reader: io.LimitReader(r, rng.Length), Closer: r}, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// Reflinks are only attempted on Linux; elsewhere files are hard linked or
+// copied.
+func reflink(dst, src *os.File) error {
+	return errors.ErrUnsupported
+}
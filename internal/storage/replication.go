@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ReplicationRuleEnabled  = "Enabled"
+	ReplicationRuleDisabled = "Disabled"
+
+	maxReplicationRules = 1000
+)
+
+// Replication statuses of objects. Objects in a bucket with replication
+// rules are PENDING until every rule selecting them replicated them, then
+// COMPLETED, or FAILED once a rule gives up. Their copies are REPLICA, and
+// are never replicated further.
+const (
+	ReplicationStatusPending   = "PENDING"
+	ReplicationStatusCompleted = "COMPLETED"
+	ReplicationStatusFailed    = "FAILED"
+	ReplicationStatusReplica   = "REPLICA"
+)
+
+// ReplicationConfiguration holds the replication rules of a bucket. It
+// follows the shape of the S3 format, with an endpoint in place of an ARN,
+// and reads and writes both its XML and JSON forms.
+type ReplicationConfiguration struct {
+	XMLName xml.Name          `xml:"ReplicationConfiguration" json:"-"`
+	Rules   []ReplicationRule `xml:"Rule" json:"Rules"`
+}
+
+// ReplicationRule copies the objects selected by its filter, and their
+// metadata, to a destination bucket as they are written, and deletes them
+// there when they are deleted if DeleteReplication is enabled.
+type ReplicationRule struct {
+	ID                string                 `xml:"ID,omitempty" json:"ID,omitempty"`
+	Status            string                 `xml:"Status" json:"Status"`
+	Filter            *ReplicationFilter     `xml:"Filter,omitempty" json:"Filter,omitempty"`
+	DeleteReplication *DeleteReplication     `xml:"DeleteReplication,omitempty" json:"DeleteReplication,omitempty"`
+	Destination       ReplicationDestination `xml:"Destination" json:"Destination"`
+}
+
+// ReplicationFilter selects objects by key prefix or tag. Only one of its
+// conditions may be set; And combines several.
+type ReplicationFilter struct {
+	Prefix string          `xml:"Prefix,omitempty" json:"Prefix,omitempty"`
+	Tag    *Tag            `xml:"Tag,omitempty" json:"Tag,omitempty"`
+	And    *ReplicationAnd `xml:"And,omitempty" json:"And,omitempty"`
+}
+
+// ReplicationAnd selects objects matching all of its conditions.
+type ReplicationAnd struct {
+	Prefix string `xml:"Prefix,omitempty" json:"Prefix,omitempty"`
+	Tags   []Tag  `xml:"Tag" json:"Tags,omitempty"`
+}
+
+// DeleteReplication tells whether deleting an object deletes its copy.
+// Objects are not versioned, so there are no delete markers to replicate
+// as in S3, and deletes are not replicated unless enabled.
+type DeleteReplication struct {
+	Status string `xml:"Status" json:"Status"`
+}
+
+// ReplicationDestination is the bucket objects are copied to. Endpoint
+// tells where it lives: in the same data directory when empty, in another
+// one given as file:///path, or on a remote mini-s3 given as
+// http(s)://host:port.
+type ReplicationDestination struct {
+	Endpoint     string `xml:"Endpoint,omitempty" json:"Endpoint,omitempty"`
+	Bucket       string `xml:"Bucket" json:"Bucket"`
+	StorageClass string `xml:"StorageClass,omitempty" json:"StorageClass,omitempty"`
+}
+
+type ErrInvalidReplication struct {
+	Rule   string
+	Reason string
+}
+
+func (e *ErrInvalidReplication) Error() string {
+	if e.Rule == "" {
+		return "invalid replication configuration: " + e.Reason
+	}
+	return fmt.Sprintf("invalid replication rule %q: %s", e.Rule, e.Reason)
+}
+
+// ParseReplicationConfiguration reads a replication configuration in XML
+// or JSON form, telling them apart by the first character.
+func ParseReplicationConfiguration(data []byte) (*ReplicationConfiguration, error) {
+	cfg := &ReplicationConfiguration{}
+	data = bytes.TrimSpace(data)
+	var err error
+	if bytes.HasPrefix(data, []byte("<")) {
+		err = xml.Unmarshal(data, cfg)
+	} else {
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return nil, &ErrInvalidReplication{Reason: err.Error()}
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration of bucket against the rules S3
+// enforces, and that no two rules replicate to the same place, nor any to
+// the bucket itself.
+func (c *ReplicationConfiguration) Validate(bucket string) error {
+	if len(c.Rules) == 0 {
+		return &ErrInvalidReplication{Reason: "at least one rule is required"}
+	}
+	if len(c.Rules) > maxReplicationRules {
+		return &ErrInvalidReplication{Reason: fmt.Sprintf("at most %d rules are allowed", maxReplicationRules)}
+	}
+
+	ids := map[string]bool{}
+	destinations := map[string]bool{}
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		name := rule.ID
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if rule.ID != "" {
+			if ids[rule.ID] {
+				return &ErrInvalidReplication{Rule: name, Reason: "rule IDs must be unique"}
+			}
+			ids[rule.ID] = true
+		}
+		if err := rule.validate(); err != nil {
+			return &ErrInvalidReplication{Rule: name, Reason: err.Error()}
+		}
+
+		d := rule.Destination
+		if d.Endpoint == "" && d.Bucket == bucket {
+			return &ErrInvalidReplication{Rule: name, Reason: "a bucket cannot be replicated to itself"}
+		}
+		if destinations[d.Endpoint+" "+d.Bucket] {
+			return &ErrInvalidReplication{Rule: name, Reason: "another rule already replicates to " + d.String()}
+		}
+		destinations[d.Endpoint+" "+d.Bucket] = true
+	}
+	return nil
+}
+
+func (r *ReplicationRule) validate() error {
+	if len(r.ID) > 255 {
+		return errors.New("ID is longer than 255 characters")
+	}
+	if r.Status != ReplicationRuleEnabled && r.Status != ReplicationRuleDisabled {
+		return fmt.Errorf("status must be %s or %s", ReplicationRuleEnabled, ReplicationRuleDisabled)
+	}
+	if d := r.DeleteReplication; d != nil && d.Status != ReplicationRuleEnabled && d.Status != ReplicationRuleDisabled {
+		return fmt.Errorf("DeleteReplication status must be %s or %s", ReplicationRuleEnabled, ReplicationRuleDisabled)
+	}
+	if f := r.Filter; f != nil {
+		conditions := 0
+		for _, set := range []bool{f.Prefix != "", f.Tag != nil, f.And != nil} {
+			if set {
+				conditions++
+			}
+		}
+		if conditions > 1 {
+			return errors.New("Filter can only have one condition, use And to combine them")
+		}
+	}
+
+	d := r.Destination
+	if d.Bucket == "" || strings.ContainsAny(d.Bucket, "/\\") || strings.HasPrefix(d.Bucket, ".") {
+		return fmt.Errorf("invalid destination bucket %q", d.Bucket)
+	}
+	if d.StorageClass != "" {
+		if err := validateStorageClass(d.StorageClass); err != nil {
+			return err
+		}
+	}
+	if d.Endpoint != "" {
+		u, err := url.Parse(d.Endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid destination endpoint: %w", err)
+		}
+		switch u.Scheme {
+		case "file":
+			if !filepath.IsAbs(u.Path) {
+				return errors.New("file endpoints need an absolute path")
+			}
+		case "http", "https":
+			if u.Host == "" {
+				return errors.New("http endpoints need a host")
+			}
+		default:
+			return fmt.Errorf("destination endpoint must be file://, http:// or https://, got %q", d.Endpoint)
+		}
+	}
+	return nil
+}
+
+func (d ReplicationDestination) String() string {
+	if d.Endpoint == "" {
+		return d.Bucket
+	}
+	return strings.TrimSuffix(d.Endpoint, "/") + "/" + d.Bucket
+}
+
+// matches reports whether the rule's filter selects the object.
+func (r *ReplicationRule) matches(object string, tags map[string]string) bool {
+	if r.Filter == nil {
+		return true
+	}
+	prefix := r.Filter.Prefix
+	var wanted []Tag
+	if r.Filter.Tag != nil {
+		wanted = append(wanted, *r.Filter.Tag)
+	}
+	if and := r.Filter.And; and != nil {
+		prefix, wanted = and.Prefix, and.Tags
+	}
+
+	if !strings.HasPrefix(object, prefix) {
+		return false
+	}
+	for _, tag := range wanted {
+		if value, ok := tags[tag.Key]; !ok || value != tag.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *ReplicationRule) replicatesDeletes() bool {
+	return r.DeleteReplication != nil && r.DeleteReplication.Status == ReplicationRuleEnabled
+}
+
+// PutBucketReplication replaces the replication rules of a bucket. Only
+// objects written from then on are replicated.
+func (l *LocalStorage) PutBucketReplication(bucket string, cfg *ReplicationConfiguration) error {
+	if err := cfg.Validate(bucket); err != nil {
+		return err
+	}
+	return l.writeBucketConfig(bucket, "replication", cfg)
+}
+
+// GetBucketReplication returns the replication rules of a bucket, or nil
+// when it has none.
+func (l *LocalStorage) GetBucketReplication(bucket string) (*ReplicationConfiguration, error) {
+	var cfg ReplicationConfiguration
+	found, err := l.readBucketConfig(bucket, "replication", &cfg)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// DeleteBucketReplication removes every replication rule of a bucket.
+// Objects already queued are still replicated.
+func (l *LocalStorage) DeleteBucketReplication(bucket string) error {
+	return l.deleteBucketConfig(bucket, "replication")
+}
+
+// WithRemoteStorage lets replication rules use http(s):// endpoints, opening
+// the Storage of a remote mini-s3 with open.
+func WithRemoteStorage(open func(endpoint string) (Storage, error)) LocalStorageOption {
+	return func(l *LocalStorage) {
+		l.openRemote = open
+	}
+}
+
+// replicationTarget opens the Storage behind a destination endpoint.
+func (l *LocalStorage) replicationTarget(endpoint string) (Storage, error) {
+	if endpoint == "" {
+		return l, nil
+	}
+	if path, ok := strings.CutPrefix(endpoint, "file://"); ok {
+		return NewLocalStorage(path, l.checksum, WithRemoteStorage(l.openRemote)), nil
+	}
+	if l.openRemote == nil {
+		return nil, fmt.Errorf("no client for the replication endpoint %s", endpoint)
+	}
+	return l.openRemote(endpoint)
+}
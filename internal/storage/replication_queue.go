@@ -0,0 +1,397 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxReplicationAttempts is how often a change is tried before it is moved
+// aside to the failed ones, backing off like notifications.
+const maxReplicationAttempts = 15
+
+// replicationEntry is a queued change to replicate, kept in its own file
+// until replicated.
+type replicationEntry struct {
+	Bucket      string                 `json:"bucket"`
+	Object      string                 `json:"object"`
+	RuleID      string                 `json:"ruleId,omitempty"`
+	Delete      bool                   `json:"delete,omitempty"`
+	Destination ReplicationDestination `json:"destination"`
+	// ETag and CreatedAt identify the version of the object to copy. Once
+	// it is overwritten the entry is dropped, as the new version has one of
+	// its own.
+	ETag      string    `json:"etag,omitempty"`
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+
+	Attempts    int       `json:"attempts,omitempty"`
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// ReplicationReport describes a pass over the replication queue.
+type ReplicationReport struct {
+	Replicated int
+	// Retrying counts the changes left for a later pass, after a failure
+	// to replicate them or an earlier change to the same object.
+	Retrying int
+	// Failed counts the changes given up on in this pass.
+	Failed int
+}
+
+// ReplicationBacklog counts the changes waiting to be replicated and those
+// given up on.
+type ReplicationBacklog struct {
+	Pending int
+	Failed  int
+}
+
+func (l *LocalStorage) replicationQueueDir() string {
+	return filepath.Join(l.path, systemDir, "replication", "queue")
+}
+
+func (l *LocalStorage) failedReplicationDir() string {
+	return filepath.Join(l.path, systemDir, "replication", "failed")
+}
+
+// queueReplication queues a change to an object for every replication rule
+// of the bucket selecting it, with previous and meta as for publish. When a
+// write is queued, the object's replication status becomes PENDING. Callers
+// hold the object's lock.
+func (l *LocalStorage) queueReplication(bucket, object string, previous, meta *objectMeta) error {
+	cfg, err := l.GetBucketReplication(bucket)
+	if err != nil || cfg == nil {
+		return err
+	}
+	subject := meta
+	if meta == nil {
+		subject = previous
+	}
+	if subject == nil || subject.ReplicationStatus == ReplicationStatusReplica {
+		return nil
+	}
+	// Like S3, objects encrypted with a customer key are not replicated,
+	// and neither are archived ones, as they cannot be read
+	if meta != nil && ((meta.Encryption != nil && meta.Encryption.KeyMD5 != "") || meta.storageClass() == StorageClassArchive) {
+		return nil
+	}
+
+	seq := l.replication.sequence(time.Now())
+	queued := false
+	for i, rule := range cfg.Rules {
+		if rule.Status != ReplicationRuleEnabled || !rule.matches(object, subject.Tags) {
+			continue
+		}
+		if meta == nil && !rule.replicatesDeletes() {
+			continue
+		}
+		entry := &replicationEntry{Bucket: bucket, Object: object, RuleID: rule.ID, Delete: meta == nil, Destination: rule.Destination}
+		if meta != nil {
+			entry.ETag, entry.CreatedAt = meta.etag(), meta.CreatedAt
+		}
+		name := fmt.Sprintf("%s-%03d-%d.json", seq, i, os.Getpid())
+		if err := writeOutboxEntry(filepath.Join(l.replicationQueueDir(), name), entry); err != nil {
+			return err
+		}
+		queued = true
+	}
+	if !queued {
+		return nil
+	}
+	l.replication.signal()
+	if meta == nil {
+		return nil
+	}
+	meta.ReplicationStatus = ReplicationStatusPending
+	return l.writeMeta(bucket, object, meta)
+}
+
+// replicatedVersion identifies a version of an object whose replication
+// status a pass settles.
+type replicatedVersion struct {
+	bucket, object, etag string
+	createdAt            int64
+}
+
+// ReplicateObjects makes one pass over the replication queue, replicating
+// the changes that are due in the order they were queued. A failure is
+// retried with exponential backoff, and holds back the later changes to
+// the same object and destination so they apply in order. Entries are
+// removed once replicated, so they may be replicated again if the process
+// stops in between, which writing the same object again makes harmless.
+// Changes that could not be queued with their writes are retried first.
+func (l *LocalStorage) ReplicateObjects(ctx context.Context, now time.Time) (*ReplicationReport, error) {
+	l.retryUnpublished()
+	names, err := outboxNames(l.replicationQueueDir())
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReplicationReport{}
+	targets := map[string]Storage{}
+	held := map[string]bool{}
+	statuses := map[replicatedVersion]string{}
+	settle := func(entry *replicationEntry, status string) {
+		if entry.Delete {
+			return
+		}
+		v := replicatedVersion{entry.Bucket, entry.Object, entry.ETag, entry.CreatedAt.UnixNano()}
+		// A version is only complete when every rule replicated it
+		if current := statuses[v]; current == ReplicationStatusFailed || (current == ReplicationStatusPending && status == ReplicationStatusCompleted) {
+			return
+		}
+		statuses[v] = status
+	}
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+
+		path := filepath.Join(l.replicationQueueDir(), name)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		var entry replicationEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return report, fmt.Errorf("reading queued replication %s: %w", name, err)
+		}
+
+		key := entry.Bucket + "/" + entry.Object + " " + entry.Destination.String()
+		if held[key] || entry.NextAttempt.After(now) {
+			held[key] = true
+			report.Retrying++
+			settle(&entry, ReplicationStatusPending)
+			continue
+		}
+
+		replicated, replicateErr := l.replicateEntry(&entry, targets)
+		if replicateErr == nil {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return report, err
+			}
+			if replicated {
+				report.Replicated++
+				settle(&entry, ReplicationStatusCompleted)
+			}
+			continue
+		}
+
+		entry.Attempts++
+		entry.LastError = replicateErr.Error()
+		if entry.Attempts >= maxReplicationAttempts {
+			if err := writeOutboxEntry(filepath.Join(l.failedReplicationDir(), name), &entry); err != nil {
+				return report, err
+			}
+			if err := os.Remove(path); err != nil {
+				return report, err
+			}
+			report.Failed++
+			settle(&entry, ReplicationStatusFailed)
+			continue
+		}
+		entry.NextAttempt = now.Add(retryDelay(entry.Attempts))
+		if err := writeOutboxEntry(path, &entry); err != nil {
+			return report, err
+		}
+		held[key] = true
+		report.Retrying++
+		settle(&entry, ReplicationStatusPending)
+	}
+
+	for v, status := range statuses {
+		if err := l.setReplicationStatus(v, status); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// replicateEntry applies a queued change to its destination. It reports
+// false, without an error, for changes superseded by a later one.
+func (l *LocalStorage) replicateEntry(entry *replicationEntry, targets map[string]Storage) (bool, error) {
+	dst := entry.Destination
+	target, ok := targets[dst.Endpoint]
+	if !ok {
+		var err error
+		if target, err = l.replicationTarget(dst.Endpoint); err != nil {
+			return false, err
+		}
+		targets[dst.Endpoint] = target
+	}
+
+	if entry.Delete {
+		exists, err := l.Exists(entry.Bucket, entry.Object)
+		if err != nil || exists {
+			return false, err
+		}
+		if err := target.Delete(dst.Bucket, entry.Object); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		return true, nil
+	}
+
+	body, info, err := l.Get(entry.Bucket, entry.Object)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+	if info.ETag != entry.ETag || !info.CreatedAt.Equal(entry.CreatedAt) {
+		return false, nil
+	}
+
+	// The replica's ETag is the MD5 of what it received, which must be what
+	// was sent
+	sent := md5.New()
+	replica, err := target.Save(dst.Bucket, entry.Object, io.TeeReader(body, sent), replicaOptions(info, dst)...)
+	if err != nil {
+		return false, err
+	}
+	if sum := hex.EncodeToString(sent.Sum(nil)); replica.ETag != sum {
+		return false, fmt.Errorf("replica of %s/%s has ETag %s, expected %s", entry.Bucket, entry.Object, replica.ETag, sum)
+	}
+	return true, nil
+}
+
+// replicaOptions saves a replica with the metadata of the object info
+// describes.
+func replicaOptions(info *ObjectInfo, dst ReplicationDestination) []Option {
+	opts := []Option{WithReplica()}
+	if info.ContentType != "" {
+		opts = append(opts, WithContentType(info.ContentType))
+	}
+	if info.ContentEncoding != "" {
+		opts = append(opts, WithContentEncoding(info.ContentEncoding))
+	}
+	if info.ContentDisposition != "" {
+		opts = append(opts, WithContentDisposition(info.ContentDisposition))
+	}
+	if info.CacheControl != "" {
+		opts = append(opts, WithCacheControl(info.CacheControl))
+	}
+	if !info.Expires.IsZero() {
+		opts = append(opts, WithExpires(info.Expires))
+	}
+	if len(info.UserMetadata) > 0 {
+		opts = append(opts, WithUserMetadata(info.UserMetadata))
+	}
+	if len(info.Tags) > 0 {
+		opts = append(opts, WithTags(info.Tags))
+	}
+	class := dst.StorageClass
+	if class == "" {
+		class = info.StorageClass
+	}
+	if class != "" {
+		opts = append(opts, WithStorageClass(class))
+	}
+	return opts
+}
+
+// setReplicationStatus records the outcome of a pass on an object, unless
+// it was overwritten since. A failure sticks until retried.
+func (l *LocalStorage) setReplicationStatus(v replicatedVersion, status string) error {
+	unlock, err := l.lockObject(v.bucket, v.object, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(v.bucket, v.object)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if meta.etag() != v.etag || meta.CreatedAt.UnixNano() != v.createdAt || meta.ReplicationStatus == status {
+		return nil
+	}
+	if meta.ReplicationStatus == ReplicationStatusFailed && status != ReplicationStatusPending {
+		return nil
+	}
+	meta.ReplicationStatus = status
+	return l.writeMeta(v.bucket, v.object, meta)
+}
+
+// RunReplication replicates queued changes each interval, and as soon as
+// new ones are queued, until ctx is done. Each pass is handed to report.
+func (l *LocalStorage) RunReplication(ctx context.Context, interval time.Duration, report func(*ReplicationReport, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-l.replication.wake:
+		}
+		report(l.ReplicateObjects(ctx, time.Now()))
+	}
+}
+
+// GetReplicationBacklog counts the changes waiting in the replication queue
+// and those given up on.
+func (l *LocalStorage) GetReplicationBacklog() (*ReplicationBacklog, error) {
+	pending, err := outboxNames(l.replicationQueueDir())
+	if err != nil {
+		return nil, err
+	}
+	failed, err := outboxNames(l.failedReplicationDir())
+	if err != nil {
+		return nil, err
+	}
+	return &ReplicationBacklog{Pending: len(pending), Failed: len(failed)}, nil
+}
+
+// RetryFailedReplication queues the changes given up on again, with their
+// attempts reset, and marks their objects PENDING. It returns how many
+// there were.
+func (l *LocalStorage) RetryFailedReplication() (int, error) {
+	names, err := outboxNames(l.failedReplicationDir())
+	if err != nil {
+		return 0, err
+	}
+	for i, name := range names {
+		path := filepath.Join(l.failedReplicationDir(), name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return i, err
+		}
+		var entry replicationEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return i, err
+		}
+		entry.Attempts, entry.NextAttempt, entry.LastError = 0, time.Time{}, ""
+		if err := writeOutboxEntry(filepath.Join(l.replicationQueueDir(), name), &entry); err != nil {
+			return i, err
+		}
+		if err := os.Remove(path); err != nil {
+			return i, err
+		}
+		if !entry.Delete {
+			v := replicatedVersion{entry.Bucket, entry.Object, entry.ETag, entry.CreatedAt.UnixNano()}
+			if err := l.setReplicationStatus(v, ReplicationStatusPending); err != nil {
+				return i, err
+			}
+		}
+	}
+	if len(names) > 0 {
+		l.replication.signal()
+	}
+	return len(names), nil
+}
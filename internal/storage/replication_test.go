@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplicationConfiguration_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     string
+		wantErr bool
+	}{
+		{"valid", `{"Rules": [{"ID": "a", "Status": "Enabled", "Filter": {"And": {"Prefix": "logs/", "Tags": [{"Key": "team", "Value": "data"}]}}, "DeleteReplication": {"Status": "Enabled"}, "Destination": {"Bucket": "backup"}}]}`, false},
+		{"remote endpoints", `{"Rules": [{"Status": "Enabled", "Destination": {"Endpoint": "http://replica:9000", "Bucket": "logs"}}, {"Status": "Enabled", "Destination": {"Endpoint": "file:///mnt/replica", "Bucket": "logs"}}]}`, false},
+		{"no rules", `{"Rules": []}`, true},
+		{"bad status", `{"Rules": [{"Status": "On", "Destination": {"Bucket": "backup"}}]}`, true},
+		{"bad delete status", `{"Rules": [{"Status": "Enabled", "DeleteReplication": {"Status": "On"}, "Destination": {"Bucket": "backup"}}]}`, true},
+		{"no destination", `{"Rules": [{"Status": "Enabled"}]}`, true},
+		{"to itself", `{"Rules": [{"Status": "Enabled", "Destination": {"Bucket": "logs"}}]}`, true},
+		{"same destination twice", `{"Rules": [{"Status": "Enabled", "Destination": {"Bucket": "backup"}}, {"Status": "Enabled", "Filter": {"Prefix": "a"}, "Destination": {"Bucket": "backup"}}]}`, true},
+		{"two filter conditions", `{"Rules": [{"Status": "Enabled", "Filter": {"Prefix": "a", "Tag": {"Key": "k", "Value": "v"}}, "Destination": {"Bucket": "backup"}}]}`, true},
+		{"unknown scheme", `{"Rules": [{"Status": "Enabled", "Destination": {"Endpoint": "s3://replica", "Bucket": "logs"}}]}`, true},
+		{"relative file endpoint", `{"Rules": [{"Status": "Enabled", "Destination": {"Endpoint": "file://replica", "Bucket": "logs"}}]}`, true},
+		{"bad storage class", `{"Rules": [{"Status": "Enabled", "Destination": {"Bucket": "backup", "StorageClass": "FROZEN"}}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseReplicationConfiguration([]byte(tt.cfg))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			var invalid *ErrInvalidReplication
+			if err := cfg.Validate("logs"); tt.wantErr != errors.As(err, &invalid) {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("Reads the XML form", func(t *testing.T) {
+		cfg, err := ParseReplicationConfiguration([]byte(`<ReplicationConfiguration>
+  <Rule>
+    <ID>backup</ID>
+    <Status>Enabled</Status>
+    <Filter><Prefix>logs/</Prefix></Filter>
+    <DeleteReplication><Status>Enabled</Status></DeleteReplication>
+    <Destination><Endpoint>http://replica:9000</Endpoint><Bucket>logs</Bucket></Destination>
+  </Rule>
+</ReplicationConfiguration>`))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		rule := cfg.Rules[0]
+		if rule.ID != "backup" || rule.Filter.Prefix != "logs/" || !rule.replicatesDeletes() || rule.Destination.String() != "http://replica:9000/logs" {
+			t.Errorf("Unexpected rule %+v", rule)
+		}
+	})
+}
+
+// failingStorage is a replication target whose writes fail while failing
+// is set.
+type failingStorage struct {
+	Storage
+	failing bool
+}
+
+func (f *failingStorage) Save(bucket, object string, r io.Reader, opts ...Option) (*ObjectInfo, error) {
+	if f.failing {
+		return nil, errors.New("replica is down")
+	}
+	return f.Storage.Save(bucket, object, r, opts...)
+}
+
+func TestLocalStorage_Replication(t *testing.T) {
+	ctx := context.Background()
+	save := func(t *testing.T, l *LocalStorage, bucket, object, content string, opts ...Option) *ObjectInfo {
+		t.Helper()
+		info, err := l.Save(bucket, object, strings.NewReader(content), opts...)
+		if err != nil {
+			t.Fatalf("Failed to save %s: %v", object, err)
+		}
+		return info
+	}
+	replicate := func(t *testing.T, l *LocalStorage, now time.Time) *ReplicationReport {
+		t.Helper()
+		report, err := l.ReplicateObjects(ctx, now)
+		if err != nil {
+			t.Fatalf("Failed to replicate: %v", err)
+		}
+		return report
+	}
+	status := func(t *testing.T, l *LocalStorage, bucket, object string) string {
+		t.Helper()
+		info, err := l.Head(bucket, object)
+		if err != nil {
+			t.Fatalf("Failed to head %s/%s: %v", bucket, object, err)
+		}
+		return info.ReplicationStatus
+	}
+	configure := func(t *testing.T, l *LocalStorage, bucket, cfg string) {
+		t.Helper()
+		parsed, err := ParseReplicationConfiguration([]byte(cfg))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if err := l.PutBucketReplication(bucket, parsed); err != nil {
+			t.Fatalf("Failed to set replication rules: %v", err)
+		}
+	}
+
+	t.Run("Copies selected objects with their metadata", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		configure(t, l, "logs", `{"Rules": [{"Status": "Enabled", "Filter": {"And": {"Prefix": "app/", "Tags": [{"Key": "keep", "Value": "yes"}]}}, "Destination": {"Bucket": "backup", "StorageClass": "COLD"}}]}`)
+
+		info := save(t, l, "logs", "app/1.log", "one", WithTags(map[string]string{"keep": "yes"}), WithContentType("text/plain"), WithUserMetadata(map[string]string{"host": "web-1"}))
+		if info.ReplicationStatus != ReplicationStatusPending {
+			t.Errorf("Expected PENDING on save, got %q", info.ReplicationStatus)
+		}
+		save(t, l, "logs", "app/2.log", "two")
+		save(t, l, "logs", "db/1.log", "three", WithTags(map[string]string{"keep": "yes"}))
+
+		if report := replicate(t, l, time.Now()); report.Replicated != 1 || report.Retrying != 0 {
+			t.Errorf("Expected 1 replicated, got %+v", report)
+		}
+		if got := status(t, l, "logs", "app/1.log"); got != ReplicationStatusCompleted {
+			t.Errorf("Expected COMPLETED, got %q", got)
+		}
+		if got := status(t, l, "logs", "app/2.log"); got != "" {
+			t.Errorf("Expected no status on an object no rule selects, got %q", got)
+		}
+
+		body, replica, err := l.Get("backup", "app/1.log")
+		if err != nil {
+			t.Fatalf("Failed to get replica: %v", err)
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if string(data) != "one" || replica.ETag != info.ETag {
+			t.Errorf("Expected the replica to hold the object, got %q with ETag %s", data, replica.ETag)
+		}
+		if replica.ReplicationStatus != ReplicationStatusReplica || replica.ContentType != "text/plain" || replica.UserMetadata["host"] != "web-1" || replica.Tags["keep"] != "yes" || replica.StorageClass != StorageClassCold {
+			t.Errorf("Expected the replica to keep the metadata, got %+v", replica)
+		}
+		if exists, _ := l.Exists("backup", "db/1.log"); exists {
+			t.Error("Expected objects outside the prefix not to be replicated")
+		}
+	})
+
+	t.Run("Replicates deletes only when enabled", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		configure(t, l, "logs", `{"Rules": [{"Status": "Enabled", "DeleteReplication": {"Status": "Enabled"}, "Destination": {"Bucket": "mirror"}}, {"Status": "Enabled", "Destination": {"Bucket": "archive"}}]}`)
+		save(t, l, "logs", "a.log", "a")
+		replicate(t, l, time.Now())
+
+		if err := l.Delete("logs", "a.log"); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+		if report := replicate(t, l, time.Now()); report.Replicated != 1 {
+			t.Errorf("Expected 1 replicated delete, got %+v", report)
+		}
+		if exists, _ := l.Exists("mirror", "a.log"); exists {
+			t.Error("Expected the delete to be replicated to mirror")
+		}
+		if exists, _ := l.Exists("archive", "a.log"); !exists {
+			t.Error("Expected archive to keep its replica")
+		}
+	})
+
+	t.Run("Replicates to another data directory", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		other := t.TempDir()
+		configure(t, l, "logs", `{"Rules": [{"Status": "Enabled", "Destination": {"Endpoint": "file://`+other+`", "Bucket": "logs"}}]}`)
+		save(t, l, "logs", "a.log", "a")
+		replicate(t, l, time.Now())
+
+		if got := status(t, NewLocalStorage(other, NewValueChecksum()), "logs", "a.log"); got != ReplicationStatusReplica {
+			t.Errorf("Expected a REPLICA in the other data directory, got %q", got)
+		}
+	})
+
+	t.Run("Only replicates the latest version", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		configure(t, l, "logs", `{"Rules": [{"Status": "Enabled", "Destination": {"Bucket": "backup"}}]}`)
+		save(t, l, "logs", "a.log", "first")
+		save(t, l, "logs", "a.log", "second")
+
+		if report := replicate(t, l, time.Now()); report.Replicated != 1 {
+			t.Errorf("Expected the first version to be skipped, got %+v", report)
+		}
+		body, _, err := l.Get("backup", "a.log")
+		if err != nil {
+			t.Fatalf("Failed to get replica: %v", err)
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if string(data) != "second" {
+			t.Errorf("Expected the second version, got %q", data)
+		}
+	})
+
+	t.Run("Replicates tag changes", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		configure(t, l, "logs", `{"Rules": [{"Status": "Enabled", "Destination": {"Bucket": "backup"}}]}`)
+		save(t, l, "logs", "a.log", "a")
+		replicate(t, l, time.Now())
+
+		if err := l.PutObjectTagging("logs", "a.log", map[string]string{"team": "data"}); err != nil {
+			t.Fatalf("Failed to tag: %v", err)
+		}
+		if got := status(t, l, "logs", "a.log"); got != ReplicationStatusPending {
+			t.Errorf("Expected PENDING after tagging, got %q", got)
+		}
+		replicate(t, l, time.Now())
+		if tags, _ := l.GetObjectTagging("backup", "a.log"); tags["team"] != "data" {
+			t.Errorf("Expected the replica to get the tags, got %v", tags)
+		}
+	})
+
+	t.Run("Does not replicate replicas", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		configure(t, l, "east", `{"Rules": [{"Status": "Enabled", "Destination": {"Bucket": "west"}}]}`)
+		configure(t, l, "west", `{"Rules": [{"Status": "Enabled", "Destination": {"Bucket": "east"}}]}`)
+		save(t, l, "east", "a.log", "a")
+		replicate(t, l, time.Now())
+
+		backlog, err := l.GetReplicationBacklog()
+		if err != nil || backlog.Pending != 0 {
+			t.Errorf("Expected nothing left to replicate, got %+v %v", backlog, err)
+		}
+		if got := status(t, l, "east", "a.log"); got != ReplicationStatusCompleted {
+			t.Errorf("Expected the original to stay COMPLETED, got %q", got)
+		}
+	})
+
+	t.Run("Retries failures and gives up eventually", func(t *testing.T) {
+		target := &failingStorage{Storage: NewLocalStorage(t.TempDir(), NewValueChecksum()), failing: true}
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum(), WithRemoteStorage(func(endpoint string) (Storage, error) {
+			return target, nil
+		}))
+		configure(t, l, "logs", `{"Rules": [{"Status": "Enabled", "Destination": {"Endpoint": "http://replica:9000", "Bucket": "logs"}}]}`)
+		save(t, l, "logs", "a.log", "a")
+		save(t, l, "logs", "a.log", "b")
+		save(t, l, "logs", "b.log", "b")
+
+		// The first version of a.log is dropped, as the second replaces it
+		now := time.Now()
+		if report := replicate(t, l, now); report.Retrying != 2 || report.Replicated != 0 {
+			t.Errorf("Expected both objects to be retried, got %+v", report)
+		}
+		// Not due yet
+		if report := replicate(t, l, now); report.Retrying != 2 {
+			t.Errorf("Expected the changes to wait, got %+v", report)
+		}
+		if got := status(t, l, "logs", "b.log"); got != ReplicationStatusPending {
+			t.Errorf("Expected PENDING while retrying, got %q", got)
+		}
+
+		for i := 0; i < maxReplicationAttempts; i++ {
+			now = now.Add(maxNotificationBackoff)
+			replicate(t, l, now)
+		}
+		if got := status(t, l, "logs", "b.log"); got != ReplicationStatusFailed {
+			t.Errorf("Expected FAILED after giving up, got %q", got)
+		}
+		backlog, _ := l.GetReplicationBacklog()
+		if backlog.Pending != 0 || backlog.Failed == 0 {
+			t.Errorf("Expected the changes to be set aside, got %+v", backlog)
+		}
+
+		target.failing = false
+		if n, err := l.RetryFailedReplication(); err != nil || n != backlog.Failed {
+			t.Fatalf("Expected %d changes retried, got %d %v", backlog.Failed, n, err)
+		}
+		if got := status(t, l, "logs", "b.log"); got != ReplicationStatusPending {
+			t.Errorf("Expected PENDING after retrying, got %q", got)
+		}
+		replicate(t, l, now)
+		if got := status(t, l, "logs", "b.log"); got != ReplicationStatusCompleted {
+			t.Errorf("Expected COMPLETED once replicated, got %q", got)
+		}
+		if exists, _ := target.Exists("logs", "a.log"); !exists {
+			t.Error("Expected a.log to be replicated")
+		}
+	})
+
+	t.Run("Needs a client for remote endpoints", func(t *testing.T) {
+		l := NewLocalStorage(t.TempDir(), NewValueChecksum())
+		configure(t, l, "logs", `{"Rules": [{"Status": "Enabled", "Destination": {"Endpoint": "http://replica:9000", "Bucket": "logs"}}]}`)
+		save(t, l, "logs", "a.log", "a")
+		if report := replicate(t, l, time.Now()); report.Retrying != 1 {
+			t.Errorf("Expected the change to be retried, got %+v", report)
+		}
+		if _, err := os.Stat(l.replicationQueueDir()); err != nil {
+			t.Errorf("Expected the queue to be kept: %v", err)
+		}
+	})
+}
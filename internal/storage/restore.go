@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrInvalidObjectState is returned when reading an archived object that has
+// not been restored, or restoring an object that is not archived.
+var ErrInvalidObjectState = errors.New("the operation is not valid for the object's storage class")
+
+// ErrInvalidRestoreDays is returned by RestoreObject for a restore shorter
+// than a day.
+var ErrInvalidRestoreDays = errors.New("restore days must be at least 1")
+
+// restoreMeta records the temporary, readable copy of an archived object.
+type restoreMeta struct {
+	Locator   string    `json:"locator"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// readLocation returns where to read the object's bytes from as of now.
+// Archived objects are only readable through an unexpired restored copy.
+func (m *objectMeta) readLocation(bucket, object string, now time.Time) (string, string, error) {
+	if m.storageClass() != StorageClassArchive {
+		backend, locator := m.location(bucket, object)
+		return backend, locator, nil
+	}
+	if m.Restore == nil || !now.Before(m.Restore.ExpiresAt) {
+		return "", "", ErrInvalidObjectState
+	}
+	return backendRestored, m.Restore.Locator, nil
+}
+
+// RestoreObject makes an archived object readable for the given number of
+// days by copying it out of its archive pack. Like S3, the copy expires at
+// midnight UTC, and restoring an object that is already restored only moves
+// its expiry.
+func (l *LocalStorage) RestoreObject(bucket, object string, days int) (*ObjectInfo, error) {
+	if err := validateObjectName(bucket, object); err != nil {
+		return nil, err
+	}
+	if days < 1 {
+		return nil, ErrInvalidRestoreDays
+	}
+
+	unlock, err := l.lockObject(bucket, object, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	if meta.storageClass() != StorageClassArchive {
+		return nil, ErrInvalidObjectState
+	}
+
+	expiresAt := dueAt(time.Now(), days, nil)
+	if meta.Restore != nil {
+		meta.Restore.ExpiresAt = expiresAt
+		if err := l.writeMeta(bucket, object, meta); err != nil {
+			return nil, err
+		}
+		return l.newObjectInfo(bucket, object, meta), nil
+	}
+
+	backend, locator := meta.location(bucket, object)
+	src, err := l.backends[backend].Open(locator)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	file, err := l.createTemp()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, digest), src); err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	restored, err := l.backends[backendRestored].Put(bucket, object, file.Name(), hex.EncodeToString(digest.Sum(nil)))
+	if err != nil {
+		return nil, err
+	}
+	meta.Restore = &restoreMeta{Locator: restored, ExpiresAt: expiresAt}
+	if err := l.writeMeta(bucket, object, meta); err != nil {
+		return nil, err
+	}
+	return l.newObjectInfo(bucket, object, meta), nil
+}
+
+// releaseRestore deletes the restored copy of an object, if it has one.
+func (l *LocalStorage) releaseRestore(bucket, object string, meta *objectMeta) error {
+	if meta.Restore == nil {
+		return nil
+	}
+	err := l.backends[backendRestored].Remove(bucket, object, meta.Restore.Locator)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// expireRestores deletes the restored copies in bucket that expired by
+// now, and returns how many there were. In a dry run, they are only
+// counted.
+func (l *LocalStorage) expireRestores(bucket string, now time.Time, dryRun bool) (int, error) {
+	objects, err := l.ListObjects(bucket)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, obj := range objects {
+		if obj.RestoreExpiresAt.IsZero() || now.Before(obj.RestoreExpiresAt) {
+			continue
+		}
+		if dryRun {
+			expired++
+			continue
+		}
+
+		done, err := l.expireRestore(bucket, obj.Object, now)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return expired, err
+		}
+		if done {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func (l *LocalStorage) expireRestore(bucket, object string, now time.Time) (bool, error) {
+	unlock, err := l.lockObject(bucket, object, true)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	// Checked again, as it may have been restored for longer since
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return false, err
+	}
+	if meta.Restore == nil || now.Before(meta.Restore.ExpiresAt) {
+		return false, nil
+	}
+
+	if err := l.releaseRestore(bucket, object, meta); err != nil {
+		return false, err
+	}
+	meta.Restore = nil
+	return true, l.writeMeta(bucket, object, meta)
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage_Archive(t *testing.T) {
+	tempDir := t.TempDir()
+	storage := NewLocalStorage(tempDir, NewValueChecksum())
+	content := strings.Repeat("audit record\n", 1000)
+
+	for _, object := range []string{"2023.log", "2024.log"} {
+		info, err := storage.Save("compliance", object, strings.NewReader(content), WithStorageClass(StorageClassArchive))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if info.StorageClass != StorageClassArchive {
+			t.Errorf("Expected class %s, got %s", StorageClassArchive, info.StorageClass)
+		}
+	}
+
+	t.Run("Packs objects into one compressed file", func(t *testing.T) {
+		packs, _ := filepath.Glob(filepath.Join(DefaultStorageClassRoot(tempDir, StorageClassArchive), "pack-*.zst"))
+		if len(packs) != 1 {
+			t.Fatalf("Expected 1 pack, got %v", packs)
+		}
+		info, err := os.Stat(packs[0])
+		if err != nil {
+			t.Fatalf("Failed to stat pack: %v", err)
+		}
+		if info.Size() >= int64(len(content)) {
+			t.Errorf("Expected the pack to be compressed, got %d bytes for 2x%d", info.Size(), len(content))
+		}
+	})
+
+	t.Run("Is not readable until restored", func(t *testing.T) {
+		if _, _, err := storage.Get("compliance", "2023.log"); !errors.Is(err, ErrInvalidObjectState) {
+			t.Errorf("Expected ErrInvalidObjectState, got %v", err)
+		}
+	})
+
+	t.Run("Restores a temporary copy", func(t *testing.T) {
+		info, err := storage.RestoreObject("compliance", "2023.log", 2)
+		if err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		if info.RestoreExpiresAt.Before(time.Now().Add(2*24*time.Hour)) || !isMidnightUTC(info.RestoreExpiresAt) {
+			t.Errorf("Expected expiry at midnight UTC after 2 days, got %v", info.RestoreExpiresAt)
+		}
+		if got := readObject(t, storage, "compliance", "2023.log"); got != content {
+			t.Errorf("Restored content does not match")
+		}
+		if got := readRange(t, storage, "compliance", "2023.log", 13, 12); string(got) != "audit record" {
+			t.Errorf("Expected 'audit record', got '%s'", got)
+		}
+		if _, _, err := storage.Get("compliance", "2024.log"); !errors.Is(err, ErrInvalidObjectState) {
+			t.Errorf("Expected the other object to stay archived, got %v", err)
+		}
+	})
+
+	t.Run("Deletes expired copies", func(t *testing.T) {
+		report, err := storage.ApplyLifecycle("", time.Now().Add(4*24*time.Hour), false)
+		if err != nil {
+			t.Fatalf("Failed to apply lifecycle: %v", err)
+		}
+		if report.ExpiredRestores != 1 {
+			t.Errorf("Expected 1 expired restore, got %+v", report)
+		}
+		if _, _, err := storage.Get("compliance", "2023.log"); !errors.Is(err, ErrInvalidObjectState) {
+			t.Errorf("Expected ErrInvalidObjectState after expiry, got %v", err)
+		}
+		copies, _ := filepath.Glob(filepath.Join(tempDir, systemDir, "restored", "compliance", "*"))
+		if len(copies) != 0 {
+			t.Errorf("Expected restored copies to be deleted, got %v", copies)
+		}
+	})
+
+	t.Run("Rejects restores of other classes", func(t *testing.T) {
+		if _, err := storage.Save("compliance", "hot.log", strings.NewReader("hot")); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if _, err := storage.RestoreObject("compliance", "hot.log", 1); !errors.Is(err, ErrInvalidObjectState) {
+			t.Errorf("Expected ErrInvalidObjectState, got %v", err)
+		}
+		if _, err := storage.RestoreObject("compliance", "2024.log", 0); !errors.Is(err, ErrInvalidRestoreDays) {
+			t.Errorf("Expected ErrInvalidRestoreDays, got %v", err)
+		}
+	})
+
+	t.Run("Lifecycle transitions objects to the archive", func(t *testing.T) {
+		backdate(t, storage, "compliance", "hot.log", time.Now().Add(-400*24*time.Hour))
+		cfg := &LifecycleConfiguration{Rules: []LifecycleRule{{
+			ID:          "archive-after-a-year",
+			Status:      LifecycleStatusEnabled,
+			Transitions: []LifecycleTransition{{Days: 30, StorageClass: StorageClassCold}, {Days: 365, StorageClass: StorageClassArchive}},
+		}}}
+		if err := storage.PutBucketLifecycle("compliance", cfg); err != nil {
+			t.Fatalf("Failed to set lifecycle: %v", err)
+		}
+		report, err := storage.ApplyLifecycle("compliance", time.Now(), false)
+		if err != nil {
+			t.Fatalf("Failed to apply lifecycle: %v", err)
+		}
+		if len(report.Actions) != 1 || report.Actions[0].StorageClass != StorageClassArchive {
+			t.Fatalf("Expected hot.log to go straight to the archive, got %+v", report.Actions)
+		}
+		if _, _, err := storage.Get("compliance", "hot.log"); !errors.Is(err, ErrInvalidObjectState) {
+			t.Errorf("Expected ErrInvalidObjectState, got %v", err)
+		}
+		if _, err := storage.RestoreObject("compliance", "hot.log", 1); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		if got := readObject(t, storage, "compliance", "hot.log"); got != "hot" {
+			t.Errorf("Expected 'hot', got '%s'", got)
+		}
+	})
+
+	t.Run("Deleting removes the restored copy", func(t *testing.T) {
+		if err := storage.Delete("compliance", "hot.log"); err != nil {
+			t.Fatalf("Failed to delete file: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(tempDir, systemDir, "restored", "compliance", "hot.log")); !os.IsNotExist(err) {
+			t.Errorf("Expected the restored copy to be deleted, got %v", err)
+		}
+	})
+}
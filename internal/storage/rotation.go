@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rotationCheckpointEvery bounds how much work an interrupted rotation has
+// to redo. Rewrapping is idempotent, so redoing a few objects is harmless.
+const rotationCheckpointEvery = 100
+
+// RotationProgress is persisted while a key rotation runs, so that an
+// interrupted job resumes where it stopped instead of starting over.
+type RotationProgress struct {
+	TargetVersion int       `json:"targetVersion"`
+	Bucket        string    `json:"bucket"`
+	Object        string    `json:"object"`
+	Rewrapped     int       `json:"rewrapped"`
+	Failed        []string  `json:"failed,omitempty"`
+	StartedAt     time.Time `json:"startedAt"`
+	CompletedAt   time.Time `json:"completedAt,omitzero"`
+}
+
+// Done reports whether the rotation went through every object.
+func (p *RotationProgress) Done() bool {
+	return !p.CompletedAt.IsZero()
+}
+
+// StaleObject is an object whose data key is not wrapped with the active
+// master key.
+type StaleObject struct {
+	Bucket     string
+	Object     string
+	KeyVersion int
+}
+
+// KeyReport summarises which master key versions objects are wrapped with.
+type KeyReport struct {
+	ActiveVersion int
+	Versions      map[int]int
+	Stale         []StaleObject
+	CustomerKeys  int
+	Unencrypted   int
+}
+
+func (l *LocalStorage) rotationProgressPath() string {
+	return filepath.Join(l.path, systemDir, "key-rotation.json")
+}
+
+// LoadRotationProgress returns the state of the last key rotation, or nil if
+// none was ever started.
+func (l *LocalStorage) LoadRotationProgress() (*RotationProgress, error) {
+	data, err := os.ReadFile(l.rotationProgressPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var progress RotationProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+func (l *LocalStorage) saveRotationProgress(progress *RotationProgress) error {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := l.rotationProgressPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RotateKeys rewraps the data key of every object encrypted at rest with the
+// active master key. Object bodies are never rewritten, only their metadata.
+//
+// If a previous rotation was interrupted it is resumed; otherwise a new
+// master key is generated first. Objects saved while the rotation runs are
+// already wrapped with the new key. Older key versions stay in the keyring
+// so objects that could not be rewrapped remain readable.
+func (l *LocalStorage) RotateKeys() (*RotationProgress, error) {
+	if l.keyring == nil {
+		return nil, ErrNoKeyring
+	}
+
+	progress, err := l.LoadRotationProgress()
+	if err != nil {
+		return nil, err
+	}
+	if err := l.keyring.refresh(); err != nil {
+		return nil, err
+	}
+
+	active := l.keyring.ActiveKey()
+	if progress == nil || progress.Done() || active == nil || progress.TargetVersion != active.Version {
+		if active, err = l.keyring.Rotate(); err != nil {
+			return nil, err
+		}
+		progress = &RotationProgress{TargetVersion: active.Version, StartedAt: time.Now()}
+		if err := l.saveRotationProgress(progress); err != nil {
+			return nil, err
+		}
+	}
+
+	pending := 0
+	err = l.walkObjects(progress.Bucket, progress.Object, func(bucket, object string) error {
+		rewrapped, err := l.rewrapKey(bucket, object, active)
+		if err != nil {
+			progress.Failed = append(progress.Failed, bucket+"/"+object)
+		}
+		if rewrapped {
+			progress.Rewrapped++
+		}
+
+		progress.Bucket, progress.Object = bucket, object
+		pending++
+		if pending == rotationCheckpointEvery {
+			pending = 0
+			return l.saveRotationProgress(progress)
+		}
+		return nil
+	})
+	if err != nil {
+		// Keep whatever was done so far for the next attempt
+		_ = l.saveRotationProgress(progress)
+		return progress, err
+	}
+
+	progress.CompletedAt = time.Now()
+	return progress, l.saveRotationProgress(progress)
+}
+
+// rewrapKey rewraps one object's data key with the given master key. It
+// reports false for objects that are not encrypted at rest or already use
+// that key.
+func (l *LocalStorage) rewrapKey(bucket, object string, master *MasterKey) (bool, error) {
+	unlock, err := l.lockObject(bucket, object, true)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	meta, err := l.readMeta(bucket, object)
+	if err != nil {
+		return false, err
+	}
+	if meta == nil || meta.Encryption == nil || meta.Encryption.KeyVersion == 0 || meta.Encryption.KeyVersion == master.Version {
+		return false, nil
+	}
+
+	old, err := l.masterKey(meta.Encryption.KeyVersion)
+	if err != nil {
+		return false, err
+	}
+	dataKey, err := openKey(old.Key, meta.Encryption.SealedKey)
+	if err != nil {
+		return false, err
+	}
+	sealed, err := sealKey(master.Key, dataKey)
+	if err != nil {
+		return false, err
+	}
+
+	meta.Encryption.SealedKey = sealed
+	meta.Encryption.KeyVersion = master.Version
+	return true, l.writeMeta(bucket, object, meta)
+}
+
+// KeyReport walks every object and reports the master key versions in use,
+// listing the objects still on an old version.
+func (l *LocalStorage) KeyReport() (*KeyReport, error) {
+	report := &KeyReport{Versions: map[int]int{}}
+	if l.keyring != nil {
+		if err := l.keyring.refresh(); err != nil {
+			return nil, err
+		}
+		if active := l.keyring.ActiveKey(); active != nil {
+			report.ActiveVersion = active.Version
+		}
+	}
+
+	err := l.walkObjects("", "", func(bucket, object string) error {
+		meta, err := l.readMeta(bucket, object)
+		if err != nil {
+			return err
+		}
+		switch {
+		case meta == nil || meta.Encryption == nil:
+			report.Unencrypted++
+		case meta.Encryption.KeyVersion == 0:
+			report.CustomerKeys++
+		default:
+			version := meta.Encryption.KeyVersion
+			report.Versions[version]++
+			if version != report.ActiveVersion {
+				report.Stale = append(report.Stale, StaleObject{Bucket: bucket, Object: object, KeyVersion: version})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// walkObjects calls fn for every object in every bucket, in lexical order,
+// starting after the given bucket and object.
+func (l *LocalStorage) walkObjects(afterBucket, afterObject string, fn func(bucket, object string) error) error {
+	buckets, err := l.listBuckets()
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range buckets {
+		if bucket < afterBucket {
+			continue
+		}
+		objects, err := l.ListObjects(bucket)
+		if err != nil {
+			return err
+		}
+		sort.Slice(objects, func(i, j int) bool { return objects[i].Object < objects[j].Object })
+
+		for _, obj := range objects {
+			if bucket == afterBucket && obj.Object <= afterObject {
+				continue
+			}
+			if err := fn(bucket, obj.Object); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// listBuckets returns the names of all buckets, sorted.
+func (l *LocalStorage) listBuckets() ([]string, error) {
+	entries, err := os.ReadDir(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			buckets = append(buckets, entry.Name())
+		}
+	}
+	return buckets, nil
+}
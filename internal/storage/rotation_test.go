@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newKeyringStorage(t *testing.T) (*LocalStorage, *Keyring) {
+	t.Helper()
+	tempDir := t.TempDir()
+
+	keyring, err := LoadKeyring(filepath.Join(t.TempDir(), "keyring.json"))
+	if err != nil {
+		t.Fatalf("Failed to load keyring: %v", err)
+	}
+	return NewLocalStorage(tempDir, NewValueChecksum(), WithKeyring(keyring)), keyring
+}
+
+func readObject(t *testing.T, storage *LocalStorage, bucket, object string, opts ...Option) string {
+	t.Helper()
+	file, _, err := storage.Get(bucket, object, opts...)
+	if err != nil {
+		t.Fatalf("Failed to get file: %v", err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	return string(content)
+}
+
+func TestLocalStorage_EncryptionAtRest(t *testing.T) {
+	storage, keyring := newKeyringStorage(t)
+
+	t.Run("Stores plaintext while the keyring is empty", func(t *testing.T) {
+		info, err := storage.Save("bucket", "plain.txt", strings.NewReader("Hello World!"))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if info.ServerSideEncryption != "" {
+			t.Errorf("Expected no encryption, got '%s'", info.ServerSideEncryption)
+		}
+	})
+
+	if _, err := keyring.Rotate(); err != nil {
+		t.Fatalf("Failed to rotate keyring: %v", err)
+	}
+
+	t.Run("Encrypts with the active master key", func(t *testing.T) {
+		info, err := storage.Save("bucket", "secret.txt", strings.NewReader("Hello World!"))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if info.ServerSideEncryption != ServerSideEncryptionAES256 || info.KeyVersion != 1 {
+			t.Errorf("Expected AES256 with key version 1, got '%s' version %d", info.ServerSideEncryption, info.KeyVersion)
+		}
+
+		onDisk, err := os.ReadFile(info.Path)
+		if err != nil {
+			t.Fatalf("Failed to read saved file: %v", err)
+		}
+		if bytes.Contains(onDisk, []byte("Hello World!")) {
+			t.Errorf("Object was stored in plaintext")
+		}
+		if got := readObject(t, storage, "bucket", "secret.txt"); got != "Hello World!" {
+			t.Errorf("Expected 'Hello World!', got '%s'", got)
+		}
+	})
+}
+
+func TestLocalStorage_RotateKeys(t *testing.T) {
+	storage, keyring := newKeyringStorage(t)
+	if _, err := keyring.Rotate(); err != nil {
+		t.Fatalf("Failed to rotate keyring: %v", err)
+	}
+
+	objects := []string{"a.txt", "b.txt", "c.txt"}
+	for _, object := range objects {
+		if _, err := storage.Save("bucket", object, strings.NewReader("content of "+object)); err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+	}
+	before, err := os.ReadFile(storage.path + "/bucket/a.txt")
+	if err != nil {
+		t.Fatalf("Failed to read saved file: %v", err)
+	}
+
+	progress, err := storage.RotateKeys()
+	if err != nil {
+		t.Fatalf("Failed to rotate keys: %v", err)
+	}
+
+	t.Run("Rewraps every object with the new key", func(t *testing.T) {
+		if progress.TargetVersion != 2 || !progress.Done() {
+			t.Errorf("Expected completed rotation to version 2, got %+v", progress)
+		}
+		if progress.Rewrapped != len(objects) {
+			t.Errorf("Expected %d rewrapped objects, got %d", len(objects), progress.Rewrapped)
+		}
+
+		report, err := storage.KeyReport()
+		if err != nil {
+			t.Fatalf("Failed to build report: %v", err)
+		}
+		if len(report.Stale) != 0 || report.Versions[2] != len(objects) {
+			t.Errorf("Expected all objects on version 2, got %+v", report)
+		}
+	})
+
+	t.Run("Leaves object bodies untouched", func(t *testing.T) {
+		after, err := os.ReadFile(storage.path + "/bucket/a.txt")
+		if err != nil {
+			t.Fatalf("Failed to read saved file: %v", err)
+		}
+		if !bytes.Equal(before, after) {
+			t.Errorf("Object body was rewritten")
+		}
+		if got := readObject(t, storage, "bucket", "a.txt"); got != "content of a.txt" {
+			t.Errorf("Expected 'content of a.txt', got '%s'", got)
+		}
+	})
+
+	t.Run("Resumes an interrupted rotation", func(t *testing.T) {
+		if _, err := keyring.Rotate(); err != nil {
+			t.Fatalf("Failed to rotate keyring: %v", err)
+		}
+		// Pretend a rotation to version 3 stopped after the first object
+		interrupted := &RotationProgress{TargetVersion: 3, Bucket: "bucket", Object: "a.txt"}
+		if err := storage.saveRotationProgress(interrupted); err != nil {
+			t.Fatalf("Failed to save progress: %v", err)
+		}
+
+		progress, err := storage.RotateKeys()
+		if err != nil {
+			t.Fatalf("Failed to rotate keys: %v", err)
+		}
+		if progress.TargetVersion != 3 || progress.Rewrapped != 2 {
+			t.Errorf("Expected resumed rotation to rewrap 2 objects to version 3, got %+v", progress)
+		}
+
+		report, err := storage.KeyReport()
+		if err != nil {
+			t.Fatalf("Failed to build report: %v", err)
+		}
+		if len(report.Stale) != 1 || report.Stale[0].Object != "a.txt" {
+			t.Errorf("Expected a.txt to be reported on an old key, got %+v", report.Stale)
+		}
+		if got := readObject(t, storage, "bucket", "a.txt"); got != "content of a.txt" {
+			t.Errorf("Expected 'content of a.txt', got '%s'", got)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// SSECustomerAlgorithm is the only algorithm S3 accepts for SSE-C.
+const SSECustomerAlgorithm = "AES256"
+
+var (
+	ErrSSECustomerKeyMissing  = errors.New("object is encrypted with a customer-provided key, but no key was supplied")
+	ErrSSECustomerKeyMismatch = errors.New("supplied customer key does not match the key used to encrypt the object")
+	ErrSSECustomerKeyNotUsed  = errors.New("customer key supplied, but the object is not encrypted with a customer-provided key")
+)
+
+type ErrInvalidSSECustomerKey struct {
+	Size int
+}
+
+func (e *ErrInvalidSSECustomerKey) Error() string {
+	return fmt.Sprintf("invalid customer key: got %d bytes, expected %d", e.Size, dataKeySize)
+}
+
+// SSECustomerKeyMD5 returns the base64-encoded MD5 digest S3 uses to identify
+// a customer key.
+func SSECustomerKeyMD5(key []byte) string {
+	sum := md5.Sum(key)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func validateSSECustomerKey(key []byte) error {
+	if len(key) != dataKeySize {
+		return &ErrInvalidSSECustomerKey{Size: len(key)}
+	}
+	return nil
+}
+
+// newSSECustomerEncryption creates a fresh data key for an object and seals it
+// with the customer key.
+func newSSECustomerEncryption(key []byte) (*encryptionMeta, []byte, error) {
+	if err := validateSSECustomerKey(key); err != nil {
+		return nil, nil, err
+	}
+
+	dataKey, err := newDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed, err := sealKey(key, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc := &encryptionMeta{
+		Algorithm: SSECustomerAlgorithm,
+		KeyMD5:    SSECustomerKeyMD5(key),
+		SealedKey: sealed,
+	}
+	return enc, dataKey, nil
+}
+
+// sseCustomerDataKey checks the supplied customer key against the object's
+// metadata and returns the data key needed to decrypt it, or nil when the
+// object is stored in plaintext.
+func sseCustomerDataKey(meta *objectMeta, key []byte) ([]byte, error) {
+	if meta == nil || meta.Encryption == nil || meta.Encryption.KeyMD5 == "" {
+		if key != nil {
+			return nil, ErrSSECustomerKeyNotUsed
+		}
+		return nil, nil
+	}
+
+	if key == nil {
+		return nil, ErrSSECustomerKeyMissing
+	}
+	if err := validateSSECustomerKey(key); err != nil {
+		return nil, err
+	}
+	if SSECustomerKeyMD5(key) != meta.Encryption.KeyMD5 {
+		return nil, ErrSSECustomerKeyMismatch
+	}
+
+	dataKey, err := openKey(key, meta.Encryption.SealedKey)
+	if err != nil {
+		return nil, ErrSSECustomerKeyMismatch
+	}
+	return dataKey, nil
+}
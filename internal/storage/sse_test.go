@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorage_SSECustomerKey(t *testing.T) {
+	tempDir := t.TempDir()
+	storage := NewLocalStorage(tempDir, NewValueChecksum())
+
+	key := bytes.Repeat([]byte("k"), 32)
+	otherKey := bytes.Repeat([]byte("o"), 32)
+	content := "top secret content"
+
+	info, err := storage.Save("sse-bucket", "secret.txt", strings.NewReader(content), WithSSECustomerKey(key))
+	if err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	t.Run("Stores ciphertext and the key MD5 only", func(t *testing.T) {
+		if info.SSECustomerKeyMD5 != SSECustomerKeyMD5(key) {
+			t.Errorf("Expected key MD5 '%s', got '%s'", SSECustomerKeyMD5(key), info.SSECustomerKeyMD5)
+		}
+		if info.Size != int64(len(content)) {
+			t.Errorf("Expected size %d, got %d", len(content), info.Size)
+		}
+
+		onDisk, err := os.ReadFile(info.Path)
+		if err != nil {
+			t.Fatalf("Failed to read saved file: %v", err)
+		}
+		if bytes.Contains(onDisk, []byte(content)) {
+			t.Errorf("Object was stored in plaintext")
+		}
+
+		meta, err := os.ReadFile(storage.metaPath("sse-bucket", "secret.txt"))
+		if err != nil {
+			t.Fatalf("Failed to read metadata: %v", err)
+		}
+		if bytes.Contains(meta, key) {
+			t.Errorf("Metadata contains the customer key")
+		}
+	})
+
+	t.Run("Decrypts with the right key", func(t *testing.T) {
+		file, objInfo, err := storage.Get("sse-bucket", "secret.txt", WithSSECustomerKey(key))
+		if err != nil {
+			t.Fatalf("Failed to get file: %v", err)
+		}
+		defer file.Close()
+
+		got, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(got) != content {
+			t.Errorf("Expected content '%s', got '%s'", content, got)
+		}
+		if objInfo.Checksum != info.Checksum {
+			t.Errorf("Expected checksum '%s', got '%s'", info.Checksum, objInfo.Checksum)
+		}
+	})
+
+	t.Run("Fails without a key", func(t *testing.T) {
+		_, _, err := storage.Get("sse-bucket", "secret.txt")
+		if !errors.Is(err, ErrSSECustomerKeyMissing) {
+			t.Errorf("Expected ErrSSECustomerKeyMissing, got %v", err)
+		}
+	})
+
+	t.Run("Fails with the wrong key", func(t *testing.T) {
+		_, _, err := storage.Get("sse-bucket", "secret.txt", WithSSECustomerKey(otherKey))
+		if !errors.Is(err, ErrSSECustomerKeyMismatch) {
+			t.Errorf("Expected ErrSSECustomerKeyMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Fails with a key for a plaintext object", func(t *testing.T) {
+		_, err := storage.Save("sse-bucket", "plain.txt", strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+
+		_, _, err = storage.Get("sse-bucket", "plain.txt", WithSSECustomerKey(key))
+		if !errors.Is(err, ErrSSECustomerKeyNotUsed) {
+			t.Errorf("Expected ErrSSECustomerKeyNotUsed, got %v", err)
+		}
+	})
+
+	t.Run("Rejects keys of the wrong size", func(t *testing.T) {
+		_, err := storage.Save("sse-bucket", "short.txt", strings.NewReader(content), WithSSECustomerKey([]byte("short")))
+		var invalid *ErrInvalidSSECustomerKey
+		if !errors.As(err, &invalid) {
+			t.Errorf("Expected ErrInvalidSSECustomerKey, got %v", err)
+		}
+	})
+
+	t.Run("Overwriting in plaintext drops the encryption", func(t *testing.T) {
+		_, err := storage.Save("sse-bucket", "rewrite.txt", strings.NewReader(content), WithSSECustomerKey(key))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		_, err = storage.Save("sse-bucket", "rewrite.txt", strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+
+		file, _, err := storage.Get("sse-bucket", "rewrite.txt")
+		if err != nil {
+			t.Fatalf("Failed to get file: %v", err)
+		}
+		file.Close()
+	})
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	dataKey := bytes.Repeat([]byte("d"), dataKeySize)
+
+	sizes := []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 17}
+	for _, size := range sizes {
+		plain := bytes.Repeat([]byte("x"), size)
+
+		var sealed bytes.Buffer
+		w, err := newEncryptWriter(&sealed, dataKey)
+		if err != nil {
+			t.Fatalf("Failed to create writer: %v", err)
+		}
+		if _, err := w.Write(plain); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Failed to close: %v", err)
+		}
+		ciphertext := sealed.Bytes()
+
+		r, err := newDecryptReader(bytes.NewReader(ciphertext), dataKey)
+		if err != nil {
+			t.Fatalf("Failed to create reader: %v", err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("Size %d: failed to decrypt: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("Size %d: decrypted content does not match", size)
+		}
+
+		// Dropping the final segment must not go unnoticed.
+		if size > segmentSize {
+			r, _ := newDecryptReader(bytes.NewReader(ciphertext[:segmentSize+16]), dataKey)
+			if _, err := io.ReadAll(r); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("Size %d: expected ErrDecrypt on truncated data, got %v", size, err)
+			}
+		}
+	}
+}
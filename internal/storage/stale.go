@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// staleData is the data of an object's previous version that could not
+// be removed when it was replaced, because its disk was offline. It is
+// kept in the stale directory until removeStale gets to remove it.
+type staleData struct {
+	Bucket  string `json:"bucket"`
+	Object  string `json:"object"`
+	Backend string `json:"backend"`
+	Locator string `json:"locator"`
+}
+
+func (l *LocalStorage) staleDir() string {
+	return filepath.Join(l.path, systemDir, "stale")
+}
+
+// deferRemoval records stale data for removeStale. The write replacing it
+// is committed by then, so a failure is only logged, and leaves the data
+// behind.
+func (l *LocalStorage) deferRemoval(stale *staleData) {
+	// Other processes sharing the data directory record stale data too
+	name := fmt.Sprintf("%s-%d.json", l.notifier.sequence(time.Now()), os.Getpid())
+	if err := writeOutboxEntry(filepath.Join(l.staleDir(), name), stale); err != nil {
+		log.Printf("mini-s3: recording the stale data of %s/%s at %s: %v", stale.Bucket, stale.Object, stale.Locator, err)
+	}
+}
+
+// removeStale removes the stale data whose disks are back, and returns how
+// much it removed. Data still unavailable is kept for a later pass.
+func (l *LocalStorage) removeStale() (int, error) {
+	names, err := outboxNames(l.staleDir())
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, name := range names {
+		done, err := l.removeStaleData(filepath.Join(l.staleDir(), name))
+		if err != nil {
+			return removed, fmt.Errorf("removing stale data %s: %w", name, err)
+		}
+		if done {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// removeStaleData removes the stale data recorded at path, and reports
+// whether it is gone.
+func (l *LocalStorage) removeStaleData(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var stale staleData
+	if err := json.Unmarshal(data, &stale); err != nil {
+		return false, err
+	}
+	backend, ok := l.backends[stale.Backend]
+	if !ok {
+		return false, fmt.Errorf("unknown backend %q", stale.Backend)
+	}
+
+	unlock, err := l.lockObject(stale.Bucket, stale.Object, true)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	// The locator may be in use again, like when the object was saved
+	// back onto the same disk since
+	meta, err := l.readMeta(stale.Bucket, stale.Object)
+	if err != nil {
+		return false, err
+	}
+	inUse := false
+	if meta != nil {
+		b, locator := meta.location(stale.Bucket, stale.Object)
+		inUse = b == stale.Backend && locator == stale.Locator
+	}
+	if !inUse {
+		err := backend.Remove(stale.Bucket, stale.Object, stale.Locator)
+		if errors.Is(err, ErrUnavailable) {
+			return false, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	return !inUse, nil
+}
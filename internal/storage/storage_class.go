@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	StorageClassStandard = "STANDARD"
+	StorageClassCold     = "COLD"
+	StorageClassArchive  = "ARCHIVE"
+)
+
+// storageClasses lists the classes from the hottest to the coldest.
+// Lifecycle transitions only ever move objects towards colder classes.
+var storageClasses = []string{StorageClassStandard, StorageClassCold, StorageClassArchive}
+
+type ErrInvalidStorageClass struct {
+	Class string
+}
+
+func (e *ErrInvalidStorageClass) Error() string {
+	return fmt.Sprintf("invalid storage class %q, expected one of %s", e.Class, strings.Join(storageClasses, ", "))
+}
+
+func validateStorageClass(class string) error {
+	if !slices.Contains(storageClasses, class) {
+		return &ErrInvalidStorageClass{Class: class}
+	}
+	return nil
+}
+
+// colder reports whether class a is colder than class b.
+func colder(a, b string) bool {
+	return slices.Index(storageClasses, a) > slices.Index(storageClasses, b)
+}
+
+// classBackend returns the name of the backend holding a class's objects.
+// Standard objects go to the default backend; every other class has a
+// backend of its own, rooted wherever that class lives.
+func classBackend(class string) string {
+	return strings.ToLower(class)
+}
+
+// DefaultStorageClassRoot is where objects of a non-standard class are kept
+// unless configured otherwise.
+func DefaultStorageClassRoot(root, class string) string {
+	return filepath.Join(root, systemDir, "classes", strings.ToLower(class))
+}
+
+// WithStorageClassRoot keeps the data of objects in the given storage class
+// under root, typically on a different disk. Metadata always stays in the
+// main data directory.
+func WithStorageClassRoot(class, root string) LocalStorageOption {
+	return func(l *LocalStorage) {
+		l.backends[classBackend(class)] = newClassBackend(l.path, class, root)
+	}
+}
+
+// newClassBackend creates the backend for a non-standard class: archived
+// objects are packed together, the others are kept as plain files.
+func newClassBackend(path, class, root string) Backend {
+	if class == StorageClassArchive {
+		return newArchiveBackend(path, root)
+	}
+	return newFileBackend(root)
+}
+
+// storageClass returns the class of an object, which is standard unless
+// recorded otherwise.
+func (m *objectMeta) storageClass() string {
+	if m.StorageClass == "" {
+		return StorageClassStandard
+	}
+	return m.StorageClass
+}
+
+// backendFor returns the backend new objects of class are stored in.
+func (l *LocalStorage) backendFor(class string) string {
+	if class == StorageClassStandard {
+		return l.defaultBackend
+	}
+	return classBackend(class)
+}
+
+// transition moves an object's data to the backend of another storage
+// class if match accepts its metadata. The stored bytes are moved as they
+// are, still compressed and encrypted. It reports whether the object moved.
+func (l *LocalStorage) transition(bucket, object, class string, match func(*objectMeta) bool) (bool, error) {
+	if err := validateStorageClass(class); err != nil {
+		return false, err
+	}
+
+	unlock, err := l.lockObject(bucket, object, true)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return false, err
+	}
+	if meta.storageClass() == class || (match != nil && !match(meta)) {
+		return false, nil
+	}
+
+	oldBackend, oldLocator := meta.location(bucket, object)
+	src, err := l.backends[oldBackend].Open(oldLocator)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	file, err := l.createTemp()
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, digest), src); err != nil {
+		return false, err
+	}
+	if err := file.Close(); err != nil {
+		return false, err
+	}
+
+	newBackend := l.backendFor(class)
+	locator, err := l.backends[newBackend].Put(bucket, object, file.Name(), hex.EncodeToString(digest.Sum(nil)))
+	if err != nil {
+		return false, err
+	}
+
+	meta.Backend = newBackend
+	meta.Locator = locator
+	meta.StorageClass = class
+	if class == StorageClassStandard {
+		meta.StorageClass = ""
+	}
+	if err := l.writeMeta(bucket, object, meta); err != nil {
+		return false, err
+	}
+
+	if oldBackend != newBackend || oldLocator != locator {
+		if err := l.backends[oldBackend].Remove(bucket, object, oldLocator); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return true, err
+		}
+	}
+	return true, nil
+}
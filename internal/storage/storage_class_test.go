@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage_StorageClasses(t *testing.T) {
+	tempDir := t.TempDir()
+	coldDir := t.TempDir()
+	storage := NewLocalStorage(tempDir, NewValueChecksum(), WithDeduplication(), WithStorageClassRoot(StorageClassCold, coldDir))
+
+	t.Run("Stores each class under its own root", func(t *testing.T) {
+		info, err := storage.Save("bucket", "cold.txt", strings.NewReader("cold content"), WithStorageClass(StorageClassCold))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if info.StorageClass != StorageClassCold {
+			t.Errorf("Expected class %s, got %s", StorageClassCold, info.StorageClass)
+		}
+		if info.Path != filepath.Join(coldDir, "bucket", "cold.txt") {
+			t.Errorf("Expected data under the cold root, got %s", info.Path)
+		}
+		if got := readObject(t, storage, "bucket", "cold.txt"); got != "cold content" {
+			t.Errorf("Expected 'cold content', got '%s'", got)
+		}
+
+		info, err = storage.Save("bucket", "hot.txt", strings.NewReader("hot content"))
+		if err != nil {
+			t.Fatalf("Failed to save file: %v", err)
+		}
+		if info.StorageClass != StorageClassStandard || !strings.HasPrefix(info.Path, tempDir) {
+			t.Errorf("Expected a standard object under the data directory, got %s at %s", info.StorageClass, info.Path)
+		}
+	})
+
+	t.Run("Rejects unknown classes", func(t *testing.T) {
+		var invalid *ErrInvalidStorageClass
+		if _, err := storage.Save("bucket", "x", strings.NewReader("x"), WithStorageClass("GLACIER_IR")); !errors.As(err, &invalid) {
+			t.Errorf("Expected ErrInvalidStorageClass, got %v", err)
+		}
+	})
+
+	t.Run("Lifecycle transitions move objects to a colder class", func(t *testing.T) {
+		now := time.Now()
+		backdate(t, storage, "bucket", "hot.txt", now.Add(-60*24*time.Hour))
+		cfg := &LifecycleConfiguration{Rules: []LifecycleRule{{
+			ID:          "archive",
+			Status:      LifecycleStatusEnabled,
+			Transitions: []LifecycleTransition{{Days: 30, StorageClass: StorageClassCold}},
+		}}}
+		if err := storage.PutBucketLifecycle("bucket", cfg); err != nil {
+			t.Fatalf("Failed to set lifecycle: %v", err)
+		}
+
+		report, err := storage.ApplyLifecycle("bucket", now, false)
+		if err != nil {
+			t.Fatalf("Failed to apply lifecycle: %v", err)
+		}
+		if len(report.Actions) != 1 || report.Actions[0].Action != LifecycleActionTransition || report.Actions[0].Object != "hot.txt" {
+			t.Fatalf("Expected hot.txt to transition, got %+v", report.Actions)
+		}
+
+		_, info, err := storage.Get("bucket", "hot.txt")
+		if err != nil {
+			t.Fatalf("Failed to get file: %v", err)
+		}
+		if info.StorageClass != StorageClassCold || info.Path != filepath.Join(coldDir, "bucket", "hot.txt") {
+			t.Errorf("Expected hot.txt under the cold root, got %s at %s", info.StorageClass, info.Path)
+		}
+		if got := readObject(t, storage, "bucket", "hot.txt"); got != "hot content" {
+			t.Errorf("Expected 'hot content', got '%s'", got)
+		}
+
+		// The blob it used to live in is no longer referenced
+		stats, err := storage.DedupStats()
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.UnreferencedBlobs != 1 {
+			t.Errorf("Expected the standard copy to be released, got %+v", stats)
+		}
+
+		report, err = storage.ApplyLifecycle("bucket", now, false)
+		if err != nil || len(report.Actions) != 0 {
+			t.Errorf("Expected nothing left to transition, got %+v, %v", report, err)
+		}
+	})
+
+	t.Run("Deleting removes data from the class root", func(t *testing.T) {
+		if err := storage.Delete("bucket", "cold.txt"); err != nil {
+			t.Fatalf("Failed to delete file: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(coldDir, "bucket", "cold.txt")); !os.IsNotExist(err) {
+			t.Errorf("Expected cold data to be deleted, got %v", err)
+		}
+	})
+}
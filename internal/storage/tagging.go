@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// S3 limits on object tags.
+const (
+	maxTags           = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// Tag is a key-value pair attached to an object.
+type Tag struct {
+	Key   string `xml:"Key" json:"Key"`
+	Value string `xml:"Value" json:"Value"`
+}
+
+type ErrInvalidTag struct {
+	Key    string
+	Reason string
+}
+
+func (e *ErrInvalidTag) Error() string {
+	if e.Key == "" {
+		return "invalid tag set: " + e.Reason
+	}
+	return fmt.Sprintf("invalid tag %q: %s", e.Key, e.Reason)
+}
+
+// ValidateTags checks a tag set against the limits S3 enforces: at most 10
+// tags, keys of 1 to 128 characters and values of up to 256, made of
+// letters, digits, spaces and + - = . _ : / @, and no keys in the reserved
+// aws: namespace.
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > maxTags {
+		return &ErrInvalidTag{Reason: fmt.Sprintf("objects can have at most %d tags", maxTags)}
+	}
+	for key, value := range tags {
+		if key == "" {
+			return &ErrInvalidTag{Reason: "tag keys cannot be empty"}
+		}
+		if utf8.RuneCountInString(key) > maxTagKeyLength {
+			return &ErrInvalidTag{Key: key, Reason: fmt.Sprintf("keys are at most %d characters", maxTagKeyLength)}
+		}
+		if utf8.RuneCountInString(value) > maxTagValueLength {
+			return &ErrInvalidTag{Key: key, Reason: fmt.Sprintf("values are at most %d characters", maxTagValueLength)}
+		}
+		if strings.HasPrefix(strings.ToLower(key), "aws:") {
+			return &ErrInvalidTag{Key: key, Reason: "the aws: prefix is reserved"}
+		}
+		if !validTagText(key) || !validTagText(value) {
+			return &ErrInvalidTag{Key: key, Reason: "only letters, digits, spaces and + - = . _ : / @ are allowed"}
+		}
+	}
+	return nil
+}
+
+func validTagText(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) && !strings.ContainsRune("+-=._:/@", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// TagSet returns tags as a list sorted by key, the form S3 APIs use.
+func TagSet(tags map[string]string) []Tag {
+	set := make([]Tag, 0, len(tags))
+	for key, value := range tags {
+		set = append(set, Tag{Key: key, Value: value})
+	}
+	sort.Slice(set, func(i, j int) bool { return set[i].Key < set[j].Key })
+	return set
+}
+
+// MatchesTags reports whether tags include every key-value pair of filter.
+func MatchesTags(tags, filter map[string]string) bool {
+	for key, value := range filter {
+		if got, ok := tags[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// PutObjectTagging replaces the tag set of an object. Tagging does not
+// change the object itself, so it is allowed on objects under object lock.
+func (l *LocalStorage) PutObjectTagging(bucket, object string, tags map[string]string) error {
+	if err := validateObjectName(bucket, object); err != nil {
+		return err
+	}
+	if err := ValidateTags(tags); err != nil {
+		return err
+	}
+
+	unlock, err := l.lockObject(bucket, object, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return err
+	}
+	meta.Tags = nil
+	if len(tags) > 0 {
+		meta.Tags = tags
+	}
+	if err := l.writeMeta(bucket, object, meta); err != nil {
+		return err
+	}
+	// Replicas get the new tags along with the rest of the object
+	return l.queueReplication(bucket, object, meta, meta)
+}
+
+// GetObjectTagging returns the tag set of an object, which is empty when
+// it has no tags.
+func (l *LocalStorage) GetObjectTagging(bucket, object string) (map[string]string, error) {
+	if err := validateObjectName(bucket, object); err != nil {
+		return nil, err
+	}
+	unlock, err := l.lockObject(bucket, object, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	meta, err := l.loadMeta(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Tags == nil {
+		return map[string]string{}, nil
+	}
+	return meta.Tags, nil
+}
+
+// DeleteObjectTagging removes every tag of an object.
+func (l *LocalStorage) DeleteObjectTagging(bucket, object string) error {
+	return l.PutObjectTagging(bucket, object, nil)
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTags(t *testing.T) {
+	tooMany := map[string]string{}
+	for i := range 11 {
+		tooMany[string(rune('a'+i))] = "v"
+	}
+
+	tests := []struct {
+		name    string
+		tags    map[string]string
+		wantErr string
+	}{
+		{"valid", map[string]string{"team": "data", "path": "a/b c+d=e.f_g:h@i"}, ""},
+		{"empty value", map[string]string{"archived": ""}, ""},
+		{"too many tags", tooMany, "at most 10 tags"},
+		{"empty key", map[string]string{"": "v"}, "cannot be empty"},
+		{"long key", map[string]string{strings.Repeat("k", 129): "v"}, "at most 128"},
+		{"long value", map[string]string{"k": strings.Repeat("v", 257)}, "at most 256"},
+		{"reserved prefix", map[string]string{"aws:team": "v"}, "reserved"},
+		{"invalid character", map[string]string{"team": "data!"}, "only letters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTags(tt.tags)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			var invalid *ErrInvalidTag
+			if !errors.As(err, &invalid) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected ErrInvalidTag containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLocalStorage_Tagging(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), NewValueChecksum())
+
+	info, err := storage.Save("data", "users.csv", strings.NewReader("id,name"), WithTags(map[string]string{"team": "data"}))
+	if err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	if info.Tags["team"] != "data" {
+		t.Errorf("Expected the tags on the saved object, got %v", info.Tags)
+	}
+
+	t.Run("Rejects invalid tags on save", func(t *testing.T) {
+		var invalid *ErrInvalidTag
+		if _, err := storage.Save("data", "x", strings.NewReader("x"), WithTags(map[string]string{"aws:x": "y"})); !errors.As(err, &invalid) {
+			t.Errorf("Expected ErrInvalidTag, got %v", err)
+		}
+	})
+
+	t.Run("Replaces tags without touching the object", func(t *testing.T) {
+		if err := storage.PutObjectTagging("data", "users.csv", map[string]string{"team": "growth", "sensitivity": "high"}); err != nil {
+			t.Fatalf("Failed to set tags: %v", err)
+		}
+		tags, err := storage.GetObjectTagging("data", "users.csv")
+		if err != nil {
+			t.Fatalf("Failed to get tags: %v", err)
+		}
+		if len(tags) != 2 || tags["team"] != "growth" || tags["sensitivity"] != "high" {
+			t.Errorf("Expected the new tags, got %v", tags)
+		}
+		_, info, err := storage.Get("data", "users.csv")
+		if err != nil {
+			t.Fatalf("Failed to get file: %v", err)
+		}
+		if info.Tags["sensitivity"] != "high" {
+			t.Errorf("Expected Get to report the tags, got %v", info.Tags)
+		}
+		if got := readObject(t, storage, "data", "users.csv"); got != "id,name" {
+			t.Errorf("Expected 'id,name', got '%s'", got)
+		}
+	})
+
+	t.Run("Deletes tags", func(t *testing.T) {
+		if err := storage.DeleteObjectTagging("data", "users.csv"); err != nil {
+			t.Fatalf("Failed to delete tags: %v", err)
+		}
+		tags, err := storage.GetObjectTagging("data", "users.csv")
+		if err != nil || len(tags) != 0 {
+			t.Errorf("Expected no tags, got %v, %v", tags, err)
+		}
+	})
+
+	t.Run("Fails on missing objects", func(t *testing.T) {
+		if err := storage.PutObjectTagging("data", "missing", map[string]string{"k": "v"}); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected a not-exist error, got %v", err)
+		}
+	})
+
+	t.Run("Lifecycle rules filter on tags", func(t *testing.T) {
+		for object, temp := range map[string]string{"keep.tmp": "false", "drop.tmp": "true"} {
+			if _, err := storage.Save("data", object, strings.NewReader("x"), WithTags(map[string]string{"temp": temp})); err != nil {
+				t.Fatalf("Failed to save file: %v", err)
+			}
+			backdate(t, storage, "data", object, time.Now().Add(-10*24*time.Hour))
+		}
+		cfg := &LifecycleConfiguration{Rules: []LifecycleRule{{
+			ID:         "temp",
+			Status:     LifecycleStatusEnabled,
+			Filter:     &LifecycleFilter{Tag: &Tag{Key: "temp", Value: "true"}},
+			Expiration: &LifecycleExpiration{Days: 1},
+		}}}
+		if err := storage.PutBucketLifecycle("data", cfg); err != nil {
+			t.Fatalf("Failed to set lifecycle: %v", err)
+		}
+		report, err := storage.ApplyLifecycle("data", time.Now(), false)
+		if err != nil {
+			t.Fatalf("Failed to apply lifecycle: %v", err)
+		}
+		if len(report.Actions) != 1 || report.Actions[0].Object != "drop.tmp" {
+			t.Errorf("Expected only drop.tmp to expire, got %+v", report.Actions)
+		}
+	})
+}